@@ -0,0 +1,108 @@
+// Package accesslog writes an access log in the Apache combined log format, apart from the
+// application logs, so log-analysis tools such as GoAccess and AWStats read it as they are.
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// timeLayout is the %t timestamp of the combined format, e.g. 10/Oct/2000:13:55:36 -0700
+const timeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Logger writes a line per request
+type Logger struct {
+	out *log.Logger
+}
+
+// New returns a logger writing to w
+func New(w io.Writer) *Logger {
+	return &Logger{out: log.New(w, "", 0)}
+}
+
+// Open returns a logger appending to the file at path, or writing to standard output for "-"
+func Open(path string) (*Logger, error) {
+	if path == "-" {
+		return New(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return New(file), nil
+}
+
+// Middleware logs every request once it is answered
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		l.out.Print(line(r, rw.status, rw.bytes, start))
+	})
+}
+
+// line formats a request as %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i". The identity and
+// user fields are always "-": callers identify themselves by API key, not by HTTP authentication.
+func line(r *http.Request, status int, bytes int64, start time.Time) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s "%s" "%s"`, field(host), start.Format(timeLayout),
+		r.Method, escape(r.RequestURI), r.Proto, status, size, field(r.Referer()), field(r.UserAgent()))
+}
+
+// field renders an empty value as "-" and escapes the others
+func field(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return escape(value)
+}
+
+// escape keeps quotes, backslashes and control characters sent by a client from breaking up a log line
+func escape(value string) string {
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
+
+// responseWriter remembers the status and counts the body bytes written by a handler
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(data)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	rw.wroteHeader = true
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/deadletter"
+	"receipt-processor/pipeline"
+	"receipt-processor/receipt"
+	"receipt-processor/store"
+)
+
+// asyncBackoff is the wait before the first retry of a failed background attempt, doubled on every retry
+const asyncBackoff = 500 * time.Millisecond
+
+// asyncJob is a receipt accepted for processing in the background
+type asyncJob struct {
+	id         string
+	raw        json.RawMessage
+	acceptedAt time.Time
+	// caller submitted the receipt, so it is processed under their settings
+	caller auth.Caller
+}
+
+// startAsync starts the workers processing receipts accepted by POST /receipts/process
+func (s *Server) startAsync(workers, queueSize int) {
+	s.async = make(chan asyncJob, queueSize)
+	for range workers {
+		go func() {
+			for job := range s.async {
+				s.processAsync(job)
+			}
+		}()
+	}
+}
+
+// acceptReceipt checks a submitted receipt against the schema and queues it for processing,
+// answering 202 with the ID it will be stored under
+func (s *Server) acceptReceipt(w http.ResponseWriter, r *http.Request, incoming *pipeline.Receipt) {
+	if problems := receipt.CheckJSON(incoming.Raw); len(problems) > 0 {
+		sendValidationErrors(w, r, http.StatusBadRequest, "receipt.invalid", problems)
+		return
+	}
+
+	// Answer a retried request with the receipt its first attempt was accepted as
+	key, ok := s.reserveIdempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	job := asyncJob{id: s.ids.NewID(), raw: incoming.Raw, acceptedAt: s.clock.Now().UTC(), caller: auth.FromContext(r.Context())}
+	select {
+	case s.async <- job:
+	default:
+		if key != "" {
+			s.idempotency.Release(key)
+		}
+		sendErrorResponse(w, r, http.StatusServiceUnavailable, "request.queueFull")
+		return
+	}
+	if key != "" {
+		if err := s.idempotency.Complete(key, job.id); err != nil {
+			log.Printf("recording idempotency key for receipt %s: %v", job.id, err)
+		}
+	}
+	setAuditResource(r, "/receipts/"+job.id)
+
+	sendReceiptAccepted(w, r, http.StatusAccepted, "accepted", job.id)
+}
+
+// processAsync processes an accepted receipt, retrying failed attempts, and moves it to the
+// dead-letter queue once its attempts run out. Invalid and rejected receipts aren't retried.
+func (s *Server) processAsync(job asyncJob) {
+	backoff := asyncBackoff
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = s.processAccepted(auth.NewContext(context.Background(), job.caller), job.id, job.raw); err == nil {
+			return
+		}
+		if !retryable(err) || attempt >= s.asyncAttempts {
+			break
+		}
+		log.Printf("background processing of receipt %s failed, attempt=%d: %v", job.id, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	log.Printf("background processing of receipt %s gave up after attempt=%d: %v", job.id, attempt, err)
+	entry := deadletter.Entry{
+		ID:         job.id,
+		Receipt:    job.raw,
+		Caller:     job.caller.Name,
+		Error:      err.Error(),
+		Attempts:   attempt,
+		AcceptedAt: job.acceptedAt,
+		FailedAt:   s.clock.Now().UTC(),
+	}
+	if err := s.deadLetters.Put(entry); err != nil {
+		log.Printf("dead-lettering receipt %s: %v", job.id, err)
+	}
+}
+
+// processAccepted runs a fresh copy of an accepted receipt through the whole pipeline under its ID
+func (s *Server) processAccepted(ctx context.Context, id string, raw json.RawMessage) error {
+	return s.pipeline.Process(ctx, &pipeline.Receipt{Raw: raw, Record: store.Record{ID: id}})
+}
+
+// retryable reports whether another attempt could succeed; invalid and rejected receipts would fail again
+func retryable(err error) bool {
+	var invalid *pipeline.Invalid
+	var rejected *pipeline.Rejection
+	return !errors.As(err, &invalid) && !errors.As(err, &rejected)
+}
+
+// ListDeadLetters returns the receipts background processing gave up on, oldest failure first
+func (s *Server) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.deadLetters.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "deadLetters.listFailed")
+		return
+	}
+	sendListResponse(w, r, "receipts", entries)
+}
+
+// RetryDeadLetter processes a dead-lettered receipt again, as the caller that submitted it, removing
+// it from the queue once it is stored. Entries queued before callers were recorded run as anonymous.
+func (s *Server) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	entry, err := s.deadLetters.Get(mux.Vars(r)["id"])
+	if errors.Is(err, deadletter.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "deadLetter.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "deadLetter.loadFailed")
+		return
+	}
+
+	caller := auth.Anonymous
+	if entry.Caller != "" {
+		caller = auth.Caller{Name: entry.Caller}
+	}
+	if err := s.processAccepted(auth.NewContext(r.Context(), caller), entry.ID, entry.Receipt); err != nil {
+		entry.Error = err.Error()
+		entry.Attempts++
+		entry.FailedAt = s.clock.Now().UTC()
+		if err := s.deadLetters.Put(entry); err != nil {
+			log.Printf("dead-lettering receipt %s: %v", entry.ID, err)
+		}
+		sendPipelineError(w, r, err, "receipt.processFailed")
+		return
+	}
+	if err := s.deadLetters.Remove(entry.ID); err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+		log.Printf("removing dead letter %s: %v", entry.ID, err)
+	}
+	setAuditResource(r, "/receipts/"+entry.ID)
+
+	sendReceiptAccepted(w, r, http.StatusCreated, "success", entry.ID)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"receipt-processor/audit"
+	"receipt-processor/auth"
+)
+
+type auditResourceKey struct{}
+
+// setAuditResource names the resource a mutating request affected when it differs from the
+// request path, e.g. the ID of a receipt that was just created
+func setAuditResource(r *http.Request, resource string) {
+	if holder, ok := r.Context().Value(auditResourceKey{}).(*string); ok {
+		*holder = resource
+	}
+}
+
+// auditMiddleware records every POST, PUT, PATCH and DELETE in the audit log once it completes
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		resource := auditPath(r.URL.Path)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditResourceKey{}, &resource)))
+
+		entry := audit.Entry{
+			Time:     s.clock.Now().UTC(),
+			Caller:   auth.FromContext(r.Context()).Name,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Resource: resource,
+			Status:   recorder.status,
+			Outcome:  audit.OutcomeSuccess,
+		}
+		if recorder.status >= 400 {
+			entry.Outcome = audit.OutcomeFailure
+		}
+		if err := s.audit.Record(entry); err != nil {
+			log.Printf("recording audit entry for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+// auditPath strips the API version prefix so both aliases of an endpoint share a resource name
+func auditPath(path string) string {
+	for _, version := range apiVersions {
+		prefix := "/" + version.name
+		if strings.HasPrefix(path, prefix+"/") {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+	return path
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	sr.wroteHeader = true
+	return sr.ResponseWriter.Write(data)
+}
+
+func (sr *statusRecorder) Flush() {
+	sr.wroteHeader = true
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// requireAdmin rejects callers without an admin API key once API keys are configured
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth.Enabled() && !auth.FromContext(r.Context()).Admin {
+			sendErrorResponse(w, r, http.StatusForbidden, "request.adminRequired")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ListAudit returns the audit entries matching the caller, method, resource, outcome, since and
+// until query parameters, oldest first. A limit without an offset pages from the most recent entries.
+func (s *Server) ListAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Caller:   query.Get("caller"),
+		Method:   strings.ToUpper(query.Get("method")),
+		Resource: query.Get("resource"),
+		Outcome:  query.Get("outcome"),
+	}
+
+	// Parse the time range and page, provide error response if malformed
+	var err error
+	if since := query.Get("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.since")
+			return
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.until")
+			return
+		}
+	}
+	p, ok := parsePage(w, r, 0, maxPageSize)
+	if !ok {
+		return
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "audit.queryFailed")
+		return
+	}
+	if !p.offsetGiven && p.limit > 0 {
+		p.offset = max(len(entries)-p.limit, 0)
+	}
+	sendPage(w, r, "entries", entries, p)
+}
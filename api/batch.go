@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"receipt-processor/pipeline"
+	"receipt-processor/validation"
+)
+
+// BatchResult reports the outcome for one receipt of a batch or stream, by its position in the input
+type BatchResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Points *int   `json:"points,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Errors locates every problem with an invalid receipt
+	Errors []validation.FieldError `json:"errors,omitempty"`
+	// Code classifies an invalid receipt that passed the schema, e.g. purchase-date-out-of-range
+	Code string `json:"code,omitempty"`
+}
+
+// ProcessBatch validates, scores and stores a JSON array of receipts. Invalid receipts are
+// reported individually without failing the rest of the batch.
+func (s *Server) ProcessBatch(w http.ResponseWriter, r *http.Request) {
+	var receipts []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&receipts); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "batch.invalid")
+		return
+	}
+	if len(receipts) == 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "batch.empty")
+		return
+	}
+	if len(receipts) > s.maxBatchSize {
+		sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, "batch.tooLarge", "max", s.maxBatchSize)
+		return
+	}
+
+	in := make(chan *pipeline.Receipt)
+	go func() {
+		defer close(in)
+		for _, raw := range receipts {
+			in <- &pipeline.Receipt{Raw: s.localize(r, raw)}
+		}
+	}()
+
+	// Prepare concurrently, then store in input order
+	results := make([]BatchResult, 0, len(receipts))
+	for prepared := range s.pipeline.Stream(r.Context(), in) {
+		results = append(results, s.commitBatchResult(r, len(results), prepared))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string][]BatchResult{"results": results})
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "request.encodeResultsFailed")
+		return
+	}
+}
+
+// ProcessStream validates, scores and stores newline-delimited JSON receipts, writing one
+// newline-delimited result per receipt as soon as it is available
+func (s *Server) ProcessStream(w http.ResponseWriter, r *http.Request) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	// Split receipts as they arrive, stopping at the first malformed line
+	var decodeErr error
+	in := make(chan *pipeline.Receipt)
+	go func() {
+		defer close(in)
+		decoder := json.NewDecoder(r.Body)
+		for {
+			var next json.RawMessage
+			if err := decoder.Decode(&next); err != nil {
+				if err != io.EOF {
+					decodeErr = err
+				}
+				return
+			}
+			in <- &pipeline.Receipt{Raw: s.localize(r, next)}
+		}
+	}()
+
+	encoder := json.NewEncoder(w)
+	index := 0
+	for prepared := range s.pipeline.Stream(r.Context(), in) {
+		encoder.Encode(s.commitBatchResult(r, index, prepared))
+		if flusher != nil {
+			flusher.Flush()
+		}
+		index++
+	}
+	if decodeErr != nil {
+		encoder.Encode(BatchResult{Index: index, Error: "The receipt is invalid."})
+	}
+}
+
+// commitBatchResult stores a prepared receipt and describes the outcome
+func (s *Server) commitBatchResult(r *http.Request, index int, prepared pipeline.Prepared) BatchResult {
+	err := prepared.Err
+	if err == nil {
+		err = s.pipeline.Commit(r.Context(), prepared.Receipt)
+	}
+	var invalid *pipeline.Invalid
+	var rejected *pipeline.Rejection
+	switch {
+	case err == nil:
+		return BatchResult{Index: index, ID: prepared.Receipt.Record.ID, Points: &prepared.Receipt.Record.Points}
+	case errors.As(err, &invalid):
+		return BatchResult{Index: index, Error: invalid.Error(), Errors: invalid.Errors, Code: invalid.Code}
+	case errors.As(err, &rejected):
+		return BatchResult{Index: index, Error: rejected.Error()}
+	}
+	return BatchResult{Index: index, Error: "Unable to store the receipt."}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GetBodyLog returns the body logging settings in effect
+func (s *Server) GetBodyLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.bodyLog.Settings())
+}
+
+// UpdateBodyLog changes the body logging settings without a restart. Fields the request omits
+// keep their current values, so enabling logging never drops the redacted fields by accident.
+func (s *Server) UpdateBodyLog(w http.ResponseWriter, r *http.Request) {
+	settings := s.bodyLog.Settings()
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "bodyLog.invalid")
+		return
+	}
+	if err := s.bodyLog.Update(settings); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "bodyLog.invalidReason", "reason", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.bodyLog.Settings())
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/store"
+)
+
+// RehydrateReceipt brings a receipt back from cold storage into the store and returns it; a receipt
+// that isn't archived is returned as it is
+func (s *Server) RehydrateReceipt(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["id"]
+	setAuditResource(r, "/receipts/"+receiptID)
+	if s.coldStorage == nil {
+		sendErrorResponse(w, r, http.StatusConflict, "coldStorage.disabled")
+		return
+	}
+	record, err := s.coldStorage.Rehydrate(receiptID)
+	if errors.Is(err, store.ErrNotFound) || err == nil && record.Deleted() {
+		sendErrorResponse(w, r, http.StatusNotFound, "receipt.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.rehydrateFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// compressionThreshold is the smallest response body, in bytes, worth compressing
+const compressionThreshold = 1024
+
+// gzipETagSuffix ends the ETag of a compressed response, inside its quotes
+const gzipETagSuffix = "-gzip"
+
+// compressionMiddleware gzips responses for clients that accept it once the body
+// grows past compressionThreshold, leaving small responses untouched
+func compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header value allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if len(fields) > 1 && strings.ReplaceAll(strings.TrimSpace(fields[1]), " ", "") == "q=0" {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// compressResponseWriter buffers the start of the body until it knows whether the
+// response is large enough to compress
+type compressResponseWriter struct {
+	http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+	buffer        bytes.Buffer
+	gzipWriter    *gzip.Writer
+	passthrough   bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(statusCode int) {
+	if cw.headerWritten {
+		return
+	}
+	cw.statusCode = statusCode
+	cw.headerWritten = true
+
+	// Responses without a body are never compressed
+	if statusCode < http.StatusOK || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.headerWritten {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(p)
+	}
+	if cw.gzipWriter != nil {
+		return cw.gzipWriter.Write(p)
+	}
+
+	cw.buffer.Write(p)
+	if cw.buffer.Len() < compressionThreshold {
+		return len(p), nil
+	}
+
+	// The body is large enough, switch to gzip and flush what has been buffered
+	header := cw.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(cw.statusCode)
+		_, err := cw.ResponseWriter.Write(cw.buffer.Bytes())
+		cw.buffer.Reset()
+		return len(p), err
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	// The compressed body is another representation, so it can't share the identity one's strong ETag
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`) {
+		header.Set("ETag", strings.TrimSuffix(etag, `"`)+gzipETagSuffix+`"`)
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	cw.gzipWriter = gzip.NewWriter(cw.ResponseWriter)
+	_, err := cw.gzipWriter.Write(cw.buffer.Bytes())
+	cw.buffer.Reset()
+	return len(p), err
+}
+
+// Flush sends everything written so far. A response flushed before reaching the threshold
+// is streamed uncompressed from then on.
+func (cw *compressResponseWriter) Flush() {
+	if cw.gzipWriter != nil {
+		cw.gzipWriter.Flush()
+	} else if !cw.passthrough {
+		if !cw.headerWritten {
+			cw.WriteHeader(http.StatusOK)
+		}
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(cw.statusCode)
+		cw.ResponseWriter.Write(cw.buffer.Bytes())
+		cw.buffer.Reset()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the gzip stream, or writes the buffered body uncompressed when it stayed below the threshold
+func (cw *compressResponseWriter) Close() error {
+	if cw.gzipWriter != nil {
+		return cw.gzipWriter.Close()
+	}
+	if cw.passthrough {
+		return nil
+	}
+	if !cw.headerWritten {
+		cw.statusCode = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	_, err := cw.ResponseWriter.Write(cw.buffer.Bytes())
+	return err
+}
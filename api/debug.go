@@ -0,0 +1,30 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"receipt-processor/auth"
+)
+
+// DebugHandler serves the net/http/pprof profiles under /debug/pprof/ and expvar under /debug/vars.
+// It is meant for a separate port that isn't exposed publicly, and only answers admin API keys.
+func DebugHandler(authn *auth.Authenticator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Profiles expose memory contents, so they need an admin key even when the API itself is open
+		if !authn.Identify(r).Admin {
+			sendErrorResponse(w, r, http.StatusForbidden, "request.adminRequired")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/deadletter"
+	"receipt-processor/erasure"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// EraseUserData hard-deletes every receipt, ledger entry, referral and streak of a user, along with
+// the copies of the receipts in cold storage, retention archives, snapshots, the outbox, the webhook
+// delivery log and the dead-letter queue, and records the erasure
+func (s *Server) EraseUserData(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	var owned []store.Record
+	for _, record := range records {
+		if record.Receipt.UserID == userID {
+			owned = append(owned, record)
+		}
+	}
+	if !s.eraseCopies(w, r, owned) {
+		return
+	}
+	if _, ok := s.eraseArchived(w, r, func(record store.Record) bool { return record.Receipt.UserID == userID }); !ok {
+		return
+	}
+	entries, err := s.deadLetters.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.deadLettersFailed")
+		return
+	}
+	for _, entry := range entries {
+		var submitted struct {
+			UserID string `json:"userId"`
+		}
+		if json.Unmarshal(entry.Receipt, &submitted) != nil || submitted.UserID != userID {
+			continue
+		}
+		if err := s.deadLetters.Remove(entry.ID); err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.deadLettersFailed")
+			return
+		}
+	}
+	deleted := 0
+	for _, record := range owned {
+		if err := s.store.Delete(record.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "user.receiptsDeleteFailed")
+			return
+		}
+		deleted++
+	}
+	if _, err := s.ledger.EraseUser(userID); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.ledgerDeleteFailed")
+		return
+	}
+	if _, err := s.referrals.EraseUser(userID); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.referralsDeleteFailed")
+		return
+	}
+	if _, err := s.streaks.EraseUser(userID); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.streakDeleteFailed")
+		return
+	}
+
+	s.sendErasure(w, r, erasure.SubjectUser, userID, deleted)
+}
+
+// EraseReceiptData hard-deletes a single receipt and its ledger entries, along with its copies in
+// cold storage, retention archives, snapshots, the outbox, the webhook delivery log and the
+// dead-letter queue, and records the erasure
+func (s *Server) EraseReceiptData(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["id"]
+
+	record, err := s.store.Get(receiptID)
+	stored := err == nil
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.deleteFailed")
+		return
+	}
+	if stored && !s.eraseCopies(w, r, []store.Record{record}) {
+		return
+	}
+	// A receipt purged by retention may only be left in its archive and in snapshots
+	archived, ok := s.eraseArchived(w, r, func(record store.Record) bool { return record.ID == receiptID })
+	if !ok {
+		return
+	}
+	err = s.deadLetters.Remove(receiptID)
+	dead := err == nil
+	if err != nil && !errors.Is(err, deadletter.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.deadLettersFailed")
+		return
+	}
+	if !stored && !dead && archived == 0 {
+		sendErrorResponse(w, r, http.StatusNotFound, "receipt.notFound")
+		return
+	}
+	deleted := 0
+	if stored {
+		if err := s.store.Delete(receiptID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.deleteFailed")
+			return
+		}
+		deleted = 1
+	}
+	if _, err := s.ledger.EraseReceipt(receiptID); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.ledgerDeleteFailed")
+		return
+	}
+
+	s.sendErasure(w, r, erasure.SubjectReceipt, receiptID, deleted)
+}
+
+// eraseCopies removes the copies of the records kept outside the store: the cold-storage archives
+// of archived ones, their unpublished outbox events and the webhook deliveries of their events. It
+// writes an error response and returns false when one can't be removed.
+func (s *Server) eraseCopies(w http.ResponseWriter, r *http.Request, records []store.Record) bool {
+	ids := make([]string, 0, len(records))
+	archived := false
+	for _, record := range records {
+		ids = append(ids, record.ID)
+		archived = archived || record.Archived()
+	}
+	if archived {
+		if s.coldStorage == nil {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.archivesFailed")
+			return false
+		}
+		if err := s.coldStorage.Erase(records); err != nil {
+			log.Printf("erasing receipts from cold storage: %v", err)
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.archivesFailed")
+			return false
+		}
+	}
+	if s.outbox != nil && len(ids) > 0 {
+		if _, err := s.outbox.EraseEvents(ids...); err != nil {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.eventsFailed")
+			return false
+		}
+	}
+	if deliveries, ok := s.store.(store.DeliveryLog); ok && len(ids) > 0 {
+		if _, err := deliveries.EraseDeliveries(ids...); err != nil {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.deliveriesFailed")
+			return false
+		}
+	}
+	return true
+}
+
+// eraseArchived rewrites the retention archives and snapshots without the receipts erase matches,
+// which are matched rather than looked up because purged receipts are no longer in the store, and
+// removes the unpublished outbox events of the purged ones. It returns how many copies it removed,
+// or writes an error response and returns false when one can't be removed.
+func (s *Server) eraseArchived(w http.ResponseWriter, r *http.Request, erase func(store.Record) bool) (int, bool) {
+	erased := map[string]bool{}
+	match := func(record store.Record) bool {
+		if !erase(record) {
+			return false
+		}
+		erased[record.ID] = true
+		return true
+	}
+	removed := 0
+	if s.retention != nil {
+		n, err := s.retention.Erase(match)
+		if err != nil {
+			log.Printf("erasing receipts from retention archives: %v", err)
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.retentionFailed")
+			return 0, false
+		}
+		removed += n
+	}
+	n, err := store.EraseRecords(s.snapshots, "", match)
+	if err != nil {
+		log.Printf("erasing receipts from snapshots: %v", err)
+		sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.snapshotsFailed")
+		return 0, false
+	}
+	removed += n
+	if s.outbox != nil && len(erased) > 0 {
+		if _, err := s.outbox.EraseEvents(slices.Collect(maps.Keys(erased))...); err != nil {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.eventsFailed")
+			return 0, false
+		}
+	}
+	return removed, true
+}
+
+// sendErasure appends the erasure record and writes it as the response
+func (s *Server) sendErasure(w http.ResponseWriter, r *http.Request, kind string, id string, deleted int) {
+	record, err := s.erasures.Append(kind, id, deleted)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "erasure.recordFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"receiptsDeleted": deleted, "erasure": record})
+}
+
+// ListErasures returns the erasure log together with the result of verifying its hash chain
+func (s *Server) ListErasures(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{"records": s.erasures.Records(), "verified": true}
+	if err := s.erasures.Verify(); err != nil {
+		response["verified"] = false
+		response["error"] = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"receipt-processor/parquet"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// parquetType is the media type of Parquet files
+const parquetType = "application/vnd.apache.parquet"
+
+// exportColumns is the flattened schema of an export: one row per item, repeating its receipt's
+// fields. Receipts without items get a single row with null item fields.
+var exportColumns = []parquet.Column{
+	{Name: "receipt_id", Type: parquet.String},
+	{Name: "created_at", Type: parquet.Timestamp},
+	{Name: "status", Type: parquet.String},
+	{Name: "user_id", Type: parquet.String, Optional: true},
+	{Name: "retailer", Type: parquet.String},
+	{Name: "retailer_id", Type: parquet.String, Optional: true},
+	{Name: "purchase_date", Type: parquet.Date, Optional: true},
+	{Name: "purchase_time", Type: parquet.String},
+	{Name: "total", Type: parquet.Double, Optional: true},
+	{Name: "points", Type: parquet.Int64},
+	{Name: "item_index", Type: parquet.Int32, Optional: true},
+	{Name: "item_description", Type: parquet.String, Optional: true},
+	{Name: "item_price", Type: parquet.Double, Optional: true},
+	{Name: "item_quantity", Type: parquet.Double, Optional: true},
+	{Name: "item_category", Type: parquet.String, Optional: true},
+	{Name: "item_brand", Type: parquet.String, Optional: true},
+	{Name: "item_upc", Type: parquet.String, Optional: true},
+}
+
+// ExportReceipts writes the receipts GET /receipts would list with the same filters as a Parquet
+// file, so data teams can load them into Spark or BigQuery as they are
+func (s *Server) ExportReceipts(w http.ResponseWriter, r *http.Request) {
+	if format := r.URL.Query().Get("format"); format != "parquet" {
+		sendErrorResponse(w, r, http.StatusBadRequest, "param.format")
+		return
+	}
+	filter, ok := parseReceiptFilter(w, r)
+	if !ok {
+		return
+	}
+	records, err := s.store.ListSorted(store.Sort{Field: store.SortCreatedAt})
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	records = slices.DeleteFunc(records, func(record store.Record) bool { return !filter.matches(record) })
+	// Stubs of receipts in cold storage have no items, so theirs are read from the archives
+	archived, err := s.loadArchived(records)
+	if err != nil {
+		log.Printf("reading receipts from cold storage for an export: %v", err)
+		sendErrorResponse(w, r, http.StatusInternalServerError, "coldStorage.readFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", parquetType)
+	w.Header().Set("Content-Disposition", `attachment; filename="receipts-`+s.clock.Now().UTC().Format("20060102T150405Z")+`.parquet"`)
+	file, err := parquet.NewWriter(w, exportColumns)
+	if err == nil {
+		for _, record := range records {
+			if full, ok := archived[record.ID]; ok {
+				record.Receipt.Items = full.Receipt.Items
+			}
+			if err = writeExportRows(file, record); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		// The status was already sent, so the client is left with a truncated file it can't read
+		log.Printf("Error exporting receipts: %v", err)
+	}
+}
+
+// loadArchived reads the archived copies of the stubs among records, keyed by ID
+func (s *Server) loadArchived(records []store.Record) (map[string]store.Record, error) {
+	if !slices.ContainsFunc(records, store.Record.Archived) {
+		return nil, nil
+	}
+	if s.coldStorage == nil {
+		return nil, errors.New("receipts are archived but cold storage is not configured")
+	}
+	return s.coldStorage.Load(records)
+}
+
+// writeExportRows writes a receipt's rows of an export
+func writeExportRows(file *parquet.Writer, record store.Record) error {
+	receipt := record.Receipt
+	var purchaseDate interface{}
+	if date, err := time.Parse(validation.DateLayout, receipt.PurchaseDate); err == nil {
+		purchaseDate = date
+	}
+	fields := []interface{}{
+		record.ID, record.CreatedAt, record.Status, optionalString(receipt.UserID),
+		receipt.Retailer, optionalString(receipt.RetailerID), purchaseDate, receipt.PurchaseTime,
+		optionalAmount(receipt.Total), int64(record.Points),
+	}
+	if len(receipt.Items) == 0 {
+		return file.Write(append(fields, nil, nil, nil, nil, nil, nil, nil)...)
+	}
+	for i, item := range receipt.Items {
+		row := append(fields[:len(fields):len(fields)], i, item.ShortDescription, optionalAmount(item.Price),
+			optionalAmount(item.Quantity), optionalString(item.Category), optionalString(item.Brand), optionalString(item.UPC))
+		if err := file.Write(row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionalString exports an empty string as null
+func optionalString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// optionalAmount exports a decimal string as a double, or null when it is empty or malformed
+func optionalAmount(value string) interface{} {
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return amount
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"receipt-processor/metrics"
+)
+
+var injectedFaults = metrics.NewCounterVec("receipts_injected_faults_total",
+	"Faults injected into requests for testing, by route and fault.", "route", "fault")
+
+// faultMiddleware delays, fails or drops requests as the fault injection rules pick, marking every
+// response it touched with X-Fault-Injected so injected failures can't be mistaken for real ones
+func (s *Server) faultMiddleware(next http.Handler) http.Handler {
+	if s.faults == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		fault := s.faults.Pick(r.Method, route)
+		if fault.Delay > 0 {
+			injectedFaults.With(route, "latency").Inc()
+			w.Header().Add("X-Fault-Injected", "latency")
+			timer := time.NewTimer(fault.Delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+		switch {
+		case fault.Drop:
+			injectedFaults.With(route, "drop").Inc()
+			// net/http closes the connection without writing a response
+			panic(http.ErrAbortHandler)
+		case fault.Status != 0:
+			injectedFaults.With(route, "error").Inc()
+			w.Header().Add("X-Fault-Injected", "error")
+			sendErrorResponse(w, r, fault.Status, "request.faultInjected", "status", fault.Status)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// fieldPattern matches one name in the fields parameter: a JSON member, or a dotted path to a
+// nested one such as receipt.items.price
+var fieldPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(\.[A-Za-z][A-Za-z0-9]*)*$`)
+
+// maxFields bounds how many names the fields parameter may list
+const maxFields = 50
+
+// projection is the tree of members the fields parameter selects; a member with no children is
+// kept whole
+type projection map[string]projection
+
+// parseProjection reads the request's fields parameter, returning nil when every field is wanted
+func parseProjection(r *http.Request) (projection, bool) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil, true
+	}
+	names := strings.Split(raw, ",")
+	if len(names) > maxFields {
+		return nil, false
+	}
+	p := projection{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !fieldPattern.MatchString(name) {
+			return nil, false
+		}
+		node := p
+		for _, member := range strings.Split(name, ".") {
+			child, ok := node[member]
+			if !ok {
+				child = projection{}
+				node[member] = child
+			}
+			node = child
+		}
+	}
+	return p, true
+}
+
+// project returns the selected members of a decoded JSON value. Arrays are projected element by
+// element, and members the value doesn't have are left out. At the top of a stored receipt,
+// names not found on the record are looked up in the receipt itself, so fields=id,retailer works.
+func (p projection) project(value interface{}, top bool) interface{} {
+	if len(p) == 0 {
+		return value
+	}
+	switch value := value.(type) {
+	case []interface{}:
+		projected := make([]interface{}, len(value))
+		for i, element := range value {
+			projected[i] = p.project(element, top)
+		}
+		return projected
+	case map[string]interface{}:
+		nested, _ := value["receipt"].(map[string]interface{})
+		projected := make(map[string]interface{}, len(p))
+		for member, child := range p {
+			if v, ok := value[member]; ok {
+				projected[member] = child.project(v, false)
+			} else if v, ok := nested[member]; ok && top {
+				projected[member] = child.project(v, false)
+			}
+		}
+		return projected
+	}
+	return value
+}
+
+// applyProjection re-encodes body keeping only the fields the request asks for. When items is
+// not empty, the projection applies to the elements of that member instead of the body itself,
+// as list responses wrap their elements.
+func applyProjection(w http.ResponseWriter, r *http.Request, body interface{}, items string) (interface{}, bool) {
+	p, ok := parseProjection(r)
+	if !ok {
+		sendErrorResponse(w, r, http.StatusBadRequest, "param.fields")
+		return nil, false
+	}
+	if p == nil {
+		return body, true
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "request.encodeFailed")
+		return nil, false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "request.encodeFailed")
+		return nil, false
+	}
+	if wrapper, ok := decoded.(map[string]interface{}); ok && items != "" {
+		wrapper[items] = p.project(wrapper[items], true)
+		return wrapper, true
+	}
+	return p.project(decoded, true), true
+}
+
+// sendListResponse writes a list response, {"<items>": [...], "links": {...}}, paged per the offset
+// and limit parameters and projected per the fields parameter. Without a limit the list is sent whole.
+func sendListResponse(w http.ResponseWriter, r *http.Request, items string, list interface{}) {
+	p, ok := parsePage(w, r, 0, maxPageSize)
+	if !ok {
+		return
+	}
+	sendPage(w, r, items, list, p)
+}
+
+// sendPage writes a page of a list response, linking to the pages before and after it
+func sendPage(w http.ResponseWriter, r *http.Request, items string, list interface{}, p page) {
+	elements := reflect.ValueOf(list)
+	start, end := p.bounds(elements.Len())
+	wrapper := map[string]interface{}{items: elements.Slice(start, end).Interface(), "links": pageLinks(r, p, elements.Len())}
+	body, ok := applyProjection(w, r, wrapper, items)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/ledger"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/store"
+)
+
+// Reasons recorded in a receipt's score history
+const (
+	reasonReprocess  = "reprocess"
+	reasonReviewEdit = "review-edit"
+)
+
+// ReprocessRequest optionally explains why a receipt is being rescored, e.g. "rule update"
+type ReprocessRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReprocessReceipt validates and scores the stored payload again with the current rules,
+// recording the previous points in the receipt's history
+func (s *Server) ReprocessReceipt(w http.ResponseWriter, r *http.Request) {
+	request := ReprocessRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		sendErrorResponse(w, r, http.StatusBadRequest, "receipt.reprocessInvalid")
+		return
+	}
+	if request.Reason == "" {
+		request.Reason = reasonReprocess
+	}
+	if len(request.Reason) > maxReasonLength {
+		sendErrorResponse(w, r, http.StatusBadRequest, "reason.tooLong", "max", maxReasonLength)
+		return
+	}
+
+	receiptID := mux.Vars(r)["id"]
+	unlock, ok := s.lockReceipts(w, r, receiptID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	record, err := s.rescore(r.Context(), record, request.Reason, auth.FromContext(r.Context()).Name)
+	var invalid *pipeline.Invalid
+	switch {
+	case errors.As(err, &invalid):
+		sendValidationErrors(w, r, http.StatusUnprocessableEntity, "receipt.storedInvalid", invalid.Errors)
+		return
+	case errors.Is(err, errUpdateFailed):
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.updateFailed")
+		return
+	case errors.Is(err, errCreditFailed):
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.creditFailed")
+		return
+	case err != nil:
+		sendPipelineError(w, r, err, "receipt.scoreFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// Errors rescore returns when the new points can't be kept
+var (
+	errUpdateFailed = errors.New("saving the rescored receipt failed")
+	errCreditFailed = errors.New("crediting the rescored points failed")
+)
+
+// rescore validates a stored receipt again in case validation rules have changed and scores it
+// with the current rules, recording the previous points in its history. Approved points are
+// already in the ledger, so the difference is moved there too. The caller holds the receipt's
+// lock; a return also locks the receipt it refunds while its clawback is worked out.
+func (s *Server) rescore(ctx context.Context, record store.Record, reason, actor string) (store.Record, error) {
+	if id := record.Receipt.OriginalReceiptID; record.Receipt.IsReturn() && id != "" {
+		unlock, err := s.receiptLocks.lock(id)
+		if err != nil {
+			return store.Record{}, err
+		}
+		defer unlock()
+	}
+	stored := &pipeline.Receipt{Receipt: record.Receipt, Record: record}
+	if err := s.pipeline.Prepare(ctx, stored); err != nil {
+		return store.Record{}, err
+	}
+
+	original := record
+	record.Receipt = stored.Receipt
+	s.recordScoreChange(&record, stored.Points, reason, actor)
+	eventID, err := s.save(record, outbox.ReceiptPointsChanged)
+	if err != nil {
+		return store.Record{}, errUpdateFailed
+	}
+	if record.Status == store.StatusApproved && record.Points != original.Points {
+		if err := s.credit(record, ledger.KindRescore, record.Points-original.Points, reason, actor); err != nil {
+			s.store.Save(original)
+			s.dropEvent(eventID)
+			return store.Record{}, errCreditFailed
+		}
+	}
+	return record, nil
+}
+
+// GetReceiptHistory returns every change to a receipt's points, oldest first
+func (s *Server) GetReceiptHistory(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.findReceipt(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	history := record.History
+	if history == nil {
+		history = []store.ScoreChange{}
+	}
+
+	sendConditionalResponse(w, r, map[string]interface{}{"id": record.ID, "points": record.Points, "history": history})
+}
+
+// maxReasonLength bounds the reason stored with every score change
+const maxReasonLength = 256
+
+// recordScoreChange sets the record's points, appending the change to its history when they differ
+func (s *Server) recordScoreChange(record *store.Record, points int, reason, actor string) {
+	if points == record.Points {
+		return
+	}
+	record.History = append(record.History, store.ScoreChange{
+		OldPoints: record.Points,
+		NewPoints: points,
+		Reason:    reason,
+		Actor:     actor,
+		Time:      s.clock.Now().UTC(),
+	})
+	record.Points = points
+}
+
+// rescoreLocked rescores a receipt under its lock, reloading it first so a change made since it
+// was listed isn't overwritten
+func (s *Server) rescoreLocked(ctx context.Context, id, reason, actor string) (store.Record, error) {
+	unlock, err := s.receiptLocks.lock(id)
+	if err != nil {
+		return store.Record{}, err
+	}
+	defer unlock()
+	record, err := s.store.Get(id)
+	if err != nil {
+		return store.Record{}, err
+	}
+	return s.rescore(ctx, record, reason, actor)
+}
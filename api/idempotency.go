@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"receipt-processor/auth"
+	"receipt-processor/idempotency"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// reserveIdempotencyKey claims the request's Idempotency-Key, returning the key to complete or release
+// once the receipt is stored, or "" when the request has none. When the key was already used it answers
+// with the receipt the first request created and reports false.
+func (s *Server) reserveIdempotencyKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	header := r.Header.Get("Idempotency-Key")
+	if header == "" {
+		return "", true
+	}
+	if len(header) > maxIdempotencyKeyLength {
+		sendErrorResponse(w, r, http.StatusBadRequest, "idempotency.keyTooLong")
+		return "", false
+	}
+
+	// Keys are scoped to the caller so clients can't collide with each other's keys
+	key := auth.FromContext(r.Context()).Name + ":" + header
+	receiptID, reserved, err := s.idempotency.Reserve(key)
+	if errors.Is(err, idempotency.ErrInProgress) {
+		sendErrorResponse(w, r, http.StatusConflict, "idempotency.inProgress")
+		return "", false
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "idempotency.checkFailed")
+		return "", false
+	}
+	if !reserved {
+		setAuditResource(r, "/receipts/"+receiptID)
+		w.Header().Set("Idempotent-Replayed", "true")
+		sendReceiptAccepted(w, r, http.StatusCreated, "success", receiptID)
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/blob"
+	"receipt-processor/i18n"
+	"receipt-processor/jobs"
+	"receipt-processor/pipeline"
+	"receipt-processor/problem"
+	"receipt-processor/store"
+)
+
+// Kinds of background jobs
+const (
+	// jobImport restores a snapshot from the snapshot store, like POST /admin/restore
+	jobImport = "import"
+	// jobExport writes a snapshot to the snapshot store, like POST /admin/snapshot
+	jobExport = "export"
+	// jobPurge deletes the receipts matching a filter, like POST /admin/receipts/purge
+	jobPurge = "purge"
+	// jobRecalculate rescores stored receipts with the current rules, like POST /receipts/{id}/reprocess
+	jobRecalculate = "recalculate"
+	// jobArchive moves old receipts to cold storage, like the scheduled moves
+	jobArchive = "archive"
+)
+
+// reasonRecalculate is recorded in the history of receipts a recalculation changed
+const reasonRecalculate = "recalculate"
+
+// JobRequest submits a background job with its kind-specific parameters
+type JobRequest struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+// RecalculateRequest selects the receipts a recalculation rescores; an empty status rescores all
+type RecalculateRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// Actor is who the score changes are recorded against, the caller who submitted the job
+	Actor string `json:"actor,omitempty"`
+}
+
+// registerJobs hands the job kinds to the job manager
+func (s *Server) registerJobs() {
+	s.jobs.Handle(jobImport, s.runImport)
+	s.jobs.Handle(jobExport, s.runExport)
+	s.jobs.Handle(jobPurge, s.runPurge)
+	s.jobs.Handle(jobRecalculate, s.runRecalculate)
+	s.jobs.Handle(jobArchive, s.runArchive)
+}
+
+// SubmitJob queues a long operation, answering 202 with the job to poll for its progress
+func (s *Server) SubmitJob(w http.ResponseWriter, r *http.Request) {
+	var request JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "job.invalid")
+		return
+	}
+	caller := auth.FromContext(r.Context()).Name
+	params, message := s.checkJobParams(request, caller)
+	if message.Key != "" {
+		problem.New(http.StatusBadRequest, message).Write(w, r)
+		return
+	}
+
+	job, err := s.jobs.Submit(request.Kind, params, caller)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "job.queueFailed")
+		return
+	}
+	setAuditResource(r, "/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// checkJobParams validates a job's parameters before it is queued, returning them normalized or
+// why they are invalid
+func (s *Server) checkJobParams(request JobRequest, caller string) (json.RawMessage, i18n.Message) {
+	decode := func(v interface{}) bool {
+		if len(request.Params) == 0 {
+			return true
+		}
+		return json.Unmarshal(request.Params, v) == nil
+	}
+
+	var params interface{}
+	switch request.Kind {
+	case jobImport, jobExport:
+		var snapshot SnapshotRequest
+		if !decode(&snapshot) {
+			return nil, i18n.NewMessage("job.snapshotParamsInvalid")
+		}
+		if snapshot.Name == "" && request.Kind == jobExport {
+			snapshot.Name = "snapshot-" + s.clock.Now().UTC().Format("20060102T150405Z") + ".jsonl.gz"
+		}
+		if err := checkSnapshotName(snapshot.Name); err != nil {
+			return nil, i18n.NewMessage("snapshot.nameInvalid")
+		}
+		params = snapshot
+	case jobPurge:
+		var purge PurgeRequest
+		if !decode(&purge) {
+			return nil, i18n.NewMessage("purge.invalid")
+		}
+		if message := purge.check(); message.Key != "" {
+			return nil, message
+		}
+		params = purge
+	case jobRecalculate:
+		var recalculate RecalculateRequest
+		if !decode(&recalculate) {
+			return nil, i18n.NewMessage("job.recalculateParamsInvalid")
+		}
+		if recalculate.Reason == "" {
+			recalculate.Reason = reasonRecalculate
+		}
+		if len(recalculate.Reason) > maxReasonLength {
+			return nil, i18n.NewMessage("reason.tooLong", "max", maxReasonLength)
+		}
+		recalculate.Actor = caller
+		params = recalculate
+	case jobArchive:
+		params = struct{}{}
+	default:
+		return nil, i18n.NewMessage("job.kind")
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, i18n.NewMessage("job.paramsInvalid")
+	}
+	return data, i18n.Message{}
+}
+
+func (s *Server) ListJobs(w http.ResponseWriter, r *http.Request) {
+	list, err := s.jobs.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "jobs.listFailed")
+		return
+	}
+	sendListResponse(w, r, "jobs", list)
+}
+
+func (s *Server) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Get(mux.Vars(r)["id"])
+	if errors.Is(err, jobs.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "job.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "job.loadFailed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelJob stops a queued or running job; a running job stops at its next receipt
+func (s *Server) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Cancel(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		sendErrorResponse(w, r, http.StatusNotFound, "job.notFound")
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		sendErrorResponse(w, r, http.StatusConflict, "job.finished")
+		return
+	case err != nil:
+		sendErrorResponse(w, r, http.StatusInternalServerError, "job.cancelFailed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// runImport restores a snapshot, counting every receipt restored
+func (s *Server) runImport(ctx context.Context, params json.RawMessage, progress *jobs.Progress) (interface{}, error) {
+	var request SnapshotRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, err
+	}
+	file, err := s.snapshots.Get(request.Name)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, fmt.Errorf("no snapshot named %s", request.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	restored, err := store.ReadSnapshot(file, progressStore{Store: s.store, ctx: ctx, progress: progress})
+	if err != nil {
+		return nil, fmt.Errorf("restored %d receipts before failing: %w", restored, err)
+	}
+	return map[string]interface{}{"name": request.Name, "restored": restored}, nil
+}
+
+// runExport writes a snapshot of every receipt
+func (s *Server) runExport(ctx context.Context, params json.RawMessage, progress *jobs.Progress) (interface{}, error) {
+	var request SnapshotRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, err
+	}
+	count, size, err := s.writeSnapshot(ctx, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	progress.SetTotal(count)
+	progress.Add(count)
+	return map[string]interface{}{"name": request.Name, "receipts": count, "bytes": size}, nil
+}
+
+// runPurge deletes the receipts matching the filter, or only counts them on a dry run
+func (s *Server) runPurge(ctx context.Context, params json.RawMessage, progress *jobs.Progress) (interface{}, error) {
+	var request PurgeRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, err
+	}
+	matched, err := s.matchPurge(request)
+	if err != nil {
+		return nil, err
+	}
+	result := PurgeProgress{Matched: len(matched)}
+	if !request.DryRun {
+		progress.SetTotal(len(matched))
+		for _, id := range matched {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := s.store.Delete(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, fmt.Errorf("deleted %d receipts before failing: %w", result.Deleted, err)
+			}
+			result.Deleted++
+			progress.Add(1)
+		}
+	}
+	result.Done = true
+	return result, nil
+}
+
+// runArchive moves the receipts due for cold storage there
+func (s *Server) runArchive(ctx context.Context, params json.RawMessage, progress *jobs.Progress) (interface{}, error) {
+	if s.coldStorage == nil {
+		return nil, errors.New("cold storage is not configured")
+	}
+	result, err := s.coldStorage.Archive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("archived %d receipts before failing: %w", result.Archived, err)
+	}
+	progress.SetTotal(result.Archived)
+	progress.Add(result.Archived)
+	return result, nil
+}
+
+// runRecalculate rescores the selected receipts with the current rules, leaving the trash and cold
+// storage alone.
+// Receipts that are no longer valid are skipped and counted.
+func (s *Server) runRecalculate(ctx context.Context, params json.RawMessage, progress *jobs.Progress) (interface{}, error) {
+	var request RecalculateRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, err
+	}
+	records, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	selected := records[:0]
+	for _, record := range records {
+		if !record.Deleted() && !record.Archived() && (request.Status == "" || record.Status == request.Status) {
+			selected = append(selected, record)
+		}
+	}
+
+	progress.SetTotal(len(selected))
+	var changed, invalid int
+	for _, record := range selected {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rescored, err := s.rescoreLocked(ctx, record.ID, request.Reason, request.Actor)
+		var invalidErr *pipeline.Invalid
+		var rejected *pipeline.Rejection
+		switch {
+		case errors.As(err, &invalidErr), errors.As(err, &rejected):
+			invalid++
+		case errors.Is(err, store.ErrNotFound):
+			// Purged or erased since the receipts were listed
+		case err != nil:
+			return nil, fmt.Errorf("rescoring receipt %s: %w", record.ID, err)
+		case rescored.Points != record.Points:
+			changed++
+		}
+		progress.Add(1)
+	}
+	return map[string]int{"matched": len(selected), "changed": changed, "invalid": invalid}, nil
+}
+
+// progressStore counts the receipts saved through it as job progress, and stops saving once the
+// job is cancelled
+type progressStore struct {
+	store.Store
+	ctx      context.Context
+	progress *jobs.Progress
+}
+
+func (p progressStore) Save(record store.Record) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	if err := p.Store.Save(record); err != nil {
+		return err
+	}
+	p.progress.Add(1)
+	return nil
+}
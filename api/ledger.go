@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/ledger"
+	"receipt-processor/outbox"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// AdjustRequest adds points to or subtracts them from a receipt, e.g. a goodwill credit
+type AdjustRequest struct {
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// AdjustReceipt changes an approved receipt's points by hand, recording the adjustment in the
+// receipt's history and the user's ledger
+func (s *Server) AdjustReceipt(w http.ResponseWriter, r *http.Request) {
+	var request AdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "adjustment.invalid")
+		return
+	}
+	if request.Points == 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "adjustment.zero")
+		return
+	}
+	if request.Reason == "" {
+		sendErrorResponse(w, r, http.StatusBadRequest, "reason.required")
+		return
+	}
+	if len(request.Reason) > maxReasonLength {
+		sendErrorResponse(w, r, http.StatusBadRequest, "reason.tooLong", "max", maxReasonLength)
+		return
+	}
+
+	receiptID := mux.Vars(r)["id"]
+	setAuditResource(r, "/receipts/"+receiptID)
+	unlock, ok := s.lockReceipts(w, r, receiptID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	// Only approved points are in the ledger; pending receipts can be corrected before approval instead
+	if record.Status != store.StatusApproved {
+		sendErrorResponse(w, r, http.StatusConflict, "adjustment.notApproved")
+		return
+	}
+	if record.Points+request.Points < 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "adjustment.negative")
+		return
+	}
+
+	original := record
+	s.recordScoreChange(&record, record.Points+request.Points, request.Reason, auth.FromContext(r.Context()).Name)
+	eventID, err := s.save(record, outbox.ReceiptPointsChanged)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.updateFailed")
+		return
+	}
+	actor := auth.FromContext(r.Context()).Name
+	if err := s.credit(record, ledger.KindAdjustment, request.Points, request.Reason, actor); err != nil {
+		s.store.Save(original)
+		s.dropEvent(eventID)
+		sendErrorResponse(w, r, http.StatusInternalServerError, "adjustment.recordFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// GetUserLedger returns every movement of a user's points, oldest first
+func (s *Server) GetUserLedger(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+
+	balance, err := s.ledger.Balance(userID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.ledgerFailed")
+		return
+	}
+	entries, err := s.ledger.Entries(userID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.ledgerFailed")
+		return
+	}
+
+	sendConditionalResponse(w, r, map[string]interface{}{"userId": userID, "balance": balance, "entries": entries})
+}
+
+// earnKind is the kind of ledger entry approving a receipt records: a clawback for returns
+func earnKind(record store.Record) string {
+	if record.Receipt.IsReturn() {
+		return ledger.KindClawback
+	}
+	return ledger.KindEarn
+}
+
+// credit records a movement of a receipt's points in the ledger of the user who submitted it
+func (s *Server) credit(record store.Record, kind string, points int, reason string, actor string) error {
+	_, err := s.ledger.Append(ledger.Entry{
+		UserID:    record.Receipt.UserID,
+		ReceiptID: record.ID,
+		Kind:      kind,
+		Points:    points,
+		Reason:    reason,
+		Actor:     actor,
+	})
+	return err
+}
+
+// approved runs what follows crediting an approved receipt's points: the referral bonus and the
+// user's streak, neither of which returns count towards. The receipt stays approved when they fail.
+func (s *Server) approved(record store.Record) {
+	if record.Receipt.IsReturn() {
+		return
+	}
+	s.rewardReferral(record)
+	if userID := record.Receipt.UserID; userID != "" {
+		if _, err := s.streaks.Record(userID, record.CreatedAt); err != nil {
+			log.Printf("recording the streak of user %s: %v", userID, err)
+		}
+	}
+}
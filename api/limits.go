@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/limits"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// errNoQuotas is returned when submission limits are set but the store can't enforce them
+var errNoQuotas = errors.New("the store can't enforce submission limits")
+
+// GetUserLimits reports how much of each submission limit a user has used and has left
+func (s *Server) GetUserLimits(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+
+	now := s.clock.Now()
+	records, err := s.userReceipts(userID, limits.Since(now))
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	usage := s.userLimits.Usage(records, userID, now)
+	sendConditionalResponse(w, r, map[string]interface{}{
+		"userId":         userID,
+		"receiptsToday":  usage.Receipts,
+		"pointsToday":    usage.PointsToday,
+		"pointsThisWeek": usage.PointsThisWeek,
+	})
+}
+
+// userReceipts returns the receipts a user submitted since a time, through the store's index
+func (s *Server) userReceipts(userID string, since time.Time) ([]store.Record, error) {
+	quotas, ok := s.store.(store.Quotas)
+	if !ok {
+		return nil, errNoQuotas
+	}
+	return quotas.UserReceipts(userID, since)
+}
+
+// saveProcessed stores a newly processed receipt like save, rejecting it when it would take its
+// user over a submission limit. The store checks the limits and saves the receipt in one step, so
+// concurrent receipts, even on other instances, can't share the last of a quota. The receipts it
+// replaces don't count.
+func (s *Server) saveProcessed(r *pipeline.Receipt, record store.Record) (string, error) {
+	if !s.userLimits.Enabled() || record.Receipt.UserID == "" {
+		return s.save(record, outbox.ReceiptProcessed)
+	}
+	quotas, ok := s.store.(store.Quotas)
+	if !ok {
+		return "", errNoQuotas
+	}
+	now := s.clock.Now()
+	var event *store.Event
+	if s.outbox != nil {
+		created, err := outbox.NewEvent(s.ids.NewID(), now, outbox.ReceiptProcessed, record)
+		if err != nil {
+			return "", err
+		}
+		event = &created
+	}
+	err := quotas.SaveChecked(record, event, limits.Since(now), func(recent []store.Record) error {
+		recent = slices.DeleteFunc(recent, func(stored store.Record) bool {
+			return slices.Contains(r.Replaces, stored.ID)
+		})
+		exceeded := s.userLimits.Usage(recent, record.Receipt.UserID, now).Check(record.Points)
+		if exceeded == nil {
+			return nil
+		}
+		code := pipeline.CodePointsLimit
+		if exceeded.Receipts {
+			code = pipeline.CodeReceiptLimit
+		}
+		return &pipeline.Rejection{Reasons: []string{exceeded.Reason}, Code: code}
+	})
+	if err != nil || event == nil {
+		return "", err
+	}
+	return event.ID, nil
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPageSize bounds the limit parameter of list endpoints
+const maxPageSize = 1000
+
+// Links lets clients navigate the API without building URLs: Self locates the resource or page a
+// response describes, and Next and Prev the pages around it in a list. They are relative to the
+// host and keep the API version the request was made to.
+type Links struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// page is the part of a list the offset and limit parameters select
+type page struct {
+	offset int
+	// limit is the most elements on the page; 0 takes the rest of the list
+	limit int
+	// offsetGiven reports whether the request chose the offset, for lists that default to their last page
+	offsetGiven bool
+}
+
+// parsePage reads the offset and limit parameters, writing the error response when they are
+// malformed. defaultLimit applies when no limit is given, 0 taking the whole list.
+func parsePage(w http.ResponseWriter, r *http.Request, defaultLimit, maxLimit int) (page, bool) {
+	query := r.URL.Query()
+	p := page{limit: defaultLimit}
+	if raw := query.Get("offset"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.offset")
+			return page{}, false
+		}
+		p.offset, p.offsetGiven = value, true
+	}
+	if raw := query.Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 || value > maxLimit {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.limit", "max", maxLimit)
+			return page{}, false
+		}
+		p.limit = value
+	}
+	return p, true
+}
+
+// bounds returns where the page starts and ends in a list of total elements
+func (p page) bounds(total int) (int, int) {
+	start := min(p.offset, total)
+	if p.limit == 0 {
+		return start, total
+	}
+	return start, min(start+p.limit, total)
+}
+
+// pageLinks links a page of a list of total elements to the pages before and after it
+func pageLinks(r *http.Request, p page, total int) Links {
+	start, end := p.bounds(total)
+	links := Links{Self: r.URL.RequestURI()}
+	if end < total {
+		links.Next = pageURL(r, end)
+	}
+	if start > 0 && p.limit > 0 {
+		links.Prev = pageURL(r, max(start-p.limit, 0))
+	}
+	return links
+}
+
+// pageURL returns the request's URL starting at another offset
+func pageURL(r *http.Request, offset int) string {
+	query := r.URL.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// versionPrefix matches the version a request path starts with, e.g. /v1. It is matched rather
+// than looked up in apiVersions, which the handlers building links are part of.
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// resourceURL returns the URL of a resource under the API version the request was made to, e.g.
+// /v1/receipts/{id} for a request to /v1/receipts/process
+func resourceURL(r *http.Request, path string) string {
+	if prefix := versionPrefix.FindString(r.URL.Path); prefix != "" {
+		return strings.TrimSuffix(prefix, "/") + path
+	}
+	return path
+}
+
+// sendReceiptAccepted answers a submission with the ID of its receipt, located by the Location
+// header and the self link
+func sendReceiptAccepted(w http.ResponseWriter, r *http.Request, statusCode int, status, id string) {
+	self := resourceURL(r, "/receipts/"+id)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", self)
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "id": id, "links": Links{Self: self}})
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+
+	"receipt-processor/store"
+)
+
+// receiptLocks serializes the changes made to each receipt, so two requests can't both load a
+// receipt, check its status and move its points in the ledger
+type receiptLocks struct {
+	// shared, when set, also locks the receipts on every instance sharing the store
+	shared store.Locks
+
+	mu    sync.Mutex
+	locks map[string]*receiptLock
+}
+
+// receiptLock is the lock of one receipt, dropped once no request holds or waits for it
+type receiptLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock locks the receipts with the given IDs and returns the function unlocking them. Several
+// receipts are locked in order of their IDs, so requests locking overlapping sets can't deadlock.
+// Requests on this instance wait for each other before taking the shared locks, so they don't hold
+// a database connection while they wait.
+func (l *receiptLocks) lock(ids ...string) (func(), error) {
+	unlock := l.lockLocal(ids...)
+	if l.shared == nil {
+		return unlock, nil
+	}
+	unlockShared, err := l.shared.LockReceipts(ids...)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return func() {
+		unlockShared()
+		unlock()
+	}, nil
+}
+
+// lockLocal locks the receipts within this process
+func (l *receiptLocks) lockLocal(ids ...string) func() {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	held := make([]*receiptLock, len(ids))
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*receiptLock{}
+	}
+	for i, id := range ids {
+		lock, ok := l.locks[id]
+		if !ok {
+			lock = &receiptLock{}
+			l.locks[id] = lock
+		}
+		lock.users++
+		held[i] = lock
+	}
+	l.mu.Unlock()
+
+	for _, lock := range held {
+		lock.Lock()
+	}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, lock := range held {
+			lock.Unlock()
+			if lock.users--; lock.users == 0 {
+				delete(l.locks, ids[i])
+			}
+		}
+	}
+}
+
+// lockReceipts locks the receipts for a request, writing an error response and returning false
+// when the locks can't be taken
+func (s *Server) lockReceipts(w http.ResponseWriter, r *http.Request, ids ...string) (func(), bool) {
+	unlock, err := s.receiptLocks.lock(ids...)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.lockFailed")
+		return nil, false
+	}
+	return unlock, true
+}
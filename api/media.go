@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonType is the media type of every request and response body that isn't listed in routeMedia
+const jsonType = "application/json"
+
+// msgpackType is the media type of the MessagePack encoding of JSON responses
+const msgpackType = "application/msgpack"
+
+// media lists the types a route reads its request body as and writes its response as, the
+// response type preferred when the client accepts several
+type media struct {
+	accepts  []string
+	produces []string
+}
+
+// routeMedia holds the routes whose bodies aren't plain JSON, by path template; the others also
+// write their responses as MessagePack
+var routeMedia = map[string]media{
+	"/receipts/stream":      {accepts: []string{"application/x-ndjson", jsonType}, produces: []string{"application/x-ndjson"}},
+	"/receipts/{id}/pdf":    {produces: []string{"application/pdf"}},
+	"/receipts/export":      {produces: []string{parquetType}},
+	"/admin/receipts/purge": {accepts: []string{jsonType}, produces: []string{"application/x-ndjson"}},
+}
+
+type responseTypeKey struct{}
+
+// responseType returns the media type mediaTypeMiddleware will send a JSON response as
+func responseType(r *http.Request) string {
+	if mediaType, ok := r.Context().Value(responseTypeKey{}).(string); ok {
+		return mediaType
+	}
+	return jsonType
+}
+
+// mediaTypeMiddleware answers 415 to a request whose body isn't of a type its route reads, rather
+// than attempting to decode it, and 406 to one whose Accept header allows none of the types the
+// route writes
+func mediaTypeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := media{accepts: []string{jsonType}, produces: []string{jsonType, msgpackType}}
+		if override, ok := routeMedia[routeOf(r)]; ok {
+			route = override
+		}
+
+		hasBody := r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+		if hasBody && (r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || !slices.Contains(route.accepts, mediaType) {
+				if r.Method == http.MethodPost {
+					w.Header().Set("Accept-Post", strings.Join(route.accepts, ", "))
+				}
+				sendErrorResponse(w, r, http.StatusUnsupportedMediaType, "request.unsupportedMediaType", "mediaTypes", strings.Join(route.accepts, " or "))
+				return
+			}
+		}
+		if !acceptsAny(r.Header.Get("Accept"), route.produces) {
+			sendErrorResponse(w, r, http.StatusNotAcceptable, "request.notAcceptable", "mediaTypes", strings.Join(route.produces, " or "))
+			return
+		}
+		if len(route.produces) > 1 {
+			w.Header().Add("Vary", "Accept")
+		}
+		if preferredType(r.Header.Get("Accept"), route.produces) == msgpackType {
+			// Not deferred: a handler that panics leaves its response to the recovery middleware
+			// rather than having half of it sent as a 200
+			mw := &msgpackResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(mw, r.WithContext(context.WithValue(r.Context(), responseTypeKey{}, msgpackType)))
+			mw.Close()
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsAny reports whether an Accept header value allows any of the media types; a missing
+// header allows them all
+func acceptsAny(accept string, mediaTypes []string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		for _, candidate := range mediaTypes {
+			major, _, _ := strings.Cut(candidate, "/")
+			if mediaType == "*/*" || mediaType == major+"/*" || mediaType == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// preferredType picks the media type an Accept header value gives the highest quality, the
+// earliest in mediaTypes among equals; a missing header prefers the first
+func preferredType(accept string, mediaTypes []string) string {
+	best, bestQuality := mediaTypes[0], -1.0
+	for _, candidate := range mediaTypes {
+		quality := 0.0
+		if strings.TrimSpace(accept) == "" {
+			quality = 1
+		}
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			major, _, _ := strings.Cut(candidate, "/")
+			if mediaType != "*/*" && mediaType != major+"/*" && mediaType != candidate {
+				continue
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			quality = max(quality, q)
+		}
+		if quality > bestQuality {
+			best, bestQuality = candidate, quality
+		}
+	}
+	return best
+}
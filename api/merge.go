@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"receipt-processor/auth"
+	"receipt-processor/ledger"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/receipt"
+	"receipt-processor/store"
+)
+
+// reasonMerged is recorded in the score history of receipts merged into another
+const reasonMerged = "merged"
+
+// MergeRequest lists the receipts submitted for parts of the same shopping trip
+type MergeRequest struct {
+	ReceiptIDs []string `json:"receiptIds"`
+}
+
+// MergeReceipts combines receipts submitted for parts of the same shopping trip, sharing their
+// retailer, purchase date and time and user, into one receipt scored once. The parts are voided:
+// they are marked merged with no points, and the points of approved ones are debited from the ledger.
+func (s *Server) MergeReceipts(w http.ResponseWriter, r *http.Request) {
+	var request MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.ReceiptIDs) < 2 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "merge.tooFew")
+		return
+	}
+	if len(request.ReceiptIDs) > s.maxBatchSize {
+		sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, "merge.tooMany", "max", s.maxBatchSize)
+		return
+	}
+
+	// The parts stay locked until they are voided, so none can be approved, merged or deleted meanwhile
+	unlock, ok := s.lockReceipts(w, r, request.ReceiptIDs...)
+	if !ok {
+		return
+	}
+	defer unlock()
+	parts := make([]store.Record, 0, len(request.ReceiptIDs))
+	seen := make(map[string]bool, len(request.ReceiptIDs))
+	for _, id := range request.ReceiptIDs {
+		if seen[id] {
+			sendErrorResponse(w, r, http.StatusBadRequest, "merge.duplicate", "id", id)
+			return
+		}
+		seen[id] = true
+		part, ok := s.findReceipt(w, r, id)
+		if !ok {
+			return
+		}
+		switch {
+		case part.Status == store.StatusMerged || part.Status == store.StatusRejected:
+			sendErrorResponse(w, r, http.StatusConflict, "merge.alreadyDecided", "id", id, "status", part.Status)
+			return
+		case part.Receipt.IsReturn():
+			sendErrorResponse(w, r, http.StatusBadRequest, "merge.return", "id", id)
+			return
+		case !sameTrip(parts, part.Receipt):
+			sendErrorResponse(w, r, http.StatusBadRequest, "merge.differentTrip", "id", id)
+			return
+		}
+		parts = append(parts, part)
+	}
+
+	merged, err := mergeParts(parts)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "merge.amounts")
+		return
+	}
+	incoming := &pipeline.Receipt{Receipt: merged, Replaces: request.ReceiptIDs}
+	if err := s.pipeline.Prepare(r.Context(), incoming); err != nil {
+		sendPipelineError(w, r, err, "merge.processFailed")
+		return
+	}
+	if err := s.pipeline.Commit(r.Context(), incoming); err != nil {
+		sendPipelineError(w, r, err, "merge.storeFailed")
+		return
+	}
+	id := incoming.Record.ID
+	setAuditResource(r, "/receipts/"+id)
+
+	// The merged receipt is stored, so a part that can't be voided is logged rather than failing the merge
+	actor := auth.FromContext(r.Context()).Name
+	for _, part := range parts {
+		if err := s.voidPart(part, id, actor); err != nil {
+			log.Printf("voiding receipt %s merged into %s: %v", part.ID, id, err)
+		}
+	}
+
+	sendReceiptAccepted(w, r, http.StatusCreated, "success", id)
+}
+
+// voidPart marks a receipt merged into mergedID, taking its points back from the ledger if they were credited
+func (s *Server) voidPart(part store.Record, mergedID, actor string) error {
+	original := part
+	s.recordScoreChange(&part, 0, reasonMerged, actor)
+	part.Status, part.StatusChangedAt = store.StatusMerged, s.clock.Now().UTC()
+	part.MergedInto = mergedID
+	eventID, err := s.save(part, outbox.ReceiptStatusChanged)
+	if err != nil {
+		return err
+	}
+	if original.Status == store.StatusApproved && original.Points != 0 {
+		if err := s.credit(part, ledger.KindMerge, -original.Points, "merged into "+mergedID, actor); err != nil {
+			s.store.Save(original)
+			s.dropEvent(eventID)
+			return err
+		}
+	}
+	return nil
+}
+
+// sameTrip reports whether a receipt is from the same retailer, purchase date and time and user as
+// the receipts before it. Retailer names are compared ignoring case and surrounding spaces.
+func sameTrip(parts []store.Record, r receipt.Receipt) bool {
+	if len(parts) == 0 {
+		return true
+	}
+	first := parts[0].Receipt
+	return strings.EqualFold(strings.TrimSpace(first.Retailer), strings.TrimSpace(r.Retailer)) &&
+		first.PurchaseDate == r.PurchaseDate && first.PurchaseTime == r.PurchaseTime && first.UserID == r.UserID
+}
+
+// mergeParts combines the parts of a shopping trip into one receipt: their items, in order, and
+// the sum of their totals. The subtotal, discount and tax are summed when every part breaks its
+// total down, and metadata keys set by several parts keep the first part's value.
+func mergeParts(parts []store.Record) (receipt.Receipt, error) {
+	first := parts[0].Receipt
+	merged := receipt.Receipt{
+		Retailer:     first.Retailer,
+		PurchaseDate: first.PurchaseDate,
+		PurchaseTime: first.PurchaseTime,
+		UserID:       first.UserID,
+	}
+	var totals, subtotals, discounts, taxes []string
+	brokenDown := true
+	for _, part := range parts {
+		merged.Items = append(merged.Items, part.Receipt.Items...)
+		totals = append(totals, part.Receipt.Total)
+		subtotals = append(subtotals, part.Receipt.Subtotal)
+		discounts = append(discounts, part.Receipt.Discount)
+		taxes = append(taxes, part.Receipt.Tax)
+		brokenDown = brokenDown && part.Receipt.Subtotal != ""
+		for key, value := range part.Receipt.Metadata {
+			if _, ok := merged.Metadata[key]; !ok {
+				if merged.Metadata == nil {
+					merged.Metadata = make(map[string]string)
+				}
+				merged.Metadata[key] = value
+			}
+		}
+	}
+
+	var err error
+	if merged.Total, err = sumAmounts(totals); err != nil {
+		return receipt.Receipt{}, err
+	}
+	// A breakdown some parts lack can't be added up, so the merged receipt goes without
+	if !brokenDown {
+		return merged, nil
+	}
+	for _, sum := range []struct {
+		field   *string
+		amounts []string
+	}{{&merged.Subtotal, subtotals}, {&merged.Discount, discounts}, {&merged.Tax, taxes}} {
+		if *sum.field, err = sumAmounts(sum.amounts); err != nil {
+			return receipt.Receipt{}, err
+		}
+	}
+	return merged, nil
+}
+
+// sumAmounts adds up amounts such as "12.50", missing ones counting as zero. The sum of only
+// missing amounts is missing too.
+func sumAmounts(amounts []string) (string, error) {
+	sum, found := new(big.Rat), false
+	for _, amount := range amounts {
+		if amount == "" {
+			continue
+		}
+		value, ok := new(big.Rat).SetString(amount)
+		if !ok {
+			return "", fmt.Errorf("amount %q can't be added up", amount)
+		}
+		sum.Add(sum, value)
+		found = true
+	}
+	if !found {
+		return "", nil
+	}
+	return sum.FloatString(2), nil
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"receipt-processor/i18n"
+)
+
+// messageArgs are the functions handlers pass catalog keys to, with the index of the key; the
+// names and values of the message's parameters follow it in those with parameters
+var messageArgs = map[string]int{
+	"sendErrorResponse":    3,
+	"sendValidationErrors": 3,
+	"sendPipelineError":    3,
+	"NewMessage":           0,
+}
+
+// withParams are the functions of messageArgs taking the message's parameters
+var withParams = map[string]bool{"sendErrorResponse": true, "NewMessage": true}
+
+// TestErrorMessagesHaveCatalogKeys checks that every key handlers write a message with is in the
+// i18n catalog, and that they fill in exactly the placeholders of its message. Keys held in
+// variables aren't checked.
+func TestErrorMessagesHaveCatalogKeys(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	checked := 0
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			function := calledName(call)
+			index, ok := messageArgs[function]
+			if !ok || index >= len(call.Args) {
+				return true
+			}
+			key, literal := stringLiteral(call.Args[index])
+			if !literal {
+				return true
+			}
+			checked++
+			position := fset.Position(call.Pos())
+			if !i18n.Has(key) {
+				t.Errorf("%s: %q is not a key of the i18n catalog", position, key)
+				return true
+			}
+			if !withParams[function] {
+				return true
+			}
+			var params []string
+			for i := index + 1; i < len(call.Args); i += 2 {
+				param, literal := stringLiteral(call.Args[i])
+				if !literal {
+					t.Errorf("%s: the parameters of %q must be named with string literals", position, key)
+					return true
+				}
+				params = append(params, param)
+			}
+			want := i18n.Placeholders(key)
+			slices.Sort(params)
+			slices.Sort(want)
+			if !slices.Equal(params, want) {
+				t.Errorf("%s: %q is given the parameters %v, want %v", position, key, params, want)
+			}
+			return true
+		})
+	}
+	if checked == 0 {
+		t.Fatal("found no messages to check")
+	}
+}
+
+// calledName returns the name of the function a call calls, with the package or receiver left out
+func calledName(call *ast.CallExpr) string {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name
+	}
+	return ""
+}
+
+// stringLiteral returns the value of a string literal, and whether expr is one
+func stringLiteral(expr ast.Expr) (string, bool) {
+	literal, ok := expr.(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+	text, err := strconv.Unquote(literal.Value)
+	return text, err == nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("receipts_http_requests_total",
+		"HTTP requests handled, by route, method and status class.", "route", "method", "code")
+	httpDuration = metrics.NewHistogramVec("receipts_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by route.", metrics.DefaultBuckets, "route")
+)
+
+// metricsMiddleware counts every request by its route template, so a route's success ratio is the
+// share of its requests that didn't answer 5xx, and observes its latency with the request ID as an
+// exemplar
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		httpRequests.With(route, r.Method, strconv.Itoa(recorder.status/100)+"xx").Inc()
+		httpDuration.With(route).ObserveWithExemplar(time.Since(start).Seconds(), map[string]string{"request_id": requestID(r)})
+	})
+}
+
+// routeOf labels a request's metrics with the path template of its route, without the API version
+// prefix
+func routeOf(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return auditPath(template)
+		}
+	}
+	return "unmatched"
+}
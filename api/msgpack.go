@@ -0,0 +1,42 @@
+package api
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+
+	"receipt-processor/msgpack"
+)
+
+// msgpackResponseWriter buffers a JSON response and sends it as MessagePack once the handler is
+// done. Responses that aren't JSON, or have no body, are sent as they were written.
+type msgpackResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	buffer     bytes.Buffer
+}
+
+func (mw *msgpackResponseWriter) WriteHeader(statusCode int) {
+	mw.statusCode = statusCode
+}
+
+func (mw *msgpackResponseWriter) Write(p []byte) (int, error) {
+	return mw.buffer.Write(p)
+}
+
+// Close converts the buffered body and sends the response
+func (mw *msgpackResponseWriter) Close() error {
+	body := mw.buffer.Bytes()
+	mediaType, _, _ := mime.ParseMediaType(mw.Header().Get("Content-Type"))
+	if len(body) > 0 && (mediaType == jsonType || strings.HasSuffix(mediaType, "+json")) {
+		if encoded, err := msgpack.FromJSON(body); err == nil {
+			body = encoded
+			mw.Header().Set("Content-Type", msgpackType)
+			mw.Header().Del("Content-Length")
+		}
+	}
+	mw.ResponseWriter.WriteHeader(mw.statusCode)
+	_, err := mw.ResponseWriter.Write(body)
+	return err
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"receipt-processor/receipt"
+	"receipt-processor/validation"
+)
+
+// NormalizationReport is the canonical form of a receipt, what normalizing it changed, and whether
+// the canonical form is valid
+type NormalizationReport struct {
+	Receipt receipt.Receipt         `json:"receipt"`
+	Changes []receipt.Change        `json:"changes"`
+	Valid   bool                    `json:"valid"`
+	Errors  []validation.FieldError `json:"errors"`
+}
+
+// NormalizeReceipt returns the canonical form of a receipt without scoring or storing it, so
+// partners can clean their data before submitting it. Amounts and dates in the caller's locale
+// are converted first, and the retailer is linked to the registry like it is when processing.
+func (s *Server) NormalizeReceipt(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "receipt.invalid")
+		return
+	}
+	submitted, err := receipt.Decode(body)
+	if err != nil {
+		sendValidationErrors(w, r, http.StatusBadRequest, "receipt.invalid", receipt.CheckJSON(body))
+		return
+	}
+	localized, err := receipt.Decode(s.localize(r, body))
+	if err != nil {
+		localized = submitted
+	}
+
+	normalized := receipt.Normalize(localized)
+	if normalized.RetailerID, _, err = s.retailers.Resolve(normalized.Retailer); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "retailer.resolveFailed")
+		return
+	}
+	report := NormalizationReport{
+		Receipt: normalized,
+		Changes: receipt.Changes(submitted, normalized),
+		Errors:  receipt.Check(normalized),
+	}
+	report.Valid = len(report.Errors) == 0
+	if report.Errors == nil {
+		report.Errors = []validation.FieldError{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
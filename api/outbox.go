@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/outbox"
+	"receipt-processor/store"
+)
+
+// ListOutbox returns the events waiting in the outbox to be published, oldest first, with the
+// failed attempts to publish them
+func (s *Server) ListOutbox(w http.ResponseWriter, r *http.Request) {
+	if s.outbox == nil {
+		sendErrorResponse(w, r, http.StatusConflict, "outbox.disabled")
+		return
+	}
+	events, err := s.outbox.PendingEvents(0)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "outbox.listFailed")
+		return
+	}
+
+	sendListResponse(w, r, "events", events)
+}
+
+// ListWebhookDeliveries returns the attempts to post events to a webhook, newest first, with the
+// webhook's answers
+func (s *Server) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if s.relay == nil || !s.relay.HasWebhook() {
+		sendErrorResponse(w, r, http.StatusConflict, "outbox.webhookDisabled")
+		return
+	}
+	if mux.Vars(r)["id"] != outbox.WebhookID {
+		sendErrorResponse(w, r, http.StatusNotFound, "webhook.notFound")
+		return
+	}
+	deliveries, err := s.relay.Deliveries()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "webhook.deliveriesFailed")
+		return
+	}
+
+	sendListResponse(w, r, "deliveries", deliveries)
+}
+
+// RedeliverWebhook posts the event of a delivery to its webhook again and returns the new delivery,
+// whether or not the webhook accepted it
+func (s *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.relay == nil || !s.relay.HasWebhook() {
+		sendErrorResponse(w, r, http.StatusConflict, "outbox.webhookDisabled")
+		return
+	}
+	delivery, err := s.relay.Redeliver(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, store.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "delivery.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadGateway, "delivery.redeliverFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/pdf"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+)
+
+// GetReceiptPDF renders a stored receipt and its points breakdown as a PDF, for support
+// attachments and dispute documentation
+func (s *Server) GetReceiptPDF(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.findReceipt(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	doc := receiptDocument(record, s.engine.Breakdown(record.Receipt))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="receipt-`+record.ID+`.pdf"`)
+	if _, err := doc.WriteTo(w); err != nil {
+		log.Printf("Error writing PDF for receipt %s: %v", record.ID, err)
+	}
+}
+
+// Column positions of the PDF tables, in points from the left margin
+const (
+	pdfQuantityColumn = 330.0
+	pdfPriceColumn    = 410.0
+	pdfRightEdge      = 495.0
+)
+
+// receiptDocument lays out a record: the receipt as submitted, its status, the points breakdown
+// and any changes to the points
+func receiptDocument(record store.Record, breakdown []scoring.RuleResult) *pdf.Document {
+	doc := pdf.New()
+	doc.Line(pdf.Bold, 18, 0, record.Receipt.Retailer)
+	doc.Line(pdf.Regular, 10, 0, "Receipt "+record.ID)
+	doc.Space(8)
+
+	field := func(label, value string) {
+		if value == "" {
+			return
+		}
+		doc.Columns(pdf.Regular, 10, []pdf.Column{{Text: label}, {X: 120, Text: value}})
+	}
+	field("Purchased", record.Receipt.PurchaseDate+" "+record.Receipt.PurchaseTime)
+	field("Submitted", record.CreatedAt.UTC().Format(time.RFC3339))
+	field("User", record.Receipt.UserID)
+	field("Retailer ID", record.Receipt.RetailerID)
+	field("Status", record.Status)
+	if !record.StatusChangedAt.IsZero() {
+		field("Status changed", record.StatusChangedAt.UTC().Format(time.RFC3339))
+	}
+	field("Reviewed by", record.ReviewedBy)
+	if record.Edited {
+		field("Edited", "Corrected by a reviewer before approval")
+	}
+	if record.Flagged {
+		field("Flagged", strings.Join(record.FlagReasons, "; "))
+	}
+
+	doc.Space(12)
+	doc.Columns(pdf.Bold, 10, []pdf.Column{
+		{Text: "Item"},
+		{X: pdfQuantityColumn, Text: "Qty", RightAlign: true},
+		{X: pdfPriceColumn, Text: "Unit price", RightAlign: true},
+		{X: pdfRightEdge, Text: "Price", RightAlign: true},
+	})
+	doc.Rule()
+	for _, item := range record.Receipt.Items {
+		doc.Columns(pdf.Regular, 10, []pdf.Column{
+			{Text: item.ShortDescription},
+			{X: pdfQuantityColumn, Text: item.Quantity, RightAlign: true},
+			{X: pdfPriceColumn, Text: item.UnitPrice, RightAlign: true},
+			{X: pdfRightEdge, Text: item.Price, RightAlign: true},
+		})
+	}
+	doc.Rule()
+	total := func(font pdf.Font, label, value string) {
+		if value == "" {
+			return
+		}
+		doc.Columns(font, 10, []pdf.Column{{X: pdfPriceColumn, Text: label, RightAlign: true}, {X: pdfRightEdge, Text: value, RightAlign: true}})
+	}
+	total(pdf.Regular, "Subtotal", record.Receipt.Subtotal)
+	total(pdf.Regular, "Discount", record.Receipt.Discount)
+	total(pdf.Regular, "Tax", record.Receipt.Tax)
+	total(pdf.Bold, "Total", record.Receipt.Total)
+
+	doc.Space(12)
+	doc.Line(pdf.Bold, 12, 0, "Points")
+	doc.Rule()
+	computed := 0
+	for _, result := range breakdown {
+		if result.Points == 0 {
+			continue
+		}
+		computed += result.Points
+		doc.Columns(pdf.Regular, 10, []pdf.Column{{Text: result.Rule}, {X: pdfRightEdge, Text: fmt.Sprint(result.Points), RightAlign: true}})
+	}
+	doc.Rule()
+	doc.Columns(pdf.Bold, 10, []pdf.Column{{Text: "Points awarded"}, {X: pdfRightEdge, Text: fmt.Sprint(record.Points), RightAlign: true}})
+	// The breakdown isn't stored, so it reflects the current rules; say so when it no longer adds up
+	if computed != record.Points {
+		note := "the receipt was scored under earlier rules"
+		if len(record.History) > 0 {
+			note = "the changes below explain the difference"
+		}
+		doc.Line(pdf.Regular, 8, 0, fmt.Sprintf("The breakdown uses the current rules and totals %d; %s.", computed, note))
+	}
+
+	if len(record.History) > 0 {
+		doc.Space(12)
+		doc.Line(pdf.Bold, 12, 0, "Changes to the points")
+		doc.Rule()
+		for _, change := range record.History {
+			doc.Columns(pdf.Regular, 10, []pdf.Column{
+				{Text: change.Time.UTC().Format(time.RFC3339)},
+				{X: 130, Text: fmt.Sprintf("%d to %d by %s", change.OldPoints, change.NewPoints, change.Actor)},
+			})
+			if change.Reason != "" {
+				doc.Line(pdf.Regular, 9, 130, change.Reason)
+			}
+		}
+	}
+	return doc
+}
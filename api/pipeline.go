@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"receipt-processor/auth"
+	"receipt-processor/fraud"
+	"receipt-processor/metrics"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/problem"
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// boundedReceipts counts the receipts stored with points outside the rule-set's maxPoints and minPoints, for
+// alerting when the cap protecting the points budget is hit
+var boundedReceipts = metrics.NewCounterVec("receipts_points_bounded_total",
+	"Receipts whose points were cut to the rule-set's maxPoints or raised to its minPoints, by bound.", "bound")
+
+// newPipeline wires the server's built-in processing into the stages of a pipeline
+func (s *Server) newPipeline(workers int) *pipeline.Pipeline {
+	return pipeline.New(pipeline.Stages{
+		Decode:   decodeStage,
+		Validate: validateStage,
+		Enrich:   s.enrichStage,
+		Score:    s.scoreStage,
+		Persist:  s.persistStage,
+	}, workers)
+}
+
+// decodeStage decodes the submitted JSON. A body that doesn't decode is reported with the schema
+// problems that explain why.
+func decodeStage(_ context.Context, r *pipeline.Receipt) error {
+	if r.Raw == nil {
+		return nil
+	}
+	decoded, err := receipt.Decode(r.Raw)
+	if err != nil {
+		return &pipeline.Invalid{Errors: receipt.CheckJSON(r.Raw)}
+	}
+	r.Receipt = decoded
+	return nil
+}
+
+// validateStage checks the receipt against the receipt schema, pointing at the submitted JSON when there is one
+func validateStage(_ context.Context, r *pipeline.Receipt) error {
+	problems := receipt.Check(r.Receipt)
+	if r.Raw != nil {
+		problems = receipt.CheckJSON(r.Raw)
+	}
+	if len(problems) > 0 {
+		return &pipeline.Invalid{Errors: problems}
+	}
+	return nil
+}
+
+// enrichStage checks the receipt it is related to exists, links the receipt to its registered
+// retailer and assigns taxonomy categories to the items submitted without one
+func (s *Server) enrichStage(_ context.Context, r *pipeline.Receipt) error {
+	if id := r.Receipt.RelatedReceiptID; id != "" && id != r.Record.Receipt.RelatedReceiptID {
+		related, err := s.store.Get(id)
+		if errors.Is(err, store.ErrNotFound) || err == nil && related.Deleted() {
+			return invalidField("/relatedReceiptId", "field.noReceipt")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	retailerID, _, err := s.retailers.Resolve(r.Receipt.Retailer)
+	if err != nil {
+		return err
+	}
+	r.Receipt.RetailerID = retailerID
+	if s.taxonomy != nil {
+		s.taxonomy.Apply(&r.Receipt)
+	}
+	return nil
+}
+
+// scoreStage scores the receipt, applying the multiplier of its user's loyalty tier and the bonus
+// for their streak. A stored receipt being rescored keeps the streak it was submitted with. Returns
+// only claw back points.
+func (s *Server) scoreStage(_ context.Context, r *pipeline.Receipt) error {
+	if r.Receipt.IsReturn() {
+		return s.scoreReturn(r)
+	}
+	member, err := s.memberOf(r.Receipt.UserID)
+	if err != nil {
+		return err
+	}
+	if r.Record.CreatedAt.IsZero() {
+		r.Record.Streak = member.Streak
+	} else {
+		member.Streak = r.Record.Streak
+	}
+	r.Breakdown = s.engine.BreakdownFor(r.Receipt, member)
+	r.Points = scoring.Total(r.Breakdown)
+	return nil
+}
+
+// persistStage checks the purchase date window and runs the fraud checks, then reserves the day's
+// streak bonus and takes the rule-set's penalty from flagged receipts. It stores the receipt within
+// the user's submission limits, under a new unique ID or the one it was accepted under for
+// background processing.
+func (s *Server) persistStage(ctx context.Context, r *pipeline.Receipt) error {
+	// The returns of a purchase are scored again and stored one at a time, so two can't both claw
+	// back the same points
+	if id := r.Receipt.OriginalReceiptID; r.Receipt.IsReturn() && id != "" {
+		unlock, err := s.receiptLocks.lock(id)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := s.scoreReturn(r); err != nil {
+			return err
+		}
+	}
+
+	if reason := s.window.Inspect(r.Receipt, auth.FromContext(ctx).Name, s.clock.Now()); reason != "" {
+		if s.window.Action == fraud.ActionReject {
+			return &pipeline.Invalid{
+				Errors: []validation.FieldError{{Pointer: "/purchaseDate", Message: reason}},
+				Code:   pipeline.CodePurchaseDate,
+			}
+		}
+		r.Flags = append(r.Flags, reason)
+	}
+
+	reasons, err := s.fraud.Inspect(r.Receipt)
+	if err != nil {
+		return err
+	}
+	if len(reasons) > 0 && s.fraud.Action() == fraud.ActionReject {
+		return &pipeline.Rejection{Reasons: reasons}
+	}
+	r.Flags = append(r.Flags, reasons...)
+	now := s.clock.Now().UTC()
+	if err := s.reserveStreak(r, now); err != nil {
+		return err
+	}
+	if rs := s.engine.RuleSet(); len(r.Flags) > 0 && rs.FlaggedPenalty > 0 {
+		r.Breakdown = scoring.AppendResult(r.Breakdown, scoring.RuleResult{Rule: scoring.FlaggedRule, Points: -rs.FlaggedPenalty}, rs)
+		r.Points = scoring.Total(r.Breakdown)
+	}
+
+	for _, result := range r.Breakdown {
+		if result.Rule == scoring.CapRule || result.Rule == scoring.FloorRule {
+			boundedReceipts.With(result.Rule).Inc()
+		}
+	}
+
+	id := r.Record.ID
+	if id == "" {
+		id = s.ids.NewID()
+	}
+	record := store.Record{
+		ID:              id,
+		Points:          r.Points,
+		CreatedAt:       now,
+		Receipt:         r.Receipt,
+		Streak:          r.Record.Streak,
+		Flagged:         len(r.Flags) > 0,
+		FlagReasons:     r.Flags,
+		Status:          store.StatusPending,
+		StatusChangedAt: now,
+	}
+	// Flagged receipts wait for manual review, the rest may be approved straight away
+	if record.Flagged {
+		record.Status = store.StatusReview
+	} else if s.autoApprove {
+		record.Status = store.StatusApproved
+	}
+	eventID, err := s.saveProcessed(r, record)
+	if err != nil {
+		s.releaseStreak(record)
+		return err
+	}
+
+	// Credit approved points straight away, dropping the receipt if they can't be
+	if record.Status == store.StatusApproved {
+		if err := s.credit(record, earnKind(record), record.Points, "", ""); err != nil {
+			s.store.Delete(record.ID)
+			s.dropEvent(eventID)
+			s.releaseStreak(record)
+			return err
+		}
+		s.approved(record)
+	}
+	s.engine.CountHits(r.Breakdown)
+	r.Record = record
+	return nil
+}
+
+// save stores a record, recording an event of eventType with it in the outbox when events are
+// published, and returns the event's ID
+func (s *Server) save(record store.Record, eventType string) (string, error) {
+	if s.outbox == nil {
+		return "", s.store.Save(record)
+	}
+	event, err := outbox.NewEvent(s.ids.NewID(), s.clock.Now(), eventType, record)
+	if err != nil {
+		return "", err
+	}
+	return event.ID, s.outbox.SaveWithEvent(record, event)
+}
+
+// dropEvent removes the event of a change that was rolled back before it could be published
+func (s *Server) dropEvent(eventID string) {
+	if eventID == "" {
+		return
+	}
+	if err := s.outbox.DeleteEvent(eventID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("dropping outbox event %s: %v", eventID, err)
+	}
+}
+
+// sendPipelineError responds to a receipt the pipeline stopped; failed is the catalog key
+// describing an unexpected error, e.g. "receipt.storeFailed"
+func sendPipelineError(w http.ResponseWriter, r *http.Request, err error, failed string) {
+	var invalid *pipeline.Invalid
+	var rejected *pipeline.Rejection
+	switch {
+	case errors.As(err, &invalid) && invalid.Code == pipeline.CodePurchaseDate:
+		problem.PurchaseDateOutOfRange(invalid.Message(), invalid.Errors).Write(w, r)
+	case errors.As(err, &invalid):
+		problem.Invalid(http.StatusBadRequest, invalid.Message(), invalid.Errors).Write(w, r)
+	case errors.As(err, &rejected) && rejected.Code == pipeline.CodeReceiptLimit:
+		problem.LimitExceeded(http.StatusTooManyRequests, rejected.Message()).Write(w, r)
+	case errors.As(err, &rejected) && rejected.Code == pipeline.CodePointsLimit:
+		problem.LimitExceeded(http.StatusUnprocessableEntity, rejected.Message()).Write(w, r)
+	case errors.As(err, &rejected):
+		problem.FraudRejected(rejected.Message()).Write(w, r)
+	default:
+		sendErrorResponse(w, r, http.StatusInternalServerError, failed)
+	}
+}
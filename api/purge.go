@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"receipt-processor/i18n"
+	"receipt-processor/problem"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// defaultPurgeBatchSize is how many receipts a purge deletes between progress reports
+const defaultPurgeBatchSize = 500
+
+// PurgeRequest selects the receipts to delete. Every criterion that is set must match.
+type PurgeRequest struct {
+	// From and To bound the purchase date, inclusive, e.g. "2022-01-01"
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Retailer matches the submitted retailer name ignoring case, RetailerID the registered retailer
+	Retailer   string `json:"retailer"`
+	RetailerID string `json:"retailerId"`
+	// UserID matches the loyalty user. Receipts record no tenant, so there is no tenant criterion.
+	UserID    string `json:"userId"`
+	BatchSize int    `json:"batchSize"`
+	// DryRun counts the matching receipts without deleting them
+	DryRun bool `json:"dryRun"`
+}
+
+// PurgeProgress reports how far a purge has got
+type PurgeProgress struct {
+	Matched int    `json:"matched"`
+	Deleted int    `json:"deleted"`
+	Done    bool   `json:"done"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (p PurgeRequest) empty() bool {
+	return p.From == "" && p.To == "" && p.Retailer == "" && p.RetailerID == "" && p.UserID == ""
+}
+
+func (p PurgeRequest) matches(record store.Record) bool {
+	r := record.Receipt
+	if p.From != "" && r.PurchaseDate < p.From {
+		return false
+	}
+	if p.To != "" && r.PurchaseDate > p.To {
+		return false
+	}
+	if p.Retailer != "" && !strings.EqualFold(strings.TrimSpace(r.Retailer), strings.TrimSpace(p.Retailer)) {
+		return false
+	}
+	if p.RetailerID != "" && r.RetailerID != p.RetailerID {
+		return false
+	}
+	if p.UserID != "" && r.UserID != p.UserID {
+		return false
+	}
+	return true
+}
+
+// check validates the filter, defaulting the batch size, and returns why it is invalid, the zero
+// message when it is valid
+func (p *PurgeRequest) check() i18n.Message {
+	// Refuse to purge everything by accident
+	if p.empty() {
+		return i18n.NewMessage("purge.noCriteria")
+	}
+	for _, date := range []string{p.From, p.To} {
+		if _, err := time.Parse(validation.DateLayout, date); date != "" && err != nil {
+			return i18n.NewMessage("purge.dates")
+		}
+	}
+	if p.BatchSize < 0 {
+		return i18n.NewMessage("purge.batchSize")
+	}
+	if p.BatchSize == 0 {
+		p.BatchSize = defaultPurgeBatchSize
+	}
+	return i18n.Message{}
+}
+
+// matchPurge lists the IDs of the receipts the filter matches
+func (s *Server) matchPurge(request PurgeRequest) ([]string, error) {
+	records, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, record := range records {
+		if request.matches(record) {
+			matched = append(matched, record.ID)
+		}
+	}
+	return matched, nil
+}
+
+// PurgeReceipts deletes every receipt matching the filter in batches, streaming newline-delimited
+// progress after each batch. User balances are kept, as they are when retention purges receipts.
+func (s *Server) PurgeReceipts(w http.ResponseWriter, r *http.Request) {
+	var request PurgeRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "purge.invalid")
+		return
+	}
+
+	if message := request.check(); message.Key != "" {
+		problem.New(http.StatusBadRequest, message).Write(w, r)
+		return
+	}
+	matched, err := s.matchPurge(request)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	progress := PurgeProgress{Matched: len(matched)}
+	report := func() {
+		encoder.Encode(progress)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if !request.DryRun {
+		for start := 0; start < len(matched); start += request.BatchSize {
+			for _, id := range matched[start:min(start+request.BatchSize, len(matched))] {
+				if err := s.store.Delete(id); err != nil && !errors.Is(err, store.ErrNotFound) {
+					progress.Error = "Unable to delete the receipts; the purge stopped."
+					report()
+					return
+				}
+				progress.Deleted++
+			}
+			report()
+		}
+	}
+	progress.Done = true
+	report()
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"receipt-processor/store"
+)
+
+// readinessTimeout bounds how long the readiness check waits for each database to answer
+const readinessTimeout = 2 * time.Second
+
+// Readiness is the answer of GET /readyz
+type Readiness struct {
+	// Status is ready, or unavailable when the primary database can't be reached
+	Status string `json:"status"`
+	// Pools are the database connection pools, the primary first; empty for the in-memory store
+	Pools []store.Pool `json:"pools"`
+}
+
+// GetReadiness reports whether the server can take traffic, answering 503 while the primary
+// database is out of reach. Unreachable replicas don't make it unready, as reads fall back to the
+// primary.
+func (s *Server) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	readiness := Readiness{Status: "ready", Pools: []store.Pool{}}
+	if checker, ok := s.store.(store.Checker); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if pools := checker.Check(ctx); len(pools) > 0 {
+			readiness.Pools = pools
+			if !pools[0].Reachable {
+				readiness.Status = "unavailable"
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if readiness.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(readiness)
+}
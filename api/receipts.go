@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/i18n"
+	"receipt-processor/pipeline"
+	"receipt-processor/problem"
+	"receipt-processor/receipt"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+func (s *Server) GetPoints(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	receiptID := params["id"]
+
+	// Find the points related to the receipt ID in the store, provide error response if not found
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	// Provide back a response with the points related to the receipt ID
+	sendConditionalResponse(w, r, map[string]int{"points": record.Points})
+}
+
+// PointsBatchRequest lists the receipts whose points to look up
+type PointsBatchRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// GetPointsBatch looks up the points of many receipts at once. The response maps every requested
+// ID to its points, or to null when no receipt has that ID, and lists the IDs not found.
+func (s *Server) GetPointsBatch(w http.ResponseWriter, r *http.Request) {
+	var request PointsBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.IDs) == 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "points.batchEmpty")
+		return
+	}
+	if len(request.IDs) > s.maxBatchSize {
+		sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, "points.batchTooLarge", "max", s.maxBatchSize)
+		return
+	}
+
+	points := make(map[string]*int, len(request.IDs))
+	notFound := []string{}
+	for _, id := range request.IDs {
+		if _, seen := points[id]; seen {
+			continue
+		}
+		record, err := s.store.Get(id)
+		if errors.Is(err, store.ErrNotFound) || err == nil && record.Deleted() {
+			points[id] = nil
+			notFound = append(notFound, id)
+			continue
+		}
+		if err != nil {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.loadFailed")
+			return
+		}
+		points[id] = &record.Points
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"points": points, "notFound": notFound})
+}
+
+func (s *Server) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	receiptID := params["id"]
+
+	// Find the stored receipt, provide error response if not found
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	sendConditionalResponse(w, r, record)
+}
+
+// findReceipt loads a stored receipt that isn't in the trash or cold storage, writing the error
+// response when it can't
+func (s *Server) findReceipt(w http.ResponseWriter, r *http.Request, id string) (store.Record, bool) {
+	record, err := s.store.Get(id)
+	if errors.Is(err, store.ErrNotFound) || err == nil && record.Deleted() {
+		sendErrorResponse(w, r, http.StatusNotFound, "receipt.notFound")
+		return store.Record{}, false
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.loadFailed")
+		return store.Record{}, false
+	}
+	if record.Archived() {
+		problem.Archived(i18n.NewMessage("receipt.archived", "id", id)).Write(w, r)
+		return store.Record{}, false
+	}
+	return record, true
+}
+
+// receiptFilter selects the receipts a listing or count covers
+type receiptFilter struct {
+	flagged *bool
+	status  string
+	// tags must all be on a receipt, and excludeTags must all be off it
+	tags        []string
+	excludeTags []string
+}
+
+// parseReceiptFilter reads the optional flagged, status, tag and excludeTag filters, writing the
+// error response when they are malformed. The tag filters can be repeated.
+func parseReceiptFilter(w http.ResponseWriter, r *http.Request) (receiptFilter, bool) {
+	query := r.URL.Query()
+	filter := receiptFilter{status: query.Get("status"), tags: query["tag"], excludeTags: query["excludeTag"]}
+	for _, tag := range append(slices.Clone(filter.tags), filter.excludeTags...) {
+		if !validation.Tag(tag) {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.tag", "tag", strconv.Quote(tag))
+			return receiptFilter{}, false
+		}
+	}
+	if raw := r.URL.Query().Get("flagged"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.flagged")
+			return receiptFilter{}, false
+		}
+		filter.flagged = &value
+	}
+	return filter, true
+}
+
+// set reports whether any filter was given
+func (f receiptFilter) set() bool {
+	return f.flagged != nil || f.status != "" || len(f.tags) > 0 || len(f.excludeTags) > 0
+}
+
+// matches reports whether a receipt passes the filters; receipts in the trash never do
+func (f receiptFilter) matches(record store.Record) bool {
+	if record.Deleted() || f.flagged != nil && record.Flagged != *f.flagged || f.status != "" && record.Status != f.status {
+		return false
+	}
+	for _, tag := range f.tags {
+		if !record.HasTag(tag) {
+			return false
+		}
+	}
+	for _, tag := range f.excludeTags {
+		if record.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) ListReceipts(w http.ResponseWriter, r *http.Request) {
+	// Parse the optional flagged, status and tag filters, provide error response if malformed
+	filter, ok := parseReceiptFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse the optional sort and order, oldest first by default
+	by := store.Sort{Field: store.SortCreatedAt}
+	if field := r.URL.Query().Get("sort"); field != "" {
+		if !store.ValidSortField(field) {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.sort", "fields", strings.Join(store.SortFields, ", "))
+			return
+		}
+		by.Field = field
+	}
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+	case "desc":
+		by.Descending = true
+	default:
+		sendErrorResponse(w, r, http.StatusBadRequest, "param.order")
+		return
+	}
+
+	// Collect every stored receipt in the requested order
+	records, err := s.store.ListSorted(by)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	matching := records[:0]
+	for _, record := range records {
+		if filter.matches(record) {
+			matching = append(matching, record)
+		}
+	}
+
+	sendListResponse(w, r, "receipts", matching)
+}
+
+// CountReceipts counts the receipts GET /receipts would list with the same filters, so clients
+// can size their pages up front
+func (s *Server) CountReceipts(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseReceiptFilter(w, r)
+	if !ok {
+		return
+	}
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.countFailed")
+		return
+	}
+	count := 0
+	for _, record := range records {
+		if filter.matches(record) {
+			count++
+		}
+	}
+	sendConditionalResponse(w, r, map[string]int{"count": count})
+}
+
+// HeadReceipt checks whether a receipt exists outside the trash, answering 200 or 404 without a body
+func (s *Server) HeadReceipt(w http.ResponseWriter, r *http.Request) {
+	record, err := s.store.Get(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, store.ErrNotFound) || err == nil && record.Deleted():
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) ProcessReceipts(w http.ResponseWriter, r *http.Request) {
+	// Decode, validate, enrich and score the incoming receipt, provide error response if it is invalid
+	incoming, ok := s.readReceipt(w, r)
+	if !ok {
+		return
+	}
+	if s.async != nil {
+		s.acceptReceipt(w, r, incoming)
+		return
+	}
+	if err := s.pipeline.Prepare(r.Context(), incoming); err != nil {
+		sendPipelineError(w, r, err, "receipt.processFailed")
+		return
+	}
+
+	// Answer a retried request with the receipt its first attempt created
+	key, ok := s.reserveIdempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.pipeline.Commit(r.Context(), incoming)
+	if err != nil {
+		if key != "" {
+			s.idempotency.Release(key)
+		}
+		sendPipelineError(w, r, err, "receipt.storeFailed")
+		return
+	}
+	record := incoming.Record
+	if key != "" {
+		if err := s.idempotency.Complete(key, record.ID); err != nil {
+			log.Printf("recording idempotency key for receipt %s: %v", record.ID, err)
+		}
+	}
+	setAuditResource(r, "/receipts/"+record.ID)
+
+	// Provide back a response with the unique ID created for the receipt and a link to it
+	sendReceiptAccepted(w, r, http.StatusCreated, "success", record.ID)
+}
+
+// readReceipt reads the request body for the pipeline to decode
+func (s *Server) readReceipt(w http.ResponseWriter, r *http.Request) (*pipeline.Receipt, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "receipt.invalid")
+		return nil, false
+	}
+	return &pipeline.Receipt{Raw: s.localize(r, body)}, true
+}
+
+// localize converts the amounts and purchase date of a submitted receipt from the formats of the
+// caller's locale, when they have one, to the canonical forms
+func (s *Server) localize(r *http.Request, raw []byte) []byte {
+	format, ok := s.locales[auth.FromContext(r.Context()).Name]
+	if !ok {
+		return raw
+	}
+	return format.Normalize(raw)
+}
+
+// ValidationReport is the outcome of validating a receipt without submitting it. Warnings are
+// data-quality problems that don't stop the receipt from being accepted.
+type ValidationReport struct {
+	Valid    bool                    `json:"valid"`
+	Errors   []validation.FieldError `json:"errors"`
+	Warnings []validation.FieldError `json:"warnings"`
+}
+
+// ValidateReceipt checks a receipt against the schema like ProcessReceipts does, and lints a valid
+// one for data-quality problems, without scoring or storing it
+func (s *Server) ValidateReceipt(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "receipt.invalid")
+		return
+	}
+	body = s.localize(r, body)
+	report := ValidationReport{Errors: receipt.CheckJSON(body), Warnings: []validation.FieldError{}}
+	if len(report.Errors) == 0 {
+		report.Valid = true
+		// The schema passed, so the receipt decodes
+		incoming, _ := receipt.Decode(body)
+		report.Warnings = append(report.Warnings, receipt.Lint(incoming, s.clock.Now().UTC())...)
+	}
+	if report.Errors == nil {
+		report.Errors = []validation.FieldError{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetReceiptSchema serves the JSON Schema receipts are validated against, so clients can
+// validate receipts before submitting them
+func GetReceiptSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(receipt.Schema())
+}
+
+func (s *Server) ScoreReceipt(w http.ResponseWriter, r *http.Request) {
+	// Decode, validate, enrich and score the receipt the same way ProcessReceipts does, without
+	// storing it or assigning an ID
+	incoming, ok := s.readReceipt(w, r)
+	if !ok {
+		return
+	}
+	if err := s.pipeline.Prepare(r.Context(), incoming); err != nil {
+		sendPipelineError(w, r, err, "receipt.scoreFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]interface{}{"points": incoming.Points, "breakdown": incoming.Breakdown})
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.scoreFailed")
+		return
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"receipt-processor/metrics"
+)
+
+var handlerPanics = metrics.NewCounterVec("receipts_http_panics_total", "Handler panics recovered, by route.", "route")
+
+// recoveryMiddleware turns a handler panic into a 500 problem, logging its stack with the request
+// ID, instead of letting net/http drop the connection. A handler that already started its response
+// can't be answered with a problem, so its response is left as it is.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// ErrAbortHandler is how a handler deliberately aborts its response
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			handlerPanics.With(routeOf(r)).Inc()
+			log.Printf("panic request_id=%s method=%s path=%s: %v\n%s", requestID(r), r.Method, r.URL.Path, recovered, debug.Stack())
+			if !recorder.wroteHeader {
+				sendErrorResponse(w, r, http.StatusInternalServerError, "request.unexpected", "requestId", requestID(r))
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
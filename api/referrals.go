@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/ledger"
+	"receipt-processor/referrals"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// reasonReferral is recorded in the ledger entries of referral bonuses
+const reasonReferral = "referral bonus"
+
+// ReferralRequest names the user a user referred
+type ReferralRequest struct {
+	UserID string `json:"userId"`
+}
+
+// CreateReferral records that the user referred another, who must not have earned points yet. Both
+// receive the referral bonus once the referred user's first receipt is approved.
+func (s *Server) CreateReferral(w http.ResponseWriter, r *http.Request) {
+	referrer := mux.Vars(r)["id"]
+	var request ReferralRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "referral.invalid")
+		return
+	}
+	if !validation.UserID(referrer) || !validation.UserID(request.UserID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+	entries, err := s.ledger.Entries(request.UserID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.ledgerFailed")
+		return
+	}
+	for _, entry := range entries {
+		if entry.Kind == ledger.KindEarn {
+			sendErrorResponse(w, r, http.StatusConflict, "referral.alreadyEarned")
+			return
+		}
+	}
+
+	referral, err := s.referrals.Link(referrer, request.UserID)
+	switch {
+	case errors.Is(err, referrals.ErrSelf):
+		sendErrorResponse(w, r, http.StatusBadRequest, "referral.self")
+		return
+	case errors.Is(err, referrals.ErrAlreadyReferred):
+		sendErrorResponse(w, r, http.StatusConflict, "referral.alreadyReferred")
+		return
+	case err != nil:
+		sendErrorResponse(w, r, http.StatusInternalServerError, "referral.recordFailed")
+		return
+	}
+	setAuditResource(r, "/users/"+referrer+"/referrals")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(referral)
+}
+
+// ListReferrals returns the referrals a user made, oldest first
+func (s *Server) ListReferrals(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+	referrals, err := s.referrals.Referrals(userID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.referralsFailed")
+		return
+	}
+	sendListResponse(w, r, "referrals", referrals)
+}
+
+// rewardReferral credits the referral bonus to a referred user and their referrer when the user's
+// first receipt is approved. The receipt is already approved, so failures are only logged, and the
+// bonus is left for the user's next approved receipt.
+func (s *Server) rewardReferral(record store.Record) {
+	userID := record.Receipt.UserID
+	if s.referralBonus <= 0 || userID == "" {
+		return
+	}
+	referral, claimed, err := s.referrals.Claim(userID, record.ID)
+	if err != nil {
+		log.Printf("claiming the referral of user %s: %v", userID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	entries := []ledger.Entry{
+		{UserID: referral.ReferredID, ReceiptID: record.ID, Kind: ledger.KindReferral, Points: s.referralBonus, Reason: reasonReferral},
+		{UserID: referral.ReferrerID, Kind: ledger.KindReferral, Points: s.referralBonus, Reason: reasonReferral},
+	}
+	for i, entry := range entries {
+		if _, err := s.ledger.Append(entry); err != nil {
+			log.Printf("crediting the referral bonus of user %s: %v", entry.UserID, err)
+			// Only release the claim when nobody was credited, or the next receipt would pay twice
+			if i == 0 {
+				if err := s.referrals.Release(userID); err != nil {
+					log.Printf("releasing the referral of user %s: %v", userID, err)
+				}
+			}
+			return
+		}
+	}
+}
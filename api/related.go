@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/receipt"
+	"receipt-processor/store"
+)
+
+// GetRelatedReceipts returns every receipt linked to a receipt, directly or through other linked
+// receipts, nearest first: its returns, corrections and the other parts of a split purchase, and
+// the receipts it refers to itself, and those merged together with it. Each receipt's own links
+// say how it is related.
+func (s *Server) GetRelatedReceipts(w http.ResponseWriter, r *http.Request) {
+	start, ok := s.findReceipt(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+
+	// Links are followed both ways, from the receipt referring to another and back
+	byID := make(map[string]store.Record, len(records))
+	neighbours := make(map[string][]string)
+	for _, record := range records {
+		if record.Deleted() {
+			continue
+		}
+		byID[record.ID] = record
+		links := record.Receipt.Links()
+		if record.MergedInto != "" {
+			links = append(links, receipt.Link{ReceiptID: record.MergedInto})
+		}
+		for _, link := range links {
+			neighbours[record.ID] = append(neighbours[record.ID], link.ReceiptID)
+			neighbours[link.ReceiptID] = append(neighbours[link.ReceiptID], record.ID)
+		}
+	}
+
+	related := []store.Record{}
+	visited := map[string]bool{start.ID: true}
+	for queue := []string{start.ID}; len(queue) > 0; queue = queue[1:] {
+		for _, id := range neighbours[queue[0]] {
+			record, ok := byID[id]
+			if visited[id] || !ok {
+				continue
+			}
+			visited[id] = true
+			related = append(related, record)
+			queue = append(queue, id)
+		}
+	}
+
+	sendListResponse(w, r, "receipts", related)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// requestIDPattern bounds the request IDs accepted from callers, so they stay safe to log and fit
+// in a metric exemplar
+var requestIDPattern = regexp.MustCompile(`^[\w\-.:]{1,64}$`)
+
+type requestIDKey struct{}
+
+// requestIDMiddleware tags every request with the caller's X-Request-ID, or a generated one when it
+// sent none or one that isn't acceptable, and echoes it in the response
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID requestIDMiddleware gave the request, empty outside of it
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"receipt-processor/i18n"
+	"receipt-processor/problem"
+	"receipt-processor/validation"
+)
+
+// sendErrorResponse writes a problem whose detail is the catalog message with the key, its
+// placeholders filled in from args, alternating names and values, e.g.
+// sendErrorResponse(w, r, http.StatusBadRequest, "param.limit", "max", maxLimit)
+func sendErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, key string, args ...interface{}) {
+	problem.New(statusCode, i18n.NewMessage(key, args...)).Write(w, r)
+}
+
+// sendValidationErrors reports why a receipt is invalid, with a JSON Pointer to each offending field
+func sendValidationErrors(w http.ResponseWriter, r *http.Request, statusCode int, key string, problems []validation.FieldError) {
+	problem.Invalid(statusCode, i18n.NewMessage(key), problems).Write(w, r)
+}
+
+// sendConditionalResponse writes body as JSON, projected per the fields parameter, with an ETag
+// derived from its content and the encoding it is sent in, replying 304 Not Modified when the
+// client already holds the current representation
+func sendConditionalResponse(w http.ResponseWriter, r *http.Request, body interface{}) {
+	body, ok := applyProjection(w, r, body, "")
+	if !ok {
+		return
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "request.encodeFailed")
+		return
+	}
+	hash := sha256.Sum256(payload)
+	tag := hex.EncodeToString(hash[:16])
+	// The MessagePack encoding is another representation, so it can't share the JSON one's strong ETag
+	if responseType(r) == msgpackType {
+		tag += "-msgpack"
+	}
+	etag := `"` + tag + `"`
+
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(payload, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag, either as it is or in
+// the form compressionMiddleware gives it
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if strings.HasSuffix(candidate, gzipETagSuffix+`"`) {
+			candidate = strings.TrimSuffix(candidate, gzipETagSuffix+`"`) + `"`
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
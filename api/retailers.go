@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/retailers"
+)
+
+// ListRetailers returns every registered retailer ordered by ID
+func (s *Server) ListRetailers(w http.ResponseWriter, r *http.Request) {
+	list, err := s.retailers.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "retailers.listFailed")
+		return
+	}
+	sendListResponse(w, r, "retailers", list)
+}
+
+// GetRetailer returns a registered retailer with the number of receipts linked to it and their points
+func (s *Server) GetRetailer(w http.ResponseWriter, r *http.Request) {
+	retailer, err := s.retailers.Get(mux.Vars(r)["id"])
+	if errors.Is(err, retailers.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "retailer.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "retailer.loadFailed")
+		return
+	}
+
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	receipts, points := 0, 0
+	for _, record := range records {
+		if record.Receipt.RetailerID == retailer.ID {
+			receipts++
+			points += record.Points
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"retailer": retailer, "receipts": receipts, "points": points})
+}
+
+// CreateRetailer registers a retailer, deriving its ID from the name when none is given
+func (s *Server) CreateRetailer(w http.ResponseWriter, r *http.Request) {
+	var retailer retailers.Retailer
+	if err := json.NewDecoder(r.Body).Decode(&retailer); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "retailer.invalid")
+		return
+	}
+	if retailer.ID == "" {
+		retailer.ID = retailers.Slug(retailer.Name)
+	}
+
+	s.saveRetailer(w, r, retailer, s.retailers.Create, http.StatusCreated)
+}
+
+// UpdateRetailer replaces a registered retailer's name, aliases and categories
+func (s *Server) UpdateRetailer(w http.ResponseWriter, r *http.Request) {
+	var retailer retailers.Retailer
+	if err := json.NewDecoder(r.Body).Decode(&retailer); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "retailer.invalid")
+		return
+	}
+	retailer.ID = mux.Vars(r)["id"]
+
+	s.saveRetailer(w, r, retailer, s.retailers.Update, http.StatusOK)
+}
+
+// saveRetailer applies a registry change and writes the saved retailer as the response
+func (s *Server) saveRetailer(w http.ResponseWriter, r *http.Request, retailer retailers.Retailer, save func(retailers.Retailer) error, status int) {
+	setAuditResource(r, "/admin/retailers/"+retailer.ID)
+	if err := retailer.Validate(); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "retailer.invalidReason", "reason", err)
+		return
+	}
+
+	err := save(retailer)
+	switch {
+	case errors.Is(err, retailers.ErrNotFound):
+		sendErrorResponse(w, r, http.StatusNotFound, "retailer.notFound")
+		return
+	case errors.Is(err, retailers.ErrConflict):
+		sendErrorResponse(w, r, http.StatusConflict, "retailer.conflict")
+		return
+	case err != nil:
+		sendErrorResponse(w, r, http.StatusInternalServerError, "retailer.saveFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(retailer)
+}
+
+// DeleteRetailer removes a retailer from the registry. Receipts already linked to it keep their retailer ID.
+func (s *Server) DeleteRetailer(w http.ResponseWriter, r *http.Request) {
+	err := s.retailers.Delete(mux.Vars(r)["id"])
+	if errors.Is(err, retailers.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "retailer.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "retailer.saveFailed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
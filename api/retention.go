@@ -0,0 +1,23 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (s *Server) SweepRetention(w http.ResponseWriter, r *http.Request) {
+	if s.retention == nil {
+		sendErrorResponse(w, r, http.StatusConflict, "retention.disabled")
+		return
+	}
+
+	// Run a sweep now instead of waiting for the next scheduled one
+	result, err := s.retention.Sweep()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "retention.sweepFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
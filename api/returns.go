@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"receipt-processor/i18n"
+	"receipt-processor/pipeline"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// scoreReturn scores a return by the points it claws back from the purchase it refunds: the share
+// of the purchase's points that the refunded amount is of its total, less what its other returns
+// took. A return without an original receipt, or of a rejected one, claws back nothing. The return
+// is credited to the original receipt's user.
+func (s *Server) scoreReturn(r *pipeline.Receipt) error {
+	clawback := 0
+	if id := r.Receipt.OriginalReceiptID; id != "" {
+		original, err := s.store.Get(id)
+		if errors.Is(err, store.ErrNotFound) || err == nil && original.Deleted() {
+			return invalidField("/originalReceiptId", "field.noReceipt")
+		}
+		if err != nil {
+			return err
+		}
+		if original.Receipt.IsReturn() {
+			return invalidField("/originalReceiptId", "field.returnOfReturn")
+		}
+		switch userID := r.Receipt.UserID; {
+		case userID == "":
+			r.Receipt.UserID = original.Receipt.UserID
+		case userID != original.Receipt.UserID:
+			return invalidField("/userId", "field.returnUser")
+		}
+
+		if original.Status != store.StatusRejected {
+			taken, err := s.clawedBack(original.ID, r.Record.ID)
+			if err != nil {
+				return err
+			}
+			clawback = min(refundShare(original, r.Receipt.Total), max(original.Points-taken, 0))
+		}
+	}
+	r.Breakdown = []scoring.RuleResult{{Rule: scoring.ClawbackRule, Points: -clawback}}
+	r.Points = -clawback
+	return nil
+}
+
+// clawedBack returns the points the returns of a receipt have taken back, leaving out the return
+// being rescored, if any
+func (s *Server) clawedBack(originalID, exceptID string) (int, error) {
+	records, err := s.store.List()
+	if err != nil {
+		return 0, err
+	}
+	taken := 0
+	for _, record := range records {
+		if record.Receipt.OriginalReceiptID == originalID && record.ID != exceptID &&
+			!record.Deleted() && record.Status != store.StatusRejected {
+			taken -= record.Points
+		}
+	}
+	return taken, nil
+}
+
+// refundShare returns the points of the original receipt the refunded amount is worth, rounded
+// down; refunds of its whole total or more are worth all of them
+func refundShare(original store.Record, refunded string) int {
+	refund, ok := new(big.Rat).SetString(strings.TrimPrefix(refunded, "-"))
+	total, valid := new(big.Rat).SetString(original.Receipt.Total)
+	if !ok || !valid || total.Sign() <= 0 || refund.Cmp(total) >= 0 {
+		return original.Points
+	}
+	share := new(big.Rat).Mul(big.NewRat(int64(original.Points), 1), refund)
+	share.Quo(share, total)
+	return int(new(big.Int).Quo(share.Num(), share.Denom()).Int64())
+}
+
+// invalidField rejects a receipt whose field at pointer refers to a receipt it can't, for the reason
+// with the catalog key
+func invalidField(pointer, key string) error {
+	message := i18n.NewMessage(key).Text(i18n.Languages[0])
+	return &pipeline.Invalid{Errors: []validation.FieldError{{Pointer: pointer, Message: message, MessageKey: key}}}
+}
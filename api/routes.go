@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/metrics"
+)
+
+// apiVersion describes the routes served under a /{name}/ path prefix
+type apiVersion struct {
+	name   string
+	routes func(s *Server, r *mux.Router)
+}
+
+// apiVersions lists every supported API version. A breaking change ships as a new
+// entry whose routes reuse the previous version's handlers where nothing changed.
+var apiVersions = []apiVersion{
+	{name: "v1", routes: (*Server).v1Routes},
+}
+
+// legacyVersion is served at the unprefixed paths so existing clients keep working
+const legacyVersion = "v1"
+
+func (s *Server) v1Routes(r *mux.Router) {
+	r.HandleFunc("/receipts", s.ListReceipts).Methods("GET")
+	r.HandleFunc("/receipts/count", s.CountReceipts).Methods("GET")
+	r.HandleFunc("/receipts/search", s.SearchReceipts).Methods("GET")
+	r.HandleFunc("/receipts/trash", s.requireAdmin(s.ListTrash)).Methods("GET")
+	r.HandleFunc("/receipts/export", s.requireAdmin(s.ExportReceipts)).Methods("GET")
+	r.HandleFunc("/receipts/{id}", s.GetReceipt).Methods("GET")
+	r.HandleFunc("/receipts/{id}", s.HeadReceipt).Methods("HEAD")
+	r.HandleFunc("/receipts/{id}", s.requireAdmin(s.DeleteReceipt)).Methods("DELETE")
+	r.HandleFunc("/receipts/{id}/restore", s.requireAdmin(s.RestoreReceipt)).Methods("POST")
+	r.HandleFunc("/receipts/{id}/rehydrate", s.RehydrateReceipt).Methods("POST")
+	r.HandleFunc("/receipts/{id}/points", s.GetPoints).Methods("GET")
+	r.HandleFunc("/receipts/points/batch", s.GetPointsBatch).Methods("POST")
+	r.HandleFunc("/receipts/{id}/pdf", s.GetReceiptPDF).Methods("GET")
+	r.HandleFunc("/receipts/process", s.requireSignature(s.ProcessReceipts)).Methods("POST")
+	r.HandleFunc("/receipts/batch", s.requireSignature(s.ProcessBatch)).Methods("POST")
+	r.HandleFunc("/receipts/stream", s.requireSignature(s.ProcessStream)).Methods("POST")
+	r.HandleFunc("/receipts/merge", s.requireSignature(s.MergeReceipts)).Methods("POST")
+	r.HandleFunc("/receipts/score", s.ScoreReceipt).Methods("POST")
+	r.HandleFunc("/receipts/validate", s.ValidateReceipt).Methods("POST")
+	r.HandleFunc("/receipts/normalize", s.NormalizeReceipt).Methods("POST")
+	r.HandleFunc("/schema/receipt.json", GetReceiptSchema).Methods("GET")
+	r.HandleFunc("/receipts/{id}/history", s.GetReceiptHistory).Methods("GET")
+	r.HandleFunc("/receipts/{id}/related", s.GetRelatedReceipts).Methods("GET")
+	r.HandleFunc("/receipts/{id}/tags", s.requireAdmin(s.TagReceipt)).Methods("POST")
+	r.HandleFunc("/receipts/{id}/reprocess", s.requireAdmin(s.ReprocessReceipt)).Methods("POST")
+	r.HandleFunc("/receipts/{id}/adjust", s.requireAdmin(s.AdjustReceipt)).Methods("POST")
+	r.HandleFunc("/receipts/{id}/approve", s.requireAdmin(s.ApproveReceipt)).Methods("POST")
+	r.HandleFunc("/receipts/{id}/reject", s.requireAdmin(s.RejectReceipt)).Methods("POST")
+	r.HandleFunc("/users/{id}/points", s.GetUserPoints).Methods("GET")
+	r.HandleFunc("/users/{id}/ledger", s.GetUserLedger).Methods("GET")
+	r.HandleFunc("/users/{id}/limits", s.GetUserLimits).Methods("GET")
+	r.HandleFunc("/users/{id}/tier", s.GetUserTier).Methods("GET")
+	r.HandleFunc("/users/{id}/streak", s.GetUserStreak).Methods("GET")
+	r.HandleFunc("/users/{id}/referrals", s.ListReferrals).Methods("GET")
+	r.HandleFunc("/users/{id}/referrals", s.requireAdmin(s.CreateReferral)).Methods("POST")
+	r.HandleFunc("/receipts/{id}/data", s.requireAdmin(s.EraseReceiptData)).Methods("DELETE")
+	r.HandleFunc("/users/{id}/data", s.requireAdmin(s.EraseUserData)).Methods("DELETE")
+	r.HandleFunc("/admin/audit", s.requireAdmin(s.ListAudit)).Methods("GET")
+	r.HandleFunc("/admin/body-log", s.requireAdmin(s.GetBodyLog)).Methods("GET")
+	r.HandleFunc("/admin/body-log", s.requireAdmin(s.UpdateBodyLog)).Methods("PUT")
+	r.HandleFunc("/admin/review-queue", s.requireAdmin(s.ListReviewQueue)).Methods("GET")
+	r.HandleFunc("/admin/review-queue/{id}/approve", s.requireAdmin(s.ApproveReceipt)).Methods("POST")
+	r.HandleFunc("/admin/review-queue/{id}/reject", s.requireAdmin(s.RejectReceipt)).Methods("POST")
+	r.HandleFunc("/admin/review-queue/{id}/edit", s.requireAdmin(s.EditAndApproveReceipt)).Methods("POST")
+	r.HandleFunc("/admin/retailers", s.requireAdmin(s.ListRetailers)).Methods("GET")
+	r.HandleFunc("/admin/retailers", s.requireAdmin(s.CreateRetailer)).Methods("POST")
+	r.HandleFunc("/admin/retailers/{id}", s.requireAdmin(s.GetRetailer)).Methods("GET")
+	r.HandleFunc("/admin/retailers/{id}", s.requireAdmin(s.UpdateRetailer)).Methods("PUT")
+	r.HandleFunc("/admin/retailers/{id}", s.requireAdmin(s.DeleteRetailer)).Methods("DELETE")
+	r.HandleFunc("/jobs", s.requireAdmin(s.ListJobs)).Methods("GET")
+	r.HandleFunc("/jobs", s.requireAdmin(s.SubmitJob)).Methods("POST")
+	r.HandleFunc("/jobs/{id}", s.requireAdmin(s.GetJob)).Methods("GET")
+	r.HandleFunc("/jobs/{id}/cancel", s.requireAdmin(s.CancelJob)).Methods("POST")
+	r.HandleFunc("/admin/dlq", s.requireAdmin(s.ListDeadLetters)).Methods("GET")
+	r.HandleFunc("/admin/outbox", s.requireAdmin(s.ListOutbox)).Methods("GET")
+	r.HandleFunc("/webhooks/{id}/deliveries", s.requireAdmin(s.ListWebhookDeliveries)).Methods("GET")
+	r.HandleFunc("/deliveries/{id}/redeliver", s.requireAdmin(s.RedeliverWebhook)).Methods("POST")
+	r.HandleFunc("/admin/store/stats", s.requireAdmin(s.GetStoreStats)).Methods("GET")
+	r.HandleFunc("/admin/dlq/{id}/retry", s.requireAdmin(s.RetryDeadLetter)).Methods("POST")
+	r.HandleFunc("/admin/erasures", s.requireAdmin(s.ListErasures)).Methods("GET")
+	r.HandleFunc("/admin/rules", s.requireAdmin(s.ListRules)).Methods("GET")
+	r.HandleFunc("/admin/rules", s.requireAdmin(s.UpdateRules)).Methods("PATCH")
+	r.HandleFunc("/admin/rules/simulate", s.requireAdmin(s.SimulateRules)).Methods("POST")
+	r.HandleFunc("/admin/snapshot", s.requireAdmin(s.CreateSnapshot)).Methods("POST")
+	r.HandleFunc("/admin/restore", s.requireAdmin(s.RestoreSnapshot)).Methods("POST")
+	r.HandleFunc("/admin/receipts/purge", s.requireAdmin(s.PurgeReceipts)).Methods("POST")
+	r.HandleFunc("/admin/retention/sweep", s.requireAdmin(s.SweepRetention)).Methods("POST")
+}
+
+// newRouter builds the router with every API version mounted under its prefix
+// and the legacy version aliased at the root
+func (s *Server) newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware, metricsMiddleware, s.faultMiddleware, compressionMiddleware, s.bodyLog.Middleware, s.auth.Middleware, s.auditMiddleware, recoveryMiddleware)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+	r.HandleFunc("/readyz", s.GetReadiness).Methods("GET")
+	r.HandleFunc("/version", s.GetVersion).Methods("GET")
+	s.uiRoutes(r)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, r, http.StatusNotFound, "request.routeNotFound")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, r, http.StatusMethodNotAllowed, "request.methodNotAllowed")
+	})
+
+	for _, version := range apiVersions {
+		sub := r.PathPrefix("/" + version.name).Subrouter()
+		sub.Use(versionHeaderMiddleware(version.name), mediaTypeMiddleware)
+		version.routes(s, sub)
+
+		if version.name == legacyVersion {
+			legacy := r.NewRoute().Subrouter()
+			legacy.Use(versionHeaderMiddleware(version.name), mediaTypeMiddleware)
+			version.routes(s, legacy)
+		}
+	}
+	return r
+}
+
+// versionHeaderMiddleware reports the API version that served the request
+func versionHeaderMiddleware(version string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("API-Version", version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
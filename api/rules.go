@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+)
+
+// SimulationRequest carries a candidate rule-set and an optional sample of receipts to replay it against
+type SimulationRequest struct {
+	RuleSet  *scoring.RuleSet  `json:"ruleSet"`
+	Receipts []receipt.Receipt `json:"receipts,omitempty"`
+}
+
+// RuleDifference compares the points a rule awards under the active and candidate rule-sets
+type RuleDifference struct {
+	Rule            string `json:"rule"`
+	CurrentPoints   int    `json:"currentPoints"`
+	SimulatedPoints int    `json:"simulatedPoints"`
+	Difference      int    `json:"difference"`
+}
+
+func (s *Server) SimulateRules(w http.ResponseWriter, r *http.Request) {
+	// Start from the active rule-set so omitted fields keep their current values
+	active := s.engine.RuleSet()
+	// Decoding reuses the copy's maps and slices, so detach them from the active rule-set first
+	candidate := active.Clone()
+	request := SimulationRequest{RuleSet: &candidate}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RuleSet == nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "rules.invalid")
+		return
+	}
+	if err := candidate.Validate(); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "rules.invalidReason", "reason", err)
+		return
+	}
+
+	// Replay the uploaded sample, or every stored receipt when no sample is provided
+	receipts := request.Receipts
+	if len(receipts) == 0 {
+		records, err := s.store.List()
+		if err != nil {
+			sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+			return
+		}
+		for _, record := range records {
+			receipts = append(receipts, record.Receipt)
+		}
+	}
+	for _, incomingReceipt := range receipts {
+		if !receipt.Validate(incomingReceipt) {
+			sendErrorResponse(w, r, http.StatusBadRequest, "receipt.invalid")
+			return
+		}
+	}
+
+	// Priorities can order the breakdowns differently, so rules are matched by name
+	names := scoring.RuleNames()
+	differences := make([]RuleDifference, len(names))
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		differences[i].Rule = name
+		index[name] = i
+	}
+	currentTotal, simulatedTotal := 0, 0
+	for _, incomingReceipt := range receipts {
+		current := scoring.Breakdown(incomingReceipt, active)
+		simulated := scoring.Breakdown(incomingReceipt, candidate)
+		for _, result := range current {
+			differences[index[result.Rule]].CurrentPoints += result.Points
+		}
+		for _, result := range simulated {
+			differences[index[result.Rule]].SimulatedPoints += result.Points
+		}
+		currentTotal += boundedTotal(current, active)
+		simulatedTotal += boundedTotal(simulated, candidate)
+	}
+	for i := range differences {
+		differences[i].Difference = differences[i].SimulatedPoints - differences[i].CurrentPoints
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"receipts":        len(receipts),
+		"currentPoints":   currentTotal,
+		"simulatedPoints": simulatedTotal,
+		"difference":      simulatedTotal - currentTotal,
+		"rules":           differences,
+	})
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "rules.simulateFailed")
+		return
+	}
+}
+
+// boundedTotal sums the points in a breakdown within the rule-set's maxPoints and minPoints
+func boundedTotal(breakdown []scoring.RuleResult, rs scoring.RuleSet) int {
+	total := scoring.Total(breakdown)
+	if bound, ok := scoring.Bound(total, rs); ok {
+		total += bound.Points
+	}
+	return total
+}
+
+// ListRules returns every scoring rule with whether it is enabled and the number of receipts it
+// awarded points to
+func (s *Server) ListRules(w http.ResponseWriter, r *http.Request) {
+	sendListResponse(w, r, "rules", s.engine.Rules())
+}
+
+// UpdateRules switches rules on or off until the server restarts, e.g. {"retailer": false}. A null
+// hands the rule back to the rule-set. Rule-set reloads keep the switches.
+func (s *Server) UpdateRules(w http.ResponseWriter, r *http.Request) {
+	var switches map[string]*bool
+	if err := json.NewDecoder(r.Body).Decode(&switches); err != nil || len(switches) == 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "rules.switchesInvalid")
+		return
+	}
+	for name := range switches {
+		if !scoring.IsRule(name) {
+			sendErrorResponse(w, r, http.StatusBadRequest, "rules.unknown", "rule", strconv.Quote(name))
+			return
+		}
+	}
+	for name, enabled := range switches {
+		s.engine.SetEnabled(name, enabled)
+		switch {
+		case enabled == nil:
+			log.Printf("rule %s handed back to the rule-set", name)
+		case *enabled:
+			log.Printf("rule %s switched on", name)
+		default:
+			log.Printf("rule %s switched off", name)
+		}
+	}
+	sendListResponse(w, r, "rules", s.engine.Rules())
+}
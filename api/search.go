@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"receipt-processor/store"
+)
+
+// Search result limits
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// SearchResult is a receipt matching a search, with the text that matched
+type SearchResult struct {
+	Receipt    store.Record `json:"receipt"`
+	Highlights []Highlight  `json:"highlights"`
+}
+
+// Highlight is a matching field of a receipt, located by JSON Pointer, with the matched words
+// wrapped in <em> tags and the rest of the text HTML-escaped
+type Highlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchReceipts finds receipts by the words of their retailer name and item descriptions, narrowed
+// by the same filters as GET /receipts
+func (s *Server) SearchReceipts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if len(store.Tokenize(query)) == 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "param.q")
+		return
+	}
+	p, ok := parsePage(w, r, defaultSearchLimit, maxSearchLimit)
+	if !ok {
+		return
+	}
+	filter, ok := parseReceiptFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// Matches up to the end of the page, and one more to tell whether there is a next page. The
+	// store can only apply that limit when no filter drops any of its matches.
+	limit := p.offset + p.limit + 1
+	storeLimit := limit
+	if filter.set() {
+		storeLimit = 0
+	}
+	records, err := s.store.Search(query, storeLimit)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.searchFailed")
+		return
+	}
+	matching := records[:0]
+	for _, record := range records {
+		if filter.matches(record) && len(matching) < limit {
+			matching = append(matching, record)
+		}
+	}
+	records = matching
+	words := make(map[string]bool)
+	for _, word := range store.Tokenize(query) {
+		words[word] = true
+	}
+	start, end := p.bounds(len(records))
+	results := make([]SearchResult, len(records))
+	for i, record := range records[start:end] {
+		result := SearchResult{Receipt: record, Highlights: []Highlight{}}
+		if snippet, ok := highlight(record.Receipt.Retailer, words); ok {
+			result.Highlights = append(result.Highlights, Highlight{Field: "/retailer", Snippet: snippet})
+		}
+		for i, item := range record.Receipt.Items {
+			if snippet, ok := highlight(item.ShortDescription, words); ok {
+				result.Highlights = append(result.Highlights, Highlight{Field: fmt.Sprintf("/items/%d/shortDescription", i), Snippet: snippet})
+			}
+		}
+		results[start+i] = result
+	}
+	sendPage(w, r, "results", results, p)
+}
+
+// highlight wraps the words of text that are searched for in <em> tags, reporting whether any were
+func highlight(text string, words map[string]bool) (string, bool) {
+	var b strings.Builder
+	matched := false
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && isWord(runes[end]) == isWord(runes[start]) {
+			end++
+		}
+		part := string(runes[start:end])
+		if isWord(runes[start]) && words[strings.ToLower(part)] {
+			b.WriteString("<em>" + html.EscapeString(part) + "</em>")
+			matched = true
+		} else {
+			b.WriteString(html.EscapeString(part))
+		}
+		start = end
+	}
+	return b.String(), matched
+}
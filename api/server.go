@@ -0,0 +1,307 @@
+// Package api implements the HTTP handlers and routing for the receipt processor.
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"receipt-processor/accesslog"
+	"receipt-processor/audit"
+	"receipt-processor/auth"
+	"receipt-processor/blob"
+	"receipt-processor/bodylog"
+	"receipt-processor/clock"
+	"receipt-processor/coldstorage"
+	"receipt-processor/deadletter"
+	"receipt-processor/erasure"
+	"receipt-processor/faults"
+	"receipt-processor/fraud"
+	"receipt-processor/idempotency"
+	"receipt-processor/ids"
+	"receipt-processor/jobs"
+	"receipt-processor/ledger"
+	"receipt-processor/limits"
+	"receipt-processor/locale"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/referrals"
+	"receipt-processor/retailers"
+	"receipt-processor/retention"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+	"receipt-processor/streaks"
+	"receipt-processor/taxonomy"
+	"receipt-processor/tiers"
+)
+
+// Options configures a Server. Zero values fall back to an in-memory store and the default rule-set.
+type Options struct {
+	Store  store.Store
+	Engine *scoring.Engine
+	// ScoringWorkers bounds concurrent scoring for the batch and stream endpoints, one per CPU by default
+	ScoringWorkers int
+	// Hooks extend the stages receipts are processed through, e.g. extra enrichment or notifications
+	Hooks []pipeline.Hook
+	// AsyncQueueSize, when set, makes POST /receipts/process answer 202 once a receipt passes schema
+	// validation and process it in the background, holding at most this many receipts waiting
+	AsyncQueueSize int
+	// AsyncMaxAttempts is how many times a receipt is processed in the background before it is
+	// dead-lettered, 3 by default
+	AsyncMaxAttempts int
+	// DeadLetters keeps the receipts background processing gave up on, an in-memory queue by default
+	DeadLetters deadletter.Store
+	// Jobs runs long operations submitted to POST /jobs, an in-memory manager by default
+	Jobs *jobs.Manager
+	// MaxBatchSize is the largest batch accepted by POST /receipts/batch, 10000 by default
+	MaxBatchSize int
+	// Snapshots is where POST /admin/snapshot writes and POST /admin/restore reads snapshots, the
+	// "snapshots" directory by default
+	Snapshots blob.Store
+	// Retention runs on-demand sweeps for POST /admin/retention/sweep; nil when retention is disabled
+	Retention *retention.Sweeper
+	// ColdStorage rehydrates archived receipts and runs archive jobs; nil when cold storage is disabled
+	ColdStorage *coldstorage.Archiver
+	// Erasures records right-to-be-forgotten deletions, an in-memory log by default
+	Erasures *erasure.Log
+	// Audit records every mutating request, an in-memory log by default
+	Audit audit.Store
+	// AccessLog logs every request in the combined log format; nil logs none
+	AccessLog *accesslog.Logger
+	// Auth identifies callers by API key; without keys every caller is anonymous and admin endpoints are open
+	Auth *auth.Authenticator
+	// Ledger records the points credited to and debited from user balances, an in-memory ledger by default
+	Ledger ledger.Book
+	// BodyLog logs a sample of request and response bodies; nil starts with body logging disabled
+	BodyLog *bodylog.Logger
+	// IDs generates receipt IDs, random UUIDs by default
+	IDs ids.Generator
+	// Idempotency remembers the receipt created for each Idempotency-Key, in memory for a day by default
+	Idempotency idempotency.Keys
+	// Retailers links receipts to known retailers, an empty in-memory registry by default
+	Retailers retailers.Store
+	// Taxonomy assigns categories to items submitted without one; nil leaves them uncategorized
+	Taxonomy *taxonomy.Taxonomy
+	// Fraud inspects receipts before they are stored; nil skips fraud checks
+	Fraud *fraud.Detector
+	// PurchaseWindow flags or rejects receipts purchased in the future or too long ago; the zero
+	// value accepts any purchase date
+	PurchaseWindow fraud.PurchaseWindow
+	// Locales are the number and date formats of the receipts submitted by the API key names they
+	// are listed under, converted to the canonical forms before validation
+	Locales map[string]locale.Format
+	// Limits caps the receipts and points each user can submit per day and week; the zero value is
+	// unlimited. The store enforces them, so it must implement store.Quotas, as every built-in store does.
+	Limits limits.Limits
+	// Referrals links users to the users who referred them, an in-memory registry by default
+	Referrals referrals.Store
+	// ReferralBonus is credited to a referred user and their referrer when the referred user's first
+	// receipt is approved; 0 disables referral bonuses
+	ReferralBonus int
+	// Outbox, when set, records an event in the same transaction as every change to a receipt, for
+	// the outbox relay to publish; nil records none
+	Outbox store.Outbox
+	// Locks, when set, locks receipts across every instance sharing the store, e.g. the Postgres
+	// store; nil locks them within this process
+	Locks store.Locks
+	// Relay, when set, lists and replays the deliveries of outbox events to the webhook
+	Relay *outbox.Relay
+	// Streaks tracks each user's consecutive days with an approved receipt, an in-memory registry by default
+	Streaks streaks.Store
+	// ExcludedTags leaves the receipts carrying any of these tags out of the stats page
+	ExcludedTags []string
+	// Tiers ranks users into loyalty tiers by their balance, tiers.DefaultThresholds by default
+	Tiers tiers.Tiers
+	// AutoApprove approves receipts that weren't flagged as soon as they are processed; otherwise
+	// every receipt waits for POST /receipts/{id}/approve
+	AutoApprove bool
+	// SigningSecret, when set, requires ingest requests to carry an X-Signature HMAC of their body
+	SigningSecret string
+	// ReplayWindow, when set with SigningSecret, rejects signed requests whose X-Timestamp is further
+	// than this from now or whose X-Nonce was already used
+	ReplayWindow time.Duration
+	// Nonces remembers the nonces of signed requests, in memory for twice the replay window by default
+	Nonces auth.Nonces
+	// Features names the optional features the server was started with, for GET /version
+	Features []string
+	// Clock tells the time receipts are created, reviewed and changed at, the system clock by default
+	Clock clock.Clock
+	// Faults injects latency, errors and dropped responses into requests for testing; nil injects none
+	Faults *faults.Injector
+}
+
+// Server serves the receipt processor API
+type Server struct {
+	store         store.Store
+	engine        *scoring.Engine
+	pipeline      *pipeline.Pipeline
+	async         chan asyncJob
+	asyncAttempts int
+	deadLetters   deadletter.Store
+	jobs          *jobs.Manager
+	maxBatchSize  int
+	snapshots     blob.Store
+	retention     *retention.Sweeper
+	coldStorage   *coldstorage.Archiver
+	erasures      *erasure.Log
+	audit         audit.Store
+	auth          *auth.Authenticator
+	ledger        ledger.Book
+	bodyLog       *bodylog.Logger
+	faults        *faults.Injector
+	clock         clock.Clock
+	ids           ids.Generator
+	idempotency   idempotency.Keys
+	retailers     retailers.Store
+	taxonomy      *taxonomy.Taxonomy
+	fraud         *fraud.Detector
+	window        fraud.PurchaseWindow
+	locales       map[string]locale.Format
+	userLimits    limits.Limits
+	tiers         tiers.Tiers
+	referrals     referrals.Store
+	referralBonus int
+	streaks       streaks.Store
+	outbox        store.Outbox
+	relay         *outbox.Relay
+	excludedTags  []string
+	// receiptLocks serializes the changes to each receipt
+	receiptLocks  receiptLocks
+	autoApprove   bool
+	signingSecret string
+	replayWindow  time.Duration
+	nonces        auth.Nonces
+	features      []string
+	router        http.Handler
+}
+
+func New(opts Options) *Server {
+	s := &Server{
+		store:         opts.Store,
+		engine:        opts.Engine,
+		asyncAttempts: opts.AsyncMaxAttempts,
+		deadLetters:   opts.DeadLetters,
+		jobs:          opts.Jobs,
+		maxBatchSize:  opts.MaxBatchSize,
+		snapshots:     opts.Snapshots,
+		retention:     opts.Retention,
+		coldStorage:   opts.ColdStorage,
+		erasures:      opts.Erasures,
+		audit:         opts.Audit,
+		auth:          opts.Auth,
+		ledger:        opts.Ledger,
+		bodyLog:       opts.BodyLog,
+		faults:        opts.Faults,
+		clock:         opts.Clock,
+		ids:           opts.IDs,
+		idempotency:   opts.Idempotency,
+		retailers:     opts.Retailers,
+		taxonomy:      opts.Taxonomy,
+		fraud:         opts.Fraud,
+		window:        opts.PurchaseWindow,
+		locales:       opts.Locales,
+		userLimits:    opts.Limits,
+		tiers:         opts.Tiers,
+		referrals:     opts.Referrals,
+		referralBonus: opts.ReferralBonus,
+		streaks:       opts.Streaks,
+		outbox:        opts.Outbox,
+		receiptLocks:  receiptLocks{shared: opts.Locks},
+		relay:         opts.Relay,
+		excludedTags:  opts.ExcludedTags,
+		autoApprove:   opts.AutoApprove,
+		signingSecret: opts.SigningSecret,
+		replayWindow:  opts.ReplayWindow,
+		nonces:        opts.Nonces,
+		features:      opts.Features,
+	}
+	if s.clock == nil {
+		s.clock = clock.System{}
+	}
+	if s.ids == nil {
+		s.ids, _ = ids.New(ids.UUIDv4, 0)
+	}
+	if s.store == nil {
+		s.store = store.NewMemory(store.MemoryOptions{Clock: s.clock})
+	}
+	if s.engine == nil {
+		s.engine = scoring.NewEngine(scoring.DefaultRuleSet)
+	}
+	if s.features == nil {
+		s.features = []string{}
+	}
+	workers := opts.ScoringWorkers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	s.pipeline = s.newPipeline(workers)
+	s.pipeline.Register(opts.Hooks...)
+	if s.asyncAttempts < 1 {
+		s.asyncAttempts = 3
+	}
+	if s.deadLetters == nil {
+		s.deadLetters, _ = deadletter.Open("")
+	}
+	if opts.AsyncQueueSize > 0 {
+		s.startAsync(workers, opts.AsyncQueueSize)
+	}
+	if s.maxBatchSize < 1 {
+		s.maxBatchSize = 10000
+	}
+	if s.jobs == nil {
+		s.jobs, _ = jobs.Open(jobs.Options{Clock: s.clock, IDs: s.ids})
+	}
+	if s.erasures == nil {
+		s.erasures, _ = erasure.Open("", s.clock)
+	}
+	if s.audit == nil {
+		s.audit, _ = audit.Open("")
+	}
+	if s.ledger == nil {
+		s.ledger, _ = ledger.Open("", s.clock)
+	}
+	if s.bodyLog == nil {
+		s.bodyLog = bodylog.New(bodylog.Settings{}, nil)
+	}
+	if s.idempotency == nil {
+		s.idempotency = idempotency.NewMemory(24 * time.Hour)
+	}
+	if s.retailers == nil {
+		s.retailers, _ = retailers.Open("")
+	}
+	if s.referrals == nil {
+		s.referrals, _ = referrals.Open("", s.clock)
+	}
+	if s.streaks == nil {
+		s.streaks, _ = streaks.Open("")
+	}
+	if s.tiers == nil {
+		s.tiers = tiers.New(tiers.DefaultThresholds)
+	}
+	if s.fraud == nil {
+		s.fraud = fraud.NewDetector(fraud.ActionOff)
+	}
+	if s.auth == nil {
+		s.auth = auth.New(nil)
+	}
+	// A nonce only needs remembering until its timestamp leaves the window, up to twice the window away
+	if s.nonces == nil {
+		s.nonces = auth.NewNonceCache(2 * s.replayWindow)
+	}
+	if s.snapshots == nil {
+		s.snapshots = blob.NewDir("snapshots")
+	}
+	s.router = s.newRouter()
+	if opts.AccessLog != nil {
+		s.router = opts.AccessLog.Middleware(s.router)
+	}
+	// Resume the jobs a restart interrupted once every kind has its runner
+	s.registerJobs()
+	go s.jobs.Run(context.Background())
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
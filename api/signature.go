@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"receipt-processor/auth"
+)
+
+const (
+	// maxSignedBodyBytes bounds the body buffered to verify a signature before it is processed
+	maxSignedBodyBytes = 32 << 20
+	// maxNonceLength bounds the memory a client can make the nonce cache hold per request
+	maxNonceLength = 128
+)
+
+// requireSignature rejects requests whose X-Signature doesn't match the body once a signing
+// secret is configured. The body is buffered so nothing is processed before it is verified.
+// With a replay window, the signed timestamp must be within the window and the nonce unused.
+func (s *Server) requireSignature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.signingSecret == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendErrorResponse(w, r, http.StatusRequestEntityTooLarge, "signature.bodyTooLarge")
+			return
+		}
+		if err != nil {
+			sendErrorResponse(w, r, http.StatusBadRequest, "request.bodyUnreadable")
+			return
+		}
+
+		timestamp, nonce := r.Header.Get(auth.TimestampHeader), r.Header.Get(auth.NonceHeader)
+		signature := r.Header.Get(auth.SignatureHeader)
+		var verified bool
+		if timestamp != "" || nonce != "" {
+			verified = auth.VerifySignatureWithNonce(s.signingSecret, timestamp, nonce, body, signature)
+		} else {
+			verified = auth.VerifySignature(s.signingSecret, body, signature)
+		}
+		if !verified {
+			sendErrorResponse(w, r, http.StatusUnauthorized, "signature.invalid")
+			return
+		}
+
+		// Only check freshness once the signature proves the timestamp and nonce weren't altered
+		if s.replayWindow > 0 && !s.checkReplay(w, r, timestamp, nonce) {
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// checkReplay rejects stale timestamps and reused nonces, writing the error response when it does
+func (s *Server) checkReplay(w http.ResponseWriter, r *http.Request, timestamp string, nonce string) bool {
+	if nonce == "" || len(nonce) > maxNonceLength {
+		sendErrorResponse(w, r, http.StatusUnauthorized, "signature.nonceInvalid")
+		return false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusUnauthorized, "signature.timestampFormat")
+		return false
+	}
+
+	now := s.clock.Now()
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > s.replayWindow || skew < -s.replayWindow {
+		sendErrorResponse(w, r, http.StatusUnauthorized, "signature.timestampWindow")
+		return false
+	}
+	fresh, err := s.nonces.Use(nonce)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "signature.nonceFailed")
+		return false
+	}
+	if !fresh {
+		sendErrorResponse(w, r, http.StatusUnauthorized, "signature.nonceUsed")
+		return false
+	}
+	return true
+}
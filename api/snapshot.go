@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"receipt-processor/blob"
+	"receipt-processor/store"
+)
+
+// SnapshotRequest names a snapshot in the configured snapshot store
+type SnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+// checkSnapshotName rejects snapshot names that aren't plain file names
+func checkSnapshotName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("snapshot name %q must be a plain file name", name)
+	}
+	return nil
+}
+
+// decodeSnapshotRequest reads the optional request body; an empty body is allowed
+func decodeSnapshotRequest(r *http.Request) (SnapshotRequest, error) {
+	var request SnapshotRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err == io.EOF {
+		err = nil
+	}
+	return request, err
+}
+
+func (s *Server) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeSnapshotRequest(r)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "snapshot.requestInvalid")
+		return
+	}
+	if request.Name == "" {
+		request.Name = "snapshot-" + s.clock.Now().UTC().Format("20060102T150405Z") + ".jsonl.gz"
+	}
+	if err := checkSnapshotName(request.Name); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "snapshot.nameInvalid")
+		return
+	}
+
+	count, size, err := s.writeSnapshot(r.Context(), request.Name)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "snapshot.writeFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": request.Name, "receipts": count, "bytes": size})
+}
+
+// writeSnapshot streams a snapshot of every receipt into the snapshot store, returning how many
+// receipts and bytes it wrote. A failed or cancelled write aborts the upload, so it never
+// replaces a good snapshot.
+func (s *Server) writeSnapshot(ctx context.Context, name string) (int, int64, error) {
+	reader, writer := io.Pipe()
+	var count int
+	go func() {
+		var err error
+		count, err = store.WriteSnapshot(contextWriter{ctx: ctx, w: writer}, s.store)
+		writer.CloseWithError(err)
+	}()
+	counted := &countingReader{r: reader}
+	err := s.snapshots.Put(name, counted)
+	reader.CloseWithError(err)
+	return count, counted.n, err
+}
+
+func (s *Server) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeSnapshotRequest(r)
+	if err != nil || request.Name == "" {
+		sendErrorResponse(w, r, http.StatusBadRequest, "snapshot.nameRequired")
+		return
+	}
+	if err := checkSnapshotName(request.Name); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "snapshot.nameInvalid")
+		return
+	}
+
+	file, err := s.snapshots.Get(request.Name)
+	if errors.Is(err, blob.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "snapshot.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "snapshot.openFailed")
+		return
+	}
+	defer file.Close()
+
+	restored, err := store.ReadSnapshot(file, s.store)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusUnprocessableEntity, "snapshot.restoreFailed", "restored", restored, "reason", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": request.Name, "restored": restored})
+}
+
+// contextWriter fails writes once its context is cancelled
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c contextWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
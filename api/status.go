@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/ledger"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// ApproveReceipt approves a pending or in-review receipt so its points count toward the user's balance
+func (s *Server) ApproveReceipt(w http.ResponseWriter, r *http.Request) {
+	s.decideReceipt(w, r, store.StatusApproved, nil)
+}
+
+// RejectReceipt rejects a pending or in-review receipt so its points never count
+func (s *Server) RejectReceipt(w http.ResponseWriter, r *http.Request) {
+	s.decideReceipt(w, r, store.StatusRejected, nil)
+}
+
+// EditAndApproveReceipt replaces a receipt awaiting a decision with the reviewer's corrected
+// version, rescores it and approves it
+func (s *Server) EditAndApproveReceipt(w http.ResponseWriter, r *http.Request) {
+	// Decode, validate, enrich and score the corrected receipt the same way ProcessReceipts does
+	corrected, ok := s.readReceipt(w, r)
+	if !ok {
+		return
+	}
+	if err := s.pipeline.Prepare(r.Context(), corrected); err != nil {
+		sendPipelineError(w, r, err, "receipt.scoreCorrectedFailed")
+		return
+	}
+
+	s.decideReceipt(w, r, store.StatusApproved, corrected)
+}
+
+// decideReceipt moves a receipt that is still awaiting a decision to the given status,
+// replacing and rescoring it first when the reviewer corrected it
+func (s *Server) decideReceipt(w http.ResponseWriter, r *http.Request, status string, corrected *pipeline.Receipt) {
+	receiptID := mux.Vars(r)["id"]
+	setAuditResource(r, "/receipts/"+receiptID)
+	unlock, ok := s.lockReceipts(w, r, receiptID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	// Approved and rejected are final
+	if record.Decided() {
+		sendErrorResponse(w, r, http.StatusConflict, "receipt.alreadyDecided", "status", record.Status)
+		return
+	}
+
+	original := record
+	if corrected != nil {
+		record.Receipt, record.Edited = corrected.Receipt, true
+		s.recordScoreChange(&record, corrected.Points, reasonReviewEdit, auth.FromContext(r.Context()).Name)
+	}
+	record.Status, record.StatusChangedAt = status, s.clock.Now().UTC()
+	record.ReviewedBy = auth.FromContext(r.Context()).Name
+	eventID, err := s.save(record, outbox.ReceiptStatusChanged)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.updateFailed")
+		return
+	}
+	if status == store.StatusApproved {
+		err := s.credit(record, earnKind(record), record.Points, "", record.ReviewedBy)
+		if errors.Is(err, ledger.ErrAlreadyEarned) {
+			// Another instance approved it first, and its record stands
+			s.dropEvent(eventID)
+			sendErrorResponse(w, r, http.StatusConflict, "receipt.alreadyDecided", "status", store.StatusApproved)
+			return
+		}
+		if err != nil {
+			s.store.Save(original)
+			s.dropEvent(eventID)
+			sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.creditFailed")
+			return
+		}
+		s.approved(record)
+	} else {
+		s.releaseStreak(record)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// ListReviewQueue returns the flagged receipts awaiting manual review, oldest first
+func (s *Server) ListReviewQueue(w http.ResponseWriter, r *http.Request) {
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	queue := []store.Record{}
+	for _, record := range records {
+		if record.Status == store.StatusReview && !record.Deleted() {
+			queue = append(queue, record)
+		}
+	}
+
+	sendListResponse(w, r, "receipts", queue)
+}
+
+// GetUserPoints returns a user's ledger balance, and the points of receipts still awaiting a decision
+func (s *Server) GetUserPoints(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	pending := 0
+	for _, record := range records {
+		if record.Receipt.UserID == userID && !record.Decided() && !record.Deleted() {
+			pending += record.Points
+		}
+	}
+
+	balance, err := s.ledger.Balance(userID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.ledgerFailed")
+		return
+	}
+
+	sendConditionalResponse(w, r, map[string]interface{}{"userId": userID, "points": balance, "pendingPoints": pending})
+}
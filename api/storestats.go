@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+
+	"receipt-processor/store"
+)
+
+// GetStoreStats describes what the store holds: its backend, the receipts it holds and their
+// approximate size, the oldest and newest of them, and how many each user submitted
+func (s *Server) GetStoreStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := store.CollectStats(s.store)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "store.describeFailed")
+		return
+	}
+
+	sendConditionalResponse(w, r, stats)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/pipeline"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+	"receipt-processor/streaks"
+	"receipt-processor/validation"
+)
+
+// StreakStatus is a user's streak and the bonus their next receipt would earn for it
+type StreakStatus struct {
+	streaks.Streak
+	// NextBonus is the streak bonus of a receipt submitted now, 0 when they already had one approved today
+	NextBonus int `json:"nextBonus"`
+}
+
+// GetUserStreak reports a user's run of consecutive days with an approved receipt
+func (s *Server) GetUserStreak(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+
+	now := s.clock.Now()
+	streak, err := s.streaks.Get(userID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.streakFailed")
+		return
+	}
+	sendConditionalResponse(w, r, StreakStatus{
+		Streak:    streak.Active(now),
+		NextBonus: scoring.StreakBonus(streak.Next(now), s.engine.RuleSet()),
+	})
+}
+
+// memberOf describes the user who submitted a receipt, the zero member for receipts without one
+func (s *Server) memberOf(userID string) (scoring.Member, error) {
+	if userID == "" {
+		return scoring.Member{}, nil
+	}
+	tier, err := s.tierOf(userID)
+	if err != nil {
+		return scoring.Member{}, err
+	}
+	streak, err := s.streaks.Get(userID)
+	if err != nil {
+		return scoring.Member{}, err
+	}
+	return scoring.Member{Tier: tier, Streak: streak.Next(s.clock.Now())}, nil
+}
+
+// reserveStreak grants the day's streak bonus to a new receipt scored with one, so the receipts a
+// user submits before the first is approved don't all earn it. A receipt that lost the bonus to
+// another is scored again without it.
+func (s *Server) reserveStreak(r *pipeline.Receipt, now time.Time) error {
+	if !r.Record.CreatedAt.IsZero() || r.Record.Streak == 0 {
+		return nil
+	}
+	streak, err := s.streaks.Reserve(r.Receipt.UserID, now)
+	if err != nil {
+		return err
+	}
+	if streak == r.Record.Streak {
+		return nil
+	}
+	member, err := s.memberOf(r.Receipt.UserID)
+	if err != nil {
+		if streak > 0 {
+			s.releaseStreak(store.Record{Receipt: r.Receipt, CreatedAt: now, Streak: streak})
+		}
+		return err
+	}
+	member.Streak, r.Record.Streak = streak, streak
+	r.Breakdown = s.engine.BreakdownFor(r.Receipt, member)
+	r.Points = scoring.Total(r.Breakdown)
+	return nil
+}
+
+// releaseStreak gives back the streak bonus granted to a receipt that won't be approved, so another
+// receipt of that day can earn it. Failures are only logged.
+func (s *Server) releaseStreak(record store.Record) {
+	if record.Streak == 0 {
+		return
+	}
+	if err := s.streaks.Release(record.Receipt.UserID, record.CreatedAt); err != nil {
+		log.Printf("releasing the streak bonus of user %s: %v", record.Receipt.UserID, err)
+	}
+}
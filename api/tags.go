@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/validation"
+)
+
+// TagRequest lists the tags to put on a receipt and to take off it
+type TagRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// TagReceipt puts tags on a receipt and takes them off, so operators can label receipts, e.g.
+// "disputed", and filter them out of listings and stats
+func (s *Server) TagReceipt(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["id"]
+	setAuditResource(r, "/receipts/"+receiptID)
+	var request TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "receipt.tagsInvalid")
+		return
+	}
+	for _, tag := range append(request.Add, request.Remove...) {
+		if !validation.Tag(tag) {
+			sendErrorResponse(w, r, http.StatusBadRequest, "param.tag", "tag", strconv.Quote(tag))
+			return
+		}
+	}
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	tags := append(slices.Clone(record.Tags), request.Add...)
+	tags = slices.DeleteFunc(tags, func(tag string) bool { return slices.Contains(request.Remove, tag) })
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	if len(tags) > validation.MaxTags {
+		sendErrorResponse(w, r, http.StatusBadRequest, "receipt.tooManyTags", "max", validation.MaxTags)
+		return
+	}
+	record.Tags = tags
+	if len(tags) == 0 {
+		record.Tags = nil
+	}
+	if err := s.store.Save(record); err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.updateFailed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
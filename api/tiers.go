@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/tiers"
+	"receipt-processor/validation"
+)
+
+// TierProgress is the next tier a user can reach and the points they still need for it
+type TierProgress struct {
+	tiers.Tier
+	PointsNeeded int `json:"pointsNeeded"`
+}
+
+// GetUserTier reports the loyalty tier a user's balance reaches, the multiplier it applies to new
+// receipts and how far the next tier is
+func (s *Server) GetUserTier(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if !validation.UserID(userID) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user.invalid")
+		return
+	}
+
+	balance, err := s.ledger.Balance(userID)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "user.ledgerFailed")
+		return
+	}
+	response := map[string]interface{}{"userId": userID, "balance": balance, "tier": nil, "multiplier": 1.0, "next": nil}
+	if tier, ok := s.tiers.For(balance); ok {
+		response["tier"] = tier
+		if multiplier, ok := s.engine.RuleSet().TierMultipliers[tier.Name]; ok {
+			response["multiplier"] = multiplier
+		}
+	}
+	if next, ok := s.tiers.Next(balance); ok {
+		response["next"] = TierProgress{Tier: next, PointsNeeded: next.MinPoints - balance}
+	}
+	sendConditionalResponse(w, r, response)
+}
+
+// tierOf returns the name of the loyalty tier a user's balance reaches, "" for receipts without a
+// user or balances below every tier
+func (s *Server) tierOf(userID string) (string, error) {
+	if userID == "" {
+		return "", nil
+	}
+	balance, err := s.ledger.Balance(userID)
+	if err != nil {
+		return "", err
+	}
+	tier, _ := s.tiers.For(balance)
+	return tier.Name, nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/auth"
+	"receipt-processor/ledger"
+	"receipt-processor/outbox"
+	"receipt-processor/store"
+)
+
+// Reasons recorded in the ledger when an approved receipt moves in and out of the trash
+const (
+	reasonDeleted  = "receipt deleted"
+	reasonRestored = "receipt restored"
+)
+
+// DeleteReceipt moves a receipt to the trash, hiding it until it is restored or the retention
+// sweeper purges it. An approved receipt's points are debited while it is there.
+func (s *Server) DeleteReceipt(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["id"]
+	setAuditResource(r, "/receipts/"+receiptID)
+	unlock, ok := s.lockReceipts(w, r, receiptID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	record, ok := s.findReceipt(w, r, receiptID)
+	if !ok {
+		return
+	}
+
+	original := record
+	now := s.clock.Now().UTC()
+	record.DeletedAt = &now
+	if !s.updateTrash(w, r, original, record, ledger.KindDeletion, -record.Points, reasonDeleted) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTrash returns the receipts in the trash, oldest first
+func (s *Server) ListTrash(w http.ResponseWriter, r *http.Request) {
+	records, err := s.store.List()
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipts.listFailed")
+		return
+	}
+	trash := []store.Record{}
+	for _, record := range records {
+		if record.Deleted() {
+			trash = append(trash, record)
+		}
+	}
+
+	sendListResponse(w, r, "receipts", trash)
+}
+
+// RestoreReceipt takes a receipt out of the trash, crediting an approved receipt's points back
+func (s *Server) RestoreReceipt(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["id"]
+	setAuditResource(r, "/receipts/"+receiptID)
+	unlock, ok := s.lockReceipts(w, r, receiptID)
+	if !ok {
+		return
+	}
+	defer unlock()
+	record, err := s.store.Get(receiptID)
+	if errors.Is(err, store.ErrNotFound) {
+		sendErrorResponse(w, r, http.StatusNotFound, "receipt.notFound")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.loadFailed")
+		return
+	}
+	if !record.Deleted() {
+		sendErrorResponse(w, r, http.StatusConflict, "receipt.notInTrash")
+		return
+	}
+
+	original := record
+	record.DeletedAt = nil
+	if !s.updateTrash(w, r, original, record, ledger.KindRestore, record.Points, reasonRestored) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// updateTrash saves a receipt moved in or out of the trash and moves an approved receipt's points
+// in the ledger, putting the original back when they can't be. It writes the error response and
+// reports false on failure. The caller holds the receipt's lock.
+func (s *Server) updateTrash(w http.ResponseWriter, r *http.Request, original, record store.Record, kind string, points int, reason string) bool {
+	eventType := outbox.ReceiptRestored
+	if record.Deleted() {
+		eventType = outbox.ReceiptDeleted
+	}
+	eventID, err := s.save(record, eventType)
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.updateFailed")
+		return false
+	}
+	if record.Status == store.StatusApproved && points != 0 {
+		if err := s.credit(record, kind, points, reason, auth.FromContext(r.Context()).Name); err != nil {
+			s.store.Save(original)
+			s.dropEvent(eventID)
+			sendErrorResponse(w, r, http.StatusInternalServerError, "receipt.movePointsFailed")
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-processor/pipeline"
+	"receipt-processor/receipt"
+	"receipt-processor/report"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+)
+
+//go:embed ui/*.html
+var uiFiles embed.FS
+
+// uiPages holds each page of the web UI parsed together with the shared layout
+var uiPages = func() map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, name := range []string{"index", "receipt", "stats", "error"} {
+		pages[name] = template.Must(template.ParseFS(uiFiles, "ui/layout.html", "ui/"+name+".html"))
+	}
+	return pages
+}()
+
+// uiRoutes mounts the web UI, a few pages for trying the service from a browser
+func (s *Server) uiRoutes(r *mux.Router) {
+	r.HandleFunc("/ui", s.uiIndex).Methods("GET")
+	r.HandleFunc("/ui/receipts", s.uiLookup).Methods("GET")
+	r.HandleFunc("/ui/receipts", s.uiSubmit).Methods("POST")
+	r.HandleFunc("/ui/receipts/{id}", s.uiReceipt).Methods("GET")
+	r.HandleFunc("/ui/stats", s.uiStats).Methods("GET")
+}
+
+// renderPage writes a UI page with the given status
+func renderPage(w http.ResponseWriter, status int, page string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := uiPages[page].ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("Error rendering UI page %s: %v", page, err)
+	}
+}
+
+// renderUIError writes the error page, the UI's counterpart of sendErrorResponse
+func renderUIError(w http.ResponseWriter, status int, message string) {
+	renderPage(w, status, "error", struct{ Title, Message string }{http.StatusText(status), message})
+}
+
+// receiptForm holds the submission form's fields, so an invalid submission can be shown again
+type receiptForm struct {
+	Retailer, PurchaseDate, PurchaseTime, Items, Total, UserID string
+}
+
+// receipt builds the receipt the form describes; items are lines of "description, price"
+func (f receiptForm) receipt() receipt.Receipt {
+	r := receipt.Receipt{
+		Retailer:     f.Retailer,
+		PurchaseDate: f.PurchaseDate,
+		PurchaseTime: f.PurchaseTime,
+		Total:        f.Total,
+		UserID:       f.UserID,
+		Items:        []receipt.Item{},
+	}
+	for _, line := range strings.Split(f.Items, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		description, price := line, ""
+		if i := strings.LastIndex(line, ","); i >= 0 {
+			description, price = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		}
+		r.Items = append(r.Items, receipt.Item{ShortDescription: description, Price: price})
+	}
+	return r
+}
+
+type indexPage struct {
+	Title           string
+	SigningRequired bool
+	Form            receiptForm
+	Errors          []string
+}
+
+func (s *Server) uiIndex(w http.ResponseWriter, r *http.Request) {
+	renderPage(w, http.StatusOK, "index", indexPage{Title: "Receipts", SigningRequired: s.signingSecret != ""})
+}
+
+// uiLookup sends the lookup form on to the receipt's page
+func (s *Server) uiLookup(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "" {
+		http.Redirect(w, r, "/ui", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/ui/receipts/"+url.PathEscape(id), http.StatusSeeOther)
+}
+
+// uiSubmit processes a receipt from the submission form. The form can't sign requests, so it is
+// refused when the server requires signatures.
+func (s *Server) uiSubmit(w http.ResponseWriter, r *http.Request) {
+	if s.signingSecret != "" {
+		renderUIError(w, http.StatusUnauthorized, "This server only accepts signed receipts.")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		renderUIError(w, http.StatusBadRequest, "The form could not be read.")
+		return
+	}
+	form := receiptForm{
+		Retailer:     strings.TrimSpace(r.PostFormValue("retailer")),
+		PurchaseDate: r.PostFormValue("purchaseDate"),
+		PurchaseTime: r.PostFormValue("purchaseTime"),
+		Items:        r.PostFormValue("items"),
+		Total:        strings.TrimSpace(r.PostFormValue("total")),
+		UserID:       strings.TrimSpace(r.PostFormValue("userId")),
+	}
+	raw, err := json.Marshal(form.receipt())
+	if err != nil {
+		renderUIError(w, http.StatusInternalServerError, "Unable to process the receipt.")
+		return
+	}
+
+	incoming := &pipeline.Receipt{Raw: raw}
+	err = s.pipeline.Prepare(r.Context(), incoming)
+	if err == nil {
+		err = s.pipeline.Commit(r.Context(), incoming)
+	}
+	var invalid *pipeline.Invalid
+	var rejected *pipeline.Rejection
+	switch {
+	case errors.As(err, &invalid):
+		page := indexPage{Title: "Receipts", Form: form}
+		for _, fieldError := range invalid.Errors {
+			page.Errors = append(page.Errors, strings.TrimPrefix(fieldError.Pointer, "/")+": "+fieldError.Message)
+		}
+		if len(page.Errors) == 0 {
+			page.Errors = []string{invalid.Error()}
+		}
+		renderPage(w, http.StatusBadRequest, "index", page)
+		return
+	case errors.As(err, &rejected):
+		renderUIError(w, http.StatusUnprocessableEntity, rejected.Error())
+		return
+	case err != nil:
+		renderUIError(w, http.StatusInternalServerError, "Unable to process the receipt.")
+		return
+	}
+	setAuditResource(r, "/receipts/"+incoming.Record.ID)
+	http.Redirect(w, r, "/ui/receipts/"+incoming.Record.ID, http.StatusSeeOther)
+}
+
+type receiptPage struct {
+	Title     string
+	Record    store.Record
+	Breakdown []scoring.RuleResult
+	// Computed totals the breakdown, which uses the current rules
+	Computed int
+}
+
+func (s *Server) uiReceipt(w http.ResponseWriter, r *http.Request) {
+	record, err := s.store.Get(mux.Vars(r)["id"])
+	if errors.Is(err, store.ErrNotFound) || err == nil && record.Deleted() {
+		renderUIError(w, http.StatusNotFound, "No receipt found for that ID.")
+		return
+	}
+	if err != nil {
+		renderUIError(w, http.StatusInternalServerError, "Unable to load the receipt.")
+		return
+	}
+	breakdown := s.engine.Breakdown(record.Receipt)
+	renderPage(w, http.StatusOK, "receipt", receiptPage{
+		Title:     "Receipt from " + record.Receipt.Retailer,
+		Record:    record,
+		Breakdown: breakdown,
+		Computed:  scoring.Total(breakdown),
+	})
+}
+
+// statsPeriod summarizes the receipts processed during one period on the stats page
+type statsPeriod struct {
+	Name   string
+	Report report.Report
+}
+
+func (s *Server) uiStats(w http.ResponseWriter, r *http.Request) {
+	records, err := s.store.List()
+	if err != nil {
+		renderUIError(w, http.StatusInternalServerError, "Unable to list receipts.")
+		return
+	}
+	records = report.Exclude(records, s.excludedTags)
+	now := s.clock.Now()
+	periods := []statsPeriod{
+		{"Last 24 hours", report.Generate(records, now.AddDate(0, 0, -1), now, now)},
+		{"Last 7 days", report.Generate(records, now.AddDate(0, 0, -7), now, now)},
+		{"All time", report.Generate(records, time.Time{}, now, now)},
+	}
+	renderPage(w, http.StatusOK, "stats", struct {
+		Title   string
+		Periods []statsPeriod
+		Top     []report.RetailerTotal
+	}{"Stats", periods, periods[2].Report.TopRetailers})
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"receipt-processor/buildinfo"
+	"receipt-processor/store"
+)
+
+// Version is the answer of GET /version
+type Version struct {
+	buildinfo.Info
+	// RuleSetVersion identifies the active rule-set, changing when it is reloaded with other values
+	RuleSetVersion string `json:"ruleSetVersion"`
+	// Storage names the store receipts are kept in: memory or postgres
+	Storage string `json:"storage"`
+	// Features names the optional features the server was started with
+	Features []string `json:"features"`
+}
+
+// GetVersion describes the running build and how it is configured, for deployment smoke tests
+// checking that the expected release came up
+func (s *Server) GetVersion(w http.ResponseWriter, r *http.Request) {
+	version := Version{
+		Info:           buildinfo.Get(),
+		RuleSetVersion: s.engine.RuleSet().Version(),
+		Storage:        store.BackendName(s.store),
+		Features:       s.features,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(version)
+}
@@ -0,0 +1,143 @@
+// Package audit records every mutating API call in an append-only log.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes recorded for an entry
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry describes one mutating API call
+type Entry struct {
+	Sequence int       `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Caller   string    `json:"caller"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Resource string    `json:"resource"`
+	Status   int       `json:"status"`
+	Outcome  string    `json:"outcome"`
+}
+
+// Filter selects entries; zero fields match everything
+type Filter struct {
+	Caller string
+	Method string
+	// Resource matches entries whose resource starts with it, e.g. "/receipts/"
+	Resource string
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	// Limit returns only the most recent matching entries when positive
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	return (f.Caller == "" || e.Caller == f.Caller) &&
+		(f.Method == "" || e.Method == f.Method) &&
+		strings.HasPrefix(e.Resource, f.Resource) &&
+		(f.Outcome == "" || e.Outcome == f.Outcome) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Store keeps the audit log: a Log in memory or a file for a single instance, or Postgres shared by
+// every instance
+type Store interface {
+	// Record assigns the entry its sequence number and persists it
+	Record(entry Entry) error
+	// Query returns the entries matching the filter, oldest first
+	Query(f Filter) ([]Entry, error)
+}
+
+// Log is an append-only audit log, optionally persisted as JSON lines
+type Log struct {
+	mu      sync.Mutex
+	path    string
+	entries []Entry
+}
+
+// Open loads the log persisted at path, creating it on first record. An empty path keeps the log in memory.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path}
+	if path == "" {
+		return l, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("reading audit log entry %d: %w", len(l.entries)+1, err)
+		}
+		l.entries = append(l.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record assigns the entry its sequence number and persists it
+func (l *Log) Record(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Sequence = len(l.entries) + 1
+	if l.path != "" {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// Query returns the entries matching the filter, oldest first
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	matched := []Entry{}
+	for _, entry := range l.entries {
+		if f.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[len(matched)-f.Limit:]
+	}
+	return matched, nil
+}
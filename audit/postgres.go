@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Postgres keeps the audit log in a PostgreSQL table, so the calls made to every instance sharing
+// the database are recorded in one log
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the audit log in db, creating the table when it doesn't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS audit_log (
+		sequence bigserial PRIMARY KEY,
+		time     timestamptz NOT NULL,
+		caller   text NOT NULL,
+		method   text NOT NULL,
+		path     text NOT NULL,
+		resource text NOT NULL,
+		status   integer NOT NULL,
+		outcome  text NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating audit_log table: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+// Record numbers the entry from the table's sequence, so entries recorded by different instances
+// never share a number
+func (p *Postgres) Record(entry Entry) error {
+	_, err := p.db.Exec(`INSERT INTO audit_log (time, caller, method, path, resource, status, outcome)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.Time, entry.Caller, entry.Method, entry.Path, entry.Resource, entry.Status, entry.Outcome)
+	return err
+}
+
+func (p *Postgres) Query(f Filter) ([]Entry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.Caller != "" {
+		where("caller = $%d", f.Caller)
+	}
+	if f.Method != "" {
+		where("method = $%d", f.Method)
+	}
+	if f.Resource != "" {
+		where("starts_with(resource, $%d)", f.Resource)
+	}
+	if f.Outcome != "" {
+		where("outcome = $%d", f.Outcome)
+	}
+	if !f.Since.IsZero() {
+		where("time >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		where("time < $%d", f.Until)
+	}
+	statement := `SELECT sequence, time, caller, method, path, resource, status, outcome FROM audit_log`
+	if len(conditions) > 0 {
+		statement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	// The most recent entries are selected newest first, then put back in order
+	statement += ` ORDER BY sequence DESC`
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		statement += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	rows, err := p.db.Query(`SELECT * FROM (`+statement+`) recent ORDER BY sequence`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(&entry.Sequence, &entry.Time, &entry.Caller, &entry.Method, &entry.Path,
+			&entry.Resource, &entry.Status, &entry.Outcome); err != nil {
+			return nil, err
+		}
+		entry.Time = entry.Time.UTC()
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,77 @@
+// Package auth identifies API callers from bearer tokens.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Key is an API key issued to a caller
+type Key struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+// Caller identifies who made a request
+type Caller struct {
+	Name  string
+	Admin bool
+}
+
+// Anonymous is the caller of requests without a recognised key
+var Anonymous = Caller{Name: "anonymous"}
+
+// Authenticator maps API keys to callers
+type Authenticator struct {
+	keys []Key
+}
+
+func New(keys []Key) *Authenticator {
+	return &Authenticator{keys: keys}
+}
+
+// Enabled reports whether any keys are configured. Without keys every caller is anonymous
+// and admin endpoints stay open, which suits local development.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Identify returns the caller for the request's bearer token
+func (a *Authenticator) Identify(r *http.Request) Caller {
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		return Anonymous
+	}
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(token)) == 1 {
+			return Caller{Name: key.Name, Admin: key.Admin}
+		}
+	}
+	return Anonymous
+}
+
+type callerKey struct{}
+
+// Middleware attaches the caller to the request context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), a.Identify(r))))
+	})
+}
+
+// NewContext returns a copy of ctx carrying caller, for work done on the caller's behalf after
+// their request has finished
+func NewContext(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// FromContext returns the caller attached by Middleware, or Anonymous
+func FromContext(ctx context.Context) Caller {
+	if caller, ok := ctx.Value(callerKey{}).(Caller); ok {
+		return caller
+	}
+	return Anonymous
+}
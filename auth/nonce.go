@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"receipt-processor/ttlcache"
+)
+
+// Nonces remember the nonces of signed requests for a fixed time so a signed request can't be replayed
+type Nonces interface {
+	// Use records the nonce, reporting false when it was already used within the ttl
+	Use(nonce string) (bool, error)
+}
+
+// NonceCache remembers nonces in memory, for a single instance
+type NonceCache struct {
+	seen *ttlcache.Cache[string, struct{}]
+}
+
+// NewNonceCache remembers each nonce for ttl
+func NewNonceCache(ttl time.Duration) *NonceCache {
+	return &NonceCache{seen: ttlcache.New[string, struct{}](ttlcache.Options{TTL: ttl})}
+}
+
+func (c *NonceCache) Use(nonce string) (bool, error) {
+	_, stored := c.seen.SetIfAbsent(nonce, struct{}{})
+	return stored, nil
+}
+
+// PostgresNonces remembers nonces in a PostgreSQL table, so a signed request can't be replayed
+// against another instance sharing the database
+type PostgresNonces struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewPostgresNonces remembers each nonce in db for ttl, creating the table when it doesn't exist yet
+func NewPostgresNonces(db *sql.DB, ttl time.Duration) (*PostgresNonces, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS request_nonces (
+		nonce   text PRIMARY KEY,
+		used_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating request_nonces table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS request_nonces_used_at ON request_nonces (used_at)`); err != nil {
+		return nil, fmt.Errorf("creating request_nonces index: %w", err)
+	}
+	return &PostgresNonces{db: db, ttl: ttl}, nil
+}
+
+func (p *PostgresNonces) Use(nonce string) (bool, error) {
+	// Times come from the database clock so instances with skewed clocks agree
+	if _, err := p.db.Exec(`DELETE FROM request_nonces WHERE used_at < now() - make_interval(secs => $1)`, p.ttl.Seconds()); err != nil {
+		return false, err
+	}
+	// The primary key makes using a nonce atomic across instances
+	result, err := p.db.Exec(`INSERT INTO request_nonces (nonce, used_at) VALUES ($1, now()) ON CONFLICT (nonce) DO NOTHING`, nonce)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
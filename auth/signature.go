@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Headers of a signed request. TimestampHeader and NonceHeader are optional unless the
+// server enforces a replay window; when present they are covered by the signature.
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Timestamp"
+	NonceHeader     = "X-Nonce"
+)
+
+const signaturePrefix = "sha256="
+
+// Sign returns the X-Signature value for body: "sha256=" followed by the hex HMAC-SHA256 under secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignWithNonce signs the timestamp and nonce together with body as "timestamp.nonce.body",
+// so neither can be replaced without invalidating the signature
+func SignWithNonce(secret string, timestamp string, nonce string, body []byte) string {
+	return Sign(secret, noncePayload(timestamp, nonce, body))
+}
+
+// VerifySignature reports whether signature is the X-Signature value of body under secret
+func VerifySignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// VerifySignatureWithNonce reports whether signature is the SignWithNonce value of the request
+func VerifySignatureWithNonce(secret string, timestamp string, nonce string, body []byte, signature string) bool {
+	return VerifySignature(secret, noncePayload(timestamp, nonce, body), signature)
+}
+
+func noncePayload(timestamp string, nonce string, body []byte) []byte {
+	payload := make([]byte, 0, len(timestamp)+len(nonce)+len(body)+2)
+	payload = append(payload, timestamp...)
+	payload = append(payload, '.')
+	payload = append(payload, nonce...)
+	payload = append(payload, '.')
+	return append(payload, body...)
+}
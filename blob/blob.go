@@ -0,0 +1,140 @@
+// Package blob stores opaque objects, such as archives and snapshots, under string keys, in a local
+// directory, Amazon S3 or Google Cloud Storage.
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned when no object is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store is implemented by every object storage backend
+type Store interface {
+	// Put stores the contents of r under key, replacing any existing object
+	Put(key string, r io.Reader) error
+	// Get opens the object stored under key, or returns ErrNotFound
+	Get(key string) (io.ReadCloser, error)
+	// List returns the keys of the objects whose keys start with prefix, in lexical order
+	List(prefix string) ([]string, error)
+}
+
+// checkKey rejects empty keys, keys ending in a slash and keys with empty, "." or ".." segments
+func checkKey(key string) error {
+	if key == "" || strings.HasSuffix(key, "/") || path.Clean("/"+key) != "/"+key {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// Prefixed stores objects of another store below a key prefix, such as "snapshots/"
+type Prefixed struct {
+	store  Store
+	prefix string
+}
+
+func NewPrefixed(store Store, prefix string) *Prefixed {
+	return &Prefixed{store: store, prefix: prefix}
+}
+
+func (p *Prefixed) Put(key string, r io.Reader) error {
+	return p.store.Put(p.prefix+key, r)
+}
+
+func (p *Prefixed) Get(key string) (io.ReadCloser, error) {
+	return p.store.Get(p.prefix + key)
+}
+
+func (p *Prefixed) List(prefix string) ([]string, error) {
+	keys, err := p.store.List(p.prefix + prefix)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, p.prefix)
+	}
+	return keys, err
+}
+
+// Dir stores objects as files below a local directory; keys may contain slashes
+type Dir struct {
+	root string
+}
+
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// path maps a key to a file below the root, rejecting keys that would escape it
+func (d *Dir) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+func (d *Dir) Put(key string, r io.Reader) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	file, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (d *Dir) Get(key string) (io.ReadCloser, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (d *Dir) List(prefix string) ([]string, error) {
+	keys := []string{}
+	err := filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == d.root {
+			return fs.SkipAll
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+		// Temporary files of uploads in progress aren't objects yet
+		key := filepath.ToSlash(relative)
+		if strings.HasPrefix(key, prefix) && !strings.HasPrefix(entry.Name(), ".blob-") {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
@@ -0,0 +1,169 @@
+package blob
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"receipt-processor/gcpauth"
+)
+
+// gcsScope is the OAuth scope requested for reading and writing objects
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// GCSOptions configures a Google Cloud Storage store
+type GCSOptions struct {
+	Bucket string
+	// CredentialsFile is a service account key file, GOOGLE_APPLICATION_CREDENTIALS by default; without
+	// one, tokens come from the metadata server of the instance the server runs on
+	CredentialsFile string
+	// KMSKeyName encrypts new objects with a customer-managed Cloud KMS key, e.g.
+	// "projects/p/locations/l/keyRings/r/cryptoKeys/k"; empty uses the bucket's default encryption
+	KMSKeyName string
+	// Endpoint replaces https://storage.googleapis.com, e.g. for an emulator, which is called without
+	// credentials; STORAGE_EMULATOR_HOST by default
+	Endpoint string
+	// HTTPClient sends the requests, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// GCS stores objects in a Google Cloud Storage bucket. Objects are buffered in memory while they are uploaded.
+type GCS struct {
+	opts GCSOptions
+	// tokens authorizes requests; nil skips authentication, for emulators
+	tokens *gcpauth.TokenSource
+}
+
+func NewGCS(opts GCSOptions) (*GCS, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("gcs bucket is required")
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	g := &GCS{opts: opts}
+	if g.opts.Endpoint == "" {
+		if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+			g.opts.Endpoint = host
+			if !strings.Contains(host, "://") {
+				g.opts.Endpoint = "http://" + host
+			}
+		}
+	}
+	if g.opts.Endpoint != "" {
+		g.opts.Endpoint = strings.TrimSuffix(g.opts.Endpoint, "/")
+		return g, nil
+	}
+	g.opts.Endpoint = "https://storage.googleapis.com"
+	tokens, err := gcpauth.New(gcsScope, opts.CredentialsFile, opts.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	g.tokens = tokens
+	return g, nil
+}
+
+func (g *GCS) Put(key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	if g.opts.KMSKeyName != "" {
+		query.Set("kmsKeyName", g.opts.KMSKeyName)
+	}
+	target := g.opts.Endpoint + "/upload/storage/v1/b/" + url.PathEscape(g.opts.Bucket) + "/o?" + query.Encode()
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := g.send(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (g *GCS) Get(key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	target := g.opts.Endpoint + "/storage/v1/b/" + url.PathEscape(g.opts.Bucket) + "/o/" + url.PathEscape(key) + "?alt=media"
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (g *GCS) List(prefix string) ([]string, error) {
+	keys := []string{}
+	query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		target := g.opts.Endpoint + "/storage/v1/b/" + url.PathEscape(g.opts.Bucket) + "/o?" + query.Encode()
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := g.send(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			keys = append(keys, item.Name)
+		}
+		if page.NextPageToken == "" {
+			return keys, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// send authorizes and sends a request, turning error responses into errors
+func (g *GCS) send(req *http.Request) (*http.Response, error) {
+	if g.tokens != nil {
+		token, err := g.tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := g.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("gcs %s %s answered %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(detail))
+}
@@ -0,0 +1,205 @@
+// Package bodylog logs sampled request and response bodies for debugging, redacting
+// configured fields before anything is written.
+package bodylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxBodyBytes is the most of each body captured; larger bodies can't be redacted reliably and are omitted
+const maxBodyBytes = 64 << 10
+
+// redacted replaces the value of every redacted field
+const redacted = "[REDACTED]"
+
+// Settings control what is logged. They can be changed while the server runs.
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// SampleRate is the fraction of requests logged, from 0 to 1
+	SampleRate float64 `json:"sampleRate"`
+	// RedactFields names the JSON fields whose values are replaced at any depth, e.g. "userId" or "metadata"
+	RedactFields []string `json:"redactFields"`
+}
+
+// Validate reports settings that can't be applied
+func (s Settings) Validate() error {
+	if s.SampleRate < 0 || s.SampleRate > 1 {
+		return fmt.Errorf("sampleRate must be between 0 and 1, got %v", s.SampleRate)
+	}
+	return nil
+}
+
+// Logger logs the bodies of a sample of requests
+type Logger struct {
+	out *log.Logger
+
+	mu       sync.RWMutex
+	settings Settings
+}
+
+// New returns a logger writing to out, or to the standard logger when out is nil
+func New(settings Settings, out *log.Logger) *Logger {
+	if out == nil {
+		out = log.Default()
+	}
+	return &Logger{out: out, settings: settings}
+}
+
+// Settings returns the settings in effect
+func (l *Logger) Settings() Settings {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	settings := l.settings
+	settings.RedactFields = slices.Clone(settings.RedactFields)
+	return settings
+}
+
+// Update replaces the settings, or leaves them unchanged when they are invalid
+func (l *Logger) Update(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	settings.RedactFields = slices.Clone(settings.RedactFields)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settings = settings
+	return nil
+}
+
+// Middleware captures the bodies of sampled requests and logs them, redacted, once the response is written
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := l.Settings()
+		if !settings.Enabled || rand.Float64() >= settings.SampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		request := &capture{}
+		if r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, request), r.Body}
+		}
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(cw, r)
+
+		l.out.Printf("body %s %s %d %s request=%s response=%s", r.Method, r.URL.Path, cw.status,
+			time.Since(start).Round(time.Microsecond), request.render(settings.RedactFields), cw.body.render(settings.RedactFields))
+	})
+}
+
+// capture keeps the start of a body, remembering whether any of it was cut off
+type capture struct {
+	buffer    bytes.Buffer
+	truncated bool
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	if room := maxBodyBytes - c.buffer.Len(); room < len(p) {
+		c.buffer.Write(p[:max(room, 0)])
+		c.truncated = true
+	} else {
+		c.buffer.Write(p)
+	}
+	return len(p), nil
+}
+
+// render returns the body with its redacted fields replaced, or a placeholder when it can't be redacted
+func (c *capture) render(fields []string) string {
+	if c.buffer.Len() == 0 {
+		return "-"
+	}
+	if c.truncated {
+		return fmt.Sprintf("[omitted: more than %d bytes]", maxBodyBytes)
+	}
+	body, ok := Redact(c.buffer.Bytes(), fields)
+	if !ok {
+		return fmt.Sprintf("[omitted: %d bytes of non-JSON]", c.buffer.Len())
+	}
+	return string(body)
+}
+
+// Redact replaces the value of every named field, at any depth, in a JSON document or a stream
+// of newline-delimited JSON documents. It reports false when the body isn't JSON.
+func Redact(body []byte, fields []string) ([]byte, bool) {
+	var out bytes.Buffer
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		encoded, err := json.Marshal(redact(document, fields))
+		if err != nil {
+			return nil, false
+		}
+		if out.Len() > 0 {
+			out.WriteByte(' ')
+		}
+		out.Write(encoded)
+	}
+	return out.Bytes(), true
+}
+
+func redact(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if slices.Contains(fields, key) {
+				v[key] = redacted
+			} else {
+				v[key] = redact(field, fields)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item, fields)
+		}
+	}
+	return value
+}
+
+// captureWriter records the status and the start of the body written by the handler
+type captureWriter struct {
+	http.ResponseWriter
+	status        int
+	headerWritten bool
+	body          capture
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if !cw.headerWritten {
+		cw.status, cw.headerWritten = status, true
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	cw.headerWritten = true
+	cw.body.Write(p)
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush lets streaming handlers flush through the capture
+func (cw *captureWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
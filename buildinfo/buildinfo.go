@@ -0,0 +1,56 @@
+// Package buildinfo identifies the running build. Version, Commit and Time are set at build time
+// with -ldflags, e.g. `make server`:
+//
+//	go build -ldflags "-X receipt-processor/buildinfo.Version=1.4.0 -X receipt-processor/buildinfo.Commit=$(git rev-parse HEAD)" ./cmd/server
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X at build time
+var (
+	// Version is the release, "dev" for builds that didn't set it
+	Version = "dev"
+	// Commit is the git commit built; when unset, the commit the go tool stamped is used
+	Commit = ""
+	// Time is when the binary was built, in RFC 3339
+	Time = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+	// Modified reports a build from a working tree with uncommitted changes, as stamped by the go tool
+	Modified bool `json:"modified,omitempty"`
+}
+
+// Get returns the build's details, falling back to the version control details the go tool
+// stamps into binaries built inside a git checkout
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: Time, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
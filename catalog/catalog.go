@@ -0,0 +1,196 @@
+// Package catalog looks items up in an external product catalog to attach their categories and
+// brands. Lookups are cached and guarded by the catalog's resilience policy, whose circuit breaker
+// stops calling the catalog while it is failing, so an outage slows nothing down.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"receipt-processor/metrics"
+	"receipt-processor/pipeline"
+	"receipt-processor/receipt"
+	"receipt-processor/resilience"
+	"receipt-processor/ttlcache"
+	"receipt-processor/validation"
+)
+
+var lookups = metrics.NewCounterVec("receipts_catalog_lookups_total", "Product catalog lookups, by outcome.", "result")
+
+// Lookup outcomes counted in receipts_catalog_lookups_total
+const (
+	resultCached  = "cached"
+	resultFound   = "found"
+	resultUnknown = "unknown"
+	resultError   = "error"
+	resultSkipped = "skipped"
+)
+
+// Product is what the catalog knows about an item
+type Product struct {
+	Category string `json:"category"`
+	Brand    string `json:"brand"`
+}
+
+// Options configures a Client. Zero values fall back to the defaults given.
+type Options struct {
+	// URL is the catalog endpoint, called as GET URL?upc=...&description=...; it answers with a
+	// Product, or 404 for items it doesn't know
+	URL string
+	// Policy guards the calls to the catalog; its timeout is 500ms by default
+	Policy resilience.Policy
+	// CacheSize is the most lookups cached, 10000 by default
+	CacheSize int
+	// CacheTTL is how long a lookup, including an unknown item, is cached, one hour by default
+	CacheTTL time.Duration
+	// HTTPClient sends the lookups, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// Client looks products up in the catalog
+type Client struct {
+	opts   Options
+	caller *resilience.Caller
+	cache  *ttlcache.Cache[string, cacheEntry]
+}
+
+type cacheEntry struct {
+	product Product
+	found   bool
+}
+
+func New(opts Options) *Client {
+	if opts.Policy.Timeout <= 0 {
+		opts.Policy.Timeout = 500 * time.Millisecond
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 10000
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = time.Hour
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{
+		opts:   opts,
+		caller: resilience.New("catalog", opts.Policy),
+		cache:  ttlcache.New[string, cacheEntry](ttlcache.Options{TTL: opts.CacheTTL, MaxEntries: opts.CacheSize}),
+	}
+}
+
+// Hook returns an enrich-stage hook that fills in the category and brand of items submitted
+// without them. Items the catalog doesn't know, or can't be reached for, are left as they are.
+func (c *Client) Hook() pipeline.Hook {
+	return pipeline.NewHook(pipeline.Enrich, func(ctx context.Context, r *pipeline.Receipt) error {
+		c.Enrich(ctx, &r.Receipt)
+		return nil
+	})
+}
+
+// Enrich fills in the category and brand of the receipt's items from the catalog
+func (c *Client) Enrich(ctx context.Context, r *receipt.Receipt) {
+	for i := range r.Items {
+		item := &r.Items[i]
+		if item.Category != "" && item.Brand != "" {
+			continue
+		}
+		product, found, err := c.Lookup(ctx, item.UPC, item.ShortDescription)
+		if err != nil && !errors.Is(err, resilience.ErrOpen) {
+			log.Printf("catalog lookup for %q: %v", item.ShortDescription, err)
+		}
+		if !found {
+			continue
+		}
+		// Catalog values must pass the same validation as submitted ones
+		if item.Category == "" && validation.Category(product.Category) {
+			item.Category = product.Category
+		}
+		if item.Brand == "" && validation.Brand(product.Brand) {
+			item.Brand = product.Brand
+		}
+	}
+}
+
+// Lookup returns the product for an item, identified by its UPC when it has one and by its
+// description otherwise, reporting false when the catalog doesn't know it
+func (c *Client) Lookup(ctx context.Context, upc, description string) (Product, bool, error) {
+	key := "description:" + description
+	if upc != "" {
+		key = "upc:" + upc
+	}
+	if product, found, ok := c.cached(key); ok {
+		lookups.With(resultCached).Inc()
+		return product, found, nil
+	}
+
+	var product Product
+	var found bool
+	err := c.caller.Do(ctx, func(ctx context.Context) error {
+		var err error
+		product, found, err = c.fetch(ctx, upc, description)
+		return err
+	})
+	if errors.Is(err, resilience.ErrOpen) {
+		lookups.With(resultSkipped).Inc()
+		return Product{}, false, err
+	}
+	if err != nil {
+		lookups.With(resultError).Inc()
+		return Product{}, false, err
+	}
+	if found {
+		lookups.With(resultFound).Inc()
+	} else {
+		lookups.With(resultUnknown).Inc()
+	}
+	c.store(key, product, found)
+	return product, found, nil
+}
+
+func (c *Client) fetch(ctx context.Context, upc, description string) (Product, bool, error) {
+	query := url.Values{"description": {description}}
+	if upc != "" {
+		query.Set("upc", upc)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.opts.URL+"?"+query.Encode(), nil)
+	if err != nil {
+		return Product{}, false, resilience.Permanent(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return Product{}, false, err
+	}
+	defer resp.Body.Close()
+
+	// Only server errors are worth retrying; the catalog will refuse a request it rejected again
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Product{}, false, nil
+	case resp.StatusCode >= 500:
+		return Product{}, false, fmt.Errorf("catalog answered %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return Product{}, false, resilience.Permanent(fmt.Errorf("catalog answered %s", resp.Status))
+	}
+	var product Product
+	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+		return Product{}, false, fmt.Errorf("decoding catalog product: %w", err)
+	}
+	return product, true, nil
+}
+
+func (c *Client) cached(key string) (Product, bool, bool) {
+	entry, ok := c.cache.Get(key)
+	return entry.product, entry.found, ok
+}
+
+func (c *Client) store(key string, product Product, found bool) {
+	c.cache.Set(key, cacheEntry{product: product, found: found})
+}
@@ -0,0 +1,258 @@
+// Package client is a Go client for the receipt processor API.
+package client
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-processor/auth"
+	"receipt-processor/problem"
+	"receipt-processor/receipt"
+	"receipt-processor/validation"
+)
+
+type Item = receipt.Item
+
+// Receipt is the payload submitted for processing
+type Receipt = receipt.Receipt
+
+// StoredReceipt is a processed receipt as returned by the server
+type StoredReceipt struct {
+	ID        string    `json:"id"`
+	Points    int       `json:"points"`
+	CreatedAt time.Time `json:"createdAt"`
+	Receipt   Receipt   `json:"receipt"`
+}
+
+// Options configures a Client. Zero values fall back to the defaults below.
+type Options struct {
+	// HTTPClient performs the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// MaxRetries is the number of retries after the first attempt, 3 by default; set to -1 to disable retries
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry, doubled on every attempt, 100ms by default
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries, 5s by default
+	MaxBackoff time.Duration
+	// SigningSecret signs request bodies with an X-Signature header, together with a fresh
+	// X-Timestamp and X-Nonce, for servers that require it
+	SigningSecret string
+}
+
+// APIError is returned when the server answers with a non-success status
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Type identifies the kind of problem, e.g. problem.TypeInvalidReceipt
+	Type string
+	// MessageKey and MessageParams identify Message in the server's error message catalog, for
+	// translating it
+	MessageKey    string
+	MessageParams map[string]string
+	// Errors locates every invalid field when a receipt was rejected
+	Errors []validation.FieldError
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("receipt processor: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is an APIError for a missing receipt
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Client struct {
+	baseURL        string
+	httpClient     *http.Client
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	signingSecret  string
+}
+
+// New creates a client for the API served at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts Options) *Client {
+	c := &Client{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		httpClient:     opts.HTTPClient,
+		maxRetries:     opts.MaxRetries,
+		initialBackoff: opts.InitialBackoff,
+		maxBackoff:     opts.MaxBackoff,
+		signingSecret:  opts.SigningSecret,
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = 3
+	} else if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.initialBackoff <= 0 {
+		c.initialBackoff = 100 * time.Millisecond
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = 5 * time.Second
+	}
+	return c
+}
+
+// ProcessReceipt submits a receipt and returns the ID assigned to it. Every attempt carries the same
+// Idempotency-Key, so a retry after a lost response doesn't store the receipt twice.
+func (c *Client) ProcessReceipt(ctx context.Context, receipt Receipt) (string, error) {
+	keyBytes := make([]byte, 16)
+	if _, err := cryptorand.Read(keyBytes); err != nil {
+		return "", err
+	}
+	header := http.Header{"Idempotency-Key": {hex.EncodeToString(keyBytes)}}
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/receipts/process", header, receipt, &response); err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+// GetPoints returns the points awarded to a processed receipt
+func (c *Client) GetPoints(ctx context.Context, id string) (int, error) {
+	var response struct {
+		Points int `json:"points"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/receipts/"+url.PathEscape(id)+"/points", nil, nil, &response); err != nil {
+		return 0, err
+	}
+	return response.Points, nil
+}
+
+// GetReceipt returns a processed receipt
+func (c *Client) GetReceipt(ctx context.Context, id string) (StoredReceipt, error) {
+	var receipt StoredReceipt
+	err := c.do(ctx, http.MethodGet, "/v1/receipts/"+url.PathEscape(id), nil, nil, &receipt)
+	return receipt, err
+}
+
+// ListReceipts returns every processed receipt, oldest first
+func (c *Client) ListReceipts(ctx context.Context) ([]StoredReceipt, error) {
+	var response struct {
+		Receipts []StoredReceipt `json:"receipts"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/receipts", nil, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Receipts, nil
+}
+
+// do sends the request, retrying with exponential backoff and jitter when it is safe to do so
+func (c *Client) do(ctx context.Context, method string, path string, header http.Header, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.initialBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := c.attempt(ctx, method, path, header, payload, out)
+		if err == nil || !retryable || attempt >= c.maxRetries {
+			return err
+		}
+
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// attempt performs a single request and reports whether a failure may be retried
+func (c *Client) attempt(ctx context.Context, method string, path string, header http.Header, payload []byte, out interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return false, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json, "+problem.ContentType)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if c.signingSecret != "" {
+			if err := c.sign(req, payload); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Transport errors are retried unless the caller gave up
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			return false, nil
+		}
+		return false, json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var details problem.Problem
+	if json.NewDecoder(resp.Body).Decode(&details) == nil {
+		apiErr.Message, apiErr.Type, apiErr.Errors = details.Detail, details.Type, details.Errors
+		apiErr.MessageKey, apiErr.MessageParams = details.MessageKey, details.MessageParams
+	}
+	return isRetryableStatus(method, resp.StatusCode), apiErr
+}
+
+// sign adds the signature headers. Every attempt gets its own nonce so retries aren't taken for replays.
+func (c *Client) sign(req *http.Request, payload []byte) error {
+	nonceBytes := make([]byte, 16)
+	if _, err := cryptorand.Read(nonceBytes); err != nil {
+		return err
+	}
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(nonceBytes)
+	req.Header.Set(auth.TimestampHeader, timestamp)
+	req.Header.Set(auth.NonceHeader, nonce)
+	req.Header.Set(auth.SignatureHeader, auth.SignWithNonce(c.signingSecret, timestamp, nonce, payload))
+	return nil
+}
+
+// isRetryableStatus reports whether a status code may be retried. Non-idempotent requests are
+// only retried when the server signals it did not process them.
+func isRetryableStatus(method string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return method == http.MethodGet
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+// Package clock tells the time behind an interface, so tests can freeze and advance it.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time; implementations are safe for concurrent use
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the real time
+type System struct{}
+
+func (System) Now() time.Time { return time.Now() }
+
+// Manual is a clock that only moves when told to
+type Manual struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManual returns a clock stopped at now
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Set moves the clock to now, which may be in its past
+func (m *Manual) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// Advance moves the clock forward by d
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
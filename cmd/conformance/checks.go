@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// problemType is the media type of error responses
+const problemType = "application/problem+json"
+
+// missingID is a receipt ID no server has stored
+const missingID = "00000000-0000-4000-8000-000000000000"
+
+// check is one test of the suite
+type check struct {
+	name string
+	run  func() error
+}
+
+// fixture is a receipt submitted by the suite with the outcome it expects
+type fixture struct {
+	name    string
+	receipt []byte
+	valid   bool
+	points  int
+}
+
+// loadFixtures reads every receipt in dir/receipts with its golden outcome from dir/golden
+func loadFixtures(dir string) ([]fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "receipts", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	fixtures := make([]fixture, 0, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "golden", name+".json"))
+		if err != nil {
+			return nil, err
+		}
+		var golden struct {
+			Valid  bool `json:"valid"`
+			Points int  `json:"points"`
+		}
+		if err := json.Unmarshal(data, &golden); err != nil {
+			return nil, fmt.Errorf("decoding golden of %s: %w", name, err)
+		}
+		fixtures = append(fixtures, fixture{name: name, receipt: body, valid: golden.Valid, points: golden.Points})
+	}
+	return fixtures, nil
+}
+
+// suite sends the requests of the checks to the server under test
+type suite struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// response is a server's answer, read in full
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (s *suite) do(method, path string, header http.Header, body []byte) (response, error) {
+	req, err := http.NewRequest(method, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return response{}, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return response{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response{}, fmt.Errorf("reading the answer to %s %s: %w", method, path, err)
+	}
+	return response{status: resp.StatusCode, header: resp.Header, body: data}, nil
+}
+
+// json checks the response has the status and a JSON body, and decodes it into out
+func (r response) json(status int, out interface{}) error {
+	if r.status != status {
+		return fmt.Errorf("status %d, want %d: %s", r.status, status, snippet(r.body))
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.header.Get("Content-Type")); mediaType != "application/json" {
+		return fmt.Errorf("Content-Type %q, want application/json", r.header.Get("Content-Type"))
+	}
+	if err := json.Unmarshal(r.body, out); err != nil {
+		return fmt.Errorf("decoding body: %w", err)
+	}
+	return nil
+}
+
+// problem is the part of an RFC 7807 problem every error response must have
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+	Errors []struct {
+		Pointer string `json:"pointer"`
+	} `json:"errors"`
+}
+
+// problem checks the response is an RFC 7807 problem with the status, of the media type mediaType
+func (r response) problem(status int, mediaType string) (problem, error) {
+	var p problem
+	if r.status != status {
+		return p, fmt.Errorf("status %d, want %d: %s", r.status, status, snippet(r.body))
+	}
+	if got, _, _ := mime.ParseMediaType(r.header.Get("Content-Type")); got != mediaType {
+		return p, fmt.Errorf("Content-Type %q, want %s", r.header.Get("Content-Type"), mediaType)
+	}
+	if err := json.Unmarshal(r.body, &p); err != nil {
+		return p, fmt.Errorf("decoding problem: %w", err)
+	}
+	switch {
+	case p.Type == "" || p.Title == "":
+		return p, fmt.Errorf("problem lacks a type or title: %s", snippet(r.body))
+	case p.Status != status:
+		return p, fmt.Errorf("problem status %d, want %d", p.Status, status)
+	}
+	return p, nil
+}
+
+// snippet shortens a body for a failure message
+func snippet(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		return text[:200] + "..."
+	}
+	return text
+}
+
+// checks returns the suite's checks, the fixtures first
+func (s *suite) checks(fixtures []fixture) []check {
+	var checks []check
+	for _, f := range fixtures {
+		if f.valid {
+			checks = append(checks, check{name: "accepts and scores " + f.name, run: func() error { return s.validReceipt(f) }})
+		} else {
+			checks = append(checks, check{name: "rejects " + f.name, run: func() error { return s.invalidReceipt(f) }})
+		}
+	}
+	return append(checks,
+		check{name: "unknown receipt is a 404 problem", run: s.unknownReceipt},
+		check{name: "malformed receipt is a 400 problem", run: s.malformedReceipt},
+		check{name: "problems are plain JSON to clients accepting only application/json", run: s.legacyProblem},
+		check{name: "unknown route is a 404 problem", run: s.unknownRoute},
+		check{name: "unsupported method is a 405 problem", run: s.unsupportedMethod},
+		check{name: "v1 prefix serves the same receipts", run: s.versionPrefix},
+		check{name: "listing is ordered oldest first, or newest first with order=desc", run: s.listingOrder},
+		check{name: "listing rejects an unknown order", run: s.listingBadOrder},
+		check{name: "search returns at most limit results", run: s.searchLimit},
+		check{name: "search rejects a limit below 1", run: s.searchBadLimit},
+	)
+}
+
+// submit processes a receipt, returning the ID it was stored under
+func (s *suite) submit(body []byte) (string, error) {
+	resp, err := s.do(http.MethodPost, "/receipts/process", nil, body)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := resp.json(http.StatusCreated, &created); err != nil {
+		return "", fmt.Errorf("POST /receipts/process: %w", err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("POST /receipts/process answered without an id")
+	}
+	return created.ID, nil
+}
+
+func (s *suite) validReceipt(f fixture) error {
+	id, err := s.submit(f.receipt)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodGet, "/receipts/"+id+"/points", nil, nil)
+	if err != nil {
+		return err
+	}
+	var points struct {
+		Points *int `json:"points"`
+	}
+	if err := resp.json(http.StatusOK, &points); err != nil {
+		return fmt.Errorf("GET /receipts/{id}/points: %w", err)
+	}
+	if points.Points == nil || *points.Points != f.points {
+		return fmt.Errorf("GET /receipts/{id}/points answered %s, want %d points", snippet(resp.body), f.points)
+	}
+
+	resp, err = s.do(http.MethodGet, "/receipts/"+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	var record struct {
+		ID     string `json:"id"`
+		Points int    `json:"points"`
+	}
+	if err := resp.json(http.StatusOK, &record); err != nil {
+		return fmt.Errorf("GET /receipts/{id}: %w", err)
+	}
+	if record.ID != id || record.Points != f.points {
+		return fmt.Errorf("GET /receipts/{id} answered id %q with %d points, want %q with %d", record.ID, record.Points, id, f.points)
+	}
+	return nil
+}
+
+func (s *suite) invalidReceipt(f fixture) error {
+	resp, err := s.do(http.MethodPost, "/receipts/process", nil, f.receipt)
+	if err != nil {
+		return err
+	}
+	p, err := resp.problem(http.StatusBadRequest, problemType)
+	if err != nil {
+		return err
+	}
+	if len(p.Errors) == 0 {
+		return fmt.Errorf("the problem doesn't locate the invalid fields: %s", snippet(resp.body))
+	}
+	for _, fieldError := range p.Errors {
+		if !strings.HasPrefix(fieldError.Pointer, "/") && fieldError.Pointer != "" {
+			return fmt.Errorf("error pointer %q isn't a JSON Pointer", fieldError.Pointer)
+		}
+	}
+	return nil
+}
+
+func (s *suite) unknownReceipt() error {
+	for _, path := range []string{"/receipts/" + missingID + "/points", "/receipts/" + missingID} {
+		resp, err := s.do(http.MethodGet, path, nil, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := resp.problem(http.StatusNotFound, problemType); err != nil {
+			return fmt.Errorf("GET %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (s *suite) malformedReceipt() error {
+	resp, err := s.do(http.MethodPost, "/receipts/process", nil, []byte(`{"retailer": `))
+	if err != nil {
+		return err
+	}
+	_, err = resp.problem(http.StatusBadRequest, problemType)
+	return err
+}
+
+func (s *suite) legacyProblem() error {
+	resp, err := s.do(http.MethodGet, "/receipts/"+missingID+"/points", http.Header{"Accept": {"application/json"}}, nil)
+	if err != nil {
+		return err
+	}
+	_, err = resp.problem(http.StatusNotFound, "application/json")
+	return err
+}
+
+func (s *suite) unknownRoute() error {
+	resp, err := s.do(http.MethodGet, "/no-such-route", nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = resp.problem(http.StatusNotFound, problemType)
+	return err
+}
+
+func (s *suite) unsupportedMethod() error {
+	resp, err := s.do(http.MethodPut, "/receipts/process", nil, []byte(`{}`))
+	if err != nil {
+		return err
+	}
+	_, err = resp.problem(http.StatusMethodNotAllowed, problemType)
+	return err
+}
+
+// sampleReceipt returns a valid receipt purchased today, for checks that need a stored receipt
+func sampleReceipt() ([]byte, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"retailer":     "Conformance Check",
+		"purchaseDate": time.Now().UTC().Format("2006-01-02"),
+		"purchaseTime": "13:01",
+		"items":        []map[string]string{{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}},
+		"total":        "6.49",
+	})
+	return data, err
+}
+
+func (s *suite) versionPrefix() error {
+	body, err := sampleReceipt()
+	if err != nil {
+		return err
+	}
+	id, err := s.submit(body)
+	if err != nil {
+		return err
+	}
+	var legacy, versioned json.RawMessage
+	for path, out := range map[string]*json.RawMessage{"/receipts/" + id + "/points": &legacy, "/v1/receipts/" + id + "/points": &versioned} {
+		resp, err := s.do(http.MethodGet, path, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := resp.json(http.StatusOK, out); err != nil {
+			return fmt.Errorf("GET %s: %w", path, err)
+		}
+	}
+	if !bytes.Equal(bytes.TrimSpace(legacy), bytes.TrimSpace(versioned)) {
+		return fmt.Errorf("/receipts/{id}/points answered %s but /v1/receipts/{id}/points %s", legacy, versioned)
+	}
+	return nil
+}
+
+// listed is a receipt as listed
+type listed struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *suite) list(query string) ([]listed, error) {
+	resp, err := s.do(http.MethodGet, "/receipts"+query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var page struct {
+		Receipts []listed `json:"receipts"`
+	}
+	if err := resp.json(http.StatusOK, &page); err != nil {
+		return nil, fmt.Errorf("GET /receipts%s: %w", query, err)
+	}
+	return page.Receipts, nil
+}
+
+func (s *suite) listingOrder() error {
+	ascending, err := s.list("")
+	if err != nil {
+		return err
+	}
+	if len(ascending) < 2 {
+		return fmt.Errorf("GET /receipts listed %d receipts after the fixtures were submitted", len(ascending))
+	}
+	for i := 1; i < len(ascending); i++ {
+		if ascending[i].CreatedAt.Before(ascending[i-1].CreatedAt) {
+			return fmt.Errorf("GET /receipts lists %s before the older %s", ascending[i-1].ID, ascending[i].ID)
+		}
+	}
+	descending, err := s.list("?order=desc")
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(descending); i++ {
+		if descending[i].CreatedAt.After(descending[i-1].CreatedAt) {
+			return fmt.Errorf("GET /receipts?order=desc lists %s before the newer %s", descending[i-1].ID, descending[i].ID)
+		}
+	}
+	return nil
+}
+
+func (s *suite) listingBadOrder() error {
+	resp, err := s.do(http.MethodGet, "/receipts?order=sideways", nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = resp.problem(http.StatusBadRequest, problemType)
+	return err
+}
+
+func (s *suite) searchLimit() error {
+	// Two matches make sure the limit is what cuts the results to one
+	for i := 0; i < 2; i++ {
+		body, err := sampleReceipt()
+		if err != nil {
+			return err
+		}
+		if _, err := s.submit(body); err != nil {
+			return err
+		}
+	}
+	resp, err := s.do(http.MethodGet, "/receipts/search?q=conformance&limit=1", nil, nil)
+	if err != nil {
+		return err
+	}
+	var page struct {
+		Results []json.RawMessage `json:"results"`
+	}
+	if err := resp.json(http.StatusOK, &page); err != nil {
+		return fmt.Errorf("GET /receipts/search: %w", err)
+	}
+	if len(page.Results) != 1 {
+		return fmt.Errorf("GET /receipts/search?limit=1 answered %d results, want 1", len(page.Results))
+	}
+	return nil
+}
+
+func (s *suite) searchBadLimit() error {
+	resp, err := s.do(http.MethodGet, "/receipts/search?q=conformance&limit=0", nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = resp.problem(http.StatusBadRequest, problemType)
+	return err
+}
@@ -0,0 +1,60 @@
+// Command conformance runs a black-box test suite against a running receipt processor, so forks and
+// alternative implementations can check they keep the API's contract:
+//
+//	go run ./cmd/conformance -url http://localhost:8080
+//
+// It submits every fixture in testdata/receipts and expects the valid ones to be accepted and
+// scored as testdata/golden records, and the invalid ones to be rejected with a problem listing
+// the invalid fields. It then checks the error format of unknown receipts, routes and methods and
+// of malformed bodies, the version prefix, and the ordering and limits of listings and searches.
+//
+// The golden points are those of the default rule-set, so run it against a server without a
+// ruleSetPath, category bonuses, fraud rejection, purchase date checks or asynchronous processing.
+// Every fixture is submitted again on each run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server under test")
+	fixtures := flag.String("fixtures", "testdata", "directory holding the receipts/ fixtures and their golden/ outcomes")
+	apiKey := flag.String("api-key", "", "API key sent with every request, for servers that require one")
+	timeout := flag.Duration("timeout", 10*time.Second, "time allowed for each request")
+	flag.Parse()
+
+	s := &suite{
+		baseURL: strings.TrimSuffix(*baseURL, "/"),
+		apiKey:  *apiKey,
+		client:  &http.Client{Timeout: *timeout},
+	}
+	cases, err := loadFixtures(*fixtures)
+	if err != nil {
+		log.Fatalf("loading fixtures: %v", err)
+	}
+	if len(cases) == 0 {
+		log.Fatalf("no fixtures found in %s/receipts", *fixtures)
+	}
+
+	passed, failed := 0, 0
+	for _, c := range s.checks(cases) {
+		if err := c.run(); err != nil {
+			fmt.Printf("FAIL %s: %v\n", c.name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", c.name)
+		passed++
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,210 @@
+// Command migrate-store copies every receipt from one store backend to another, for moving from
+// the default in-memory store to PostgreSQL, or between databases.
+//
+// The in-memory store keeps nothing once the server stops, so take a snapshot with
+// POST /admin/snapshot first and copy from the snapshot file:
+//
+//	go run ./cmd/migrate-store -from snapshots/snapshot-20240101T120000Z.jsonl.gz -to postgres://localhost/receipts
+//
+// Each side is a PostgreSQL URL or the path of a snapshot file. Receipts are copied oldest first
+// and the last one copied is checkpointed to the -progress file, so an interrupted copy to
+// PostgreSQL resumes where it stopped when run again. The ledger, referrals and streaks live in
+// their own files whichever store is used, so they need no migration.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"receipt-processor/store"
+)
+
+// checkpoint is the position of the last receipt copied, in the oldest-first order of store.List
+type checkpoint struct {
+	CreatedAt time.Time `json:"createdAt"`
+	ID        string    `json:"id"`
+	Copied    int       `json:"copied"`
+}
+
+// after reports whether record comes after the checkpoint
+func (c checkpoint) after(record store.Record) bool {
+	if record.CreatedAt.Equal(c.CreatedAt) {
+		return record.ID > c.ID
+	}
+	return record.CreatedAt.After(c.CreatedAt)
+}
+
+func main() {
+	from := flag.String("from", "", "PostgreSQL URL or snapshot file to copy receipts from")
+	to := flag.String("to", "", "PostgreSQL URL or snapshot file to copy receipts to")
+	progressPath := flag.String("progress", "migrate-store.progress", "file recording the last receipt copied, so an interrupted copy resumes")
+	every := flag.Int("checkpoint", 500, "receipts copied between checkpoints")
+	flag.Parse()
+
+	if *from == "" || *to == "" {
+		log.Fatal("both -from and -to are required")
+	}
+	if *every < 1 {
+		log.Fatal("-checkpoint must be at least 1")
+	}
+
+	source, closeSource, err := openSource(*from)
+	if err != nil {
+		log.Fatalf("opening %s: %v", redact(*from), err)
+	}
+	defer closeSource()
+	records, err := source.List()
+	if err != nil {
+		log.Fatalf("listing receipts: %v", err)
+	}
+
+	// A snapshot is written in one go, so there is nothing to resume
+	if !isDatabase(*to) {
+		file, err := os.Create(*to)
+		if err != nil {
+			log.Fatalf("creating %s: %v", *to, err)
+		}
+		if err := store.WriteRecords(file, records); err != nil {
+			file.Close()
+			log.Fatalf("writing %s: %v", *to, err)
+		}
+		if err := file.Close(); err != nil {
+			log.Fatalf("writing %s: %v", *to, err)
+		}
+		log.Printf("copied %d receipts to %s", len(records), *to)
+		return
+	}
+
+	destination, closeDestination, err := openDatabase(*to)
+	if err != nil {
+		log.Fatalf("opening %s: %v", redact(*to), err)
+	}
+	defer closeDestination()
+
+	progress, err := loadCheckpoint(*progressPath)
+	if err != nil {
+		log.Fatalf("reading %s: %v", *progressPath, err)
+	}
+	if progress.Copied > 0 {
+		log.Printf("resuming after %d receipts, from receipt %s", progress.Copied, progress.ID)
+	}
+	skipped := 0
+	for _, record := range records {
+		if progress.ID != "" && !progress.after(record) {
+			skipped++
+			continue
+		}
+		if err := destination.Save(record); err != nil {
+			log.Fatalf("copying receipt %s: %v", record.ID, err)
+		}
+		progress = checkpoint{CreatedAt: record.CreatedAt, ID: record.ID, Copied: progress.Copied + 1}
+		if progress.Copied%*every == 0 {
+			if err := saveCheckpoint(*progressPath, progress); err != nil {
+				log.Fatalf("writing %s: %v", *progressPath, err)
+			}
+			log.Printf("copied %d of %d receipts", progress.Copied, len(records))
+		}
+	}
+	if err := saveCheckpoint(*progressPath, progress); err != nil {
+		log.Fatalf("writing %s: %v", *progressPath, err)
+	}
+	log.Printf("copied %d receipts to %s, %d were copied by an earlier run", len(records)-skipped, redact(*to), skipped)
+}
+
+func isDatabase(target string) bool {
+	return strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://")
+}
+
+// openSource opens a database, or loads a snapshot file into memory
+func openSource(source string) (store.Store, func(), error) {
+	if isDatabase(source) {
+		return openDatabase(source)
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	memory := store.NewMemory(store.MemoryOptions{})
+	if _, err := store.ReadSnapshot(file, memory); err != nil {
+		return nil, nil, err
+	}
+	return memory, func() {}, nil
+}
+
+func openDatabase(url string) (store.Store, func(), error) {
+	db, err := sql.Open("pgx", url)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	postgres, err := store.NewPostgres(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return postgres, func() { db.Close() }, nil
+}
+
+// loadCheckpoint reads the progress of an earlier run, or an empty checkpoint when there was none
+func loadCheckpoint(path string) (checkpoint, error) {
+	var progress checkpoint
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return progress, err
+	}
+	return progress, json.Unmarshal(data, &progress)
+}
+
+// saveCheckpoint atomically replaces the progress file
+func saveCheckpoint(path string, progress checkpoint) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".migrate-store-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// redact hides the password of a database URL before it is logged
+func redact(url string) string {
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		return url
+	}
+	credentials, host, ok := strings.Cut(rest, "@")
+	if !ok {
+		return url
+	}
+	if user, _, hasPassword := strings.Cut(credentials, ":"); hasPassword {
+		return fmt.Sprintf("%s://%s:***@%s", scheme, user, host)
+	}
+	return url
+}
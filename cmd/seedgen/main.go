@@ -0,0 +1,194 @@
+// Command seedgen generates realistic random receipts for load testing and benchmarking.
+//
+// By default the receipts are written to stdout as one JSON object per line. With -target they
+// are submitted to a running server instead:
+//
+//	go run ./cmd/seedgen -n 10000 -target http://localhost:8080 -concurrency 8
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/client"
+	"receipt-processor/receipt"
+)
+
+var defaultRetailers = []string{
+	"Target", "Walgreens", "M&M Corner Market", "Costco Wholesale", "Trader Joes",
+	"Whole Foods Market", "7-Eleven", "Home Depot", "Corner Bakery & Cafe", "Safeway",
+}
+
+var products = []string{
+	"Mountain Dew 12PK", "Emils Cheese Pizza", "Knorr Creamy Chicken", "Doritos Nacho Cheese",
+	"Klarbrunn 12-PK 12 FL OZ", "Gatorade", "Pepsi - 12-oz", "Dasani", "Paper Towels", "Bananas",
+	"Whole Milk", "Sourdough Bread", "Avocados", "Orange Juice", "Eggs - Dozen", "Coffee Beans",
+	"Ground Beef", "Greek Yogurt", "Batteries AA 8PK", "Dish Soap",
+}
+
+func main() {
+	count := flag.Int("n", 100, "number of receipts to generate")
+	retailers := flag.String("retailers", strings.Join(defaultRetailers, ","), "comma-separated retailer names to pick from")
+	minItems := flag.Int("min-items", 1, "minimum items per receipt")
+	maxItems := flag.Int("max-items", 10, "maximum items per receipt")
+	from := flag.String("from", time.Now().AddDate(-1, 0, 0).Format("2006-01-02"), "earliest purchase date (YYYY-MM-DD)")
+	to := flag.String("to", time.Now().Format("2006-01-02"), "latest purchase date (YYYY-MM-DD)")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed, for reproducible data sets")
+	target := flag.String("target", "", "base URL of a server to submit the receipts to instead of printing them")
+	concurrency := flag.Int("concurrency", 4, "parallel submissions when -target is set")
+	signingSecret := flag.String("signing-secret", os.Getenv("SIGNING_SECRET"), "secret to sign submissions with when the server requires signatures")
+	flag.Parse()
+
+	startDate, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatalf("invalid -from date: %v", err)
+	}
+	endDate, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		log.Fatalf("invalid -to date: %v", err)
+	}
+	if endDate.Before(startDate) {
+		log.Fatal("-to must not be before -from")
+	}
+	if *minItems < 1 || *maxItems < *minItems {
+		log.Fatal("item counts must satisfy 1 <= -min-items <= -max-items")
+	}
+
+	generator := &generator{
+		rng:       rand.New(rand.NewSource(*seed)),
+		retailers: splitNonEmpty(*retailers),
+		minItems:  *minItems,
+		maxItems:  *maxItems,
+		startDate: startDate,
+		days:      int(endDate.Sub(startDate).Hours()/24) + 1,
+	}
+	if len(generator.retailers) == 0 {
+		log.Fatal("at least one retailer is required")
+	}
+
+	receipts := make(chan receipt.Receipt)
+	go func() {
+		defer close(receipts)
+		for i := 0; i < *count; i++ {
+			receipts <- generator.receipt()
+		}
+	}()
+
+	if *target == "" {
+		encoder := json.NewEncoder(os.Stdout)
+		for r := range receipts {
+			if err := encoder.Encode(r); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+	submit(*target, *concurrency, *signingSecret, receipts)
+}
+
+type generator struct {
+	rng       *rand.Rand
+	retailers []string
+	minItems  int
+	maxItems  int
+	startDate time.Time
+	days      int
+}
+
+// receipt builds a random receipt that passes validation, with a total matching its items
+func (g *generator) receipt() receipt.Receipt {
+	itemCount := g.minItems + g.rng.Intn(g.maxItems-g.minItems+1)
+	items := make([]receipt.Item, itemCount)
+	totalCents := 0
+	for i := range items {
+		cents := g.priceCents()
+		totalCents += cents
+		items[i] = receipt.Item{
+			ShortDescription: products[g.rng.Intn(len(products))],
+			Price:            formatCents(cents),
+		}
+	}
+
+	purchaseDate := g.startDate.AddDate(0, 0, g.rng.Intn(g.days))
+	return receipt.Receipt{
+		Retailer:     g.retailers[g.rng.Intn(len(g.retailers))],
+		PurchaseDate: purchaseDate.Format("2006-01-02"),
+		PurchaseTime: fmt.Sprintf("%02d:%02d", g.rng.Intn(24), g.rng.Intn(60)),
+		Items:        items,
+		Total:        formatCents(totalCents),
+	}
+}
+
+// priceCents returns a price skewed towards everyday amounts, with round and quarter prices mixed in
+func (g *generator) priceCents() int {
+	dollars := int(g.rng.ExpFloat64() * 6)
+	switch g.rng.Intn(4) {
+	case 0:
+		return dollars * 100
+	case 1:
+		return dollars*100 + 25*g.rng.Intn(4)
+	default:
+		return dollars*100 + g.rng.Intn(100)
+	}
+}
+
+func formatCents(cents int) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// submit posts the receipts to the server with the given number of workers
+func submit(target string, concurrency int, signingSecret string, receipts <-chan receipt.Receipt) {
+	c := client.New(target, client.Options{SigningSecret: signingSecret})
+	ctx := context.Background()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		submitted int
+		failed    int
+	)
+	started := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range receipts {
+				_, err := c.ProcessReceipt(ctx, r)
+				mu.Lock()
+				if err != nil {
+					failed++
+					log.Printf("submitting receipt: %v", err)
+				} else {
+					submitted++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(started)
+	log.Printf("submitted %d receipts (%d failed) in %s, %.0f receipts/s",
+		submitted, failed, elapsed.Round(time.Millisecond), float64(submitted)/elapsed.Seconds())
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func splitNonEmpty(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
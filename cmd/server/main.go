@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"receipt-processor/accesslog"
+	"receipt-processor/api"
+	"receipt-processor/audit"
+	"receipt-processor/auth"
+	"receipt-processor/blob"
+	"receipt-processor/bodylog"
+	"receipt-processor/buildinfo"
+	"receipt-processor/catalog"
+	"receipt-processor/clock"
+	"receipt-processor/coldstorage"
+	"receipt-processor/config"
+	"receipt-processor/deadletter"
+	"receipt-processor/erasure"
+	"receipt-processor/faults"
+	"receipt-processor/fraud"
+	"receipt-processor/idempotency"
+	"receipt-processor/ids"
+	"receipt-processor/jobs"
+	"receipt-processor/leader"
+	"receipt-processor/ledger"
+	"receipt-processor/limits"
+	"receipt-processor/locale"
+	"receipt-processor/notify"
+	"receipt-processor/outbox"
+	"receipt-processor/pipeline"
+	"receipt-processor/referrals"
+	"receipt-processor/report"
+	"receipt-processor/retailers"
+	"receipt-processor/retention"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+	"receipt-processor/streaks"
+	"receipt-processor/taxonomy"
+	"receipt-processor/tiers"
+	"receipt-processor/warehouse"
+)
+
+// poolReportInterval is the time between updates of the database pool metrics
+const poolReportInterval = 15 * time.Second
+
+// leaseTTL is how long an instance that stopped holds on to the leader lease before another takes over
+const leaseTTL = 30 * time.Second
+
+func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file")
+	checkOnly := flag.Bool("validate-config", false, "check the config, the files it names and the connections it needs, then exit")
+	flag.Parse()
+
+	if *checkOnly {
+		if !validateConfig(os.Stdout, *configPath) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("loading config: %v", err)
+	}
+
+	// Wire the API to a store shared through the database, or an in-memory one, optionally behind a read cache
+	var receipts store.Store
+	var keys idempotency.Keys
+	var lease *leader.Lease
+	var points ledger.Book
+	var nonces auth.Nonces
+	var referralStore referrals.Store
+	var streakStore streaks.Store
+	var auditLog audit.Store
+	var deadLetters deadletter.Store
+	var registry retailers.Store
+	jobOpts := jobs.Options{Path: cfg.JobPath}
+	var postgres *store.Postgres
+	// receiptLocker locks receipts across instances sharing the database
+	var receiptLocker store.Locks
+	if cfg.DatabaseURL != "" {
+		db, err := sql.Open("pgx", cfg.DatabaseURL)
+		if err == nil {
+			err = db.Ping()
+		}
+		if err != nil {
+			log.Fatalf("connecting to the database: %v", err)
+		}
+		defer db.Close()
+		configurePool(db, cfg)
+		// Replicas are only pinged to warn early; reads fall back to the primary while they are unreachable
+		var replicas []*sql.DB
+		for _, url := range cfg.DatabaseReplicaURLs {
+			replica, err := sql.Open("pgx", url)
+			if err != nil {
+				log.Fatalf("opening read replica: %v", err)
+			}
+			defer replica.Close()
+			configurePool(replica, cfg)
+			if err := replica.Ping(); err != nil {
+				log.Printf("read replica unreachable, reading from the primary until it is back: %v", err)
+			}
+			replicas = append(replicas, replica)
+		}
+		postgres, err = store.NewPostgres(db, replicas...)
+		if err != nil {
+			log.Fatalf("opening receipt store: %v", err)
+		}
+		receipts = postgres
+		receiptLocker = postgres
+		poolCtx, stopPools := context.WithCancel(context.Background())
+		defer stopPools()
+		go postgres.ReportPools(poolCtx, poolReportInterval)
+		if keys, err = idempotency.NewPostgres(db, time.Duration(cfg.IdempotencyTTL)); err != nil {
+			log.Fatalf("opening idempotency keys: %v", err)
+		}
+		// Balances and used nonces are shared too, so every instance credits and refuses the same
+		if points, err = ledger.NewPostgres(db); err != nil {
+			log.Fatalf("opening ledger: %v", err)
+		}
+		// A nonce only needs remembering until its timestamp leaves the window, up to twice the window away
+		if nonces, err = auth.NewPostgresNonces(db, 2*time.Duration(cfg.ReplayWindow)); err != nil {
+			log.Fatalf("opening request nonces: %v", err)
+		}
+		// Referral and streak bonuses are paid once whichever instance approves the receipt
+		if referralStore, err = referrals.NewPostgres(db); err != nil {
+			log.Fatalf("opening referrals: %v", err)
+		}
+		if streakStore, err = streaks.NewPostgres(db); err != nil {
+			log.Fatalf("opening streaks: %v", err)
+		}
+		// Every instance records to one audit log, retries from one dead-letter queue and links to one registry
+		if auditLog, err = audit.NewPostgres(db); err != nil {
+			log.Fatalf("opening audit log: %v", err)
+		}
+		if deadLetters, err = deadletter.NewPostgres(db); err != nil {
+			log.Fatalf("opening dead-letter queue: %v", err)
+		}
+		if registry, err = retailers.NewPostgres(db); err != nil {
+			log.Fatalf("opening retailer registry: %v", err)
+		}
+		if jobOpts.Store, err = jobs.NewPostgres(db); err != nil {
+			log.Fatalf("opening jobs: %v", err)
+		}
+		// Only the instance holding the lease runs background jobs
+		if lease, err = leader.NewLease(db, "background-jobs", cfg.InstanceID, leaseTTL); err != nil {
+			log.Fatalf("opening leader lease: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go lease.Run(ctx)
+		// Any instance queues, reports and cancels jobs, but only the lease holder runs them
+		jobOpts.Leader = lease
+	} else {
+		memory := store.NewMemory(store.MemoryOptions{
+			MaxReceipts: cfg.MaxReceipts,
+			MaxBytes:    cfg.MaxStoreBytes,
+			TTL:         time.Duration(cfg.ReceiptTTL),
+		})
+		defer memory.Close()
+		receipts = memory
+		keys = idempotency.NewMemory(time.Duration(cfg.IdempotencyTTL))
+		if points, err = ledger.Open(cfg.LedgerPath, clock.System{}); err != nil {
+			log.Fatalf("opening ledger: %v", err)
+		}
+		if referralStore, err = referrals.Open(cfg.ReferralPath, clock.System{}); err != nil {
+			log.Fatalf("opening referrals: %v", err)
+		}
+		if streakStore, err = streaks.Open(cfg.StreakPath); err != nil {
+			log.Fatalf("opening streaks: %v", err)
+		}
+		if auditLog, err = audit.Open(cfg.AuditLogPath); err != nil {
+			log.Fatalf("opening audit log: %v", err)
+		}
+		if deadLetters, err = deadletter.Open(cfg.DeadLetterPath); err != nil {
+			log.Fatalf("opening dead-letter queue: %v", err)
+		}
+		if registry, err = retailers.Open(cfg.RetailerRegistryPath); err != nil {
+			log.Fatalf("opening retailer registry: %v", err)
+		}
+	}
+	if cfg.CacheSize > 0 {
+		cached := store.NewCached(receipts, store.CacheOptions{Size: cfg.CacheSize, TTL: time.Duration(cfg.CacheTTL)})
+		receipts = cached
+		// Drop the copies of receipts other instances change
+		if postgres != nil {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go postgres.WatchChanges(ctx, cached.Invalidate)
+		}
+	}
+
+	// Keep snapshots and archives in object storage when a blob store is configured
+	objects, err := openBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("opening blob store: %v", err)
+	}
+
+	// Purge old and trashed receipts in the background when a retention age is configured
+	var sweeper *retention.Sweeper
+	if cfg.RetentionMaxAge > 0 || cfg.TrashMaxAge > 0 {
+		retentionOpts := retention.Options{
+			MaxAge:      time.Duration(cfg.RetentionMaxAge),
+			TrashMaxAge: time.Duration(cfg.TrashMaxAge),
+			Interval:    time.Duration(cfg.RetentionInterval),
+		}
+		if cfg.ArchiveDir != "" {
+			retentionOpts.Archive = blobStore(objects, cfg.ArchiveDir)
+		}
+		if lease != nil {
+			retentionOpts.Leader = lease
+		}
+		sweeper = retention.NewSweeper(receipts, retentionOpts)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go sweeper.Run(ctx)
+	}
+
+	// Move old receipts to cold storage in the background, leaving stubs to rehydrate them from
+	var archiver *coldstorage.Archiver
+	if cfg.ColdStorageAfterMonths > 0 {
+		coldOpts := coldstorage.Options{
+			AfterMonths: cfg.ColdStorageAfterMonths,
+			Interval:    time.Duration(cfg.ColdStorageInterval),
+			Objects:     blobStore(objects, cfg.ColdStorageDir),
+		}
+		if lease != nil {
+			coldOpts.Leader = lease
+		}
+		archiver = coldstorage.New(receipts, coldOpts)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go archiver.Run(ctx)
+	}
+
+	erasures, err := erasure.Open(cfg.ErasureLogPath, clock.System{})
+	if err != nil {
+		log.Fatalf("opening erasure log: %v", err)
+	}
+	if err := erasures.Verify(); err != nil {
+		log.Printf("WARNING: %v; the erasure log may have been tampered with", err)
+	}
+
+	var accessLog *accesslog.Logger
+	if cfg.AccessLogPath != "" {
+		if accessLog, err = accesslog.Open(cfg.AccessLogPath); err != nil {
+			log.Fatalf("opening access log: %v", err)
+		}
+	}
+	backgroundJobs, err := jobs.Open(jobOpts)
+	if err != nil {
+		log.Fatalf("opening jobs: %v", err)
+	}
+
+	var categories *taxonomy.Taxonomy
+	if cfg.CategoryTaxonomyPath != "" {
+		if categories, err = taxonomy.Load(cfg.CategoryTaxonomyPath); err != nil {
+			log.Fatalf("loading category taxonomy: %v", err)
+		}
+	}
+	ruleSet, err := loadRuleSet(cfg)
+	if err != nil {
+		log.Fatalf("loading rule-set: %v", err)
+	}
+	engine := scoring.NewEngine(ruleSet)
+
+	// Config validation already rejected unknown ID strategies and fraud actions
+	idGenerator, _ := ids.New(cfg.IDStrategy, cfg.IDNode)
+	fraudAction, _ := fraud.ParseAction(cfg.FraudAction)
+	detector := fraud.NewDetector(fraudAction,
+		fraud.ImpossibleTotal{MaxTotal: cfg.FraudMaxTotal},
+		fraud.ItemCount{Max: cfg.FraudMaxItems},
+		fraud.Duplicate{Store: receipts, Window: time.Duration(cfg.FraudDuplicateWindow)},
+	)
+	thresholds := tiers.DefaultThresholds
+	if len(cfg.TierThresholds) > 0 {
+		thresholds = cfg.TierThresholds
+	}
+	loyaltyTiers := tiers.New(thresholds)
+	purchaseDateAction, _ := fraud.ParseAction(cfg.PurchaseDateAction)
+	window := fraud.PurchaseWindow{
+		Action:             purchaseDateAction,
+		MaxAgeDays:         cfg.PurchaseDateMaxAgeDays,
+		MaxAgeDaysByCaller: cfg.PurchaseDateMaxAgeByCaller,
+	}
+	locales := make(map[string]locale.Format, len(cfg.ReceiptLocaleByCaller))
+	for caller, name := range cfg.ReceiptLocaleByCaller {
+		locales[caller] = locale.Formats[name]
+	}
+
+	// Notify the configured channels of the events they subscribed to
+	var smtpServer *notify.SMTP
+	if cfg.SMTPAddr != "" {
+		smtpServer = &notify.SMTP{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.SMTPFrom}
+	}
+	var notifier *notify.Notifier
+	if len(cfg.Notifications.Channels) > 0 {
+		notifyOpts := notify.Options{
+			Channels:         make(map[string]notify.Channel),
+			Subscriptions:    make(map[notify.Event][]string),
+			FailureThreshold: cfg.Notifications.FailureThreshold,
+			FailureWindow:    time.Duration(cfg.Notifications.FailureWindow),
+		}
+		for name, channel := range cfg.Notifications.Channels {
+			if channel.Type == "slack" {
+				notifyOpts.Channels[name] = notify.NewSlack(channel.Webhook, cfg.Resilience["slack"].Policy(), nil)
+			} else {
+				notifyOpts.Channels[name] = notify.Email{Server: *smtpServer, To: channel.To}
+			}
+			for _, event := range channel.Events {
+				notifyOpts.Subscriptions[notify.Event(event)] = append(notifyOpts.Subscriptions[notify.Event(event)], name)
+			}
+		}
+		notifier = notify.New(notifyOpts)
+	}
+
+	// Produce the scheduled reports, on the leader only when instances share a database
+	if len(cfg.Reports) > 0 {
+		reportOpts := report.Options{
+			Output:   blobStore(objects, cfg.ReportDir),
+			Webhooks: cfg.Resilience["report-webhooks"].Policy(),
+		}
+		// Config validation already parsed every report schedule
+		for _, r := range cfg.Reports {
+			definition, _ := r.Definition()
+			reportOpts.Reports = append(reportOpts.Reports, definition)
+		}
+		reportOpts.ExcludeTags = cfg.StatsExcludedTags
+		reportOpts.Mail = smtpServer
+		reportOpts.Notifier = notifier
+		if lease != nil {
+			reportOpts.Leader = lease
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go report.NewScheduler(receipts, reportOpts).Run(ctx)
+	}
+
+	// Publish an event for every receipt change from the outbox the store records them in
+	var events store.Outbox
+	var relay *outbox.Relay
+	if cfg.OutboxWebhook != "" || cfg.Warehouse != "" {
+		// Every store records events in an outbox
+		events = receipts.(store.Outbox)
+		relayOpts := outbox.Options{
+			Webhook:  cfg.OutboxWebhook,
+			Policy:   cfg.Resilience["outbox-webhook"].Policy(),
+			Interval: time.Duration(cfg.OutboxInterval),
+			// Every store keeps a delivery log
+			Deliveries: receipts.(store.DeliveryLog),
+			IDs:        idGenerator,
+		}
+		sink, err := newWarehouse(cfg)
+		if err != nil {
+			log.Fatalf("configuring the warehouse: %v", err)
+		}
+		if sink != nil {
+			relayOpts.Sink = sink
+		}
+		if lease != nil {
+			relayOpts.Leader = lease
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		relay = outbox.NewRelay(events, relayOpts)
+		go relay.Run(ctx)
+	}
+
+	// Look items up in the product catalog before they are scored
+	var hooks []pipeline.Hook
+	if cfg.CatalogURL != "" {
+		products := catalog.New(catalog.Options{
+			URL:      cfg.CatalogURL,
+			Policy:   cfg.Resilience["catalog"].Policy(),
+			CacheTTL: time.Duration(cfg.CatalogCacheTTL),
+		})
+		hooks = append(hooks, products.Hook())
+	}
+	if notifier != nil {
+		hooks = append(hooks, notifier.Hooks()...)
+	}
+
+	authn := auth.New(cfg.APIKeys)
+	bodyLogger := bodylog.New(cfg.BodyLog, nil)
+	var injector *faults.Injector
+	if cfg.FaultInjection.Enabled {
+		injector = faults.New(cfg.FaultInjection.Active())
+		log.Printf("WARNING: fault injection is enabled with %d rules; requests will be delayed, failed or dropped on purpose", len(cfg.FaultInjection.Rules))
+	}
+	server := api.New(api.Options{
+		Store:            receipts,
+		Engine:           engine,
+		ScoringWorkers:   cfg.ScoringWorkers,
+		Hooks:            hooks,
+		AsyncQueueSize:   cfg.AsyncQueueSize,
+		AsyncMaxAttempts: cfg.AsyncMaxAttempts,
+		DeadLetters:      deadLetters,
+		Jobs:             backgroundJobs,
+		MaxBatchSize:     cfg.MaxBatchSize,
+		Snapshots:        blobStore(objects, cfg.SnapshotDir),
+		Retention:        sweeper,
+		ColdStorage:      archiver,
+		Erasures:         erasures,
+		Audit:            auditLog,
+		AccessLog:        accessLog,
+		Auth:             authn,
+		Ledger:           points,
+		BodyLog:          bodyLogger,
+		IDs:              idGenerator,
+		Idempotency:      keys,
+		Retailers:        registry,
+		Taxonomy:         categories,
+		Fraud:            detector,
+		PurchaseWindow:   window,
+		Locales:          locales,
+		Limits: limits.Limits{
+			ReceiptsPerDay: cfg.UserReceiptsPerDay,
+			PointsPerDay:   cfg.UserPointsPerDay,
+			PointsPerWeek:  cfg.UserPointsPerWeek,
+		},
+		Tiers:         loyaltyTiers,
+		Referrals:     referralStore,
+		ReferralBonus: cfg.ReferralBonus,
+		Streaks:       streakStore,
+		Outbox:        events,
+		Locks:         receiptLocker,
+		Relay:         relay,
+		ExcludedTags:  cfg.StatsExcludedTags,
+		AutoApprove:   cfg.AutoApprove,
+		SigningSecret: cfg.SigningSecret,
+		ReplayWindow:  time.Duration(cfg.ReplayWindow),
+		Nonces:        nonces,
+		Features:      cfg.Features(),
+		Faults:        injector,
+	})
+
+	// Apply edits to the config and rule-set files without a restart
+	if *configPath != "" || cfg.RuleSetPath != "" {
+		go func() {
+			err := config.Watch(context.Background(), *configPath, cfg, func(previous, next config.Config) error {
+				ruleSet, err := loadRuleSet(next)
+				if err != nil {
+					return err
+				}
+				// Leave runtime changes made through /admin/body-log alone unless the file changed them
+				if !reflect.DeepEqual(previous.BodyLog, next.BodyLog) {
+					if err := bodyLogger.Update(next.BodyLog); err != nil {
+						return err
+					}
+				}
+				// Fault injection rules can change, but turning it on or off needs a restart
+				if injector != nil {
+					if err := injector.Update(next.FaultInjection.Active()); err != nil {
+						return err
+					}
+				}
+				engine.SetRuleSet(ruleSet)
+				return nil
+			})
+			if err != nil {
+				log.Printf("WARNING: %v; config changes need a restart", err)
+			}
+		}()
+	}
+
+	// Serve profiles on their own port so it can stay off the public network
+	if cfg.DebugAddr != "" {
+		go func() {
+			fmt.Printf("Debug endpoints are running on %s\n", cfg.DebugAddr)
+			log.Fatal(http.ListenAndServe(cfg.DebugAddr, api.DebugHandler(authn)))
+		}()
+	}
+
+	// Start server
+	build := buildinfo.Get()
+	fmt.Printf("API %s (%s) is running on %s\n", build.Version, build.Commit, cfg.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Addr, server))
+}
+
+// configurePool applies the configured connection pool limits to a database
+func configurePool(db *sql.DB, cfg config.Config) {
+	db.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DatabaseMaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.DatabaseConnMaxLifetime))
+}
+
+// openBlobStore connects to the configured object storage, or returns nil to keep objects in local directories
+func openBlobStore(cfg config.Config) (blob.Store, error) {
+	switch cfg.BlobStore {
+	case "s3":
+		return blob.NewS3(blob.S3Options{Bucket: cfg.BlobBucket, Encryption: cfg.BlobEncryption, KMSKeyID: cfg.BlobKMSKey})
+	case "gcs":
+		return blob.NewGCS(blob.GCSOptions{Bucket: cfg.BlobBucket, KMSKeyName: cfg.BlobKMSKey})
+	}
+	return nil, nil
+}
+
+// newWarehouse returns the configured warehouse sink, nil when there is none
+func newWarehouse(cfg config.Config) (outbox.Sink, error) {
+	policy := cfg.Resilience["warehouse"].Policy()
+	switch cfg.Warehouse {
+	case "bigquery":
+		return warehouse.NewBigQuery(warehouse.BigQueryOptions{
+			Project: cfg.WarehouseProject,
+			Dataset: cfg.WarehouseDataset,
+			Table:   cfg.WarehouseTable,
+			Policy:  policy,
+		})
+	case "http":
+		return warehouse.NewEndpoint(warehouse.EndpointOptions{URL: cfg.WarehouseURL, Table: cfg.WarehouseTable, Policy: policy}), nil
+	}
+	return nil, nil
+}
+
+// blobStore returns the store for objects kept in dir: the directory itself, or the objects below
+// that prefix in object storage
+func blobStore(objects blob.Store, dir string) blob.Store {
+	if objects == nil {
+		return blob.NewDir(dir)
+	}
+	return blob.NewPrefixed(objects, strings.TrimPrefix(path.Clean("/"+dir), "/")+"/")
+}
+
+// loadRuleSet returns the rule-set configured by cfg: the rule-set file or the defaults, with the
+// configured category bonuses and points bounds
+func loadRuleSet(cfg config.Config) (scoring.RuleSet, error) {
+	ruleSet := scoring.DefaultRuleSet.Clone()
+	if cfg.RuleSetPath != "" {
+		var err error
+		if ruleSet, err = scoring.LoadRuleSet(cfg.RuleSetPath); err != nil {
+			return scoring.RuleSet{}, err
+		}
+	}
+	if cfg.CategoryBonuses != nil {
+		ruleSet.CategoryBonuses = cfg.CategoryBonuses
+	}
+	if cfg.MaxReceiptPoints > 0 {
+		ruleSet.MaxPoints = cfg.MaxReceiptPoints
+	}
+	if cfg.MinReceiptPoints != 0 {
+		ruleSet.MinPoints = cfg.MinReceiptPoints
+	}
+	return ruleSet, ruleSet.Validate()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"receipt-processor/blob"
+	"receipt-processor/config"
+	"receipt-processor/taxonomy"
+)
+
+// checkTimeout bounds each connectivity check of -validate-config
+const checkTimeout = 5 * time.Second
+
+// check is one step of -validate-config
+type check struct {
+	name string
+	run  func() error
+}
+
+// validateConfig loads the configuration and everything it points at without starting the server:
+// the rule-set and taxonomy files, the database and its replicas, the blob store and the warehouse.
+// It prints the outcome of every check to w and reports whether they all passed.
+func validateConfig(w io.Writer, path string) bool {
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(w, "FAIL config: %v\n", err)
+		return false
+	}
+	fmt.Fprintln(w, "ok   config")
+
+	checks := []check{
+		{name: "rule-set", run: func() error {
+			_, err := loadRuleSet(cfg)
+			return err
+		}},
+	}
+	if cfg.CategoryTaxonomyPath != "" {
+		checks = append(checks, check{name: "category taxonomy", run: func() error {
+			_, err := taxonomy.Load(cfg.CategoryTaxonomyPath)
+			return err
+		}})
+	}
+	if cfg.DatabaseURL != "" {
+		checks = append(checks, check{name: "database", run: func() error { return ping(cfg.DatabaseURL) }})
+		for i, url := range cfg.DatabaseReplicaURLs {
+			checks = append(checks, check{name: fmt.Sprintf("read replica %d", i+1), run: func() error { return ping(url) }})
+		}
+	}
+	if cfg.BlobStore != "" {
+		checks = append(checks, check{name: "blob store", run: func() error {
+			objects, err := openBlobStore(cfg)
+			if err != nil {
+				return err
+			}
+			return probeBlobStore(objects)
+		}})
+	}
+	if cfg.Warehouse != "" {
+		checks = append(checks, check{name: "warehouse", run: func() error {
+			_, err := newWarehouse(cfg)
+			return err
+		}})
+	}
+
+	passed := true
+	for _, c := range checks {
+		if err := c.run(); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.name, err)
+			passed = false
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s\n", c.name)
+	}
+	return passed
+}
+
+// ping connects to a database and checks it answers
+func ping(url string) error {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// probeBlobStore reads an object that doesn't exist, which a reachable bucket the credentials can
+// read answers with not found, without writing to it
+func probeBlobStore(objects blob.Store) error {
+	done := make(chan error, 1)
+	go func() {
+		body, err := objects.Get("receipt-processor-config-check")
+		if err == nil {
+			body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || errors.Is(err, blob.ErrNotFound) {
+			return nil
+		}
+		return err
+	case <-time.After(checkTimeout):
+		return fmt.Errorf("no answer within %s", checkTimeout)
+	}
+}
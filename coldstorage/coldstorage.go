@@ -0,0 +1,261 @@
+// Package coldstorage moves old receipts out of the store into compressed files in object storage,
+// leaving a stub of each in the store, and brings them back on demand.
+package coldstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"receipt-processor/blob"
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+	"receipt-processor/store"
+)
+
+var (
+	archivedReceipts   = metrics.NewCounter("receipts_cold_storage_archived_total", "Receipts moved to cold storage.")
+	rehydratedReceipts = metrics.NewCounter("receipts_cold_storage_rehydrated_total", "Receipts brought back from cold storage.")
+	archiveFailures    = metrics.NewCounter("receipts_cold_storage_failures_total", "Moves to cold storage that stopped on an error.")
+)
+
+// errFound stops reading an archive once the record looked for was read
+var errFound = errors.New("found")
+
+// Options configures an Archiver
+type Options struct {
+	// AfterMonths is how many months after processing a receipt is moved to cold storage
+	AfterMonths int
+	// Interval is the time between background moves, one day by default
+	Interval time.Duration
+	// Objects receives the archives
+	Objects blob.Store
+	// Leader, when set, limits background moves to the instance holding it; on-demand moves always run
+	Leader interface{ Held() bool }
+	// Clock tells how old receipts are, the system clock by default
+	Clock clock.Clock
+}
+
+// Result describes a completed move
+type Result struct {
+	Archived int    `json:"archived"`
+	Archive  string `json:"archive,omitempty"`
+}
+
+// Archiver moves receipts older than AfterMonths to cold storage
+type Archiver struct {
+	store store.Store
+	opts  Options
+	// mu keeps background and on-demand moves from running at the same time
+	mu sync.Mutex
+}
+
+func New(s store.Store, opts Options) *Archiver {
+	if opts.Interval <= 0 {
+		opts.Interval = 24 * time.Hour
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	return &Archiver{store: s, opts: opts}
+}
+
+// Archive writes every receipt processed more than AfterMonths ago, outside the trash, to one
+// archive, then replaces each with its stub
+func (a *Archiver) Archive(ctx context.Context) (Result, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	records, err := a.store.List()
+	if err != nil {
+		archiveFailures.Inc()
+		return Result{}, err
+	}
+	now := a.opts.Clock.Now()
+	cutoff := now.AddDate(0, -a.opts.AfterMonths, 0)
+	var due []store.Record
+	for _, record := range records {
+		if !record.Archived() && !record.Deleted() && record.CreatedAt.Before(cutoff) {
+			due = append(due, record)
+		}
+	}
+	if len(due) == 0 {
+		return Result{}, nil
+	}
+
+	// Upload the archive before stubbing anything, so a failed upload loses nothing
+	var buf bytes.Buffer
+	if err := store.WriteRecords(&buf, due); err != nil {
+		archiveFailures.Inc()
+		return Result{}, err
+	}
+	result := Result{Archive: "receipts-" + now.UTC().Format("20060102T150405.000Z") + ".jsonl.gz"}
+	if err := a.opts.Objects.Put(result.Archive, &buf); err != nil {
+		archiveFailures.Inc()
+		return Result{}, err
+	}
+	for _, record := range due {
+		if err := ctx.Err(); err != nil {
+			archivedReceipts.Add(float64(result.Archived))
+			return result, err
+		}
+		if err := a.store.Save(stub(record, result.Archive, now)); err != nil {
+			archiveFailures.Inc()
+			archivedReceipts.Add(float64(result.Archived))
+			return result, err
+		}
+		result.Archived++
+	}
+	archivedReceipts.Add(float64(result.Archived))
+	return result, nil
+}
+
+// stub drops the bulk of a record, keeping what listings, reports and balances read
+func stub(record store.Record, archive string, now time.Time) store.Record {
+	record.Receipt.Items, record.Receipt.Metadata, record.History = nil, nil, nil
+	record.ArchivedAt, record.Archive = &now, archive
+	return record
+}
+
+// Rehydrate brings an archived receipt back into the store, restoring the parts its stub dropped,
+// and returns it. A receipt that isn't archived is returned as it is, and one that doesn't exist is
+// store.ErrNotFound.
+func (a *Archiver) Rehydrate(id string) (store.Record, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	record, err := a.store.Get(id)
+	if err != nil || !record.Archived() {
+		return record, err
+	}
+	file, err := a.opts.Objects.Get(record.Archive)
+	if err != nil {
+		return store.Record{}, fmt.Errorf("opening archive %s: %w", record.Archive, err)
+	}
+	defer file.Close()
+
+	var archived *store.Record
+	err = store.ReadRecords(file, func(candidate store.Record) error {
+		if candidate.ID != id {
+			return nil
+		}
+		archived = &candidate
+		return errFound
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return store.Record{}, fmt.Errorf("reading archive %s: %w", record.Archive, err)
+	}
+	if archived == nil {
+		return store.Record{}, fmt.Errorf("archive %s has no receipt %s", record.Archive, id)
+	}
+
+	record.Receipt.Items, record.Receipt.Metadata, record.History = archived.Receipt.Items, archived.Receipt.Metadata, archived.History
+	record.ArchivedAt, record.Archive = nil, ""
+	if err := a.store.Save(record); err != nil {
+		return store.Record{}, err
+	}
+	rehydratedReceipts.Inc()
+	return record, nil
+}
+
+// Load reads the archived copies of the given stubs, keyed by ID, without bringing them back into
+// the store. Each archive is read once; records that aren't archived are skipped.
+func (a *Archiver) Load(stubs []store.Record) (map[string]store.Record, error) {
+	wanted := map[string]map[string]bool{}
+	for _, record := range stubs {
+		if !record.Archived() {
+			continue
+		}
+		if wanted[record.Archive] == nil {
+			wanted[record.Archive] = map[string]bool{}
+		}
+		wanted[record.Archive][record.ID] = true
+	}
+	archived := make(map[string]store.Record)
+	for archive, ids := range wanted {
+		file, err := a.opts.Objects.Get(archive)
+		if err != nil {
+			return nil, fmt.Errorf("opening archive %s: %w", archive, err)
+		}
+		err = store.ReadRecords(file, func(record store.Record) error {
+			if ids[record.ID] {
+				archived[record.ID] = record
+			}
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading archive %s: %w", archive, err)
+		}
+	}
+	return archived, nil
+}
+
+// Erase rewrites the archives holding the given records without them, so erased receipts don't
+// survive in cold storage once their stubs are deleted. Records that aren't archived are skipped.
+func (a *Archiver) Erase(records []store.Record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	erased := map[string]map[string]bool{}
+	for _, record := range records {
+		if !record.Archived() {
+			continue
+		}
+		if erased[record.Archive] == nil {
+			erased[record.Archive] = map[string]bool{}
+		}
+		erased[record.Archive][record.ID] = true
+	}
+	for archive, ids := range erased {
+		file, err := a.opts.Objects.Get(archive)
+		if err != nil {
+			return fmt.Errorf("opening archive %s: %w", archive, err)
+		}
+		var kept []store.Record
+		err = store.ReadRecords(file, func(record store.Record) error {
+			if !ids[record.ID] {
+				kept = append(kept, record)
+			}
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("reading archive %s: %w", archive, err)
+		}
+		var buf bytes.Buffer
+		if err := store.WriteRecords(&buf, kept); err != nil {
+			return err
+		}
+		if err := a.opts.Objects.Put(archive, &buf); err != nil {
+			return fmt.Errorf("rewriting archive %s: %w", archive, err)
+		}
+	}
+	return nil
+}
+
+// Run moves receipts to cold storage every Interval until ctx is cancelled
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.opts.Leader != nil && !a.opts.Leader.Held() {
+				continue
+			}
+			result, err := a.Archive(ctx)
+			if err != nil {
+				log.Printf("moving receipts to cold storage failed after %d receipts: %v", result.Archived, err)
+			} else if result.Archived > 0 {
+				log.Printf("moved %d receipts to cold storage in %s", result.Archived, result.Archive)
+			}
+		}
+	}
+}
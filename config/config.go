@@ -0,0 +1,1126 @@
+// Package config loads the server configuration from an optional JSON file and the environment.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-processor/auth"
+	"receipt-processor/bodylog"
+	"receipt-processor/faults"
+	"receipt-processor/fraud"
+	"receipt-processor/ids"
+	"receipt-processor/locale"
+	"receipt-processor/notify"
+	"receipt-processor/report"
+	"receipt-processor/resilience"
+	"receipt-processor/validation"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	// Addr is the address the HTTP server listens on
+	Addr string `json:"addr"`
+	// DebugAddr serves pprof and expvar to admin API keys on a separate address; empty disables it
+	DebugAddr string `json:"debugAddr"`
+	// ScoringWorkers bounds how many receipts of a batch or stream are scored concurrently
+	ScoringWorkers int `json:"scoringWorkers"`
+	// MaxBatchSize is the largest number of receipts accepted by the batch endpoint
+	MaxBatchSize int `json:"maxBatchSize"`
+	// AsyncQueueSize processes receipts submitted one at a time in the background, holding at most this
+	// many waiting; 0 processes them before answering
+	AsyncQueueSize int `json:"asyncQueueSize"`
+	// AsyncMaxAttempts is how many times a receipt is processed in the background before it is dead-lettered
+	AsyncMaxAttempts int `json:"asyncMaxAttempts"`
+	// DeadLetterPath persists the receipts background processing gave up on; empty keeps them in
+	// memory. With a DatabaseURL they are kept in the database instead.
+	DeadLetterPath string `json:"deadLetterPath"`
+	// JobPath persists background jobs so jobs interrupted by a restart run again; empty keeps them in
+	// memory. With a DatabaseURL the jobs are kept in the database instead.
+	JobPath string `json:"jobPath"`
+	// MaxReceipts caps the in-memory store, evicting the least recently used receipts; 0 is unlimited
+	MaxReceipts int `json:"maxReceipts"`
+	// MaxStoreBytes is the approximate memory budget of the in-memory store; 0 is unlimited
+	MaxStoreBytes int64 `json:"maxStoreBytes"`
+	// ReceiptTTL expires receipts from the in-memory store this long after they were processed; 0 keeps them
+	ReceiptTTL Duration `json:"receiptTTL"`
+	// DatabaseURL stores receipts, idempotency keys, the ledger, referrals, streaks, the audit log, the
+	// dead-letter queue, the retailer registry, background jobs, request nonces and the leader lease in
+	// PostgreSQL, shared by every instance given the same URL; empty keeps them in memory
+	DatabaseURL string `json:"databaseURL"`
+	// DatabaseReplicaURLs are read replicas of DatabaseURL that receipt reads, listings and searches are
+	// spread over; reads go to DatabaseURL while none is reachable
+	DatabaseReplicaURLs []string `json:"databaseReplicaURLs"`
+	// DatabaseMaxOpenConns caps the connections opened to each database; 0 is unlimited
+	DatabaseMaxOpenConns int `json:"databaseMaxOpenConns"`
+	// DatabaseMaxIdleConns is how many idle connections to each database are kept open for reuse
+	DatabaseMaxIdleConns int `json:"databaseMaxIdleConns"`
+	// DatabaseConnMaxLifetime closes connections this long after they were opened; 0 keeps them
+	DatabaseConnMaxLifetime Duration `json:"databaseConnMaxLifetime"`
+	// InstanceID names this instance when competing for the leader lease; it must differ between instances and
+	// defaults to the host name and process ID
+	InstanceID string `json:"instanceID"`
+	// IdempotencyTTL is how long an Idempotency-Key is remembered after it is first used
+	IdempotencyTTL Duration `json:"idempotencyTTL"`
+	// CacheSize caches this many recently read receipts in front of the store; 0 disables the cache
+	CacheSize int `json:"cacheSize"`
+	// CacheTTL bounds how long a cached receipt is served before it is read from the store again
+	CacheTTL Duration `json:"cacheTTL"`
+	// SnapshotDir is the directory snapshots are written to and restored from, or their key prefix
+	// in the blob store's bucket
+	SnapshotDir string `json:"snapshotDir"`
+	// RetentionMaxAge purges receipts this long after they were processed; 0 disables retention
+	RetentionMaxAge Duration `json:"retentionMaxAge"`
+	// TrashMaxAge purges receipts this long after they were moved to the trash; 0 keeps them there
+	TrashMaxAge Duration `json:"trashMaxAge"`
+	// RetentionInterval is the time between background retention sweeps
+	RetentionInterval Duration `json:"retentionInterval"`
+	// ArchiveDir receives purged receipts before deletion, or is their key prefix in the blob store's
+	// bucket; empty deletes without archiving
+	ArchiveDir string `json:"archiveDir"`
+	// ColdStorageAfterMonths moves receipts to cold storage this many months after they were processed,
+	// leaving a stub in the store; 0 disables cold storage
+	ColdStorageAfterMonths int `json:"coldStorageAfterMonths"`
+	// ColdStorageDir receives the receipts moved to cold storage, or is their key prefix in the blob
+	// store's bucket
+	ColdStorageDir string `json:"coldStorageDir"`
+	// ColdStorageInterval is the time between moves to cold storage
+	ColdStorageInterval Duration `json:"coldStorageInterval"`
+	// BlobStore keeps snapshots and archives in object storage, s3 or gcs, instead of local directories
+	BlobStore string `json:"blobStore"`
+	// BlobBucket is the bucket of the blob store
+	BlobBucket string `json:"blobBucket"`
+	// BlobEncryption is the server-side encryption of S3 objects, AES256 or aws:kms; empty uses the bucket's default
+	BlobEncryption string `json:"blobEncryption"`
+	// BlobKMSKey is the KMS key objects are encrypted with: the key ID used with aws:kms, or a Cloud KMS key name for gcs
+	BlobKMSKey string `json:"blobKMSKey"`
+	// ErasureLogPath persists the tamper-evident erasure log; empty keeps it in memory
+	ErasureLogPath string `json:"erasureLogPath"`
+	// AuditLogPath persists the audit log of mutating requests; empty keeps it in memory. With a
+	// DatabaseURL the audit log is kept in the database instead.
+	AuditLogPath string `json:"auditLogPath"`
+	// AccessLogPath appends an access log in the Apache combined format to this file, or writes it to
+	// standard output for "-"; empty writes none
+	AccessLogPath string `json:"accessLogPath"`
+	// LedgerPath persists the points ledger behind user balances; empty keeps it in memory. With a
+	// DatabaseURL the ledger is kept in the database instead.
+	LedgerPath string `json:"ledgerPath"`
+	// ReferralPath persists the referrals between users; empty keeps them in memory. With a
+	// DatabaseURL the referrals are kept in the database instead.
+	ReferralPath string `json:"referralPath"`
+	// ReferralBonus is credited to a referred user and their referrer once the referred user's first
+	// receipt is approved; 0 disables referral bonuses
+	ReferralBonus int `json:"referralBonus"`
+	// StatsExcludedTags leaves the receipts carrying any of these tags out of reports and the stats page
+	StatsExcludedTags []string `json:"statsExcludedTags"`
+	// StreakPath persists each user's streak of consecutive days with an approved receipt; empty keeps
+	// them in memory. With a DatabaseURL the streaks are kept in the database instead.
+	StreakPath string `json:"streakPath"`
+	// BodyLog logs a sample of request and response bodies for debugging; it can also be changed at
+	// runtime through /admin/body-log
+	BodyLog bodylog.Settings `json:"bodyLog"`
+	// FaultInjection delays, fails or drops requests to chosen routes, for testing clients against
+	// the server; it can't be enabled with a DatabaseURL or APIKeys
+	FaultInjection FaultInjection `json:"faultInjection"`
+	// APIKeys identifies callers; admin endpoints require an admin key once any are configured
+	APIKeys []auth.Key `json:"apiKeys"`
+	// SigningSecret requires receipts submitted for processing to be signed with it; empty disables signing
+	SigningSecret string `json:"signingSecret"`
+	// ReplayWindow rejects signed requests whose timestamp is further than this from now or whose nonce was
+	// already used; 0 disables replay protection
+	ReplayWindow Duration `json:"replayWindow"`
+	// IDStrategy generates receipt IDs: uuidv4, uuidv7, ulid or snowflake
+	IDStrategy string `json:"idStrategy"`
+	// IDNode distinguishes processes generating snowflake IDs
+	IDNode int `json:"idNode"`
+	// RuleSetPath is a JSON file overriding the default scoring rule-set; empty uses the defaults
+	RuleSetPath string `json:"ruleSetPath"`
+	// RetailerRegistryPath persists the registry of known retailers; empty keeps it in memory. With a
+	// DatabaseURL the registry is kept in the database instead.
+	RetailerRegistryPath string `json:"retailerRegistryPath"`
+	// CategoryTaxonomyPath is a JSON file mapping item categories to description keywords; empty disables it
+	CategoryTaxonomyPath string `json:"categoryTaxonomyPath"`
+	// CatalogURL is an external product catalog that items without a category or brand are looked up in;
+	// empty disables lookups
+	CatalogURL string `json:"catalogURL"`
+	// CatalogCacheTTL is how long a catalog lookup is cached
+	CatalogCacheTTL Duration `json:"catalogCacheTTL"`
+	// Reports are summaries of processed receipts produced on a schedule
+	Reports []ReportConfig `json:"reports"`
+	// OutboxWebhook receives an event for every change to a receipt, from processing to approval,
+	// rescoring and the trash, published from the outbox the receipts are stored with; empty records
+	// no events
+	OutboxWebhook string `json:"outboxWebhook"`
+	// OutboxInterval is the time between polls of the outbox
+	OutboxInterval Duration `json:"outboxInterval"`
+	// Warehouse loads the same events into a data warehouse: bigquery, or http for a batch endpoint;
+	// empty loads none
+	Warehouse string `json:"warehouse"`
+	// WarehouseURL is the batch endpoint of the http warehouse
+	WarehouseURL string `json:"warehouseURL"`
+	// WarehouseProject and WarehouseDataset hold the table of the bigquery warehouse
+	WarehouseProject string `json:"warehouseProject"`
+	WarehouseDataset string `json:"warehouseDataset"`
+	// WarehouseTable is the table the events are loaded into
+	WarehouseTable string `json:"warehouseTable"`
+	// ReportDir is the directory reports are written to, or their key prefix in the blob store's bucket
+	ReportDir string `json:"reportDir"`
+	// SMTPAddr is the host:port of the mail server reports are emailed through; empty disables email
+	SMTPAddr string `json:"smtpAddr"`
+	// SMTPUsername and SMTPPassword authenticate with the mail server when set
+	SMTPUsername string `json:"smtpUsername"`
+	SMTPPassword string `json:"smtpPassword"`
+	// SMTPFrom is the sender address of emails
+	SMTPFrom string `json:"smtpFrom"`
+	// Notifications sends processing events, such as bursts of failures, to email and Slack channels
+	Notifications Notifications `json:"notifications"`
+	// Resilience holds the timeouts, retries and circuit breaker of each outbound integration, by name
+	Resilience map[string]ResiliencePolicy `json:"resilience"`
+	// CategoryBonuses awards extra points for every item in a category, replacing those of the rule-set file
+	CategoryBonuses map[string]int `json:"categoryBonuses"`
+	// MaxReceiptPoints caps the points of a receipt, replacing the rule-set file's maxPoints when positive
+	MaxReceiptPoints int `json:"maxReceiptPoints"`
+	// MinReceiptPoints is the fewest points a receipt earns, replacing the rule-set file's minPoints when not 0
+	MinReceiptPoints int `json:"minReceiptPoints"`
+	// AutoApprove approves receipts that weren't flagged as soon as they are processed
+	AutoApprove bool `json:"autoApprove"`
+	// FraudAction is off, flag (store suspicious receipts as flagged) or reject
+	FraudAction string `json:"fraudAction"`
+	// FraudMaxTotal is the largest plausible receipt total in dollars
+	FraudMaxTotal int64 `json:"fraudMaxTotal"`
+	// FraudMaxItems is the largest plausible number of items on a receipt
+	FraudMaxItems int `json:"fraudMaxItems"`
+	// FraudDuplicateWindow is how long a matching receipt from the same user counts as a duplicate
+	FraudDuplicateWindow Duration `json:"fraudDuplicateWindow"`
+	// PurchaseDateAction is off, flag or reject for receipts purchased in the future or more than
+	// PurchaseDateMaxAgeDays ago
+	PurchaseDateAction string `json:"purchaseDateAction"`
+	// PurchaseDateMaxAgeDays is how many days after its purchase date a receipt is still accepted; 0 allows any age
+	PurchaseDateMaxAgeDays int `json:"purchaseDateMaxAgeDays"`
+	// PurchaseDateMaxAgeByCaller overrides PurchaseDateMaxAgeDays for the API key names it lists
+	PurchaseDateMaxAgeByCaller map[string]int `json:"purchaseDateMaxAgeByCaller"`
+	// ReceiptLocaleByCaller names the locale, e.g. "de-DE", whose number and date formats the
+	// receipts of the API key names it lists are written in; other callers use the canonical forms
+	ReceiptLocaleByCaller map[string]string `json:"receiptLocaleByCaller"`
+	// UserReceiptsPerDay caps the receipts each user can submit per UTC day; 0 is unlimited
+	UserReceiptsPerDay int `json:"userReceiptsPerDay"`
+	// UserPointsPerDay and UserPointsPerWeek cap the points each user can earn per UTC day and week
+	// starting Monday; 0 is unlimited
+	UserPointsPerDay  int `json:"userPointsPerDay"`
+	UserPointsPerWeek int `json:"userPointsPerWeek"`
+	// TierThresholds maps loyalty tier names to the balance that reaches them; empty uses bronze at 0,
+	// silver at 1000 and gold at 5000
+	TierThresholds map[string]int `json:"tierThresholds"`
+}
+
+// Duration is a time.Duration written as a string such as "90s" or "24h" in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("durations must be strings such as \"24h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Integrations lists the outbound integrations a resilience policy can be configured for
+var Integrations = []string{"catalog", "outbox-webhook", "report-webhooks", "slack", "warehouse"}
+
+// Notifications configures the notification channels and the events they receive
+type Notifications struct {
+	// Channels are the notification channels by name
+	Channels map[string]NotificationChannel `json:"channels"`
+	// FailureThreshold is how many processing failures within FailureWindow raise processing-failures
+	FailureThreshold int `json:"failureThreshold"`
+	// FailureWindow is how far back processing failures are counted
+	FailureWindow Duration `json:"failureWindow"`
+}
+
+// NotificationChannel is an email or Slack channel
+type NotificationChannel struct {
+	// Type is email or slack
+	Type string `json:"type"`
+	// Events lists the events sent to the channel: processing-failures, fraud-flagged or summary
+	Events []string `json:"events"`
+	// To lists the addresses of an email channel
+	To []string `json:"to"`
+	// Webhook is the incoming webhook URL of a Slack channel
+	Webhook string `json:"webhook"`
+}
+
+// ReportConfig schedules a report
+type ReportConfig struct {
+	// Name identifies the report; it must be lowercase letters, digits and dashes
+	Name string `json:"name"`
+	// Period is daily or weekly
+	Period string `json:"period"`
+	// Schedule is a cron expression in UTC, "0 6 * * *" (06:00 every day) for daily reports and
+	// "0 6 * * 1" (06:00 on Mondays) for weekly ones by default
+	Schedule string `json:"schedule"`
+	// Webhook receives the report as a JSON POST; empty skips it
+	Webhook string `json:"webhook"`
+	// Email lists the addresses the report is mailed to
+	Email []string `json:"email"`
+}
+
+// Definition returns the report definition the scheduler runs
+func (r ReportConfig) Definition() (report.Definition, error) {
+	expr := r.Schedule
+	if expr == "" {
+		expr = "0 6 * * *"
+		if r.Period == report.Weekly {
+			expr = "0 6 * * 1"
+		}
+	}
+	schedule, err := report.ParseSchedule(expr)
+	if err != nil {
+		return report.Definition{}, err
+	}
+	return report.Definition{Name: r.Name, Period: r.Period, Schedule: schedule, Webhook: r.Webhook, Email: r.Email}, nil
+}
+
+// FaultInjection configures the faults injected into requests
+type FaultInjection struct {
+	Enabled bool        `json:"enabled"`
+	Rules   []FaultRule `json:"rules"`
+}
+
+// FaultRule is a faults.Rule as written in the config file
+type FaultRule struct {
+	// Route is a path template such as "/receipts/{id}/points", or "*" for every route
+	Route       string   `json:"route"`
+	Methods     []string `json:"methods"`
+	Latency     Duration `json:"latency"`
+	Jitter      Duration `json:"jitter"`
+	ErrorRate   float64  `json:"errorRate"`
+	ErrorStatus int      `json:"errorStatus"`
+	DropRate    float64  `json:"dropRate"`
+}
+
+func (r FaultRule) Rule() faults.Rule {
+	return faults.Rule{
+		Route:       r.Route,
+		Methods:     r.Methods,
+		Latency:     time.Duration(r.Latency),
+		Jitter:      time.Duration(r.Jitter),
+		ErrorRate:   r.ErrorRate,
+		ErrorStatus: r.ErrorStatus,
+		DropRate:    r.DropRate,
+	}
+}
+
+// Active returns the rules to inject, none unless fault injection is enabled
+func (f FaultInjection) Active() []faults.Rule {
+	if !f.Enabled {
+		return nil
+	}
+	rules := make([]faults.Rule, 0, len(f.Rules))
+	for _, rule := range f.Rules {
+		rules = append(rules, rule.Rule())
+	}
+	return rules
+}
+
+// ResiliencePolicy is a resilience.Policy as written in the config file
+type ResiliencePolicy struct {
+	Timeout          Duration `json:"timeout"`
+	Budget           Duration `json:"budget"`
+	Retries          int      `json:"retries"`
+	Backoff          Duration `json:"backoff"`
+	FailureThreshold int      `json:"failureThreshold"`
+	Cooldown         Duration `json:"cooldown"`
+}
+
+func (p ResiliencePolicy) Policy() resilience.Policy {
+	return resilience.Policy{
+		Timeout:          time.Duration(p.Timeout),
+		Budget:           time.Duration(p.Budget),
+		Retries:          p.Retries,
+		Backoff:          time.Duration(p.Backoff),
+		FailureThreshold: p.FailureThreshold,
+		Cooldown:         time.Duration(p.Cooldown),
+	}
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	host, _ := os.Hostname()
+	return Config{
+		Addr:              ":8080",
+		ScoringWorkers:    runtime.NumCPU(),
+		MaxBatchSize:      10000,
+		AsyncMaxAttempts:  3,
+		SnapshotDir:       "snapshots",
+		RetentionInterval: Duration(time.Hour),
+		TrashMaxAge:       Duration(30 * 24 * time.Hour),
+		CacheTTL:          Duration(time.Minute),
+		IdempotencyTTL:    Duration(24 * time.Hour),
+		CatalogCacheTTL:   Duration(time.Hour),
+		ReportDir:         "reports",
+		OutboxInterval:    Duration(time.Second),
+		Notifications:     Notifications{FailureThreshold: 10, FailureWindow: Duration(5 * time.Minute)},
+		Resilience: map[string]ResiliencePolicy{
+			"slack": {
+				Timeout:          Duration(5 * time.Second),
+				Budget:           Duration(20 * time.Second),
+				Retries:          2,
+				Backoff:          Duration(time.Second),
+				FailureThreshold: 5,
+				Cooldown:         Duration(time.Minute),
+			},
+			"report-webhooks": {
+				Timeout:          Duration(5 * time.Second),
+				Budget:           Duration(30 * time.Second),
+				Retries:          2,
+				Backoff:          Duration(time.Second),
+				FailureThreshold: 5,
+				Cooldown:         Duration(time.Minute),
+			},
+			"outbox-webhook": {
+				Timeout:          Duration(5 * time.Second),
+				Budget:           Duration(15 * time.Second),
+				Retries:          2,
+				Backoff:          Duration(time.Second),
+				FailureThreshold: 5,
+				Cooldown:         Duration(30 * time.Second),
+			},
+			"warehouse": {
+				Timeout:          Duration(10 * time.Second),
+				Budget:           Duration(30 * time.Second),
+				Retries:          2,
+				Backoff:          Duration(time.Second),
+				FailureThreshold: 5,
+				Cooldown:         Duration(time.Minute),
+			},
+			"catalog": {
+				Timeout:          Duration(500 * time.Millisecond),
+				Budget:           Duration(time.Second),
+				Retries:          1,
+				Backoff:          Duration(50 * time.Millisecond),
+				FailureThreshold: 5,
+				Cooldown:         Duration(30 * time.Second),
+			},
+		},
+		DatabaseMaxIdleConns: 2,
+		ColdStorageDir:       "cold-storage",
+		WarehouseTable:       "receipt_events",
+		ColdStorageInterval:  Duration(24 * time.Hour),
+		InstanceID:           fmt.Sprintf("%s-%d", host, os.Getpid()),
+		IDStrategy:           "uuidv4",
+		AutoApprove:          true,
+		FraudAction:          "off",
+		FraudMaxTotal:        10000,
+		FraudMaxItems:        100,
+		FraudDuplicateWindow: Duration(10 * time.Minute),
+		PurchaseDateAction:   "off",
+		ReferralBonus:        100,
+		StatsExcludedTags:    []string{"test"},
+		BodyLog:              bodylog.Settings{SampleRate: 1, RedactFields: []string{"userId", "metadata"}},
+	}
+}
+
+// Load starts from Default, applies the JSON file at path when path is not empty, then
+// applies environment variable overrides
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func applyEnv(cfg *Config) error {
+	if addr := os.Getenv("ADDR"); addr != "" {
+		cfg.Addr = addr
+	}
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		cfg.DatabaseURL = url
+	}
+	if urls := os.Getenv("DATABASE_REPLICA_URLS"); urls != "" {
+		cfg.DatabaseReplicaURLs = strings.Split(urls, ",")
+	}
+	if err := envInt("DATABASE_MAX_OPEN_CONNS", &cfg.DatabaseMaxOpenConns); err != nil {
+		return err
+	}
+	if err := envInt("DATABASE_MAX_IDLE_CONNS", &cfg.DatabaseMaxIdleConns); err != nil {
+		return err
+	}
+	if err := envDuration("DATABASE_CONN_MAX_LIFETIME", &cfg.DatabaseConnMaxLifetime); err != nil {
+		return err
+	}
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		cfg.InstanceID = id
+	}
+	if err := envDuration("IDEMPOTENCY_TTL", &cfg.IdempotencyTTL); err != nil {
+		return err
+	}
+	if dir := os.Getenv("SNAPSHOT_DIR"); dir != "" {
+		cfg.SnapshotDir = dir
+	}
+	if dir := os.Getenv("ARCHIVE_DIR"); dir != "" {
+		cfg.ArchiveDir = dir
+	}
+	if err := envInt("COLD_STORAGE_AFTER_MONTHS", &cfg.ColdStorageAfterMonths); err != nil {
+		return err
+	}
+	if dir := os.Getenv("COLD_STORAGE_DIR"); dir != "" {
+		cfg.ColdStorageDir = dir
+	}
+	if err := envDuration("COLD_STORAGE_INTERVAL", &cfg.ColdStorageInterval); err != nil {
+		return err
+	}
+	if dir := os.Getenv("REPORT_DIR"); dir != "" {
+		cfg.ReportDir = dir
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		cfg.SMTPAddr = addr
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		cfg.SMTPUsername = username
+	}
+	if password := os.Getenv("SMTP_PASSWORD"); password != "" {
+		cfg.SMTPPassword = password
+	}
+	if from := os.Getenv("SMTP_FROM"); from != "" {
+		cfg.SMTPFrom = from
+	}
+	if backend := os.Getenv("BLOB_STORE"); backend != "" {
+		cfg.BlobStore = backend
+	}
+	if bucket := os.Getenv("BLOB_BUCKET"); bucket != "" {
+		cfg.BlobBucket = bucket
+	}
+	if encryption := os.Getenv("BLOB_ENCRYPTION"); encryption != "" {
+		cfg.BlobEncryption = encryption
+	}
+	if key := os.Getenv("BLOB_KMS_KEY"); key != "" {
+		cfg.BlobKMSKey = key
+	}
+	if path := os.Getenv("ERASURE_LOG_PATH"); path != "" {
+		cfg.ErasureLogPath = path
+	}
+	if path := os.Getenv("AUDIT_LOG_PATH"); path != "" {
+		cfg.AuditLogPath = path
+	}
+	if path := os.Getenv("ACCESS_LOG_PATH"); path != "" {
+		cfg.AccessLogPath = path
+	}
+	if path := os.Getenv("DEAD_LETTER_PATH"); path != "" {
+		cfg.DeadLetterPath = path
+	}
+	if path := os.Getenv("JOB_PATH"); path != "" {
+		cfg.JobPath = path
+	}
+	if path := os.Getenv("LEDGER_PATH"); path != "" {
+		cfg.LedgerPath = path
+	}
+	if path := os.Getenv("REFERRAL_PATH"); path != "" {
+		cfg.ReferralPath = path
+	}
+	if err := envInt("REFERRAL_BONUS", &cfg.ReferralBonus); err != nil {
+		return err
+	}
+	if url := os.Getenv("OUTBOX_WEBHOOK"); url != "" {
+		cfg.OutboxWebhook = url
+	}
+	if err := envDuration("OUTBOX_INTERVAL", &cfg.OutboxInterval); err != nil {
+		return err
+	}
+	if warehouse := os.Getenv("WAREHOUSE"); warehouse != "" {
+		cfg.Warehouse = warehouse
+	}
+	if url := os.Getenv("WAREHOUSE_URL"); url != "" {
+		cfg.WarehouseURL = url
+	}
+	if project := os.Getenv("WAREHOUSE_PROJECT"); project != "" {
+		cfg.WarehouseProject = project
+	}
+	if dataset := os.Getenv("WAREHOUSE_DATASET"); dataset != "" {
+		cfg.WarehouseDataset = dataset
+	}
+	if table := os.Getenv("WAREHOUSE_TABLE"); table != "" {
+		cfg.WarehouseTable = table
+	}
+	if path := os.Getenv("STREAK_PATH"); path != "" {
+		cfg.StreakPath = path
+	}
+	if tags, ok := os.LookupEnv("STATS_EXCLUDED_TAGS"); ok {
+		cfg.StatsExcludedTags = nil
+		if tags != "" {
+			cfg.StatsExcludedTags = strings.Split(tags, ",")
+		}
+	}
+	if strategy := os.Getenv("ID_STRATEGY"); strategy != "" {
+		cfg.IDStrategy = strategy
+	}
+	if err := envInt("ID_NODE", &cfg.IDNode); err != nil {
+		return err
+	}
+	if path := os.Getenv("RULE_SET_PATH"); path != "" {
+		cfg.RuleSetPath = path
+	}
+	if path := os.Getenv("RETAILER_REGISTRY_PATH"); path != "" {
+		cfg.RetailerRegistryPath = path
+	}
+	if path := os.Getenv("CATEGORY_TAXONOMY_PATH"); path != "" {
+		cfg.CategoryTaxonomyPath = path
+	}
+	if url := os.Getenv("CATALOG_URL"); url != "" {
+		cfg.CatalogURL = url
+	}
+	catalogPolicy := cfg.Resilience["catalog"]
+	if err := envDuration("CATALOG_TIMEOUT", &catalogPolicy.Timeout); err != nil {
+		return err
+	}
+	if cfg.Resilience == nil {
+		cfg.Resilience = make(map[string]ResiliencePolicy)
+	}
+	cfg.Resilience["catalog"] = catalogPolicy
+	if err := envDuration("CATALOG_CACHE_TTL", &cfg.CatalogCacheTTL); err != nil {
+		return err
+	}
+	if err := envIntMap("CATEGORY_BONUSES", &cfg.CategoryBonuses); err != nil {
+		return err
+	}
+	if err := envInt("MAX_RECEIPT_POINTS", &cfg.MaxReceiptPoints); err != nil {
+		return err
+	}
+	if err := envInt("MIN_RECEIPT_POINTS", &cfg.MinReceiptPoints); err != nil {
+		return err
+	}
+	if err := envBool("AUTO_APPROVE", &cfg.AutoApprove); err != nil {
+		return err
+	}
+	if action := os.Getenv("FRAUD_ACTION"); action != "" {
+		cfg.FraudAction = action
+	}
+	if err := envInt64("FRAUD_MAX_TOTAL", &cfg.FraudMaxTotal); err != nil {
+		return err
+	}
+	if err := envInt("FRAUD_MAX_ITEMS", &cfg.FraudMaxItems); err != nil {
+		return err
+	}
+	if err := envDuration("FRAUD_DUPLICATE_WINDOW", &cfg.FraudDuplicateWindow); err != nil {
+		return err
+	}
+	if action := os.Getenv("PURCHASE_DATE_ACTION"); action != "" {
+		cfg.PurchaseDateAction = action
+	}
+	if err := envInt("PURCHASE_DATE_MAX_AGE_DAYS", &cfg.PurchaseDateMaxAgeDays); err != nil {
+		return err
+	}
+	if err := envIntMap("PURCHASE_DATE_MAX_AGE_BY_CALLER", &cfg.PurchaseDateMaxAgeByCaller); err != nil {
+		return err
+	}
+	if err := envStringMap("RECEIPT_LOCALE_BY_CALLER", &cfg.ReceiptLocaleByCaller); err != nil {
+		return err
+	}
+	if err := envInt("USER_RECEIPTS_PER_DAY", &cfg.UserReceiptsPerDay); err != nil {
+		return err
+	}
+	if err := envInt("USER_POINTS_PER_DAY", &cfg.UserPointsPerDay); err != nil {
+		return err
+	}
+	if err := envInt("USER_POINTS_PER_WEEK", &cfg.UserPointsPerWeek); err != nil {
+		return err
+	}
+	if err := envIntMap("TIER_THRESHOLDS", &cfg.TierThresholds); err != nil {
+		return err
+	}
+	if addr := os.Getenv("DEBUG_ADDR"); addr != "" {
+		cfg.DebugAddr = addr
+	}
+	if secret := os.Getenv("SIGNING_SECRET"); secret != "" {
+		cfg.SigningSecret = secret
+	}
+	if err := envAPIKeys("API_KEYS", &cfg.APIKeys); err != nil {
+		return err
+	}
+	if err := envBool("BODY_LOG", &cfg.BodyLog.Enabled); err != nil {
+		return err
+	}
+	if err := envFloat("BODY_LOG_SAMPLE_RATE", &cfg.BodyLog.SampleRate); err != nil {
+		return err
+	}
+	if err := envBool("FAULT_INJECTION", &cfg.FaultInjection.Enabled); err != nil {
+		return err
+	}
+	if fields := os.Getenv("BODY_LOG_REDACT"); fields != "" {
+		cfg.BodyLog.RedactFields = strings.Split(fields, ",")
+	}
+	if err := envInt("SCORING_WORKERS", &cfg.ScoringWorkers); err != nil {
+		return err
+	}
+	if err := envInt("MAX_BATCH_SIZE", &cfg.MaxBatchSize); err != nil {
+		return err
+	}
+	if err := envInt("ASYNC_QUEUE_SIZE", &cfg.AsyncQueueSize); err != nil {
+		return err
+	}
+	if err := envInt("ASYNC_MAX_ATTEMPTS", &cfg.AsyncMaxAttempts); err != nil {
+		return err
+	}
+	if err := envInt("MAX_RECEIPTS", &cfg.MaxReceipts); err != nil {
+		return err
+	}
+	if err := envInt64("MAX_STORE_BYTES", &cfg.MaxStoreBytes); err != nil {
+		return err
+	}
+	if err := envDuration("RECEIPT_TTL", &cfg.ReceiptTTL); err != nil {
+		return err
+	}
+	if err := envInt("CACHE_SIZE", &cfg.CacheSize); err != nil {
+		return err
+	}
+	if err := envDuration("CACHE_TTL", &cfg.CacheTTL); err != nil {
+		return err
+	}
+	if err := envDuration("RETENTION_MAX_AGE", &cfg.RetentionMaxAge); err != nil {
+		return err
+	}
+	if err := envDuration("TRASH_MAX_AGE", &cfg.TrashMaxAge); err != nil {
+		return err
+	}
+	if err := envDuration("REPLAY_WINDOW", &cfg.ReplayWindow); err != nil {
+		return err
+	}
+	return envDuration("RETENTION_INTERVAL", &cfg.RetentionInterval)
+}
+
+// envInt64 overrides *value with the integer environment variable name when it is set
+func envInt64(name string, value *int64) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %w", name, err)
+	}
+	*value = parsed
+	return nil
+}
+
+// envDuration overrides *value with the duration environment variable name when it is set
+func envDuration(name string, value *Duration) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("%s must be a duration such as 24h: %w", name, err)
+	}
+	*value = Duration(parsed)
+	return nil
+}
+
+// envAPIKeys overrides *keys with the comma-separated name:key[:admin] entries of the environment variable name
+func envAPIKeys(name string, keys *[]auth.Key) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	var parsed []auth.Key
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "admin") {
+			return fmt.Errorf("%s entries must look like name:key or name:key:admin", name)
+		}
+		parsed = append(parsed, auth.Key{Name: parts[0], Key: parts[1], Admin: len(parts) == 3})
+	}
+	*keys = parsed
+	return nil
+}
+
+// envIntMap overrides *value with the comma-separated key=integer entries of the environment variable name
+func envIntMap(name string, value *map[string]int) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed := make(map[string]int)
+	for _, entry := range strings.Split(raw, ",") {
+		key, number, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		points, err := strconv.Atoi(number)
+		if !ok || err != nil {
+			return fmt.Errorf("%s entries must look like name=10", name)
+		}
+		parsed[key] = points
+	}
+	*value = parsed
+	return nil
+}
+
+// envStringMap overrides *value with the comma-separated key=value entries of the environment variable name
+func envStringMap(name string, value *map[string]string) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed := make(map[string]string)
+	for _, entry := range strings.Split(raw, ",") {
+		key, setting, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || key == "" || setting == "" {
+			return fmt.Errorf("%s entries must look like name=value", name)
+		}
+		parsed[key] = setting
+	}
+	*value = parsed
+	return nil
+}
+
+// envBool overrides *value with the boolean environment variable name when it is set
+func envBool(name string, value *bool) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false: %w", name, err)
+	}
+	*value = parsed
+	return nil
+}
+
+// envFloat overrides *value with the number environment variable name when it is set
+func envFloat(name string, value *float64) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be a number: %w", name, err)
+	}
+	*value = parsed
+	return nil
+}
+
+// envInt overrides *value with the integer environment variable name when it is set
+func envInt(name string, value *int) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %w", name, err)
+	}
+	*value = parsed
+	return nil
+}
+
+// Validate reports the first setting that is out of range
+func (cfg Config) Validate() error {
+	if cfg.Addr == "" {
+		return fmt.Errorf("addr must not be empty")
+	}
+	if cfg.ScoringWorkers < 1 {
+		return fmt.Errorf("scoringWorkers must be at least 1, got %d", cfg.ScoringWorkers)
+	}
+	if cfg.MaxBatchSize < 1 {
+		return fmt.Errorf("maxBatchSize must be at least 1, got %d", cfg.MaxBatchSize)
+	}
+	if cfg.AsyncQueueSize < 0 {
+		return fmt.Errorf("asyncQueueSize must not be negative, got %d", cfg.AsyncQueueSize)
+	}
+	if cfg.AsyncMaxAttempts < 1 || cfg.AsyncMaxAttempts > 10 {
+		return fmt.Errorf("asyncMaxAttempts must be between 1 and 10, got %d", cfg.AsyncMaxAttempts)
+	}
+	if cfg.MaxReceipts < 0 || cfg.MaxStoreBytes < 0 || cfg.ReceiptTTL < 0 {
+		return fmt.Errorf("maxReceipts, maxStoreBytes and receiptTTL must not be negative")
+	}
+	if cfg.DatabaseURL != "" && (cfg.MaxReceipts != 0 || cfg.MaxStoreBytes != 0 || cfg.ReceiptTTL != 0) {
+		return fmt.Errorf("maxReceipts, maxStoreBytes and receiptTTL only apply to the in-memory store, not databaseURL")
+	}
+	if cfg.DatabaseURL != "" {
+		for _, file := range []struct{ name, path string }{
+			{"ledgerPath", cfg.LedgerPath},
+			{"referralPath", cfg.ReferralPath},
+			{"streakPath", cfg.StreakPath},
+			{"auditLogPath", cfg.AuditLogPath},
+			{"deadLetterPath", cfg.DeadLetterPath},
+			{"retailerRegistryPath", cfg.RetailerRegistryPath},
+			{"jobPath", cfg.JobPath},
+		} {
+			if file.path != "" {
+				return fmt.Errorf("%s only applies without a databaseURL, which keeps its data in the database", file.name)
+			}
+		}
+	}
+	if len(cfg.DatabaseReplicaURLs) > 0 && cfg.DatabaseURL == "" {
+		return fmt.Errorf("databaseReplicaURLs need a databaseURL")
+	}
+	if cfg.DatabaseMaxOpenConns < 0 || cfg.DatabaseMaxIdleConns < 0 || cfg.DatabaseConnMaxLifetime < 0 {
+		return fmt.Errorf("databaseMaxOpenConns, databaseMaxIdleConns and databaseConnMaxLifetime must not be negative")
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		return fmt.Errorf("idempotencyTTL must be positive")
+	}
+	if cfg.CacheSize < 0 || cfg.CacheTTL < 0 {
+		return fmt.Errorf("cacheSize and cacheTTL must not be negative")
+	}
+	if cfg.RetentionMaxAge < 0 || cfg.TrashMaxAge < 0 || cfg.RetentionInterval <= 0 {
+		return fmt.Errorf("retentionMaxAge and trashMaxAge must not be negative and retentionInterval must be positive")
+	}
+	if cfg.ColdStorageAfterMonths < 0 || cfg.ColdStorageInterval <= 0 {
+		return fmt.Errorf("coldStorageAfterMonths must not be negative and coldStorageInterval must be positive")
+	}
+	if cfg.ColdStorageAfterMonths > 0 && cfg.ColdStorageDir == "" {
+		return fmt.Errorf("coldStorageAfterMonths needs a coldStorageDir")
+	}
+	if cfg.ReplayWindow < 0 || (cfg.ReplayWindow > 0 && cfg.SigningSecret == "") {
+		return fmt.Errorf("replayWindow must not be negative and needs a signingSecret")
+	}
+	for name := range cfg.CategoryBonuses {
+		if !validation.Category(name) {
+			return fmt.Errorf("categoryBonuses has an invalid category name %q", name)
+		}
+	}
+	if cfg.MaxReceiptPoints < 0 || (cfg.MaxReceiptPoints > 0 && cfg.MinReceiptPoints > cfg.MaxReceiptPoints) {
+		return fmt.Errorf("maxReceiptPoints must not be negative or below minReceiptPoints")
+	}
+	if cfg.CatalogCacheTTL <= 0 {
+		return fmt.Errorf("catalogCacheTTL must be positive")
+	}
+	for name, policy := range cfg.Resilience {
+		if !slices.Contains(Integrations, name) {
+			return fmt.Errorf("resilience has an unknown integration %q, expected one of %s", name, strings.Join(Integrations, ", "))
+		}
+		if policy.Timeout < 0 || policy.Budget < 0 || policy.Backoff < 0 || policy.Cooldown < 0 {
+			return fmt.Errorf("resilience.%s durations must not be negative", name)
+		}
+		if policy.Retries < 0 || policy.Retries > 10 || policy.FailureThreshold < 0 {
+			return fmt.Errorf("resilience.%s retries must be between 0 and 10 and failureThreshold must not be negative", name)
+		}
+	}
+	if cfg.CatalogURL != "" {
+		if u, err := url.Parse(cfg.CatalogURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" {
+			return fmt.Errorf("catalogURL must be an http or https URL without a query, got %q", cfg.CatalogURL)
+		}
+	}
+	if _, err := ids.New(cfg.IDStrategy, cfg.IDNode); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, r := range cfg.Reports {
+		if !validation.Category(r.Name) || names[r.Name] {
+			return fmt.Errorf("reports need unique names of lowercase letters, digits and dashes, got %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Period != report.Daily && r.Period != report.Weekly {
+			return fmt.Errorf("report %s period must be daily or weekly, got %q", r.Name, r.Period)
+		}
+		if _, err := r.Definition(); err != nil {
+			return fmt.Errorf("report %s: %w", r.Name, err)
+		}
+		if r.Webhook != "" {
+			if u, err := url.Parse(r.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("report %s webhook must be an http or https URL, got %q", r.Name, r.Webhook)
+			}
+		}
+		if len(r.Email) > 0 && (cfg.SMTPAddr == "" || cfg.SMTPFrom == "") {
+			return fmt.Errorf("report %s emails need smtpAddr and smtpFrom", r.Name)
+		}
+	}
+	if cfg.Notifications.FailureThreshold < 1 || cfg.Notifications.FailureWindow <= 0 {
+		return fmt.Errorf("notifications.failureThreshold must be at least 1 and notifications.failureWindow positive")
+	}
+	for name, channel := range cfg.Notifications.Channels {
+		switch channel.Type {
+		case "email":
+			if len(channel.To) == 0 || cfg.SMTPAddr == "" || cfg.SMTPFrom == "" {
+				return fmt.Errorf("notification channel %s needs addresses in to, smtpAddr and smtpFrom", name)
+			}
+		case "slack":
+			if u, err := url.Parse(channel.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("notification channel %s webhook must be an http or https URL, got %q", name, channel.Webhook)
+			}
+		default:
+			return fmt.Errorf("notification channel %s type must be email or slack, got %q", name, channel.Type)
+		}
+		for _, event := range channel.Events {
+			if !slices.Contains(notify.Events, notify.Event(event)) {
+				return fmt.Errorf("notification channel %s has an unknown event %q", name, event)
+			}
+		}
+	}
+	switch cfg.BlobStore {
+	case "":
+	case "s3", "gcs":
+		if cfg.BlobBucket == "" {
+			return fmt.Errorf("blobStore %s needs a blobBucket", cfg.BlobStore)
+		}
+	default:
+		return fmt.Errorf("blobStore must be s3 or gcs, got %q", cfg.BlobStore)
+	}
+	if cfg.BlobEncryption != "" && (cfg.BlobStore != "s3" || (cfg.BlobEncryption != "AES256" && cfg.BlobEncryption != "aws:kms")) {
+		return fmt.Errorf("blobEncryption must be AES256 or aws:kms with blobStore s3, got %q", cfg.BlobEncryption)
+	}
+	if cfg.BlobKMSKey != "" && cfg.BlobStore != "gcs" && cfg.BlobEncryption != "aws:kms" {
+		return fmt.Errorf("blobKMSKey needs blobStore gcs or blobEncryption aws:kms")
+	}
+	if _, err := fraud.ParseAction(cfg.FraudAction); err != nil {
+		return err
+	}
+	if cfg.FraudMaxTotal < 0 || cfg.FraudMaxItems < 0 || cfg.FraudDuplicateWindow < 0 {
+		return fmt.Errorf("fraudMaxTotal, fraudMaxItems and fraudDuplicateWindow must not be negative")
+	}
+	if _, err := fraud.ParseAction(cfg.PurchaseDateAction); err != nil {
+		return fmt.Errorf("purchaseDateAction must be off, flag or reject, got %q", cfg.PurchaseDateAction)
+	}
+	if cfg.PurchaseDateMaxAgeDays < 0 {
+		return fmt.Errorf("purchaseDateMaxAgeDays must not be negative")
+	}
+	for caller, days := range cfg.PurchaseDateMaxAgeByCaller {
+		if days < 0 {
+			return fmt.Errorf("purchaseDateMaxAgeByCaller[%q] must not be negative", caller)
+		}
+	}
+	for caller, name := range cfg.ReceiptLocaleByCaller {
+		if _, ok := locale.Formats[name]; !ok {
+			return fmt.Errorf("receiptLocaleByCaller[%q] must be one of %s, got %q", caller, strings.Join(locale.Names(), ", "), name)
+		}
+	}
+	if cfg.UserReceiptsPerDay < 0 || cfg.UserPointsPerDay < 0 || cfg.UserPointsPerWeek < 0 {
+		return fmt.Errorf("userReceiptsPerDay, userPointsPerDay and userPointsPerWeek must not be negative")
+	}
+	if cfg.ReferralBonus < 0 {
+		return fmt.Errorf("referralBonus must not be negative")
+	}
+	if cfg.OutboxWebhook != "" {
+		if u, err := url.Parse(cfg.OutboxWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("outboxWebhook must be an http or https URL, got %q", cfg.OutboxWebhook)
+		}
+	}
+	if cfg.OutboxInterval <= 0 {
+		return fmt.Errorf("outboxInterval must be positive")
+	}
+	switch cfg.Warehouse {
+	case "":
+	case "bigquery":
+		if cfg.WarehouseProject == "" || cfg.WarehouseDataset == "" {
+			return fmt.Errorf("warehouse bigquery needs a warehouseProject and warehouseDataset")
+		}
+	case "http":
+		if u, err := url.Parse(cfg.WarehouseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("warehouseURL must be an http or https URL, got %q", cfg.WarehouseURL)
+		}
+	default:
+		return fmt.Errorf("warehouse must be bigquery or http, got %q", cfg.Warehouse)
+	}
+	invalidTableRune := func(r rune) bool {
+		return r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9')
+	}
+	if cfg.WarehouseTable == "" || strings.IndexFunc(cfg.WarehouseTable, invalidTableRune) >= 0 {
+		return fmt.Errorf("warehouseTable must be letters, digits and underscores, got %q", cfg.WarehouseTable)
+	}
+	for _, tag := range cfg.StatsExcludedTags {
+		if !validation.Tag(tag) {
+			return fmt.Errorf("statsExcludedTags entry %q must be letters, digits and the characters -_.:", tag)
+		}
+	}
+	for name, minPoints := range cfg.TierThresholds {
+		if !validation.Category(name) || minPoints < 0 {
+			return fmt.Errorf("tierThresholds[%q] needs a name of lowercase letters, digits and dashes and a threshold that isn't negative", name)
+		}
+	}
+	if cfg.DebugAddr != "" && !hasAdminKey(cfg.APIKeys) {
+		return fmt.Errorf("debugAddr needs an admin API key to protect it")
+	}
+	if err := cfg.BodyLog.Validate(); err != nil {
+		return fmt.Errorf("bodyLog: %w", err)
+	}
+	// A shared database or API keys mark a real deployment, which FAULT_INJECTION alone mustn't degrade
+	if cfg.FaultInjection.Enabled && (cfg.DatabaseURL != "" || len(cfg.APIKeys) > 0) {
+		return fmt.Errorf("faultInjection is for development and test servers and can't be enabled with a databaseURL or apiKeys")
+	}
+	for i, rule := range cfg.FaultInjection.Rules {
+		if err := rule.Rule().Validate(); err != nil {
+			return fmt.Errorf("faultInjection.rules[%d]: %w", i, err)
+		}
+	}
+	for i, key := range cfg.APIKeys {
+		if key.Name == "" || key.Key == "" {
+			return fmt.Errorf("apiKeys[%d] needs both a name and a key", i)
+		}
+	}
+	return nil
+}
+
+// Features names the optional features the configuration enables, sorted
+func (cfg Config) Features() []string {
+	enabled := map[string]bool{
+		"async-processing":     cfg.AsyncQueueSize > 0,
+		"postgres":             cfg.DatabaseURL != "",
+		"read-replicas":        len(cfg.DatabaseReplicaURLs) > 0,
+		"read-cache":           cfg.CacheSize > 0,
+		"retention":            cfg.RetentionMaxAge > 0,
+		"cold-storage":         cfg.ColdStorageAfterMonths > 0,
+		"blob-store":           cfg.BlobStore != "",
+		"api-keys":             len(cfg.APIKeys) > 0,
+		"request-signing":      cfg.SigningSecret != "",
+		"replay-protection":    cfg.SigningSecret != "" && cfg.ReplayWindow > 0,
+		"custom-rule-set":      cfg.RuleSetPath != "",
+		"category-taxonomy":    cfg.CategoryTaxonomyPath != "",
+		"product-catalog":      cfg.CatalogURL != "",
+		"reports":              len(cfg.Reports) > 0,
+		"outbox":               cfg.OutboxWebhook != "",
+		"warehouse":            cfg.Warehouse != "",
+		"notifications":        len(cfg.Notifications.Channels) > 0,
+		"auto-approve":         cfg.AutoApprove,
+		"fraud-checks":         cfg.FraudAction != "" && cfg.FraudAction != "off",
+		"purchase-date-checks": cfg.PurchaseDateAction != "" && cfg.PurchaseDateAction != "off",
+		"user-limits":          cfg.UserReceiptsPerDay > 0 || cfg.UserPointsPerDay > 0 || cfg.UserPointsPerWeek > 0,
+		"referral-bonus":       cfg.ReferralBonus > 0,
+		"body-log":             cfg.BodyLog.Enabled,
+		"fault-injection":      cfg.FaultInjection.Enabled,
+	}
+	features := []string{}
+	for name, on := range enabled {
+		if on {
+			features = append(features, name)
+		}
+	}
+	slices.Sort(features)
+	return features
+}
+
+// hasAdminKey reports whether any of the keys is an admin key
+func hasAdminKey(keys []auth.Key) bool {
+	for _, key := range keys {
+		if key.Admin {
+			return true
+		}
+	}
+	return false
+}
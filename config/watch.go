@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"receipt-processor/metrics"
+)
+
+var reloads = metrics.NewCounterVec("receipts_config_reloads_total", "Config file reloads, by whether they were applied.", "result")
+
+// reloadDelay lets an editor finish writing before the file is read
+const reloadDelay = 100 * time.Millisecond
+
+// Reloadable copies the settings that can change while the server runs from next onto cfg.
+// Every other setting needs a restart.
+func (cfg Config) Reloadable(next Config) Config {
+	cfg.RuleSetPath = next.RuleSetPath
+	cfg.CategoryBonuses = next.CategoryBonuses
+	cfg.MaxReceiptPoints = next.MaxReceiptPoints
+	cfg.MinReceiptPoints = next.MinReceiptPoints
+	cfg.BodyLog = next.BodyLog
+	cfg.FaultInjection.Rules = next.FaultInjection.Rules
+	return cfg
+}
+
+// Changed returns the JSON names of the settings that differ between a and b
+func Changed(a, b Config) []string {
+	var names []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			name, _, _ := strings.Cut(va.Type().Field(i).Tag.Get("json"), ",")
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Watch reloads the config file at path, and the rule-set file it names, whenever either changes,
+// until ctx is done. Each reload is loaded and validated like the startup configuration, environment
+// overrides included, then passed to apply with the settings that need a restart left as they were.
+// Invalid reloads are logged and counted instead of applied.
+func Watch(ctx context.Context, path string, current Config, apply func(previous, next Config) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watching config: %w", err)
+	}
+	defer watcher.Close()
+
+	// Editors often replace files rather than write them, so watch the directories and match names
+	files := make(map[string]bool)
+	watch := func(file string) error {
+		if file == "" {
+			return nil
+		}
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if !files[file] {
+			if err := watcher.Add(filepath.Dir(file)); err != nil {
+				return fmt.Errorf("watching %s: %w", file, err)
+			}
+			files[file] = true
+		}
+		return nil
+	}
+	if err := watch(path); err != nil {
+		return err
+	}
+	if err := watch(current.RuleSetPath); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	var trigger string
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-watcher.Events:
+			if name, err := filepath.Abs(event.Name); err == nil && files[name] &&
+				event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				trigger = name
+				timer.Reset(reloadDelay)
+			}
+		case err := <-watcher.Errors:
+			log.Printf("config watch error=%q", err)
+		case <-timer.C:
+			next, err := Load(path)
+			if err == nil {
+				err = apply(current, current.Reloadable(next))
+			}
+			if err != nil {
+				reloads.With("invalid").Inc()
+				log.Printf("config reload result=invalid file=%s error=%q", trigger, err)
+				continue
+			}
+			reloads.With("applied").Inc()
+			log.Printf("config reload result=applied file=%s changed=%s restartRequired=%s", trigger,
+				list(Changed(current, current.Reloadable(next))), list(Changed(current.Reloadable(next), next)))
+			current = current.Reloadable(next)
+			if err := watch(current.RuleSetPath); err != nil {
+				log.Printf("config watch error=%q", err)
+			}
+		}
+	}
+}
+
+// list formats setting names for a log line, e.g. "ruleSetPath,bodyLog" or "-"
+func list(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
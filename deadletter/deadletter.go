@@ -0,0 +1,177 @@
+// Package deadletter keeps the receipts that background processing gave up on, with the error that
+// stopped them, so they can be inspected and retried.
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"receipt-processor/metrics"
+)
+
+var size = metrics.NewGauge("receipts_dead_letters", "Receipts waiting in the dead-letter queue.")
+
+// ErrNotFound is returned when no dead letter is kept under an ID
+var ErrNotFound = errors.New("dead letter not found")
+
+// Entry is a receipt whose processing failed
+type Entry struct {
+	// ID is the receipt ID handed out when the receipt was accepted
+	ID string `json:"id"`
+	// Receipt is the receipt as submitted
+	Receipt json.RawMessage `json:"receipt"`
+	// Caller is the name of the API key that submitted the receipt, so retries run under its settings
+	Caller string `json:"caller,omitempty"`
+	// Error is why the last attempt failed
+	Error string `json:"error"`
+	// Attempts counts every attempt to process the receipt, including retries from the queue
+	Attempts int `json:"attempts"`
+	// AcceptedAt is when the receipt was submitted and FailedAt when its last attempt failed
+	AcceptedAt time.Time `json:"acceptedAt"`
+	FailedAt   time.Time `json:"failedAt"`
+}
+
+// Store keeps the dead letters: a Queue in memory or a file for a single instance, or Postgres
+// shared by every instance
+type Store interface {
+	// Put adds an entry, replacing any earlier one for the same receipt
+	Put(entry Entry) error
+	// Get returns the entry kept under id, or ErrNotFound
+	Get(id string) (Entry, error)
+	// List returns every entry, oldest failure first
+	List() ([]Entry, error)
+	// Remove drops the entry kept under id, or returns ErrNotFound
+	Remove(id string) error
+}
+
+// Queue holds the dead letters, optionally persisted to a JSON file
+type Queue struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Open loads the queue persisted at path, creating it on first change. An empty path keeps the queue in memory.
+func Open(path string) (*Queue, error) {
+	q := &Queue{path: path, entries: make(map[string]Entry)}
+	if path == "" {
+		return q, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing dead-letter queue %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		q.entries[entry.ID] = entry
+	}
+	size.Set(float64(len(q.entries)))
+	return q, nil
+}
+
+// Put adds an entry, replacing any earlier one for the same receipt
+func (q *Queue) Put(entry Entry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	previous, existed := q.entries[entry.ID]
+	q.entries[entry.ID] = entry
+	return q.persist(func() {
+		if existed {
+			q.entries[entry.ID] = previous
+		} else {
+			delete(q.entries, entry.ID)
+		}
+	})
+}
+
+// Get returns the entry kept under id, or ErrNotFound
+func (q *Queue) Get(id string) (Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry, ok := q.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return entry, nil
+}
+
+// List returns every entry, oldest failure first
+func (q *Queue) List() ([]Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.sorted(), nil
+}
+
+// Remove drops the entry kept under id, or returns ErrNotFound
+func (q *Queue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	previous, ok := q.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(q.entries, id)
+	return q.persist(func() { q.entries[id] = previous })
+}
+
+func (q *Queue) sorted() []Entry {
+	entries := make([]Entry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].FailedAt.Equal(entries[j].FailedAt) {
+			return entries[i].FailedAt.Before(entries[j].FailedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// persist writes the queue to its file, calling undo to roll the change back when that fails;
+// the caller holds mu
+func (q *Queue) persist(undo func()) error {
+	if q.path != "" {
+		if err := writeFile(q.path, q.sorted()); err != nil {
+			undo()
+			return err
+		}
+	}
+	size.Set(float64(len(q.entries)))
+	return nil
+}
+
+// writeFile replaces the file through a temporary file so a crash never leaves it half written
+func writeFile(path string, entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".deadletter-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,106 @@
+package deadletter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Postgres keeps the dead letters in a PostgreSQL table, so every instance sharing the database
+// lists and retries the same queue
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the dead letters in db, creating the table when it doesn't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS dead_letters (
+		id        text PRIMARY KEY,
+		failed_at timestamptz NOT NULL,
+		entry     jsonb NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating dead_letters table: %w", err)
+	}
+	p := &Postgres{db: db}
+	if err := p.count(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Postgres) Put(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec(`INSERT INTO dead_letters (id, failed_at, entry) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET failed_at = EXCLUDED.failed_at, entry = EXCLUDED.entry`,
+		entry.ID, entry.FailedAt, string(data))
+	if err != nil {
+		return err
+	}
+	return p.count()
+}
+
+func (p *Postgres) Get(id string) (Entry, error) {
+	var data []byte
+	err := p.db.QueryRow(`SELECT entry FROM dead_letters WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	err = json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+func (p *Postgres) List() ([]Entry, error) {
+	rows, err := p.db.Query(`SELECT entry FROM dead_letters ORDER BY failed_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (p *Postgres) Remove(id string) error {
+	result, err := p.db.Exec(`DELETE FROM dead_letters WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return p.count()
+}
+
+// count sets the queue size gauge; other instances' changes show up on this instance's next one
+func (p *Postgres) count() error {
+	var n int
+	if err := p.db.QueryRow(`SELECT count(*) FROM dead_letters`).Scan(&n); err != nil {
+		return err
+	}
+	size.Set(float64(n))
+	return nil
+}
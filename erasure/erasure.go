@@ -0,0 +1,157 @@
+// Package erasure keeps a tamper-evident log of right-to-be-forgotten requests.
+//
+// Every record holds the SHA-256 hash of the record before it, so editing or removing
+// an earlier record breaks the chain and is reported by Verify. Subjects are stored
+// hashed, so the log itself does not retain the erased identifiers.
+package erasure
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+)
+
+// Subject kinds
+const (
+	SubjectUser    = "user"
+	SubjectReceipt = "receipt"
+)
+
+// Record describes one completed erasure
+type Record struct {
+	Sequence        int       `json:"sequence"`
+	SubjectKind     string    `json:"subjectKind"`
+	SubjectHash     string    `json:"subjectHash"`
+	ReceiptsDeleted int       `json:"receiptsDeleted"`
+	ErasedAt        time.Time `json:"erasedAt"`
+	PreviousHash    string    `json:"previousHash"`
+	Hash            string    `json:"hash"`
+}
+
+// digest hashes every field of the record except Hash itself
+func (r Record) digest() string {
+	payload := fmt.Sprintf("%d|%s|%s|%d|%s|%s", r.Sequence, r.SubjectKind, r.SubjectHash,
+		r.ReceiptsDeleted, r.ErasedAt.UTC().Format(time.RFC3339Nano), r.PreviousHash)
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashSubject returns the hash under which a subject identifier is recorded
+func HashSubject(kind string, id string) string {
+	sum := sha256.Sum256([]byte(kind + ":" + id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is an append-only, hash-chained list of erasure records, optionally persisted as JSON lines
+type Log struct {
+	mu      sync.Mutex
+	path    string
+	clock   clock.Clock
+	records []Record
+}
+
+// Open loads the log persisted at path, creating it on first append. An empty path keeps the log in memory.
+// Erasures are timed by c, the system clock when nil.
+func Open(path string, c clock.Clock) (*Log, error) {
+	if c == nil {
+		c = clock.System{}
+	}
+	l := &Log{path: path, clock: c}
+	if path == "" {
+		return l, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("reading erasure log record %d: %w", len(l.records)+1, err)
+		}
+		l.records = append(l.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append chains a new record for an erasure of the subject and persists it
+func (l *Log) Append(kind string, id string, receiptsDeleted int) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := Record{
+		Sequence:        len(l.records) + 1,
+		SubjectKind:     kind,
+		SubjectHash:     HashSubject(kind, id),
+		ReceiptsDeleted: receiptsDeleted,
+		ErasedAt:        l.clock.Now().UTC(),
+	}
+	if len(l.records) > 0 {
+		record.PreviousHash = l.records[len(l.records)-1].Hash
+	}
+	record.Hash = record.digest()
+
+	if l.path != "" {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return Record{}, err
+		}
+		file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return Record{}, err
+		}
+		_, err = file.Write(append(line, '\n'))
+		if syncErr := file.Sync(); err == nil {
+			err = syncErr
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return Record{}, err
+		}
+	}
+
+	l.records = append(l.records, record)
+	return record, nil
+}
+
+// Records returns a copy of every record, oldest first
+func (l *Log) Records() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Record(nil), l.records...)
+}
+
+// Verify checks the hash chain, returning an error naming the first record that was tampered with
+func (l *Log) Verify() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous := ""
+	for i, record := range l.records {
+		if record.Sequence != i+1 || record.PreviousHash != previous || record.Hash != record.digest() {
+			return fmt.Errorf("erasure log record %d fails verification", i+1)
+		}
+		previous = record.Hash
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package faults injects latency, errors and dropped responses into chosen routes, so clients'
+// timeouts and retries can be tested against a running server. It is meant for development and
+// test environments and does nothing unless configured.
+package faults
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnyRoute matches every route
+const AnyRoute = "*"
+
+// Rule injects faults into the requests to a route
+type Rule struct {
+	// Route is a route's path template without its version prefix, e.g. "/receipts/{id}/points",
+	// or AnyRoute
+	Route string
+	// Methods limits the rule to these methods; empty matches every method
+	Methods []string
+	// Latency delays every matching request, by up to Jitter more at random
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the fraction of matching requests answered with ErrorStatus instead of being
+	// handled, from 0 to 1
+	ErrorRate float64
+	// ErrorStatus is 503 by default
+	ErrorStatus int
+	// DropRate is the fraction of matching requests whose connection is closed without an answer,
+	// from 0 to 1
+	DropRate float64
+}
+
+// Validate reports a rule that can't be applied
+func (r Rule) Validate() error {
+	switch {
+	case r.Route != AnyRoute && !strings.HasPrefix(r.Route, "/"):
+		return fmt.Errorf("route must be a path template such as /receipts/{id} or %q, got %q", AnyRoute, r.Route)
+	case r.Latency < 0 || r.Jitter < 0:
+		return fmt.Errorf("latency and jitter can't be negative")
+	case r.ErrorRate < 0 || r.ErrorRate > 1:
+		return fmt.Errorf("errorRate must be between 0 and 1, got %v", r.ErrorRate)
+	case r.DropRate < 0 || r.DropRate > 1:
+		return fmt.Errorf("dropRate must be between 0 and 1, got %v", r.DropRate)
+	case r.ErrorStatus != 0 && (r.ErrorStatus < 400 || r.ErrorStatus > 599):
+		return fmt.Errorf("errorStatus must be a 4xx or 5xx status, got %d", r.ErrorStatus)
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a request
+func (r Rule) matches(method, route string) bool {
+	if r.Route != AnyRoute && r.Route != route {
+		return false
+	}
+	return len(r.Methods) == 0 || slices.ContainsFunc(r.Methods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+// Fault is what is done to one request
+type Fault struct {
+	// Delay is waited before the request is handled
+	Delay time.Duration
+	// Status, when set, answers the request with this error instead of handling it
+	Status int
+	// Drop closes the connection without answering the request
+	Drop bool
+}
+
+// Injector picks the faults for each request from its rules
+type Injector struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// New returns an injector applying the rules, which must be valid
+func New(rules []Rule) *Injector {
+	return &Injector{rules: slices.Clone(rules)}
+}
+
+// Rules returns the rules in effect
+func (in *Injector) Rules() []Rule {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return slices.Clone(in.rules)
+}
+
+// Update replaces the rules, or leaves them unchanged when any is invalid
+func (in *Injector) Update(rules []Rule) error {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = slices.Clone(rules)
+	return nil
+}
+
+// Pick returns the faults for a request to a route. Every matching rule adds its latency; the
+// first matching rule that drops or fails the request decides how.
+func (in *Injector) Pick(method, route string) Fault {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	var fault Fault
+	for _, rule := range in.rules {
+		if !rule.matches(method, route) {
+			continue
+		}
+		fault.Delay += rule.Latency
+		if rule.Jitter > 0 {
+			fault.Delay += rand.N(rule.Jitter)
+		}
+		if fault.Drop || fault.Status != 0 {
+			continue
+		}
+		switch roll := rand.Float64(); {
+		case roll < rule.DropRate:
+			fault.Drop = true
+		case roll < rule.DropRate+rule.ErrorRate:
+			fault.Status = rule.ErrorStatus
+			if fault.Status == 0 {
+				fault.Status = 503
+			}
+		}
+	}
+	return fault
+}
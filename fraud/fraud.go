@@ -0,0 +1,204 @@
+// Package fraud inspects receipts before they are stored and flags or rejects suspicious ones.
+package fraud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+	"receipt-processor/receipt"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+var detections = metrics.NewCounterVec("receipts_fraud_detections_total", "Receipts a fraud check found suspicious.", "check")
+
+// Action is what happens to a receipt that fails a check
+type Action string
+
+const (
+	// ActionOff skips the checks entirely
+	ActionOff Action = "off"
+	// ActionFlag stores the receipt marked as flagged
+	ActionFlag Action = "flag"
+	// ActionReject refuses to store the receipt
+	ActionReject Action = "reject"
+)
+
+// ParseAction validates an action name from the configuration
+func ParseAction(name string) (Action, error) {
+	switch action := Action(name); action {
+	case ActionOff, ActionFlag, ActionReject:
+		return action, nil
+	}
+	return "", fmt.Errorf("fraud action must be off, flag or reject, got %q", name)
+}
+
+// Check inspects a validated receipt, returning a reason when it looks fraudulent and "" otherwise
+type Check interface {
+	Name() string
+	Inspect(r receipt.Receipt) (string, error)
+}
+
+// Detector runs every check against incoming receipts
+type Detector struct {
+	action Action
+	checks []Check
+}
+
+func NewDetector(action Action, checks ...Check) *Detector {
+	return &Detector{action: action, checks: checks}
+}
+
+// Action reports what should happen to receipts that fail a check
+func (d *Detector) Action() Action {
+	return d.action
+}
+
+// Inspect returns the reasons every failing check gave, none when the receipt looks legitimate
+func (d *Detector) Inspect(r receipt.Receipt) ([]string, error) {
+	if d.action == ActionOff {
+		return nil, nil
+	}
+	var reasons []string
+	for _, check := range d.checks {
+		reason, err := check.Inspect(r)
+		if err != nil {
+			return nil, fmt.Errorf("fraud check %s: %w", check.Name(), err)
+		}
+		if reason != "" {
+			detections.With(check.Name()).Inc()
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons, nil
+}
+
+// ImpossibleTotal flags totals above MaxTotal dollars, and item prices adding up to more than the
+// subtotal, or the total when the receipt has no subtotal
+type ImpossibleTotal struct {
+	MaxTotal int64
+}
+
+func (ImpossibleTotal) Name() string { return "impossibleTotal" }
+
+func (c ImpossibleTotal) Inspect(r receipt.Receipt) (string, error) {
+	total, ok := cents(r.Total)
+	if !ok || (c.MaxTotal > 0 && total > c.MaxTotal*100) {
+		return fmt.Sprintf("total %s exceeds the maximum of %d.00", r.Total, c.MaxTotal), nil
+	}
+	// Discounts legitimately take the total below the item prices, but not the subtotal
+	limit, limitName, limitAmount := total, "total", r.Total
+	if r.Subtotal != "" {
+		if limit, ok = cents(r.Subtotal); !ok {
+			return fmt.Sprintf("subtotal %s is implausibly large", r.Subtotal), nil
+		}
+		limitName, limitAmount = "subtotal", r.Subtotal
+	}
+	var items int64
+	for _, item := range r.Items {
+		price, ok := cents(item.Price)
+		if !ok {
+			return fmt.Sprintf("item price %s is implausibly large", item.Price), nil
+		}
+		if items += price; items > limit {
+			return fmt.Sprintf("item prices add up to more than the %s %s", limitName, limitAmount), nil
+		}
+	}
+	return "", nil
+}
+
+// ItemCount flags receipts with more than Max items
+type ItemCount struct {
+	Max int
+}
+
+func (ItemCount) Name() string { return "itemCount" }
+
+func (c ItemCount) Inspect(r receipt.Receipt) (string, error) {
+	if c.Max > 0 && len(r.Items) > c.Max {
+		return fmt.Sprintf("%d items exceeds the maximum of %d", len(r.Items), c.Max), nil
+	}
+	return "", nil
+}
+
+// Duplicate flags a receipt when the same user submitted one with the same retailer, purchase
+// date, time and total within Window
+type Duplicate struct {
+	Store  store.Store
+	Window time.Duration
+	// Clock tells how recent submissions are, the system clock when nil
+	Clock clock.Clock
+}
+
+func (Duplicate) Name() string { return "duplicate" }
+
+func (c Duplicate) Inspect(r receipt.Receipt) (string, error) {
+	if r.UserID == "" {
+		return "", nil
+	}
+	records, err := c.Store.List()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if c.Clock != nil {
+		now = c.Clock.Now()
+	}
+	since := now.Add(-c.Window)
+	// List is oldest first, so the recent submissions are at the end
+	for i := len(records) - 1; i >= 0 && records[i].CreatedAt.After(since); i-- {
+		previous := records[i].Receipt
+		if previous.UserID == r.UserID && previous.Retailer == r.Retailer && previous.Total == r.Total &&
+			previous.PurchaseDate == r.PurchaseDate && previous.PurchaseTime == r.PurchaseTime {
+			return fmt.Sprintf("duplicates receipt %s submitted at %s", records[i].ID, records[i].CreatedAt.Format(time.RFC3339)), nil
+		}
+	}
+	return "", nil
+}
+
+// PurchaseWindow refuses receipts purchased in the future, or longer ago than the age limit of the
+// caller submitting them. It runs apart from the Detector so its action can differ from that of the
+// fraud checks.
+type PurchaseWindow struct {
+	// Action is what happens to a receipt outside the window; the zero value is ActionOff
+	Action Action
+	// MaxAgeDays is how many days after its purchase date a receipt is still accepted; 0 allows any age
+	MaxAgeDays int
+	// MaxAgeDaysByCaller overrides MaxAgeDays for the API key names it lists
+	MaxAgeDaysByCaller map[string]int
+}
+
+// Inspect returns why a validated receipt submitted by caller at now is outside the window, or ""
+// when it is inside. A purchase date a day ahead is accepted, for callers in timezones further east.
+func (w PurchaseWindow) Inspect(r receipt.Receipt, caller string, now time.Time) string {
+	if w.Action == "" || w.Action == ActionOff {
+		return ""
+	}
+	date, err := time.Parse(validation.DateLayout, r.PurchaseDate)
+	if err != nil {
+		return ""
+	}
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if date.After(today.AddDate(0, 0, 1)) {
+		return fmt.Sprintf("purchase date %s is in the future", r.PurchaseDate)
+	}
+	maxAge := w.MaxAgeDays
+	if days, ok := w.MaxAgeDaysByCaller[caller]; ok {
+		maxAge = days
+	}
+	if maxAge > 0 && date.Before(today.AddDate(0, 0, -maxAge)) {
+		return fmt.Sprintf("purchase date %s is more than %d days ago", r.PurchaseDate, maxAge)
+	}
+	return ""
+}
+
+// cents parses a validated amount such as "12.50", reporting false when it overflows
+func cents(amount string) (int64, bool) {
+	value, err := strconv.ParseInt(strings.Replace(amount, ".", "", 1), 10, 64)
+	return value, err == nil
+}
@@ -0,0 +1,119 @@
+// Package i18n translates the API's user-facing error messages from an embedded catalog, in the
+// language negotiated from a request's Accept-Language header.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed catalog/*.json
+var catalogFiles embed.FS
+
+// Languages the catalog translates messages into; English comes first as the fallback
+var Languages = []string{"en", "es", "fr"}
+
+var matcher = language.NewMatcher([]language.Tag{language.English, language.Spanish, language.French})
+
+// Message identifies a message of the catalog by its key, with the values of its placeholders,
+// e.g. {Key: "param.limit", Params: {"max": "100"}}. Clients receive both to translate it themselves.
+type Message struct {
+	Key    string
+	Params map[string]string
+}
+
+// NewMessage returns the message with the key, its placeholders filled in from args, alternating
+// names and values, e.g. NewMessage("param.limit", "max", 100). Values are formatted with fmt.Sprint.
+func NewMessage(key string, args ...interface{}) Message {
+	message := Message{Key: key}
+	if len(args) > 1 {
+		message.Params = make(map[string]string, len(args)/2)
+		for i := 0; i+1 < len(args); i += 2 {
+			message.Params[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+		}
+	}
+	return message
+}
+
+// Text returns the message in lang with its placeholders filled in, in English when lang has no
+// catalog. A key missing from the catalog is returned as it is.
+func (m Message) Text(lang string) string {
+	text, ok := messages[lang][m.Key]
+	if !ok {
+		if text, ok = messages[Languages[0]][m.Key]; !ok {
+			return m.Key
+		}
+	}
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		if value, ok := m.Params[match[1:len(match)-1]]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// Has reports whether the catalog has a message with the key
+func Has(key string) bool {
+	_, ok := messages[Languages[0]][key]
+	return ok
+}
+
+// Placeholders returns the names of the placeholders of the message with the key, in the order
+// they appear in English
+func Placeholders(key string) []string {
+	var names []string
+	for _, match := range placeholder.FindAllStringSubmatch(messages[Languages[0]][key], -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// messages holds each language's messages by key
+var messages = map[string]map[string]string{}
+
+// placeholder matches a parameter of a message, e.g. {max}
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+func init() {
+	for _, lang := range Languages {
+		data, err := catalogFiles.ReadFile("catalog/" + lang + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("reading the %s message catalog: %v", lang, err))
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("parsing the %s message catalog: %v", lang, err))
+		}
+		messages[lang] = catalog
+	}
+	for key := range messages[Languages[0]] {
+		for _, lang := range Languages[1:] {
+			if _, ok := messages[lang][key]; !ok {
+				panic(fmt.Sprintf("the %s message catalog has no message %q", lang, key))
+			}
+		}
+	}
+}
+
+// Negotiate picks the catalog language best matching an Accept-Language header, English when
+// none does
+func Negotiate(acceptLanguage string) string {
+	_, index, confidence := matcher.Match(parseAcceptLanguage(acceptLanguage)...)
+	if confidence == language.No {
+		return Languages[0]
+	}
+	return Languages[index]
+}
+
+// parseAcceptLanguage returns the languages of an Accept-Language header, most preferred first
+func parseAcceptLanguage(header string) []language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+	return tags
+}
@@ -0,0 +1,64 @@
+// Package idempotency remembers the result of requests sent with an Idempotency-Key, so a client
+// retrying after a timeout gets the original result instead of creating a duplicate.
+package idempotency
+
+import (
+	"errors"
+	"time"
+
+	"receipt-processor/ttlcache"
+)
+
+// ErrInProgress is returned while the first request with a key is still being processed
+var ErrInProgress = errors.New("a request with this idempotency key is in progress")
+
+// Keys is implemented by every idempotency key backend
+type Keys interface {
+	// Reserve claims key for a new request and reports true, or returns the result recorded by the
+	// earlier request with the same key
+	Reserve(key string) (result string, reserved bool, err error)
+	// Complete records the result of the request that reserved key
+	Complete(key, result string) error
+	// Release forgets a reserved key whose request failed, so it can be retried
+	Release(key string) error
+}
+
+// Memory keeps keys in this process; use Postgres when several instances serve the same clients
+type Memory struct {
+	keys *ttlcache.Cache[string, memoryKey]
+}
+
+type memoryKey struct {
+	result string
+	done   bool
+}
+
+// NewMemory remembers each key for ttl after it is first reserved
+func NewMemory(ttl time.Duration) *Memory {
+	return &Memory{keys: ttlcache.New[string, memoryKey](ttlcache.Options{TTL: ttl})}
+}
+
+func (m *Memory) Reserve(key string) (string, bool, error) {
+	entry, reserved := m.keys.SetIfAbsent(key, memoryKey{})
+	switch {
+	case reserved:
+		return "", true, nil
+	case !entry.done:
+		return "", false, ErrInProgress
+	}
+	return entry.result, false, nil
+}
+
+func (m *Memory) Complete(key, result string) error {
+	m.keys.Update(key, func(memoryKey, bool) (memoryKey, bool) {
+		return memoryKey{result: result, done: true}, true
+	})
+	return nil
+}
+
+func (m *Memory) Release(key string) error {
+	m.keys.Update(key, func(entry memoryKey, ok bool) (memoryKey, bool) {
+		return entry, ok && entry.done
+	})
+	return nil
+}
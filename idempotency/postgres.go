@@ -0,0 +1,74 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Postgres keeps keys in a PostgreSQL table, so a retry reaching a different instance still finds
+// the original result
+type Postgres struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewPostgres remembers each key in db for ttl after it is first reserved, creating the table when
+// it doesn't exist yet
+func NewPostgres(db *sql.DB, ttl time.Duration) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key         text PRIMARY KEY,
+		result      text,
+		reserved_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating idempotency_keys table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idempotency_keys_reserved_at ON idempotency_keys (reserved_at)`); err != nil {
+		return nil, fmt.Errorf("creating idempotency_keys index: %w", err)
+	}
+	return &Postgres{db: db, ttl: ttl}, nil
+}
+
+func (p *Postgres) Reserve(key string) (string, bool, error) {
+	// Expire old keys first, including one left in progress by an instance that stopped. Times come
+	// from the database clock so instances with skewed clocks agree.
+	if _, err := p.db.Exec(`DELETE FROM idempotency_keys WHERE reserved_at < now() - make_interval(secs => $1)`, p.ttl.Seconds()); err != nil {
+		return "", false, err
+	}
+
+	// The primary key makes the reservation atomic across instances
+	inserted, err := p.db.Exec(`INSERT INTO idempotency_keys (key, reserved_at) VALUES ($1, now())
+		ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return "", false, err
+	}
+	if rows, err := inserted.RowsAffected(); err != nil || rows == 1 {
+		return "", err == nil, err
+	}
+
+	var result sql.NullString
+	err = p.db.QueryRow(`SELECT result FROM idempotency_keys WHERE key = $1`, key).Scan(&result)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released or expired in between; the client can simply retry
+		return "", false, ErrInProgress
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !result.Valid {
+		return "", false, ErrInProgress
+	}
+	return result.String, false, nil
+}
+
+func (p *Postgres) Complete(key, result string) error {
+	_, err := p.db.Exec(`UPDATE idempotency_keys SET result = $2 WHERE key = $1`, key, result)
+	return err
+}
+
+func (p *Postgres) Release(key string) error {
+	_, err := p.db.Exec(`DELETE FROM idempotency_keys WHERE key = $1 AND result IS NULL`, key)
+	return err
+}
@@ -0,0 +1,164 @@
+// Package ids generates receipt IDs with a configurable strategy.
+//
+// UUIDv4 IDs are random. The other strategies start with a timestamp, so IDs sort in the
+// order they were generated, which keeps inserts into ordered indexes cheap.
+package ids
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Strategy names accepted by New
+const (
+	UUIDv4    = "uuidv4"
+	UUIDv7    = "uuidv7"
+	ULID      = "ulid"
+	Snowflake = "snowflake"
+)
+
+// Generator produces unique IDs; implementations are safe for concurrent use
+type Generator interface {
+	NewID() string
+}
+
+// New returns the generator for a strategy. node identifies this process for snowflake IDs,
+// which are only unique across processes with distinct nodes.
+func New(strategy string, node int) (Generator, error) {
+	switch strategy {
+	case UUIDv4, "":
+		return uuidV4{}, nil
+	case UUIDv7:
+		return uuidV7{}, nil
+	case ULID:
+		return &ulidGenerator{}, nil
+	case Snowflake:
+		if node < 0 || node > maxSnowflakeNode {
+			return nil, fmt.Errorf("snowflake node must be between 0 and %d, got %d", maxSnowflakeNode, node)
+		}
+		return &snowflakeGenerator{node: int64(node)}, nil
+	}
+	return nil, fmt.Errorf("id strategy must be uuidv4, uuidv7, ulid or snowflake, got %q", strategy)
+}
+
+type uuidV4 struct{}
+
+func (uuidV4) NewID() string { return uuid.New().String() }
+
+// uuidV7 relies on the uuid package keeping IDs from this process monotonic within a millisecond
+type uuidV7 struct{}
+
+func (uuidV7) NewID() string { return uuid.Must(uuid.NewV7()).String() }
+
+// crockford is the ULID base32 alphabet, which omits I, L, O and U
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator produces 26-character ULIDs: a 48-bit millisecond timestamp followed by 80 random
+// bits. IDs within the same millisecond increment the random part so they stay ordered.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+func (g *ulidGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.lastMs {
+		// Same millisecond, or the clock stepped back: stay on the last timestamp and count up
+		ms = g.lastMs
+		if !increment(g.entropy[:]) {
+			// 2^80 IDs in one millisecond; move to the next one rather than repeat
+			ms++
+			rand.Read(g.entropy[:])
+		}
+	} else {
+		rand.Read(g.entropy[:])
+	}
+	g.lastMs = ms
+
+	var raw [16]byte
+	for i := 0; i < 6; i++ {
+		raw[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(raw[6:], g.entropy[:])
+	return encodeULID(raw)
+}
+
+// increment adds one to a big-endian number, reporting false when it wrapped around
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes 128 bits as 26 base32 characters, the first holding only the top 3 bits
+func encodeULID(raw [16]byte) string {
+	var out [26]byte
+	// Consume the 128 bits five at a time from the least significant end
+	var acc uint32
+	bits := 0
+	pos := 25
+	for i := 15; i >= 0; i-- {
+		acc |= uint32(raw[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			out[pos] = crockford[acc&31]
+			acc >>= 5
+			bits -= 5
+			pos--
+		}
+	}
+	out[0] = crockford[acc&31]
+	return string(out[:])
+}
+
+// Snowflake IDs pack milliseconds since snowflakeEpoch, the node and a per-millisecond sequence into 63 bits
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	maxSnowflakeNode      = 1<<snowflakeNodeBits - 1
+	maxSnowflakeSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+type snowflakeGenerator struct {
+	node int64
+
+	mu       sync.Mutex
+	lastMs   int64
+	sequence int64
+}
+
+func (g *snowflakeGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Now().UnixMilli() - snowflakeEpoch
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if g.sequence++; g.sequence > maxSnowflakeSequence {
+			// This millisecond is used up; borrow the next one
+			ms++
+			g.sequence = 0
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = ms
+
+	id := ms<<(snowflakeNodeBits+snowflakeSequenceBits) | g.node<<snowflakeSequenceBits | g.sequence
+	// Zero-pad to the 19 digits of the largest int63 so the strings sort like the numbers
+	return fmt.Sprintf("%019d", id)
+}
@@ -0,0 +1,108 @@
+package ids
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+var strategies = []string{UUIDv4, UUIDv7, ULID, Snowflake}
+
+func TestNoCollisionsAcrossGoroutines(t *testing.T) {
+	const goroutines, perGoroutine = 8, 20000
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			generator, err := New(strategy, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results := make([][]string, goroutines)
+			var wg sync.WaitGroup
+			for g := range results {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						results[g] = append(results[g], generator.NewID())
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, goroutines*perGoroutine)
+			for _, batch := range results {
+				for _, id := range batch {
+					if seen[id] {
+						t.Fatalf("duplicate ID %s", id)
+					}
+					seen[id] = true
+				}
+			}
+		})
+	}
+}
+
+func TestNoCollisionsAcrossSnowflakeNodes(t *testing.T) {
+	first, _ := New(Snowflake, 1)
+	second, _ := New(Snowflake, 2)
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		for _, id := range []string{first.NewID(), second.NewID()} {
+			if seen[id] {
+				t.Fatalf("duplicate ID %s across nodes", id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestTimeOrderedStrategiesSort(t *testing.T) {
+	for _, strategy := range []string{UUIDv7, ULID, Snowflake} {
+		t.Run(strategy, func(t *testing.T) {
+			generator, _ := New(strategy, 0)
+			previous := generator.NewID()
+			// Far more IDs than fit in one millisecond's sequence, so overflow is exercised too
+			for i := 0; i < 50000; i++ {
+				next := generator.NewID()
+				if next <= previous {
+					t.Fatalf("ID %s generated after %s does not sort after it", next, previous)
+				}
+				previous = next
+			}
+		})
+	}
+}
+
+func TestULIDFormat(t *testing.T) {
+	generator, _ := New(ULID, 0)
+	id := generator.NewID()
+	if len(id) != 26 {
+		t.Fatalf("ULID %s has %d characters, want 26", id, len(id))
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(crockford, c) {
+			t.Fatalf("ULID %s contains %q outside the Crockford alphabet", id, c)
+		}
+	}
+
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	if got := encodeULID([16]byte{}); got != "00000000000000000000000000" {
+		t.Errorf("encodeULID(zero) = %s", got)
+	}
+	if got := encodeULID(max); got != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("encodeULID(max) = %s", got)
+	}
+}
+
+func TestNewRejectsInvalidSettings(t *testing.T) {
+	if _, err := New("sequential", 0); err == nil {
+		t.Error("unknown strategy was accepted")
+	}
+	if _, err := New(Snowflake, maxSnowflakeNode+1); err == nil {
+		t.Error("out-of-range snowflake node was accepted")
+	}
+}
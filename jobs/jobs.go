@@ -0,0 +1,441 @@
+// Package jobs runs long operations, such as bulk imports and purges, in the background. Jobs
+// report their progress, can be cancelled, and are kept in a JSON file or a database so jobs
+// interrupted by a restart run again.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+	"receipt-processor/ids"
+	"receipt-processor/metrics"
+)
+
+var finished = metrics.NewCounterVec("receipts_jobs_total", "Background jobs finished, by kind and status.", "kind", "status")
+
+// Job statuses. Jobs are queued until the worker starts them and end succeeded, failed or cancelled.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// ErrNotFound is returned when no job has an ID
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned when cancelling a job that already ended
+	ErrFinished = errors.New("job already finished")
+)
+
+// persistInterval bounds how often the progress of the running job is written to the store, and
+// how often the store is checked for a cancellation made through another instance
+const persistInterval = time.Second
+
+// pollInterval is how often the worker looks for jobs queued through other instances
+const pollInterval = 5 * time.Second
+
+// Job is a long operation and how far it has got
+type Job struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Params are the kind-specific parameters the job was submitted with
+	Params json.RawMessage `json:"params,omitempty"`
+	// SubmittedBy names the caller who submitted the job
+	SubmittedBy string `json:"submittedBy,omitempty"`
+	Status      string `json:"status"`
+	// Total is how many items the job has to process, zero until it is known; Done counts those processed
+	Total int `json:"total"`
+	Done  int `json:"done"`
+	// Percent is how much of the job is complete, omitted while the total is unknown
+	Percent *float64 `json:"percent,omitempty"`
+	// Result is the kind-specific outcome of a succeeded job
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// Attempts counts the times the job was started, more than once when a restart interrupted it
+	Attempts int `json:"attempts"`
+	// CancelRequested is set when the job is cancelled through an instance that isn't running it
+	CancelRequested bool       `json:"cancelRequested,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job has ended
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// Runner does the work of one kind of job, reporting progress as it goes, and returns the result
+// to record. It must stop when ctx is cancelled. A job may run again from the start after a
+// restart, so runners should be safe to repeat.
+type Runner func(ctx context.Context, params json.RawMessage, progress *Progress) (interface{}, error)
+
+// Progress reports how far a running job has got
+type Progress struct {
+	manager *Manager
+}
+
+// SetTotal records how many items the job has to process
+func (p *Progress) SetTotal(total int) {
+	p.manager.update(func(job *Job) { job.Total = total })
+}
+
+// Add counts n more items processed
+func (p *Progress) Add(n int) {
+	p.manager.update(func(job *Job) { job.Done += n })
+}
+
+// Options configures a Manager
+type Options struct {
+	// Path persists jobs to a JSON file; empty keeps them in memory. It is ignored with a Store.
+	Path string
+	// Store keeps the jobs instead of Path, e.g. Postgres to share them between instances
+	Store Store
+	// Leader, when set, limits running jobs to the instance holding it; every instance sharing a
+	// Store must share a Leader, so jobs still run one at a time
+	Leader interface{ Held() bool }
+	// Retain is how long finished jobs are kept, a week by default
+	Retain time.Duration
+	// Clock tells the time jobs are submitted, started and finished at, the system clock by default
+	Clock clock.Clock
+	// IDs generates job IDs, random UUIDs by default
+	IDs ids.Generator
+}
+
+// Manager queues jobs and runs them one at a time, in the order they were submitted
+type Manager struct {
+	opts  Options
+	store Store
+
+	mu      sync.Mutex
+	runners map[string]Runner
+	// running is this instance's copy of the job it is running, ahead of the store by the progress
+	// made since the last flush
+	running *Job
+	// cancel stops the running job; cancelled records that Cancel, not shutdown, stopped it
+	cancel    context.CancelFunc
+	cancelled bool
+	// wake tells the worker a job was queued
+	wake chan struct{}
+}
+
+// Open loads the jobs persisted at opts.Path, or uses opts.Store. Jobs that were running when the
+// process stopped are queued to run again.
+func Open(opts Options) (*Manager, error) {
+	if opts.Retain <= 0 {
+		opts.Retain = 7 * 24 * time.Hour
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	if opts.IDs == nil {
+		opts.IDs, _ = ids.New(ids.UUIDv4, 0)
+	}
+	jobStore := opts.Store
+	if jobStore == nil {
+		var err error
+		if jobStore, err = openFile(opts.Path); err != nil {
+			return nil, err
+		}
+	}
+	return &Manager{opts: opts, store: jobStore, runners: make(map[string]Runner), wake: make(chan struct{}, 1)}, nil
+}
+
+// Handle registers the runner for a kind of job; register every kind before Run
+func (m *Manager) Handle(kind string, runner Runner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runners[kind] = runner
+}
+
+// Submit queues a job of a registered kind
+func (m *Manager) Submit(kind string, params json.RawMessage, submittedBy string) (Job, error) {
+	m.mu.Lock()
+	_, ok := m.runners[kind]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, fmt.Errorf("unknown job kind %q", kind)
+	}
+	now := m.opts.Clock.Now()
+	if err := m.store.Prune(now.Add(-m.opts.Retain)); err != nil {
+		return Job{}, err
+	}
+	job := Job{
+		ID:          m.opts.IDs.NewID(),
+		Kind:        kind,
+		Params:      params,
+		SubmittedBy: submittedBy,
+		Status:      StatusQueued,
+		CreatedAt:   now.UTC(),
+	}
+	if err := m.store.Insert(job); err != nil {
+		return Job{}, err
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return snapshot(job), nil
+}
+
+// Get returns the job with the ID, or ErrNotFound
+func (m *Manager) Get(id string) (Job, error) {
+	if job, ok := m.local(id); ok {
+		return job, nil
+	}
+	job, err := m.store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return snapshot(job), nil
+}
+
+// List returns every job, newest first
+func (m *Manager) List() ([]Job, error) {
+	stored, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]Job, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		if job, ok := m.local(stored[i].ID); ok {
+			jobs = append(jobs, job)
+		} else {
+			jobs = append(jobs, snapshot(stored[i]))
+		}
+	}
+	return jobs, nil
+}
+
+// local returns this instance's copy of the job when it is running it
+func (m *Manager) local(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running == nil || m.running.ID != id {
+		return Job{}, false
+	}
+	return snapshot(*m.running), true
+}
+
+// Cancel stops a job: a queued job is cancelled at once, a running one as soon as its runner
+// notices, which for a job another instance runs is after that instance next checks the store
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	if m.running != nil && m.running.ID == id {
+		defer m.mu.Unlock()
+		m.cancelled = true
+		m.cancel()
+		return snapshot(*m.running), nil
+	}
+	m.mu.Unlock()
+
+	job, err := m.store.Update(id, func(job *Job) error {
+		switch job.Status {
+		case StatusQueued:
+			m.end(job, StatusCancelled, nil, "")
+		case StatusRunning:
+			job.CancelRequested = true
+		default:
+			return ErrFinished
+		}
+		return nil
+	})
+	if errors.Is(err, ErrFinished) {
+		return snapshot(job), err
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return snapshot(job), nil
+}
+
+// Run starts queued jobs one at a time until ctx is cancelled. A job running at shutdown is left
+// queued, to run again. With a Leader, jobs only run while it is held.
+func (m *Manager) Run(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	for {
+		job, runner, jobCtx, ok := m.next(ctx)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.wake:
+				continue
+			case <-poll.C:
+				continue
+			}
+		}
+		done := make(chan struct{})
+		go m.watch(ctx, job.ID, done)
+		result, err := runner(jobCtx, job.Params, &Progress{manager: m})
+		close(done)
+		m.finish(ctx, result, err)
+	}
+}
+
+// next marks the oldest queued job running, returning it with its runner and context
+func (m *Manager) next(ctx context.Context) (Job, Runner, context.Context, bool) {
+	if ctx.Err() != nil || !m.leading() {
+		return Job{}, nil, nil, false
+	}
+	for {
+		job, ok, err := m.store.Claim(m.opts.Clock.Now().UTC())
+		if err != nil {
+			log.Printf("claiming the next job failed: %v", err)
+			return Job{}, nil, nil, false
+		}
+		if !ok {
+			return Job{}, nil, nil, false
+		}
+		m.mu.Lock()
+		runner, ok := m.runners[job.Kind]
+		m.mu.Unlock()
+		if !ok {
+			m.record(job.ID, func(stored *Job) {
+				m.end(stored, StatusFailed, nil, "No runner handles jobs of this kind.")
+			})
+			continue
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		var jobCtx context.Context
+		jobCtx, m.cancel = context.WithCancel(ctx)
+		m.running, m.cancelled = &job, false
+		log.Printf("job id=%s kind=%s started attempt=%d", job.ID, job.Kind, job.Attempts)
+		return job, runner, jobCtx, true
+	}
+}
+
+// watch writes the running job's progress to the store every persistInterval until done, and
+// stops the job when it is cancelled through another instance or the Leader is lost
+func (m *Manager) watch(ctx context.Context, id string, done <-chan struct{}) {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !m.leading() {
+			log.Printf("job id=%s stopped: the leader lease was lost", id)
+			m.mu.Lock()
+			m.cancel()
+			m.mu.Unlock()
+			continue
+		}
+		m.mu.Lock()
+		progress := *m.running
+		m.mu.Unlock()
+		stored, err := m.store.Update(id, func(job *Job) error {
+			job.Total, job.Done = progress.Total, progress.Done
+			return nil
+		})
+		if err != nil {
+			log.Printf("job id=%s persisting progress failed: %v", id, err)
+			continue
+		}
+		if stored.CancelRequested {
+			m.mu.Lock()
+			m.cancelled = true
+			m.cancel()
+			m.mu.Unlock()
+		}
+	}
+}
+
+// finish records how the running job ended
+func (m *Manager) finish(ctx context.Context, result interface{}, err error) {
+	m.mu.Lock()
+	m.cancel()
+	job, cancelled := *m.running, m.cancelled
+	m.running = nil
+	m.mu.Unlock()
+
+	if !m.leading() {
+		// The instance now holding the Leader runs the job again
+		return
+	}
+	var data json.RawMessage
+	if err == nil && !cancelled && ctx.Err() == nil {
+		var marshalErr error
+		if data, marshalErr = json.Marshal(result); marshalErr != nil {
+			err = marshalErr
+		}
+	}
+	stored := m.record(job.ID, func(stored *Job) {
+		stored.Total, stored.Done = job.Total, job.Done
+		switch {
+		case cancelled:
+			m.end(stored, StatusCancelled, nil, "")
+		case ctx.Err() != nil:
+			// Shutting down: leave the job to run again
+			stored.Status = StatusQueued
+		case err != nil:
+			m.end(stored, StatusFailed, nil, err.Error())
+		default:
+			m.end(stored, StatusSucceeded, data, "")
+		}
+	})
+	if stored.Finished() {
+		log.Printf("job id=%s kind=%s status=%s done=%d", stored.ID, stored.Kind, stored.Status, stored.Done)
+	}
+}
+
+// record changes a job in the store, logging a failure
+func (m *Manager) record(id string, change func(job *Job)) Job {
+	job, err := m.store.Update(id, func(job *Job) error {
+		change(job)
+		return nil
+	})
+	if err != nil {
+		log.Printf("job id=%s persisting state failed: %v", id, err)
+	}
+	return job
+}
+
+// leading reports whether this instance may run jobs
+func (m *Manager) leading() bool {
+	return m.opts.Leader == nil || m.opts.Leader.Held()
+}
+
+// end marks a job finished
+func (m *Manager) end(job *Job, status string, result json.RawMessage, message string) {
+	now := m.opts.Clock.Now().UTC()
+	job.Status, job.Result, job.Error, job.FinishedAt = status, result, message, &now
+	job.CancelRequested = false
+	finished.With(job.Kind, status).Inc()
+}
+
+// update changes the running job's progress
+func (m *Manager) update(change func(job *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running != nil {
+		change(m.running)
+	}
+}
+
+// snapshot fills in a job's percent complete for callers
+func snapshot(job Job) Job {
+	if job.Status == StatusSucceeded {
+		percent := 100.0
+		job.Percent = &percent
+	} else if job.Total > 0 {
+		percent := float64(min(job.Done, job.Total)) * 100 / float64(job.Total)
+		job.Percent = &percent
+	}
+	return job
+}
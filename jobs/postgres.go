@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Postgres keeps the jobs in a PostgreSQL table, so every instance sharing the database reports
+// and cancels the same jobs
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the jobs in db, creating the table when it doesn't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id          text PRIMARY KEY,
+		created_at  timestamptz NOT NULL,
+		status      text NOT NULL,
+		finished_at timestamptz,
+		job         jsonb NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating jobs table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status, created_at, id)`); err != nil {
+		return nil, fmt.Errorf("creating jobs status index: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+func (p *Postgres) Insert(job Job) error {
+	return save(p.db, job, `INSERT INTO jobs (id, created_at, status, finished_at, job) VALUES ($1, $2, $3, $4, $5)`)
+}
+
+func (p *Postgres) Get(id string) (Job, error) {
+	return scanJob(p.db.QueryRow(`SELECT job FROM jobs WHERE id = $1`, id))
+}
+
+func (p *Postgres) List() ([]Job, error) {
+	rows, err := p.db.Query(`SELECT job FROM jobs ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (p *Postgres) Claim(now time.Time) (Job, bool, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return Job{}, false, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`SELECT job FROM jobs WHERE status = $1 FOR UPDATE`, StatusRunning)
+	if err != nil {
+		return Job{}, false, err
+	}
+	var abandoned []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			rows.Close()
+			return Job{}, false, err
+		}
+		abandoned = append(abandoned, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Job{}, false, err
+	}
+	for _, job := range abandoned {
+		job.Status = StatusQueued
+		if err := save(tx, job, updateJob); err != nil {
+			return Job{}, false, err
+		}
+	}
+
+	job, err := scanJob(tx.QueryRow(`SELECT job FROM jobs WHERE status = $1 ORDER BY created_at, id LIMIT 1 FOR UPDATE`, StatusQueued))
+	if errors.Is(err, ErrNotFound) {
+		return Job{}, false, tx.Commit()
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	start(&job, now)
+	if err := save(tx, job, updateJob); err != nil {
+		return Job{}, false, err
+	}
+	return job, true, tx.Commit()
+}
+
+func (p *Postgres) Update(id string, change func(job *Job) error) (Job, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return Job{}, err
+	}
+	defer tx.Rollback()
+	job, err := scanJob(tx.QueryRow(`SELECT job FROM jobs WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return Job{}, err
+	}
+	changed := job
+	if err := change(&changed); err != nil {
+		return job, err
+	}
+	if err := save(tx, changed, updateJob); err != nil {
+		return Job{}, err
+	}
+	return changed, tx.Commit()
+}
+
+func (p *Postgres) Prune(cutoff time.Time) error {
+	_, err := p.db.Exec(`DELETE FROM jobs WHERE finished_at < $1`, cutoff)
+	return err
+}
+
+// updateJob replaces a job's row with save
+const updateJob = `UPDATE jobs SET created_at = $2, status = $3, finished_at = $4, job = $5 WHERE id = $1`
+
+// save writes a job through db or a transaction with a statement taking its ID, creation time,
+// status, finish time and JSON
+func save(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, job Job, statement string) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(statement, job.ID, job.CreatedAt, job.Status, job.FinishedAt, string(data))
+	return err
+}
+
+// scanJob reads a row holding a job's JSON, or returns ErrNotFound
+func scanJob(row interface{ Scan(...interface{}) error }) (Job, error) {
+	var data []byte
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	err = json.Unmarshal(data, &job)
+	return job, err
+}
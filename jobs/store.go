@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps the jobs: in memory or a JSON file for a single instance by default, or Postgres
+// shared by every instance
+type Store interface {
+	// Insert adds a job
+	Insert(job Job) error
+	// Get returns the job with the ID, or ErrNotFound
+	Get(id string) (Job, error)
+	// List returns every job, oldest first
+	List() ([]Job, error)
+	// Claim queues again the jobs left running, whose worker stopped, then marks the oldest queued
+	// job running at now and returns it, reporting false when none is queued
+	Claim(now time.Time) (Job, bool, error)
+	// Update applies change to the job with the ID and returns it, or ErrNotFound. An error from
+	// change leaves the job unchanged and is returned with it.
+	Update(id string, change func(job *Job) error) (Job, error)
+	// Prune drops the jobs that finished before cutoff
+	Prune(cutoff time.Time) error
+}
+
+// fileStore keeps the jobs in memory, optionally persisted to a JSON file
+type fileStore struct {
+	path string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// openFile loads the jobs persisted at path, creating the file on first change. An empty path keeps
+// them in memory.
+func openFile(path string) (*fileStore, error) {
+	f := &fileStore{path: path, jobs: make(map[string]*Job)}
+	if path == "" {
+		return f, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("parsing jobs %s: %w", path, err)
+	}
+	for _, job := range jobs {
+		f.jobs[job.ID] = job
+	}
+	return f, nil
+}
+
+func (f *fileStore) Insert(job Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobs[job.ID] = &job
+	if err := f.persist(); err != nil {
+		delete(f.jobs, job.ID)
+		return err
+	}
+	return nil
+}
+
+func (f *fileStore) Get(id string) (Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job, ok := f.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+func (f *fileStore) List() ([]Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	jobs := make([]Job, 0, len(f.jobs))
+	for _, job := range f.sorted() {
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
+
+func (f *fileStore) Claim(now time.Time) (Job, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed *Job
+	for _, job := range f.sorted() {
+		if job.Status == StatusRunning {
+			job.Status = StatusQueued
+		}
+		if claimed == nil && job.Status == StatusQueued {
+			claimed = job
+		}
+	}
+	if claimed == nil {
+		return Job{}, false, nil
+	}
+	start(claimed, now)
+	return *claimed, true, f.persist()
+}
+
+func (f *fileStore) Update(id string, change func(job *Job) error) (Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job, ok := f.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	changed := *job
+	if err := change(&changed); err != nil {
+		return *job, err
+	}
+	*job = changed
+	return changed, f.persist()
+}
+
+func (f *fileStore) Prune(cutoff time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, job := range f.jobs {
+		if job.Finished() && job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(f.jobs, id)
+		}
+	}
+	return nil
+}
+
+// sorted returns the jobs oldest first; the caller holds mu
+func (f *fileStore) sorted() []*Job {
+	jobs := make([]*Job, 0, len(f.jobs))
+	for _, job := range f.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// persist writes the jobs to their file; the caller holds mu
+func (f *fileStore) persist() error {
+	if f.path == "" {
+		return nil
+	}
+	return writeFile(f.path, f.sorted())
+}
+
+// start marks a claimed job running from the start
+func start(job *Job, now time.Time) {
+	job.Status, job.StartedAt, job.Done, job.Total = StatusRunning, &now, 0, 0
+	job.CancelRequested = false
+	job.Attempts++
+}
+
+// writeFile replaces the file through a temporary file so a crash never leaves it half written
+func writeFile(path string, jobs []*Job) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".jobs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,114 @@
+// Package leader elects one of several server instances to run background jobs, using a lease
+// row in the shared database.
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"receipt-processor/metrics"
+)
+
+var leading = metrics.NewGauge("receipts_leader", "1 while this instance holds the leader lease, otherwise 0.")
+
+// Lease is held by at most one instance at a time. The holder renews it well before it expires;
+// when the holder stops, another instance takes it over once it expires.
+type Lease struct {
+	db     *sql.DB
+	name   string
+	holder string
+	ttl    time.Duration
+
+	mu sync.Mutex
+	// until is when this instance's hold lapses unless it is renewed
+	until time.Time
+}
+
+// NewLease competes for the lease called name as holder, which must be unique to each instance,
+// creating the table when it doesn't exist yet
+func NewLease(db *sql.DB, name, holder string, ttl time.Duration) (*Lease, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS leader_leases (
+		name       text PRIMARY KEY,
+		holder     text NOT NULL,
+		expires_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating leader_leases table: %w", err)
+	}
+	return &Lease{db: db, name: name, holder: holder, ttl: ttl}, nil
+}
+
+// Held reports whether this instance holds the lease
+func (l *Lease) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.until)
+}
+
+// acquire takes the lease when it is free or expired, or renews it when this instance already holds it
+func (l *Lease) acquire() error {
+	start := time.Now()
+	// Expiry is judged by the database clock so instances with skewed clocks agree
+	result, err := l.db.Exec(`INSERT INTO leader_leases (name, holder, expires_at)
+		VALUES ($1, $2, now() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leader_leases.holder = EXCLUDED.holder OR leader_leases.expires_at < now()`,
+		l.name, l.holder, l.ttl.Seconds())
+	held := false
+	if err == nil {
+		var rows int64
+		rows, err = result.RowsAffected()
+		held = rows == 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	wasHeld := time.Now().Before(l.until)
+	if held {
+		// Count from before the statement was sent, so this instance gives up no later than the database does
+		l.until = start.Add(l.ttl)
+	} else if err == nil {
+		l.until = time.Time{}
+	}
+	switch nowHeld := time.Now().Before(l.until); {
+	case nowHeld && !wasHeld:
+		log.Printf("leader lease %s acquired by %s", l.name, l.holder)
+		leading.Set(1)
+	case !nowHeld && wasHeld:
+		log.Printf("leader lease %s lost by %s", l.name, l.holder)
+		leading.Set(0)
+	}
+	return err
+}
+
+// Run competes for the lease until ctx is cancelled, then releases it if held
+func (l *Lease) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		if err := l.acquire(); err != nil {
+			log.Printf("renewing leader lease %s: %v", l.name, err)
+		}
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// release hands the lease over straight away instead of letting it expire
+func (l *Lease) release() {
+	l.mu.Lock()
+	l.until = time.Time{}
+	l.mu.Unlock()
+	leading.Set(0)
+	if _, err := l.db.Exec(`DELETE FROM leader_leases WHERE name = $1 AND holder = $2`, l.name, l.holder); err != nil {
+		log.Printf("releasing leader lease %s: %v", l.name, err)
+	}
+}
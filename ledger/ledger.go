@@ -0,0 +1,255 @@
+// Package ledger records every movement of loyalty points into and out of user balances.
+//
+// A user's balance is the sum of their entries, so it survives receipts being purged by
+// retention. Entries are only ever removed when their user or receipt is erased.
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+)
+
+// Entry kinds
+const (
+	// KindEarn credits an approved receipt's points
+	KindEarn = "earn"
+	// KindRescore moves the difference when an approved receipt is reprocessed
+	KindRescore = "rescore"
+	// KindAdjustment is a manual goodwill credit or correction
+	KindAdjustment = "adjustment"
+	// KindReferral credits the bonus of a referral to the referred user and their referrer
+	KindReferral = "referral"
+	// KindDeletion debits an approved receipt's points when it is moved to the trash
+	KindDeletion = "deletion"
+	// KindRestore credits them back when it is restored
+	KindRestore = "restore"
+	// KindMerge debits the points of an approved receipt merged into another, which earns them instead
+	KindMerge = "merge"
+	// KindClawback debits the points a return takes back from the purchase it refunds
+	KindClawback = "clawback"
+)
+
+// ErrAlreadyEarned is returned by Append for a second earn or clawback entry of the same receipt
+var ErrAlreadyEarned = errors.New("the receipt already earned its points")
+
+// earns reports whether an entry of kind is the one a receipt earns its points with when approved
+func earns(kind string) bool {
+	return kind == KindEarn || kind == KindClawback
+}
+
+// Entry is one movement of points, positive for credits and negative for debits
+type Entry struct {
+	Sequence  int       `json:"sequence"`
+	Time      time.Time `json:"time"`
+	UserID    string    `json:"userId,omitempty"`
+	ReceiptID string    `json:"receiptId,omitempty"`
+	Kind      string    `json:"kind"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+}
+
+// Book keeps the entries of a ledger: a Ledger in memory or a file for a single instance, or
+// Postgres shared by every instance
+type Book interface {
+	// Append assigns the entry its sequence number and time, persists it and returns it; a second
+	// earn or clawback entry for a receipt returns ErrAlreadyEarned
+	Append(entry Entry) (Entry, error)
+	// Entries returns a user's entries, oldest first
+	Entries(userID string) ([]Entry, error)
+	// Balance sums a user's entries
+	Balance(userID string) (int, error)
+	// EraseUser removes every entry for a user and returns how many were removed
+	EraseUser(userID string) (int, error)
+	// EraseReceipt removes every entry for a receipt and returns how many were removed
+	EraseReceipt(receiptID string) (int, error)
+}
+
+// Ledger is an append-only list of entries, optionally persisted as JSON lines
+type Ledger struct {
+	mu       sync.Mutex
+	path     string
+	clock    clock.Clock
+	entries  []Entry
+	sequence int
+	// earned holds the receipts with an earn or clawback entry
+	earned map[string]bool
+}
+
+// Open loads the ledger persisted at path, creating it on first append. An empty path keeps the ledger in memory.
+// Entries are timed by c, the system clock when nil.
+func Open(path string, c clock.Clock) (*Ledger, error) {
+	if c == nil {
+		c = clock.System{}
+	}
+	l := &Ledger{path: path, clock: c, earned: map[string]bool{}}
+	if path == "" {
+		return l, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("reading ledger entry %d: %w", len(l.entries)+1, err)
+		}
+		l.entries = append(l.entries, entry)
+		l.sequence = max(l.sequence, entry.Sequence)
+		if earns(entry.Kind) {
+			l.earned[entry.ReceiptID] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append assigns the entry its sequence number and time, persists it and returns it. A receipt
+// earns its points once: a second earn or clawback entry for it returns ErrAlreadyEarned.
+func (l *Ledger) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if earns(entry.Kind) && entry.ReceiptID != "" && l.earned[entry.ReceiptID] {
+		return Entry{}, ErrAlreadyEarned
+	}
+
+	entry.Sequence = l.sequence + 1
+	entry.Time = l.clock.Now().UTC()
+	if l.path != "" {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return Entry{}, err
+		}
+		file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return Entry{}, err
+		}
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return Entry{}, err
+		}
+	}
+	l.sequence = entry.Sequence
+	l.entries = append(l.entries, entry)
+	if earns(entry.Kind) && entry.ReceiptID != "" {
+		l.earned[entry.ReceiptID] = true
+	}
+	return entry, nil
+}
+
+// Entries returns a user's entries, oldest first
+func (l *Ledger) Entries(userID string) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	matched := []Entry{}
+	for _, entry := range l.entries {
+		if entry.UserID == userID {
+			matched = append(matched, entry)
+		}
+	}
+	return matched, nil
+}
+
+// Balance sums a user's entries
+func (l *Ledger) Balance(userID string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	balance := 0
+	for _, entry := range l.entries {
+		if entry.UserID == userID {
+			balance += entry.Points
+		}
+	}
+	return balance, nil
+}
+
+// EraseUser removes every entry for a user and returns how many were removed
+func (l *Ledger) EraseUser(userID string) (int, error) {
+	return l.erase(func(entry Entry) bool { return entry.UserID == userID })
+}
+
+// EraseReceipt removes every entry for a receipt and returns how many were removed
+func (l *Ledger) EraseReceipt(receiptID string) (int, error) {
+	return l.erase(func(entry Entry) bool { return entry.ReceiptID == receiptID })
+}
+
+// erase rewrites the ledger without the matching entries
+func (l *Ledger) erase(match func(Entry) bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := make([]Entry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		if !match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(l.entries) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	if l.path != "" {
+		if err := l.persist(kept); err != nil {
+			return 0, err
+		}
+	}
+	l.entries = kept
+	l.earned = map[string]bool{}
+	for _, entry := range kept {
+		if earns(entry.Kind) {
+			l.earned[entry.ReceiptID] = true
+		}
+	}
+	return removed, nil
+}
+
+// persist atomically replaces the ledger file with the given entries
+func (l *Ledger) persist(entries []Entry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".ledger-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
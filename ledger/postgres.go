@@ -0,0 +1,103 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Postgres keeps the ledger in a PostgreSQL table, so every instance sharing the database sees the
+// same balances
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the ledger in db, creating the table when it doesn't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ledger (
+		sequence   bigserial PRIMARY KEY,
+		time       timestamptz NOT NULL DEFAULT now(),
+		user_id    text NOT NULL,
+		receipt_id text NOT NULL,
+		kind       text NOT NULL,
+		points     integer NOT NULL,
+		reason     text NOT NULL,
+		actor      text NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating ledger table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS ledger_user ON ledger (user_id, sequence)`); err != nil {
+		return nil, fmt.Errorf("creating ledger user index: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS ledger_receipt ON ledger (receipt_id)`); err != nil {
+		return nil, fmt.Errorf("creating ledger receipt index: %w", err)
+	}
+	// A receipt earns its points once, whichever instance approves it
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS ledger_earned ON ledger (receipt_id)
+		WHERE kind IN ('` + KindEarn + `', '` + KindClawback + `') AND receipt_id <> ''`)
+	if err != nil {
+		return nil, fmt.Errorf("creating ledger earned index: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+// Append records the entry, timed by the database clock so instances with skewed clocks agree
+func (p *Postgres) Append(entry Entry) (Entry, error) {
+	err := p.db.QueryRow(`INSERT INTO ledger (user_id, receipt_id, kind, points, reason, actor)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING RETURNING sequence, time`,
+		entry.UserID, entry.ReceiptID, entry.Kind, entry.Points, entry.Reason, entry.Actor).Scan(&entry.Sequence, &entry.Time)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, ErrAlreadyEarned
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Time = entry.Time.UTC()
+	return entry, nil
+}
+
+func (p *Postgres) Entries(userID string) ([]Entry, error) {
+	rows, err := p.db.Query(`SELECT sequence, time, user_id, receipt_id, kind, points, reason, actor
+		FROM ledger WHERE user_id = $1 ORDER BY sequence`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(&entry.Sequence, &entry.Time, &entry.UserID, &entry.ReceiptID, &entry.Kind,
+			&entry.Points, &entry.Reason, &entry.Actor); err != nil {
+			return nil, err
+		}
+		entry.Time = entry.Time.UTC()
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (p *Postgres) Balance(userID string) (int, error) {
+	var balance int
+	err := p.db.QueryRow(`SELECT coalesce(sum(points), 0) FROM ledger WHERE user_id = $1`, userID).Scan(&balance)
+	return balance, err
+}
+
+func (p *Postgres) EraseUser(userID string) (int, error) {
+	return p.erase(`DELETE FROM ledger WHERE user_id = $1`, userID)
+}
+
+func (p *Postgres) EraseReceipt(receiptID string) (int, error) {
+	return p.erase(`DELETE FROM ledger WHERE receipt_id = $1`, receiptID)
+}
+
+// erase deletes the entries a statement matches and returns how many it removed
+func (p *Postgres) erase(statement string, arg string) (int, error) {
+	result, err := p.db.Exec(statement, arg)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
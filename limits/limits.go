@@ -0,0 +1,105 @@
+// Package limits caps how many receipts and points each user can submit per day and week.
+package limits
+
+import (
+	"fmt"
+	"time"
+
+	"receipt-processor/store"
+)
+
+// Limits are the caps on a user's submissions; zero values mean unlimited. Days and weeks are
+// calendar days and weeks in UTC, weeks starting on Monday.
+type Limits struct {
+	ReceiptsPerDay int
+	PointsPerDay   int
+	PointsPerWeek  int
+}
+
+// Enabled reports whether any cap is set
+func (l Limits) Enabled() bool {
+	return l.ReceiptsPerDay > 0 || l.PointsPerDay > 0 || l.PointsPerWeek > 0
+}
+
+// Quota is how much of one cap a user has used. Limit and Remaining are nil when it is unlimited.
+type Quota struct {
+	Limit     *int      `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining *int      `json:"remaining"`
+	ResetsAt  time.Time `json:"resetsAt"`
+}
+
+// Usage is a user's standing against every cap
+type Usage struct {
+	Receipts       Quota `json:"receiptsToday"`
+	PointsToday    Quota `json:"pointsToday"`
+	PointsThisWeek Quota `json:"pointsThisWeek"`
+}
+
+// Exceeded is why a receipt would take its user over a cap
+type Exceeded struct {
+	// Receipts is true when the cap on receipts was hit, false when a cap on points was
+	Receipts bool
+	Reason   string
+}
+
+// Usage sums the receipts the user submitted today and the points they earned today and this week.
+// Rejected receipts don't count.
+func (l Limits) Usage(records []store.Record, userID string, now time.Time) Usage {
+	day, week := periods(now)
+
+	var receipts, pointsToday, pointsThisWeek int
+	for _, record := range records {
+		if record.Receipt.UserID != userID || record.Status == store.StatusRejected || record.Status == store.StatusMerged || record.CreatedAt.Before(week) {
+			continue
+		}
+		pointsThisWeek += record.Points
+		if !record.CreatedAt.Before(day) {
+			receipts++
+			pointsToday += record.Points
+		}
+	}
+	return Usage{
+		Receipts:       quota(l.ReceiptsPerDay, receipts, day.AddDate(0, 0, 1)),
+		PointsToday:    quota(l.PointsPerDay, pointsToday, day.AddDate(0, 0, 1)),
+		PointsThisWeek: quota(l.PointsPerWeek, pointsThisWeek, week.AddDate(0, 0, 7)),
+	}
+}
+
+// Since is the start of the current week, before which Usage counts no receipts
+func Since(now time.Time) time.Time {
+	_, week := periods(now)
+	return week
+}
+
+// periods returns the start of the UTC day and week now falls in
+func periods(now time.Time) (day, week time.Time) {
+	now = now.UTC()
+	day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// time.Weekday counts from Sunday, so shift it to count from Monday
+	week = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	return day, week
+}
+
+// Check reports the cap a new receipt worth points would exceed, or nil when it is within them all
+func (u Usage) Check(points int) *Exceeded {
+	if u.Receipts.Remaining != nil && *u.Receipts.Remaining < 1 {
+		return &Exceeded{Receipts: true, Reason: fmt.Sprintf("the user has already submitted %d receipts today", *u.Receipts.Limit)}
+	}
+	if u.PointsToday.Remaining != nil && points > *u.PointsToday.Remaining {
+		return &Exceeded{Reason: fmt.Sprintf("the receipt's %d points exceed the %d points the user can still earn today", points, *u.PointsToday.Remaining)}
+	}
+	if u.PointsThisWeek.Remaining != nil && points > *u.PointsThisWeek.Remaining {
+		return &Exceeded{Reason: fmt.Sprintf("the receipt's %d points exceed the %d points the user can still earn this week", points, *u.PointsThisWeek.Remaining)}
+	}
+	return nil
+}
+
+func quota(limit, used int, resetsAt time.Time) Quota {
+	q := Quota{Used: used, ResetsAt: resetsAt}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		q.Limit, q.Remaining = &limit, &remaining
+	}
+	return q
+}
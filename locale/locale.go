@@ -0,0 +1,144 @@
+// Package locale parses the amounts and dates of receipts exported by point-of-sale systems in
+// regional formats, e.g. 1.234,56 and 31/01/2024, into the canonical forms the schema requires.
+package locale
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is how a locale writes numbers and dates
+type Format struct {
+	// Decimal separates the fraction of a number, and Group the thousands of its integer part;
+	// Group may be written as any of several characters, e.g. the spaces French uses
+	Decimal string
+	Group   []string
+	// DateLayout is the date format, as a time.Parse layout
+	DateLayout string
+}
+
+// Formats are the supported locales by BCP 47 tag
+var Formats = map[string]Format{
+	"en-US": {Decimal: ".", Group: []string{","}, DateLayout: "01/02/2006"},
+	"en-GB": {Decimal: ".", Group: []string{","}, DateLayout: "02/01/2006"},
+	"de-DE": {Decimal: ",", Group: []string{"."}, DateLayout: "02.01.2006"},
+	"es-ES": {Decimal: ",", Group: []string{"."}, DateLayout: "02/01/2006"},
+	"fr-FR": {Decimal: ",", Group: []string{" ", "\u00a0", "\u202f"}, DateLayout: "02/01/2006"},
+	"it-IT": {Decimal: ",", Group: []string{"."}, DateLayout: "02/01/2006"},
+	"nl-NL": {Decimal: ",", Group: []string{"."}, DateLayout: "02-01-2006"},
+	"pt-BR": {Decimal: ",", Group: []string{"."}, DateLayout: "02/01/2006"},
+	"ja-JP": {Decimal: ".", Group: []string{","}, DateLayout: "2006/01/02"},
+}
+
+// Names returns the supported locales in order
+func Names() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canonicalDate is the date layout of the schema
+const canonicalDate = "2006-01-02"
+
+// Number converts a number such as "-1.234,56" to its canonical form, "-1234.56". Grouped digits
+// must come in threes. A number not written in the locale's format is reported with false.
+func (f Format) Number(s string) (string, bool) {
+	sign := ""
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = "-", rest
+	}
+	integer, fraction, hasFraction := strings.Cut(s, f.Decimal)
+	for _, group := range f.Group {
+		integer = strings.ReplaceAll(integer, group, "\x00")
+	}
+	groups := strings.Split(integer, "\x00")
+	for i, group := range groups {
+		if !digits(group) || i > 0 && len(group) != 3 || i == 0 && len(groups) > 1 && len(group) > 3 {
+			return "", false
+		}
+	}
+	if hasFraction && !digits(fraction) {
+		return "", false
+	}
+	canonical := sign + strings.Join(groups, "")
+	if hasFraction {
+		canonical += "." + fraction
+	}
+	return canonical, true
+}
+
+// digits reports whether s is one or more ASCII digits
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Date converts a date such as "31/01/2024" to its canonical form, "2024-01-31". Dates already in
+// the canonical form are kept, as no locale writes them differently.
+func (f Format) Date(s string) (string, bool) {
+	if _, err := time.Parse(canonicalDate, s); err == nil {
+		return s, true
+	}
+	date, err := time.Parse(f.DateLayout, s)
+	if err != nil {
+		return "", false
+	}
+	return date.Format(canonicalDate), true
+}
+
+// Amount fields of a receipt and its items
+var (
+	receiptAmounts = []string{"total", "subtotal", "discount", "tax"}
+	itemAmounts    = []string{"price", "unitPrice", "quantity"}
+)
+
+// Normalize rewrites the amounts and purchase date of an encoded receipt from the locale's format
+// to the canonical one. Values that aren't in the locale's format, and bodies that aren't JSON
+// objects, are left for schema validation to report.
+func (f Format) Normalize(raw []byte) []byte {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil || fields == nil || decoder.Decode(new(interface{})) != io.EOF {
+		return raw
+	}
+	f.rewrite(fields, receiptAmounts, f.Number)
+	f.rewrite(fields, []string{"purchaseDate"}, f.Date)
+	if items, ok := fields["items"].([]interface{}); ok {
+		for _, item := range items {
+			if item, ok := item.(map[string]interface{}); ok {
+				f.rewrite(item, itemAmounts, f.Number)
+			}
+		}
+	}
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return raw
+	}
+	return normalized
+}
+
+// rewrite replaces the string values of the named fields with their canonical forms
+func (f Format) rewrite(fields map[string]interface{}, names []string, canonical func(string) (string, bool)) {
+	for _, name := range names {
+		if value, ok := fields[name].(string); ok {
+			if converted, ok := canonical(strings.TrimSpace(value)); ok {
+				fields[name] = converted
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package locale
+
+import "testing"
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		locale, in, want string
+		ok               bool
+	}{
+		{"de-DE", "1.234,56", "1234.56", true},
+		{"de-DE", "-12,50", "-12.50", true},
+		{"de-DE", "1234,56", "1234.56", true},
+		{"de-DE", "12.50", "", false},
+		{"de-DE", "1.23,45", "", false},
+		{"fr-FR", "1 234,56", "1234.56", true},
+		{"en-US", "1,234.56", "1234.56", true},
+		{"en-US", "12.50", "12.50", true},
+		{"en-US", "1234,56", "", false},
+		{"en-US", "12a.00", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Formats[tt.locale].Number(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s Number(%q) = %q, %v, want %q, %v", tt.locale, tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	raw := []byte(`{"purchaseDate":"31/01/2024","total":"1.234,50","items":[{"price":"1.234,50","unitPrice":"x"}],"count":1}`)
+	want := `{"count":1,"items":[{"price":"1234.50","unitPrice":"x"}],"purchaseDate":"2024-01-31","total":"1234.50"}`
+	if got := string(Formats["es-ES"].Normalize(raw)); got != want {
+		t.Errorf("Normalize() = %s, want %s", got, want)
+	}
+	for _, invalid := range []string{`not json`, `null`, `{"total":"1,00"} {}`} {
+		if got := string(Formats["es-ES"].Normalize([]byte(invalid))); got != invalid {
+			t.Errorf("Normalize(%s) = %s, want it unchanged", invalid, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogramSeries is a single labelled histogram of a family
+type histogramSeries struct {
+	mu sync.Mutex
+	// counts holds the observations of each bucket, not cumulated, the last one being +Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+	// exemplars holds the latest exemplar observed in each bucket, nil while there is none
+	exemplars []*exemplar
+}
+
+// exemplar is one observation linked to where it came from
+type exemplar struct {
+	labels string
+	value  float64
+	time   time.Time
+}
+
+// histogramFamily is a histogram name with one series per combination of label values
+type histogramFamily struct {
+	metricName string
+	help       string
+	buckets    []float64
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+func (f *histogramFamily) name() string {
+	return f.metricName
+}
+
+func (f *histogramFamily) with(values []string) *histogramSeries {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(f.buckets)+1), exemplars: make([]*exemplar, len(f.buckets)+1)}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *histogramFamily) write(b *strings.Builder, openMetrics bool) {
+	writeHeader(b, f.metricName, f.help, "histogram", openMetrics)
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := append(append([]string{}, f.labels...), "le")
+	for _, key := range keys {
+		var values []string
+		if len(f.labels) > 0 {
+			values = strings.Split(key, "\xff")
+		}
+		s := f.series[key]
+		s.mu.Lock()
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			upper := math.Inf(1)
+			if i < len(f.buckets) {
+				upper = f.buckets[i]
+			}
+			fmt.Fprintf(b, "%s_bucket%s %d", f.metricName, formatLabels(names, append(values, formatValue(upper))), cumulative)
+			if e := s.exemplars[i]; openMetrics && e != nil {
+				fmt.Fprintf(b, " # {%s} %s %s", e.labels, formatValue(e.value), strconv.FormatFloat(float64(e.time.UnixMilli())/1000, 'f', 3, 64))
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.metricName, formatLabels(f.labels, values), formatValue(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.metricName, formatLabels(f.labels, values), s.count)
+		s.mu.Unlock()
+	}
+	f.mu.Unlock()
+}
+
+// Histogram counts observations, such as request latencies, into buckets so quantiles can be
+// estimated from them
+type Histogram struct {
+	s       *histogramSeries
+	buckets []float64
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.observe(value, nil)
+}
+
+// ObserveWithExemplar observes value and keeps it as the bucket's exemplar, labelled e.g.
+// {"request_id": "..."}, so a slow bucket can be traced back to a request. Exemplars are only
+// exposed in the OpenMetrics format.
+func (h *Histogram) ObserveWithExemplar(value float64, labels map[string]string) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	h.observe(value, &exemplar{labels: strings.Join(pairs, ","), value: value, time: time.Now()})
+}
+
+func (h *Histogram) observe(value float64, e *exemplar) {
+	i := sort.SearchFloat64s(h.buckets, value)
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	h.s.counts[i]++
+	h.s.sum += value
+	h.s.count++
+	if e != nil {
+		h.s.exemplars[i] = e
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	f *histogramFamily
+}
+
+// NewHistogramVec registers a histogram family with the given upper bucket bounds, in increasing
+// order, and label names in the Default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	f := &histogramFamily{metricName: name, help: help, buckets: buckets, labels: labels, series: make(map[string]*histogramSeries)}
+	return &HistogramVec{f: Default.register(f).(*histogramFamily)}
+}
+
+// With returns the histogram for the label values, in the order the labels were declared
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{s: v.f.with(values), buckets: v.f.buckets}
+}
+
+// NewHistogram registers an unlabelled histogram in the Default registry
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
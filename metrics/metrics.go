@@ -0,0 +1,248 @@
+// Package metrics is a small Prometheus-compatible metrics registry exposed in the text format, or
+// in the OpenMetrics format, which carries histogram exemplars, to scrapers that ask for it.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector writes the exposition lines of one metric family, in the OpenMetrics format when
+// openMetrics is set
+type collector interface {
+	name() string
+	write(b *strings.Builder, openMetrics bool)
+}
+
+// Registry holds the metrics exposed by Handler
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the registry used by the package-level constructors
+var Default = NewRegistry()
+
+// register adds c, returning the collector already registered under the same name if there is one
+func (reg *Registry) register(c collector) collector {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if existing, ok := reg.collectors[c.name()]; ok {
+		return existing
+	}
+	reg.collectors[c.name()] = c
+	return c
+}
+
+// Handler serves every registered metric in the Prometheus text format, or the OpenMetrics format
+// when the scraper accepts it
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		reg.mu.Lock()
+		names := make([]string, 0, len(reg.collectors))
+		for name := range reg.collectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		for _, name := range names {
+			reg.collectors[name].write(&b, openMetrics)
+		}
+		reg.mu.Unlock()
+
+		if openMetrics {
+			b.WriteString("# EOF\n")
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		}
+		w.Write([]byte(b.String()))
+	})
+}
+
+// Handler serves the Default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// series is a single labelled value of a metric family
+type series struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (s *series) add(delta float64) {
+	s.mu.Lock()
+	s.value += delta
+	s.mu.Unlock()
+}
+
+func (s *series) set(value float64) {
+	s.mu.Lock()
+	s.value = value
+	s.mu.Unlock()
+}
+
+func (s *series) get() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+// family is a metric name with one series per combination of label values
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{metricName: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(b *strings.Builder, openMetrics bool) {
+	writeHeader(b, f.metricName, f.help, f.kind, openMetrics)
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var values []string
+		if len(f.labels) > 0 {
+			values = strings.Split(key, "\xff")
+		}
+		fmt.Fprintf(b, "%s%s %s\n", f.metricName, formatLabels(f.labels, values), formatValue(f.series[key].get()))
+	}
+	f.mu.Unlock()
+}
+
+// writeHeader writes the HELP and TYPE lines of a family. OpenMetrics names a counter family
+// without the _total suffix of its samples.
+func writeHeader(b *strings.Builder, name, help, kind string, openMetrics bool) {
+	if openMetrics && kind == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	s *series
+}
+
+func (c *Counter) Inc() {
+	c.s.add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.s.add(delta)
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	f *family
+}
+
+// NewCounterVec registers a counter family with the given label names in the Default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: Default.register(newFamily(name, help, "counter", labels)).(*family)}
+}
+
+// With returns the counter for the label values, in the order the labels were declared
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{s: v.f.with(values)}
+}
+
+// NewCounter registers an unlabelled counter in the Default registry
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	s *series
+}
+
+func (g *Gauge) Set(value float64) {
+	g.s.set(value)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.s.add(delta)
+}
+
+// GaugeVec is a gauge partitioned by label values
+type GaugeVec struct {
+	f *family
+}
+
+// NewGaugeVec registers a gauge family with the given label names in the Default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: Default.register(newFamily(name, help, "gauge", labels)).(*family)}
+}
+
+// With returns the gauge for the label values, in the order the labels were declared
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{s: v.f.with(values)}
+}
+
+// NewGauge registers an unlabelled gauge in the Default registry
+func NewGauge(name, help string) *Gauge {
+	return NewGaugeVec(name, help).With()
+}
@@ -0,0 +1,169 @@
+// Package msgpack converts JSON documents to MessagePack, a binary encoding of the same data model
+// that is smaller and faster to parse, for clients on constrained networks. Object members keep
+// their order, and numbers are written as integers when they have no fraction or exponent.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FromJSON converts a JSON document to MessagePack. Whitespace after the document, such as the
+// newline json.Encoder writes, is ignored; anything else is an error.
+func FromJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var out bytes.Buffer
+	if err := convert(decoder, &out); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("msgpack: unexpected data after the JSON document")
+	}
+	return out.Bytes(), nil
+}
+
+// convert reads the next JSON value from decoder and writes it to out
+func convert(decoder *json.Decoder, out *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch value := token.(type) {
+	case nil:
+		out.WriteByte(0xc0)
+	case bool:
+		if value {
+			out.WriteByte(0xc3)
+		} else {
+			out.WriteByte(0xc2)
+		}
+	case string:
+		writeString(out, value)
+	case json.Number:
+		return writeNumber(out, value)
+	case json.Delim:
+		// Lengths come before the elements, so they're encoded separately and counted first
+		var elements bytes.Buffer
+		count := 0
+		for decoder.More() {
+			if value == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				writeString(&elements, key.(string))
+			}
+			if err := convert(decoder, &elements); err != nil {
+				return err
+			}
+			count++
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		if value == '{' {
+			writeHeader(out, count, 0x80, 0xde)
+		} else {
+			writeHeader(out, count, 0x90, 0xdc)
+		}
+		out.Write(elements.Bytes())
+	default:
+		return fmt.Errorf("msgpack: unexpected JSON token %v", token)
+	}
+	return nil
+}
+
+// writeHeader writes the length of a map or array: in fix, its fixed-size marker, below 16, and
+// after the 16-bit marker or the 32-bit one that follows it otherwise
+func writeHeader(out *bytes.Buffer, count int, fix, marker16 byte) {
+	switch {
+	case count < 16:
+		out.WriteByte(fix | byte(count))
+	case count <= math.MaxUint16:
+		out.WriteByte(marker16)
+		out.Write(binary.BigEndian.AppendUint16(nil, uint16(count)))
+	default:
+		out.WriteByte(marker16 + 1)
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(count)))
+	}
+}
+
+// writeString writes a UTF-8 string
+func writeString(out *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		out.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		out.Write([]byte{0xd9, byte(n)})
+	case n <= math.MaxUint16:
+		out.WriteByte(0xda)
+		out.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		out.WriteByte(0xdb)
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+	out.WriteString(s)
+}
+
+// writeNumber writes a number in the smallest integer format that holds it, or as a 64-bit float
+// when it has a fraction or exponent or doesn't fit in 64 bits
+func writeNumber(out *bytes.Buffer, number json.Number) error {
+	s := number.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			writeInt(out, i)
+			return nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			out.WriteByte(0xcf)
+			out.Write(binary.BigEndian.AppendUint64(nil, u))
+			return nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("msgpack: %w", err)
+	}
+	out.WriteByte(0xcb)
+	out.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+	return nil
+}
+
+// writeInt writes a signed integer as a positive or negative fixint when it fits, and otherwise
+// in the narrowest signed or unsigned format that holds it
+func writeInt(out *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f, i < 0 && i >= -32:
+		out.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		out.Write([]byte{0xcc, byte(i)})
+	case i >= 0 && i <= math.MaxUint16:
+		out.WriteByte(0xcd)
+		out.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= 0 && i <= math.MaxUint32:
+		out.WriteByte(0xce)
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	case i >= 0:
+		out.WriteByte(0xcf)
+		out.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	case i >= math.MinInt8:
+		out.Write([]byte{0xd0, byte(i)})
+	case i >= math.MinInt16:
+		out.WriteByte(0xd1)
+		out.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		out.WriteByte(0xd2)
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		out.WriteByte(0xd3)
+		out.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
@@ -0,0 +1,39 @@
+package msgpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want []byte
+	}{
+		{`null`, []byte{0xc0}},
+		{`true`, []byte{0xc3}},
+		{`[false, 1, -1, 200, -200, 70000]`, []byte{0x96, 0xc2, 0x01, 0xff, 0xcc, 0xc8, 0xd1, 0xff, 0x38, 0xce, 0x00, 0x01, 0x11, 0x70}},
+		{`1.5`, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{`{"b":"x","a":[]}` + "\n", []byte{0x82, 0xa1, 'b', 0xa1, 'x', 0xa1, 'a', 0x90}},
+		{`18446744073709551615`, []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		got, err := FromJSON([]byte(tt.json))
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("FromJSON(%s) = % x, %v, want % x", tt.json, got, err, tt.want)
+		}
+	}
+
+	long := strings.Repeat("a", 40)
+	got, err := FromJSON([]byte(`"` + long + `"`))
+	if err != nil || !bytes.Equal(got, append([]byte{0xd9, 40}, long...)) {
+		t.Errorf("FromJSON(40-byte string) = % x, %v", got, err)
+	}
+
+	for _, invalid := range []string{``, `{"a":`, `[1] [2]`} {
+		if _, err := FromJSON([]byte(invalid)); err == nil {
+			t.Errorf("FromJSON(%q) succeeded, want an error", invalid)
+		}
+	}
+}
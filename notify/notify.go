@@ -0,0 +1,237 @@
+// Package notify sends notifications about processing events, such as bursts of failures or
+// receipts flagged by fraud checks, to pluggable channels like email and Slack.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+	"receipt-processor/pipeline"
+	"receipt-processor/resilience"
+)
+
+var sent = metrics.NewCounterVec("receipts_notifications_total", "Notifications sent, by event, channel and outcome.", "event", "channel", "result")
+
+// Event names something worth notifying about
+type Event string
+
+const (
+	// ProcessingFailures fires when receipts fail to process FailureThreshold times within FailureWindow
+	ProcessingFailures Event = "processing-failures"
+	// FraudFlagged fires for every receipt fraud checks flagged for review
+	FraudFlagged Event = "fraud-flagged"
+	// Summary fires for every scheduled report produced
+	Summary Event = "summary"
+)
+
+// Events lists every event channels can subscribe to
+var Events = []Event{ProcessingFailures, FraudFlagged, Summary}
+
+// sendTimeout bounds the delivery of a notification to each channel
+const sendTimeout = 30 * time.Second
+
+// Message is a notification
+type Message struct {
+	Subject string
+	Text    string
+}
+
+// Channel delivers notifications
+type Channel interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTP sends email through a mail server
+type SMTP struct {
+	// Addr is the server's host:port
+	Addr string
+	// Username and Password authenticate with PLAIN auth when set
+	Username string
+	Password string
+	// From is the sender address
+	From string
+}
+
+// Send mails a plain-text message
+func (m SMTP) Send(to []string, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	message := "From: " + m.From + "\r\n" +
+		"To: " + strings.Join(to, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(m.Addr, auth, m.From, to, []byte(message))
+}
+
+// Email is a channel mailing notifications to a list of addresses
+type Email struct {
+	Server SMTP
+	To     []string
+}
+
+func (e Email) Send(_ context.Context, m Message) error {
+	return e.Server.Send(e.To, m.Subject, m.Text)
+}
+
+// Slack is a channel posting notifications to a Slack incoming webhook
+type Slack struct {
+	webhook string
+	caller  *resilience.Caller
+	client  *http.Client
+}
+
+// NewSlack returns a channel posting to webhook, following policy; a nil client uses http.DefaultClient
+func NewSlack(webhook string, policy resilience.Policy, client *http.Client) *Slack {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Slack{webhook: webhook, caller: resilience.New("slack", policy), client: client}
+}
+
+func (s *Slack) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]string{"text": "*" + m.Subject + "*\n" + m.Text})
+	if err != nil {
+		return err
+	}
+	return s.caller.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhook, bytes.NewReader(body))
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("slack answered %s", resp.Status)
+		case resp.StatusCode >= 300:
+			return resilience.Permanent(fmt.Errorf("slack answered %s", resp.Status))
+		}
+		return nil
+	})
+}
+
+// Options configures a Notifier
+type Options struct {
+	// Channels are the configured channels by name
+	Channels map[string]Channel
+	// Subscriptions lists the names of the channels notified of each event
+	Subscriptions map[Event][]string
+	// FailureThreshold is how many failures within FailureWindow raise ProcessingFailures, 10 by default
+	FailureThreshold int
+	// FailureWindow is how far back failures are counted, five minutes by default. After firing,
+	// ProcessingFailures stays quiet for a window.
+	FailureWindow time.Duration
+	// Clock tells the time failures happen at, the system clock by default
+	Clock clock.Clock
+}
+
+// Notifier sends events to the channels subscribed to them. Notifications are delivered in the
+// background, so sending never holds up processing.
+type Notifier struct {
+	opts Options
+
+	mu sync.Mutex
+	// failures holds the times of recent failures; alertedAt is when ProcessingFailures last fired
+	failures  []time.Time
+	alertedAt time.Time
+}
+
+func New(opts Options) *Notifier {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 10
+	}
+	if opts.FailureWindow <= 0 {
+		opts.FailureWindow = 5 * time.Minute
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	return &Notifier{opts: opts}
+}
+
+// Notify sends a message about event to every channel subscribed to it
+func (n *Notifier) Notify(event Event, m Message) {
+	for _, name := range n.opts.Subscriptions[event] {
+		channel, ok := n.opts.Channels[name]
+		if !ok {
+			continue
+		}
+		go func(name string, channel Channel) {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := channel.Send(ctx, m); err != nil {
+				sent.With(string(event), name, "failure").Inc()
+				log.Printf("notification event=%s channel=%s failed: %v", event, name, err)
+				return
+			}
+			sent.With(string(event), name, "success").Inc()
+		}(name, channel)
+	}
+}
+
+// Failed counts a processing failure, raising ProcessingFailures once they reach the threshold
+func (n *Notifier) Failed(err error) {
+	now := n.opts.Clock.Now()
+	n.mu.Lock()
+	cutoff := now.Add(-n.opts.FailureWindow)
+	recent := n.failures[:0]
+	for _, at := range n.failures {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	// Only the newest failures up to the threshold matter
+	if len(recent) >= n.opts.FailureThreshold {
+		recent = recent[len(recent)-n.opts.FailureThreshold+1:]
+	}
+	n.failures = append(recent, now)
+	fire := len(n.failures) >= n.opts.FailureThreshold && now.Sub(n.alertedAt) >= n.opts.FailureWindow
+	if fire {
+		n.alertedAt = now
+	}
+	n.mu.Unlock()
+
+	if fire {
+		n.Notify(ProcessingFailures, Message{
+			Subject: "Receipt processing is failing",
+			Text:    fmt.Sprintf("%d receipts failed to process within %s. The latest error was: %v", n.opts.FailureThreshold, n.opts.FailureWindow, err),
+		})
+	}
+}
+
+// Hooks returns the pipeline hooks raising FraudFlagged for flagged receipts and counting failures
+func (n *Notifier) Hooks() []pipeline.Hook {
+	return []pipeline.Hook{
+		pipeline.NewHook(pipeline.Notify, func(_ context.Context, r *pipeline.Receipt) error {
+			if len(r.Flags) > 0 {
+				n.Notify(FraudFlagged, Message{
+					Subject: "Receipt " + r.Record.ID + " was flagged for review",
+					Text:    fmt.Sprintf("The receipt from %s for %s was flagged: %s.", r.Receipt.Retailer, r.Receipt.Total, strings.Join(r.Flags, "; ")),
+				})
+			}
+			return nil
+		}),
+		pipeline.NewHook(pipeline.Failed, func(_ context.Context, r *pipeline.Receipt) error {
+			n.Failed(r.Err)
+			return nil
+		}),
+	}
+}
@@ -0,0 +1,278 @@
+// Package outbox publishes the receipt events stores record in their outbox to a webhook and a
+// sink such as a data warehouse, in the order they were recorded, retrying each until it is delivered.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+	"receipt-processor/ids"
+	"receipt-processor/metrics"
+	"receipt-processor/resilience"
+	"receipt-processor/store"
+)
+
+var (
+	published     = metrics.NewCounterVec("receipts_outbox_published_total", "Outbox events posted to the webhook, by outcome.", "result")
+	pendingEvents = metrics.NewGauge("receipts_outbox_pending", "Outbox events waiting to be published.")
+)
+
+// Event types
+const (
+	// ReceiptProcessed is recorded when a receipt is first stored
+	ReceiptProcessed = "receipt.processed"
+	// ReceiptStatusChanged is recorded when a receipt is approved or rejected
+	ReceiptStatusChanged = "receipt.status-changed"
+	// ReceiptPointsChanged is recorded when a receipt is rescored or its points are adjusted by hand
+	ReceiptPointsChanged = "receipt.points-changed"
+	// ReceiptDeleted is recorded when a receipt is moved to the trash
+	ReceiptDeleted = "receipt.deleted"
+	// ReceiptRestored is recorded when a receipt is restored from the trash
+	ReceiptRestored = "receipt.restored"
+)
+
+// NewEvent describes a change to a receipt made at a time, carrying the stored record as its payload
+func NewEvent(id string, at time.Time, eventType string, record store.Record) (store.Event, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return store.Event{}, err
+	}
+	return store.Event{
+		ID:        id,
+		Type:      eventType,
+		ReceiptID: record.ID,
+		CreatedAt: at.UTC(),
+		Payload:   payload,
+	}, nil
+}
+
+// WebhookID identifies the outbox webhook in the delivery log
+const WebhookID = "outbox"
+
+// responseSnippet is how much of a webhook's response body a delivery keeps, in bytes
+const responseSnippet = 512
+
+// Sink receives the events of a poll as one batch, e.g. to load them into a data warehouse. An
+// event is only removed once the sink took it, so it can receive an event again.
+type Sink interface {
+	Publish(ctx context.Context, events []store.Event) error
+}
+
+// Options configures a Relay
+type Options struct {
+	// Webhook receives every event as a JSON POST; empty posts none
+	Webhook string
+	// Sink, when set, receives the events before they are posted to the webhook
+	Sink Sink
+	// Policy guards the posts to the webhook
+	Policy resilience.Policy
+	// HTTPClient posts to the webhook, http.DefaultClient by default
+	HTTPClient *http.Client
+	// Interval is the time between polls of the outbox, one second by default
+	Interval time.Duration
+	// BatchSize is the most events published per poll, 100 by default
+	BatchSize int
+	// Leader, when set, limits publishing to the instance holding it, so instances sharing a store
+	// don't post the same events
+	Leader interface{ Held() bool }
+	// Deliveries, when set, keeps every attempt to post an event to the webhook
+	Deliveries store.DeliveryLog
+	// Clock timestamps deliveries, the system clock by default
+	Clock clock.Clock
+	// IDs generates delivery IDs, random UUIDs by default
+	IDs ids.Generator
+}
+
+// Relay publishes the events waiting in an outbox
+type Relay struct {
+	outbox   store.Outbox
+	opts     Options
+	webhooks *resilience.Caller
+	// mu keeps polls from publishing the same events concurrently
+	mu sync.Mutex
+}
+
+func NewRelay(outbox store.Outbox, opts Options) *Relay {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	if opts.IDs == nil {
+		opts.IDs, _ = ids.New(ids.UUIDv4, 0)
+	}
+	return &Relay{outbox: outbox, opts: opts, webhooks: resilience.New("outbox-webhook", opts.Policy)}
+}
+
+// Publish hands the waiting events to the sink, then posts them oldest first, removing each once
+// the webhook accepted it, and returns how many were published. It stops at the first event that
+// fails so events are never delivered out of order; that event is retried on the next poll, and a
+// batch the sink failed is retried as a whole.
+func (rl *Relay) Publish(ctx context.Context) (int, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	defer func() {
+		if remaining, err := rl.outbox.PendingEvents(0); err == nil {
+			pendingEvents.Set(float64(len(remaining)))
+		}
+	}()
+
+	events, err := rl.outbox.PendingEvents(rl.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if rl.opts.Sink != nil && len(events) > 0 {
+		if err := rl.opts.Sink.Publish(ctx, events); err != nil {
+			if failErr := rl.outbox.FailEvent(events[0].ID, err.Error()); failErr != nil {
+				log.Printf("outbox event=%s recording the failure failed: %v", events[0].ID, failErr)
+			}
+			return 0, fmt.Errorf("publishing %d events to the sink: %w", len(events), err)
+		}
+	}
+	count := 0
+	for _, event := range events {
+		if rl.opts.Webhook != "" {
+			if err := rl.post(ctx, event); err != nil {
+				published.With("failure").Inc()
+				if failErr := rl.outbox.FailEvent(event.ID, err.Error()); failErr != nil {
+					log.Printf("outbox event=%s recording the failure failed: %v", event.ID, failErr)
+				}
+				return count, fmt.Errorf("publishing event %s: %w", event.ID, err)
+			}
+			published.With("success").Inc()
+		}
+		// The webhook and sink already have the event, so one that can't be removed is published
+		// again and consumers drop it by its ID
+		if err := rl.outbox.DeleteEvent(event.ID); err != nil {
+			return count, fmt.Errorf("removing published event %s: %w", event.ID, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Run publishes the waiting events every Interval until ctx is cancelled
+func (rl *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(rl.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if rl.opts.Leader != nil && !rl.opts.Leader.Held() {
+				continue
+			}
+			if _, err := rl.Publish(ctx); err != nil {
+				log.Printf("outbox publishing failed: %v", err)
+			}
+		}
+	}
+}
+
+// HasWebhook reports whether the relay posts events to a webhook
+func (rl *Relay) HasWebhook() bool {
+	return rl.opts.Webhook != ""
+}
+
+// Deliveries returns the attempts to post events to the webhook, newest first
+func (rl *Relay) Deliveries() ([]store.Delivery, error) {
+	if rl.opts.Deliveries == nil {
+		return []store.Delivery{}, nil
+	}
+	return rl.opts.Deliveries.Deliveries(WebhookID)
+}
+
+// Redeliver posts the event of a delivery to the webhook again, retrying per the webhook policy,
+// and returns the last attempt; a webhook refusing the event is reported by the attempt rather than
+// an error. An unknown delivery returns store.ErrNotFound.
+func (rl *Relay) Redeliver(ctx context.Context, id string) (store.Delivery, error) {
+	if rl.opts.Deliveries == nil {
+		return store.Delivery{}, store.ErrNotFound
+	}
+	original, err := rl.opts.Deliveries.GetDelivery(id)
+	if err != nil {
+		return store.Delivery{}, err
+	}
+	var last store.Delivery
+	err = rl.webhooks.Do(ctx, func(ctx context.Context) error {
+		var err error
+		last, err = rl.attempt(ctx, original.Event, id)
+		return err
+	})
+	if last.ID == "" {
+		return store.Delivery{}, fmt.Errorf("redelivering %s: %w", id, err)
+	}
+	return last, nil
+}
+
+// post sends an event to the webhook, retrying per the webhook policy
+func (rl *Relay) post(ctx context.Context, event store.Event) error {
+	return rl.webhooks.Do(ctx, func(ctx context.Context) error {
+		_, err := rl.attempt(ctx, event, "")
+		return err
+	})
+}
+
+// attempt posts an event to the webhook once, recording the delivery when there is a log. The
+// event ID is sent in the Idempotency-Key header so consumers can drop the duplicates of an event
+// delivered again.
+func (rl *Relay) attempt(ctx context.Context, event store.Event, redeliveryOf string) (store.Delivery, error) {
+	event.Attempts, event.LastError = 0, ""
+	data, err := json.Marshal(event)
+	if err != nil {
+		return store.Delivery{}, resilience.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rl.opts.Webhook, bytes.NewReader(data))
+	if err != nil {
+		return store.Delivery{}, resilience.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID)
+
+	delivery := store.Delivery{
+		ID:           rl.opts.IDs.NewID(),
+		Webhook:      WebhookID,
+		Event:        event,
+		RedeliveryOf: redeliveryOf,
+		AttemptedAt:  rl.opts.Clock.Now().UTC(),
+	}
+	resp, err := rl.opts.HTTPClient.Do(req)
+	if err == nil {
+		delivery.StatusCode = resp.StatusCode
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, responseSnippet))
+		delivery.Response = string(snippet)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 500:
+			err = fmt.Errorf("webhook answered %s", resp.Status)
+		case resp.StatusCode >= 300:
+			err = resilience.Permanent(fmt.Errorf("webhook answered %s", resp.Status))
+		}
+	}
+	delivery.LatencyMS = rl.opts.Clock.Now().Sub(delivery.AttemptedAt).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if rl.opts.Deliveries != nil {
+		if logErr := rl.opts.Deliveries.RecordDelivery(delivery); logErr != nil {
+			log.Printf("outbox event=%s recording the delivery failed: %v", event.ID, logErr)
+		}
+	}
+	return delivery, err
+}
@@ -0,0 +1,383 @@
+// Package parquet writes flat Apache Parquet files, the columnar format analytics engines such as
+// Spark and BigQuery load directly. Every column is a plain, gzip-compressed, optionally nullable
+// value; nested and repeated columns aren't supported.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// magic starts and ends every Parquet file
+const magic = "PAR1"
+
+// Type is the type of a column's values
+type Type int
+
+const (
+	// String columns hold UTF-8 text, written as Go strings
+	String Type = iota
+	// Int32 and Int64 columns hold integers, written as int, int32 or int64
+	Int32
+	Int64
+	// Double columns hold floating point numbers, written as float64
+	Double
+	// Date columns hold calendar days, and Timestamp columns UTC instants with millisecond
+	// precision, both written as time.Time
+	Date
+	Timestamp
+)
+
+// Physical types, converted types, repetitions, encodings, codecs and page types of the format
+const (
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedDate            = 6
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip = 2
+
+	pageData = 0
+)
+
+// Column describes a column of a file
+type Column struct {
+	Name string
+	Type Type
+	// Optional columns accept nil values
+	Optional bool
+}
+
+// physical returns the type the column's values are stored as and the converted type that says how
+// to read them, -1 when there is none
+func (c Column) physical() (int32, int32) {
+	switch c.Type {
+	case String:
+		return physicalByteArray, convertedUTF8
+	case Int32:
+		return physicalInt32, -1
+	case Int64:
+		return physicalInt64, -1
+	case Double:
+		return physicalDouble, -1
+	case Date:
+		return physicalInt32, convertedDate
+	default:
+		return physicalInt64, convertedTimestampMillis
+	}
+}
+
+// DefaultRowGroupSize is the number of rows buffered before they are written as a row group
+const DefaultRowGroupSize = 50000
+
+// Writer writes rows to a Parquet file. Rows are buffered in memory until a row group is full, and
+// the file is only complete once Close writes its footer.
+type Writer struct {
+	w       *countingWriter
+	columns []Column
+	// RowGroupSize is the most rows of each row group, DefaultRowGroupSize unless changed before
+	// the first Write
+	RowGroupSize int
+
+	// pending holds the values of the rows not written yet, by column; nil for null values
+	pending   [][]interface{}
+	rowGroups []rowGroup
+	rows      int64
+}
+
+type rowGroup struct {
+	chunks []columnChunk
+	rows   int64
+	size   int64
+}
+
+type columnChunk struct {
+	offset           int64
+	values           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewWriter starts a Parquet file with the given columns on w
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet: a file needs at least one column")
+	}
+	writer := &Writer{
+		w:            &countingWriter{w: w},
+		columns:      columns,
+		RowGroupSize: DefaultRowGroupSize,
+		pending:      make([][]interface{}, len(columns)),
+	}
+	if _, err := io.WriteString(writer.w, magic); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Write adds a row with a value for every column, in order
+func (w *Writer) Write(row ...interface{}) error {
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, value := range row {
+		column := w.columns[i]
+		if value == nil {
+			if !column.Optional {
+				return fmt.Errorf("parquet: column %s is required", column.Name)
+			}
+			continue
+		}
+		if !accepts(column.Type, value) {
+			return fmt.Errorf("parquet: column %s can't hold a %T", column.Name, value)
+		}
+	}
+	for i, value := range row {
+		w.pending[i] = append(w.pending[i], value)
+	}
+	if len(w.pending[0]) >= w.RowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func accepts(t Type, value interface{}) bool {
+	switch value.(type) {
+	case string:
+		return t == String
+	case int, int32, int64:
+		return t == Int32 || t == Int64
+	case float64:
+		return t == Double
+	case time.Time:
+		return t == Date || t == Timestamp
+	}
+	return false
+}
+
+// flush writes the pending rows as a row group, one data page per column
+func (w *Writer) flush() error {
+	rows := len(w.pending[0])
+	if rows == 0 {
+		return nil
+	}
+	group := rowGroup{rows: int64(rows)}
+	for i, column := range w.columns {
+		chunk, err := w.writeChunk(column, w.pending[i])
+		if err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.uncompressedSize
+		w.pending[i] = w.pending[i][:0]
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.rows += int64(rows)
+	return nil
+}
+
+func (w *Writer) writeChunk(column Column, values []interface{}) (columnChunk, error) {
+	var page bytes.Buffer
+	if column.Optional {
+		levels := definitionLevels(values)
+		binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+	}
+	for _, value := range values {
+		if value != nil {
+			encodePlain(&page, column.Type, value)
+		}
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(page.Bytes())
+	if err := gz.Close(); err != nil {
+		return columnChunk{}, err
+	}
+
+	header := &compactWriter{}
+	header.beginStruct()
+	header.i32(1, pageData)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(compressed.Len()))
+	header.structField(5)
+	header.i32(1, int32(len(values)))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.endStruct()
+	header.endStruct()
+
+	chunk := columnChunk{
+		offset:           w.w.n,
+		values:           int64(len(values)),
+		uncompressedSize: int64(header.buf.Len() + page.Len()),
+		compressedSize:   int64(header.buf.Len() + compressed.Len()),
+	}
+	if _, err := w.w.Write(header.buf.Bytes()); err != nil {
+		return columnChunk{}, err
+	}
+	if _, err := w.w.Write(compressed.Bytes()); err != nil {
+		return columnChunk{}, err
+	}
+	return chunk, nil
+}
+
+// definitionLevels encodes whether each value is present, 1, or null, 0, as runs of the RLE/bit-packing
+// hybrid encoding with a bit width of 1
+func definitionLevels(values []interface{}) []byte {
+	var levels compactWriter
+	for start := 0; start < len(values); {
+		end := start + 1
+		for end < len(values) && (values[end] == nil) == (values[start] == nil) {
+			end++
+		}
+		levels.uvarint(uint64(end-start) << 1)
+		if values[start] == nil {
+			levels.buf.WriteByte(0)
+		} else {
+			levels.buf.WriteByte(1)
+		}
+		start = end
+	}
+	return levels.buf.Bytes()
+}
+
+// encodePlain appends a value in the plain encoding of its column's physical type
+func encodePlain(buf *bytes.Buffer, t Type, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		binary.Write(buf, binary.LittleEndian, uint32(len(v)))
+		buf.WriteString(v)
+	case float64:
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(v))
+	case time.Time:
+		if t == Date {
+			days := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+			binary.Write(buf, binary.LittleEndian, int32(days))
+		} else {
+			binary.Write(buf, binary.LittleEndian, v.UnixMilli())
+		}
+	default:
+		var n int64
+		switch v := value.(type) {
+		case int:
+			n = int64(v)
+		case int32:
+			n = int64(v)
+		case int64:
+			n = v
+		}
+		if t == Int32 {
+			binary.Write(buf, binary.LittleEndian, int32(n))
+		} else {
+			binary.Write(buf, binary.LittleEndian, n)
+		}
+	}
+}
+
+// Close writes the remaining rows and the footer describing the file. It doesn't close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	footer := w.footer()
+	if _, err := w.w.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.w, magic)
+	return err
+}
+
+// footer encodes the file metadata: the schema, and where each row group's column chunks are
+func (w *Writer) footer() []byte {
+	meta := &compactWriter{}
+	meta.beginStruct()
+	meta.i32(1, 1)
+
+	// The schema is a root element followed by its columns
+	meta.list(2, compactStruct, len(w.columns)+1)
+	meta.beginStruct()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(w.columns)))
+	meta.endStruct()
+	for _, column := range w.columns {
+		physical, converted := column.physical()
+		repetition := int32(repetitionRequired)
+		if column.Optional {
+			repetition = repetitionOptional
+		}
+		meta.beginStruct()
+		meta.i32(1, physical)
+		meta.i32(3, repetition)
+		meta.string(4, column.Name)
+		if converted >= 0 {
+			meta.i32(6, converted)
+		}
+		meta.endStruct()
+	}
+
+	meta.i64(3, w.rows)
+	meta.list(4, compactStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		meta.beginStruct()
+		meta.list(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := w.columns[i].physical()
+			meta.beginStruct()
+			meta.i64(2, chunk.offset)
+			meta.structField(3)
+			meta.i32(1, physical)
+			meta.list(2, compactI32, 2)
+			meta.i32Element(encodingPlain)
+			meta.i32Element(encodingRLE)
+			meta.list(3, compactBinary, 1)
+			meta.stringElement(w.columns[i].Name)
+			meta.i32(4, codecGzip)
+			meta.i64(5, chunk.values)
+			meta.i64(6, chunk.uncompressedSize)
+			meta.i64(7, chunk.compressedSize)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, group.size)
+		meta.i64(3, group.rows)
+		meta.endStruct()
+	}
+	meta.string(6, "receipt-processor")
+	meta.endStruct()
+	return meta.buf.Bytes()
+}
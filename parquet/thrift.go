@@ -0,0 +1,98 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol field types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes the Thrift structs of the file metadata and page headers in the compact
+// protocol. Fields must be written in increasing order within each struct.
+type compactWriter struct {
+	buf bytes.Buffer
+	// lastField is the ID of the previous field of each struct being written, innermost last
+	lastField []int16
+}
+
+func (c *compactWriter) beginStruct() {
+	c.lastField = append(c.lastField, 0)
+}
+
+func (c *compactWriter) endStruct() {
+	c.buf.WriteByte(0)
+	c.lastField = c.lastField[:len(c.lastField)-1]
+}
+
+func (c *compactWriter) fieldHeader(id int16, kind byte) {
+	last := &c.lastField[len(c.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		c.buf.WriteByte(kind)
+		c.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes a zigzag-encoded variable-length integer
+func (c *compactWriter) varint(v int64) {
+	c.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (c *compactWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	c.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.fieldHeader(id, compactI32)
+	c.varint(int64(v))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.fieldHeader(id, compactI64)
+	c.varint(v)
+}
+
+func (c *compactWriter) string(id int16, v string) {
+	c.fieldHeader(id, compactBinary)
+	c.uvarint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+// list writes the header of a list field of n elements of the given type
+func (c *compactWriter) list(id int16, kind byte, n int) {
+	c.fieldHeader(id, compactList)
+	if n < 15 {
+		c.buf.WriteByte(byte(n)<<4 | kind)
+		return
+	}
+	c.buf.WriteByte(0xf0 | kind)
+	c.uvarint(uint64(n))
+}
+
+// structField writes the header of a struct field, whose fields follow until endStruct
+func (c *compactWriter) structField(id int16) {
+	c.fieldHeader(id, compactStruct)
+	c.beginStruct()
+}
+
+// Elements of a list follow its header without field headers; struct elements are written between
+// beginStruct and endStruct
+
+func (c *compactWriter) i32Element(v int32) {
+	c.varint(int64(v))
+}
+
+func (c *compactWriter) stringElement(v string) {
+	c.uvarint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
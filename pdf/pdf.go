@@ -0,0 +1,168 @@
+// Package pdf writes simple text-only PDF documents, such as printable receipts, using the standard
+// Helvetica fonts every PDF reader provides.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size and margin, in points
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+	Margin     = 50.0
+)
+
+// Font selects one of the standard fonts
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+)
+
+// fontNames are the base fonts behind each Font, referenced as /F1 and /F2
+var fontNames = []string{"Helvetica", "Helvetica-Bold"}
+
+// Document lays text out top to bottom, starting a new page when one is full
+type Document struct {
+	pages []*bytes.Buffer
+	// y is where the next line's baseline goes on the current page
+	y float64
+}
+
+func New() *Document {
+	d := &Document{}
+	d.newPage()
+	return d
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = PageHeight - Margin
+}
+
+// Line writes a line of text at the left margin, indented by indent points
+func (d *Document) Line(font Font, size float64, indent float64, text string) {
+	d.Columns(font, size, []Column{{X: indent, Text: text}})
+}
+
+// Column is a piece of text placed at X points from the left margin; right-aligned columns end at
+// X instead of starting there
+type Column struct {
+	X          float64
+	Text       string
+	RightAlign bool
+}
+
+// Columns writes one line with text in several columns, such as a row of a table
+func (d *Document) Columns(font Font, size float64, columns []Column) {
+	lineHeight := size * 1.4
+	if d.y-lineHeight < Margin {
+		d.newPage()
+	}
+	d.y -= lineHeight
+	page := d.pages[len(d.pages)-1]
+	for _, column := range columns {
+		if column.Text == "" {
+			continue
+		}
+		x := Margin + column.X
+		if column.RightAlign {
+			x -= width(column.Text, size)
+		}
+		fmt.Fprintf(page, "BT /F%d %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font+1, size, x, d.y, escape(column.Text))
+	}
+}
+
+// Rule draws a horizontal line across the page below the last line
+func (d *Document) Rule() {
+	d.Space(4)
+	page := d.pages[len(d.pages)-1]
+	fmt.Fprintf(page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", Margin, d.y, PageWidth-Margin, d.y)
+	d.Space(4)
+}
+
+// Space leaves points of vertical space
+func (d *Document) Space(points float64) {
+	d.y -= points
+	if d.y < Margin {
+		d.newPage()
+	}
+}
+
+// WriteTo writes the document as a PDF file
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 and 2 are the catalog and page tree, 3 and 4 the fonts, then a page and its content per page
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	for _, name := range fontNames {
+		object("<< /Type /Font /Subtype /Type1 /BaseFont /" + name + " /Encoding /WinAnsiEncoding >>")
+	}
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.WriteTo(w)
+}
+
+// escape encodes text as a PDF string in WinAnsiEncoding, replacing characters it can't represent
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// width estimates the width of text in Helvetica, in points; digits, which right-aligned columns
+// mostly hold, are exact
+func width(text string, size float64) float64 {
+	units := 0
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9', r == '$':
+			units += 556
+		case r == '.' || r == ',' || r == ' ':
+			units += 278
+		case r == '-':
+			units += 333
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
@@ -0,0 +1,309 @@
+// Package pipeline runs submitted receipts through the stages of processing, decode → validate →
+// enrich → score → persist → notify, with hooks that extensions register to run at any stage, and
+// when processing fails.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"receipt-processor/i18n"
+	"receipt-processor/metrics"
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+// Stage names a step of processing
+type Stage string
+
+const (
+	Decode   Stage = "decode"
+	Validate Stage = "validate"
+	Enrich   Stage = "enrich"
+	Score    Stage = "score"
+	Persist  Stage = "persist"
+	Notify   Stage = "notify"
+	// Failed isn't a stage of processing: its hooks run when a receipt fails for another reason than
+	// being invalid or rejected, e.g. because it couldn't be stored
+	Failed Stage = "failed"
+)
+
+// Receipt is a submission travelling through the pipeline. Each stage fills in more of it.
+type Receipt struct {
+	// Raw is the submitted JSON, decoded into Receipt by the decode stage; it is nil when Receipt was
+	// built in code
+	Raw     json.RawMessage
+	Receipt receipt.Receipt
+	// Points and Breakdown are set by the score stage; score hooks may adjust Points
+	Points    int
+	Breakdown []scoring.RuleResult
+	// Flags lists why the receipt looks suspicious; flagged receipts are stored for manual review
+	Flags []string
+	// Replaces lists the stored receipts this one takes the place of, such as the parts of a merged
+	// receipt; they don't count against the user's submission limits
+	Replaces []string
+	// Record is the stored receipt, set by the persist stage; a stored receipt being rescored starts
+	// with it set
+	Record store.Record
+	// Err is why processing failed, set before the failed hooks run
+	Err error
+}
+
+// Func is the work of one stage for one receipt
+type Func func(ctx context.Context, r *Receipt) error
+
+// Hook extends a stage. Hooks run after the stage's built-in work, in registration order. An error
+// from a hook before the receipt is stored stops its processing; return a *Rejection to turn the
+// receipt away rather than fail. Persist and notify hooks run once the receipt is stored, so their
+// errors are logged instead.
+type Hook interface {
+	Stage() Stage
+	Run(ctx context.Context, r *Receipt) error
+}
+
+// NewHook returns a hook running fn at stage
+func NewHook(stage Stage, fn Func) Hook {
+	return funcHook{stage: stage, fn: fn}
+}
+
+type funcHook struct {
+	stage Stage
+	fn    Func
+}
+
+func (h funcHook) Stage() Stage                              { return h.stage }
+func (h funcHook) Run(ctx context.Context, r *Receipt) error { return h.fn(ctx, r) }
+
+// Codes classifying why a receipt that passed the schema is invalid or rejected
+const (
+	// CodePurchaseDate marks receipts purchased in the future or too long ago to be accepted
+	CodePurchaseDate = "purchase-date-out-of-range"
+	// CodeReceiptLimit marks receipts rejected because their user submitted too many today
+	CodeReceiptLimit = "receipt-limit-exceeded"
+	// CodePointsLimit marks receipts rejected because they would earn their user too many points
+	CodePointsLimit = "points-limit-exceeded"
+)
+
+// Invalid is returned when a receipt fails to decode or validate
+type Invalid struct {
+	// Errors locates every problem found, when they could be located
+	Errors []validation.FieldError
+	// Code classifies a receipt that passed the schema but is invalid for another reason, e.g.
+	// CodePurchaseDate; it is empty for schema problems
+	Code string
+}
+
+func (e *Invalid) Error() string {
+	return e.Message().Text(i18n.Languages[0])
+}
+
+// Message is the catalog message describing the error
+func (e *Invalid) Message() i18n.Message {
+	if e.Code == CodePurchaseDate {
+		return i18n.NewMessage("receipt.purchaseDateOutOfRange")
+	}
+	return i18n.NewMessage("receipt.invalid")
+}
+
+// Rejection is returned when a receipt is turned away, e.g. by fraud checks
+type Rejection struct {
+	Reasons []string
+	// Code classifies a rejection other than by the fraud checks, e.g. CodeReceiptLimit
+	Code string
+}
+
+func (e *Rejection) Error() string {
+	return e.Message().Text(i18n.Languages[0])
+}
+
+// Message is the catalog message describing the error
+func (e *Rejection) Message() i18n.Message {
+	reasons := strings.Join(e.Reasons, "; ")
+	if e.Code == CodeReceiptLimit || e.Code == CodePointsLimit {
+		return i18n.NewMessage("receipt.limitExceeded", "reasons", reasons)
+	}
+	return i18n.NewMessage("receipt.fraudRejected", "reasons", reasons)
+}
+
+// Stages holds the built-in work of each stage; nil stages only run their hooks
+type Stages struct {
+	Decode, Validate, Enrich, Score, Persist, Notify Func
+}
+
+// Pipeline processes receipts through its stages and registered hooks
+type Pipeline struct {
+	stages  Stages
+	workers int
+
+	mu    sync.RWMutex
+	hooks map[Stage][]Hook
+}
+
+// New returns a pipeline running the built-in stages, preparing at most workers receipts at a time
+// in Stream
+func New(stages Stages, workers int) *Pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pipeline{stages: stages, workers: workers, hooks: make(map[Stage][]Hook)}
+}
+
+// Register adds hooks, which apply to receipts processed from then on
+func (p *Pipeline) Register(hooks ...Hook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, hook := range hooks {
+		p.hooks[hook.Stage()] = append(p.hooks[hook.Stage()], hook)
+	}
+}
+
+// Prepare decodes, validates, enriches and scores a receipt without storing it. It has no side
+// effects of its own, so receipts can be prepared concurrently.
+func (p *Pipeline) Prepare(ctx context.Context, r *Receipt) error {
+	for _, stage := range []struct {
+		name    Stage
+		builtin Func
+	}{{Decode, p.stages.Decode}, {Validate, p.stages.Validate}, {Enrich, p.stages.Enrich}, {Score, p.stages.Score}} {
+		if err := p.run(ctx, stage.name, stage.builtin, r); err != nil {
+			p.fail(ctx, r, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit persists a prepared receipt and notifies about it. Receipts must be committed one at a
+// time, in the order they were submitted, so checks against stored receipts see the earlier ones.
+func (p *Pipeline) Commit(ctx context.Context, r *Receipt) error {
+	if p.stages.Persist != nil {
+		if err := p.stages.Persist(ctx, r); err != nil {
+			p.fail(ctx, r, err)
+			return err
+		}
+	}
+	p.runLogged(ctx, Persist, r)
+	if p.stages.Notify != nil {
+		if err := p.stages.Notify(ctx, r); err != nil {
+			log.Printf("pipeline notify receipt %s: %v", r.Record.ID, err)
+		}
+	}
+	p.runLogged(ctx, Notify, r)
+	return nil
+}
+
+// Process prepares and commits a receipt
+func (p *Pipeline) Process(ctx context.Context, r *Receipt) error {
+	if err := p.Prepare(ctx, r); err != nil {
+		return err
+	}
+	return p.Commit(ctx, r)
+}
+
+// Prepared is the outcome of preparing one receipt of a stream
+type Prepared struct {
+	Receipt *Receipt
+	Err     error
+}
+
+// Stream prepares receipts as they arrive on in on a bounded number of goroutines, emitting them in
+// arrival order. The returned channel is closed once in is closed and every receipt was delivered.
+func (p *Pipeline) Stream(ctx context.Context, in <-chan *Receipt) <-chan Prepared {
+	out := make(chan Prepared)
+	// pending holds one channel per in-flight receipt, in arrival order
+	pending := make(chan chan Prepared, p.workers)
+	slots := make(chan struct{}, p.workers)
+
+	go func() {
+		defer close(pending)
+		for r := range in {
+			resultCh := make(chan Prepared, 1)
+			pending <- resultCh
+			slots <- struct{}{}
+			go func(r *Receipt) {
+				defer func() { <-slots }()
+				resultCh <- Prepared{Receipt: r, Err: p.Prepare(ctx, r)}
+			}(r)
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for resultCh := range pending {
+			out <- <-resultCh
+		}
+	}()
+	return out
+}
+
+// run performs a stage's built-in work, then its hooks, stopping at the first error
+func (p *Pipeline) run(ctx context.Context, stage Stage, builtin Func, r *Receipt) error {
+	if builtin != nil {
+		if err := builtin(ctx, r); err != nil {
+			return err
+		}
+	}
+	for _, hook := range p.hooksFor(stage) {
+		if err := hook.Run(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runLogged runs the hooks of a stage whose errors can no longer stop processing, logging them
+func (p *Pipeline) runLogged(ctx context.Context, stage Stage, r *Receipt) {
+	for _, hook := range p.hooksFor(stage) {
+		if err := hook.Run(ctx, r); err != nil {
+			log.Printf("pipeline %s hook for receipt %s: %v", stage, r.Record.ID, err)
+		}
+	}
+}
+
+var processingErrors = metrics.NewCounterVec("receipts_processing_errors_total", "Receipts that failed processing, by error type.", "type")
+
+// errorType classifies a processing error for receipts_processing_errors_total: "invalid" for schema
+// problems, the Code of other invalid and rejected receipts, "rejected" for the fraud checks,
+// "canceled" and "timeout" when the request ended first, and "internal" for everything else
+func errorType(err error) string {
+	var invalid *Invalid
+	var rejected *Rejection
+	switch {
+	case errors.As(err, &invalid) && invalid.Code != "":
+		return invalid.Code
+	case invalid != nil:
+		return "invalid"
+	case errors.As(err, &rejected) && rejected.Code != "":
+		return rejected.Code
+	case rejected != nil:
+		return "rejected"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "internal"
+}
+
+// fail counts the error and runs the failed hooks for one that isn't the receipt's own fault
+func (p *Pipeline) fail(ctx context.Context, r *Receipt, err error) {
+	processingErrors.With(errorType(err)).Inc()
+	var invalid *Invalid
+	var rejected *Rejection
+	if errors.As(err, &invalid) || errors.As(err, &rejected) {
+		return
+	}
+	r.Err = err
+	p.runLogged(ctx, Failed, r)
+}
+
+func (p *Pipeline) hooksFor(stage Stage) []Hook {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.hooks[stage]
+}
@@ -0,0 +1,132 @@
+// Package problem is the error model shared by every API handler, rendered as RFC 7807
+// problem details.
+package problem
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"receipt-processor/i18n"
+	"receipt-processor/validation"
+)
+
+// Problem types more specific than the HTTP status. Every other problem is "about:blank",
+// whose title is the status text.
+const (
+	TypeInvalidReceipt = "/problems/invalid-receipt"
+	TypeFraudRejected  = "/problems/fraud-rejected"
+	TypePurchaseDate   = "/problems/purchase-date-out-of-range"
+	TypeLimitExceeded  = "/problems/limit-exceeded"
+	TypeArchived       = "/problems/receipt-archived"
+)
+
+// Content types a problem can be served as
+const (
+	ContentType       = "application/problem+json"
+	legacyContentType = "application/json"
+)
+
+// Problem describes why a request failed
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// MessageKey and MessageParams identify Detail in the error message catalog, so clients can
+	// translate it themselves
+	MessageKey    string            `json:"messageKey,omitempty"`
+	MessageParams map[string]string `json:"messageParams,omitempty"`
+	// Errors locates every problem with an invalid request body
+	Errors []validation.FieldError `json:"errors,omitempty"`
+	// Error repeats Detail in English for clients written against the earlier {"error": "..."} bodies
+	Error string `json:"error,omitempty"`
+
+	// message is the catalog message Detail is written from, in the language of the request
+	message i18n.Message
+}
+
+// New returns a problem identified by its status alone, e.g. New(404, i18n.NewMessage("receipt.notFound"))
+func New(status int, message i18n.Message) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, message: message}
+}
+
+// Invalid returns a problem listing every invalid field of a receipt
+func Invalid(status int, message i18n.Message, errors []validation.FieldError) *Problem {
+	return &Problem{Type: TypeInvalidReceipt, Title: "Invalid receipt", Status: status, message: message, Errors: errors}
+}
+
+// FraudRejected returns a problem for a receipt turned away by fraud checks
+func FraudRejected(message i18n.Message) *Problem {
+	return &Problem{Type: TypeFraudRejected, Title: "Rejected by fraud checks", Status: http.StatusUnprocessableEntity, message: message}
+}
+
+// PurchaseDateOutOfRange returns a problem for a receipt purchased in the future or too long ago
+func PurchaseDateOutOfRange(message i18n.Message, errors []validation.FieldError) *Problem {
+	return &Problem{Type: TypePurchaseDate, Title: "Purchase date out of range", Status: http.StatusUnprocessableEntity, message: message, Errors: errors}
+}
+
+// LimitExceeded returns a problem for a receipt that would take its user over a submission limit,
+// with status 429 for the limit on receipts and 422 for those on points
+func LimitExceeded(status int, message i18n.Message) *Problem {
+	return &Problem{Type: TypeLimitExceeded, Title: "Submission limit exceeded", Status: status, message: message}
+}
+
+// Archived returns a problem for a receipt moved to cold storage, which has to be rehydrated first
+func Archived(message i18n.Message) *Problem {
+	return &Problem{Type: TypeArchived, Title: "Receipt archived", Status: http.StatusConflict, message: message}
+}
+
+// Write sends the problem in response to r, as application/problem+json unless the client only accepts
+// application/json. Its detail and the field messages with a key are written in the language r
+// accepts.
+func (p *Problem) Write(w http.ResponseWriter, r *http.Request) {
+	body := *p
+	if body.Instance == "" {
+		body.Instance = r.URL.Path
+	}
+	lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	body.Detail, body.Error = p.message.Text(lang), p.message.Text(i18n.Languages[0])
+	body.MessageKey, body.MessageParams = p.message.Key, p.message.Params
+	if len(body.Errors) > 0 {
+		body.Errors = make([]validation.FieldError, len(p.Errors))
+		for i, fieldError := range p.Errors {
+			if fieldError.MessageKey != "" {
+				fieldError.Message = i18n.NewMessage(fieldError.MessageKey).Text(lang)
+			}
+			body.Errors[i] = fieldError
+		}
+	}
+
+	w.Header().Set("Content-Type", negotiate(r.Header.Get("Accept")))
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// negotiate picks the problem content type for an Accept header
+func negotiate(accept string) string {
+	if accept == "" {
+		return ContentType
+	}
+	acceptsLegacy := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case ContentType, "application/*", "*/*":
+			return ContentType
+		case legacyContentType:
+			acceptsLegacy = true
+		}
+	}
+	if acceptsLegacy {
+		return legacyContentType
+	}
+	return ContentType
+}
@@ -0,0 +1,35 @@
+package receipt_test
+
+import (
+	"fmt"
+	"testing"
+
+	"receipt-processor/receipt"
+)
+
+func benchmarkReceipt(itemCount int) receipt.Receipt {
+	r := receipt.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+	}
+	for i := 0; i < itemCount; i++ {
+		r.Items = append(r.Items, receipt.Item{ShortDescription: "Gatorade", Price: "2.25"})
+	}
+	return r
+}
+
+func BenchmarkValidate(b *testing.B) {
+	for _, itemCount := range []int{1, 10, 100, 1000} {
+		r := benchmarkReceipt(itemCount)
+		b.Run(fmt.Sprintf("items=%d", itemCount), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !receipt.Validate(r) {
+					b.Fatal("benchmark receipt is invalid")
+				}
+			}
+		})
+	}
+}
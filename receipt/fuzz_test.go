@@ -0,0 +1,64 @@
+package receipt_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"receipt-processor/receipt"
+)
+
+// addFixtureSeeds seeds the fuzz corpus with every receipt in the fixtures directory
+func addFixtureSeeds(f *testing.F) {
+	fixtures, err := filepath.Glob("../testdata/receipts/*.json")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	addFixtureSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r receipt.Receipt
+		if err := json.Unmarshal(data, &r); err != nil {
+			return
+		}
+
+		// Anything that decodes must survive a round trip unchanged
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("encoding decoded receipt: %v", err)
+		}
+		var again receipt.Receipt
+		if err := json.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("decoding re-encoded receipt: %v", err)
+		}
+		reencoded, _ := json.Marshal(again)
+		if string(encoded) != string(reencoded) {
+			t.Fatalf("round trip changed the receipt:\n%s\n%s", encoded, reencoded)
+		}
+	})
+}
+
+func FuzzValidate(f *testing.F) {
+	addFixtureSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r receipt.Receipt
+		if err := json.Unmarshal(data, &r); err != nil {
+			return
+		}
+
+		// Validation must be deterministic and never panic
+		if receipt.Validate(r) != receipt.Validate(r) {
+			t.Fatal("validation is not deterministic")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package receipt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"receipt-processor/validation"
+)
+
+// longDescription is the longest item description Lint doesn't warn about; printed receipts
+// abbreviate descriptions well below it
+const longDescription = 64
+
+// Lint reports data-quality problems in a valid receipt that don't make it invalid: amounts that
+// don't add up, purchase dates in the future and unusually long or padded descriptions. now is
+// the time the receipt is checked at.
+func Lint(receipt Receipt, now time.Time) []validation.FieldError {
+	var warnings []validation.FieldError
+
+	// Items should add up to the subtotal, or to the total when the receipt has no breakdown
+	sum, ok := int64(0), true
+	for _, item := range receipt.Items {
+		price, valid := cents(item.Price)
+		// Sums too large to count in cents can't be compared
+		ok = ok && valid && price <= math.MaxInt64-sum
+		if ok {
+			sum += price
+		}
+	}
+	target, field := receipt.Total, "total"
+	if receipt.Subtotal != "" {
+		target, field = receipt.Subtotal, "subtotal"
+	}
+	if expected, valid := cents(target); ok && valid && (sum-expected > 1 || expected-sum > 1) {
+		warnings = append(warnings, validation.FieldError{
+			Pointer: "/" + field,
+			Message: fmt.Sprintf("the item prices add up to %d.%02d, not %s", sum/100, sum%100, target),
+		})
+	}
+
+	// Allow a day ahead so receipts from timezones east of the server aren't reported
+	if date, err := time.Parse(validation.DateLayout, receipt.PurchaseDate); err == nil && date.After(now.AddDate(0, 0, 1)) {
+		warnings = append(warnings, validation.FieldError{
+			Pointer: "/purchaseDate",
+			Message: "the purchase date is in the future",
+		})
+	}
+
+	for i, item := range receipt.Items {
+		trimmed := strings.TrimSpace(item.ShortDescription)
+		if utf8.RuneCountInString(trimmed) > longDescription {
+			warnings = append(warnings, validation.FieldError{
+				Pointer: fmt.Sprintf("/items/%d/shortDescription", i),
+				Message: fmt.Sprintf("the description is unusually long, more than %d characters", longDescription),
+			})
+		} else if trimmed != item.ShortDescription {
+			warnings = append(warnings, validation.FieldError{
+				Pointer: fmt.Sprintf("/items/%d/shortDescription", i),
+				Message: "the description has leading or trailing spaces, which are ignored when it is scored",
+			})
+		}
+	}
+	return warnings
+}
+
+// cents parses a well-formed amount such as "12.25" into cents
+func cents(amount string) (int64, bool) {
+	value, err := strconv.ParseInt(strings.Replace(amount, ".", "", 1), 10, 64)
+	return value, err == nil
+}
@@ -0,0 +1,117 @@
+package receipt
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+
+	"receipt-processor/validation"
+)
+
+// Layouts Normalize reads purchase dates and times in besides the canonical ones. Dates whose day
+// and month could be swapped aren't read.
+var (
+	dateLayouts = []string{"2006-1-2", "2006/1/2", "20060102", time.RFC3339}
+	timeLayouts = []string{"15:4", "15:04:05", "3:04 PM", "3:04PM", "3:04:05 PM", "1504"}
+)
+
+// Change is a value Normalize changed, located by its JSON Pointer
+type Change struct {
+	Pointer string `json:"pointer"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// Normalize returns the canonical form of a receipt: the retailer trimmed, with its runs of
+// whitespace collapsed and case-folded, the purchase date and time in their canonical layouts,
+// amounts with two decimals and no currency sign, and item descriptions trimmed with their runs of
+// whitespace collapsed. Values it can't read are kept as they are, for validation to report.
+func Normalize(receipt Receipt) Receipt {
+	normalized := receipt
+	normalized.Retailer = cases.Fold().String(collapseSpaces(receipt.Retailer))
+	normalized.PurchaseDate = normalizeTime(receipt.PurchaseDate, validation.DateLayout, dateLayouts)
+	normalized.PurchaseTime = normalizeTime(receipt.PurchaseTime, validation.TimeLayout, timeLayouts)
+	normalized.Total = normalizeAmount(receipt.Total)
+	normalized.Subtotal = normalizeAmount(receipt.Subtotal)
+	normalized.Discount = normalizeAmount(receipt.Discount)
+	normalized.Tax = normalizeAmount(receipt.Tax)
+	normalized.Items = make([]Item, len(receipt.Items))
+	for i, item := range receipt.Items {
+		item.ShortDescription = collapseSpaces(item.ShortDescription)
+		item.Price = normalizeAmount(item.Price)
+		item.UnitPrice = normalizeAmount(item.UnitPrice)
+		item.Quantity = strings.TrimSpace(item.Quantity)
+		normalized.Items[i] = item
+	}
+	if receipt.Items == nil {
+		normalized.Items = nil
+	}
+	return normalized
+}
+
+// Changes lists the values Normalize changed between a receipt and its normalized form
+func Changes(before, after Receipt) []Change {
+	changes := []Change{}
+	compare := func(pointer, from, to string) {
+		if from != to {
+			changes = append(changes, Change{Pointer: pointer, From: from, To: to})
+		}
+	}
+	compare("/retailer", before.Retailer, after.Retailer)
+	compare("/purchaseDate", before.PurchaseDate, after.PurchaseDate)
+	compare("/purchaseTime", before.PurchaseTime, after.PurchaseTime)
+	for i := range min(len(before.Items), len(after.Items)) {
+		from, to := before.Items[i], after.Items[i]
+		compare(fmt.Sprintf("/items/%d/shortDescription", i), from.ShortDescription, to.ShortDescription)
+		compare(fmt.Sprintf("/items/%d/price", i), from.Price, to.Price)
+		compare(fmt.Sprintf("/items/%d/quantity", i), from.Quantity, to.Quantity)
+		compare(fmt.Sprintf("/items/%d/unitPrice", i), from.UnitPrice, to.UnitPrice)
+	}
+	compare("/total", before.Total, after.Total)
+	compare("/subtotal", before.Subtotal, after.Subtotal)
+	compare("/discount", before.Discount, after.Discount)
+	compare("/tax", before.Tax, after.Tax)
+	return changes
+}
+
+// collapseSpaces trims s and reduces its runs of whitespace to one space
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// normalizeTime rewrites a date or time read with one of layouts in the canonical layout. AM and
+// PM are read in either case.
+func normalizeTime(value, canonical string, layouts []string) string {
+	trimmed := strings.ToUpper(strings.TrimSpace(value))
+	for _, layout := range append([]string{canonical}, layouts...) {
+		if parsed, err := time.Parse(layout, trimmed); err == nil {
+			return parsed.Format(canonical)
+		}
+	}
+	return value
+}
+
+// normalizeAmount rewrites an amount such as " $6.5" as "6.50". Amounts with fractions of a cent
+// are kept, as rounding them would change the receipt.
+func normalizeAmount(amount string) string {
+	trimmed := strings.TrimSpace(amount)
+	sign := ""
+	if rest, ok := strings.CutPrefix(trimmed, "-"); ok {
+		sign, trimmed = "-", rest
+	}
+	trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "$"))
+	value, ok := new(big.Rat).SetString(trimmed)
+	if trimmed == "" || !ok || strings.ContainsAny(trimmed, "eE/") || value.Sign() < 0 {
+		return amount
+	}
+	if !new(big.Rat).Mul(value, big.NewRat(100, 1)).IsInt() {
+		return amount
+	}
+	if value.Sign() == 0 {
+		sign = ""
+	}
+	return sign + value.FloatString(2)
+}
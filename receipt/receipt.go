@@ -0,0 +1,91 @@
+// Package receipt defines the receipt payload accepted by the API and validates it against the
+// embedded JSON Schema.
+package receipt
+
+import "strings"
+
+type Item struct {
+	ShortDescription string `json:"shortDescription"`
+	Price            string `json:"price"`
+	// Category optionally classifies the item, e.g. "produce"; the server may assign one from its taxonomy
+	Category string `json:"category,omitempty"`
+	// Quantity and UnitPrice optionally break the price down, e.g. "3" at "0.50" for a price of "1.50"
+	Quantity  string `json:"quantity,omitempty"`
+	UnitPrice string `json:"unitPrice,omitempty"`
+	// UPC optionally identifies the product by its barcode, e.g. "012000161155"
+	UPC string `json:"upc,omitempty"`
+	// Brand optionally names the product's brand; the server may assign one from its product catalog
+	Brand string `json:"brand,omitempty"`
+}
+
+// Receipt is a receipt as submitted for processing
+type Receipt struct {
+	Retailer     string `json:"retailer"`
+	PurchaseDate string `json:"purchaseDate"`
+	PurchaseTime string `json:"purchaseTime"`
+	Items        []Item `json:"items"`
+	Total        string `json:"total"`
+	// Subtotal, Discount and Tax optionally break the total down; subtotal - discount + tax must equal the total
+	Subtotal string `json:"subtotal,omitempty"`
+	Discount string `json:"discount,omitempty"`
+	Tax      string `json:"tax,omitempty"`
+	// UserID optionally links the receipt to the loyalty account that submitted it
+	UserID string `json:"userId,omitempty"`
+	// RetailerID is assigned by the server when the retailer is in its registry; submitted values are ignored
+	RetailerID string `json:"retailerId,omitempty"`
+	// Metadata carries integrator-defined values such as store numbers or campaign codes, stored verbatim
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Type is TypePurchase, the default, or TypeReturn
+	Type string `json:"type,omitempty"`
+	// OriginalReceiptID optionally names the receipt of the purchase a return refunds
+	OriginalReceiptID string `json:"originalReceiptId,omitempty"`
+	// RelatedReceiptID optionally names another receipt this one is the Relationship of, e.g. the
+	// receipt it corrects
+	RelatedReceiptID string `json:"relatedReceiptId,omitempty"`
+	Relationship     string `json:"relationship,omitempty"`
+}
+
+// Receipt types
+const (
+	TypePurchase = "purchase"
+	// TypeReturn refunds a purchase; its total is the amount refunded
+	TypeReturn = "return"
+)
+
+// Relationships a receipt can have to another
+const (
+	// RelationReturn links a return to the purchase it refunds, through OriginalReceiptID
+	RelationReturn = "return"
+	// RelationCorrection links a receipt to the one it corrects
+	RelationCorrection = "correction"
+	// RelationSplit links the receipts of a purchase paid in parts, e.g. with several cards
+	RelationSplit = "split"
+)
+
+// Link is a receipt's relationship to another
+type Link struct {
+	ReceiptID    string `json:"receiptId"`
+	Relationship string `json:"relationship"`
+}
+
+// Links returns the receipts this one refers to: the purchase a return refunds and its related receipt
+func (r Receipt) Links() []Link {
+	var links []Link
+	if r.OriginalReceiptID != "" {
+		links = append(links, Link{ReceiptID: r.OriginalReceiptID, Relationship: RelationReturn})
+	}
+	if r.RelatedReceiptID != "" {
+		links = append(links, Link{ReceiptID: r.RelatedReceiptID, Relationship: r.Relationship})
+	}
+	return links
+}
+
+// IsReturn reports whether the receipt refunds a purchase: it has type return, or a negative total
+func (r Receipt) IsReturn() bool {
+	return r.Type == TypeReturn || strings.HasPrefix(r.Total, "-")
+}
+
+// Validate reports whether the receipt is well formed; Check reports why it isn't
+func Validate(receipt Receipt) bool {
+	return len(Check(receipt)) == 0
+}
@@ -0,0 +1,159 @@
+package receipt
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"receipt-processor/validation"
+)
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// schema is the compiled schema of version 1, shared by every request
+var schema = compileSchema()
+
+func compileSchema() *jsonschema.Schema {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+	if err != nil {
+		panic(fmt.Sprintf("parsing the receipt schema: %v", err))
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource("receipt.json", doc); err != nil {
+		panic(fmt.Sprintf("loading the receipt schema: %v", err))
+	}
+	return compiler.MustCompile("receipt.json")
+}
+
+// printer formats schema error messages
+var printer = message.NewPrinter(language.English)
+
+// pointer encodes an instance location as a JSON Pointer
+func pointer(tokens []string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return sb.String()
+}
+
+// Schema returns the JSON Schema of CurrentVersion
+func Schema() []byte {
+	return schemaJSON
+}
+
+// CheckJSON validates an encoded receipt against the schema of the version it names and the checks
+// spanning several fields, returning every problem found, or none when the receipt is valid
+func CheckJSON(data []byte) []validation.FieldError {
+	number, err := versionOf(data)
+	if err != nil {
+		return []validation.FieldError{{Pointer: "/schemaVersion", Message: err.Error()}}
+	}
+	return checkVersion(versions[number], data)
+}
+
+// checkVersion validates an encoded receipt against the schema of a version, then decodes it to
+// apply the checks spanning several fields
+func checkVersion(v version, data []byte) []validation.FieldError {
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return []validation.FieldError{{Pointer: "", Message: "The receipt is not valid JSON.", MessageKey: "field.notJSON"}}
+	}
+	if err := v.schema.Validate(instance); err != nil {
+		validationErr, ok := err.(*jsonschema.ValidationError)
+		if !ok {
+			return []validation.FieldError{{Pointer: "", Message: err.Error()}}
+		}
+		return schemaErrors(validationErr)
+	}
+
+	// The schema passed, so the receipt decodes and its amounts are well formed
+	receipt, err := v.decode(data)
+	if err != nil {
+		return []validation.FieldError{{Pointer: "", Message: "The receipt is not valid JSON.", MessageKey: "field.notJSON"}}
+	}
+	return crossFieldErrors(receipt)
+}
+
+// Check validates a decoded receipt the same way CheckJSON does, against the schema of CurrentVersion
+func Check(receipt Receipt) []validation.FieldError {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return []validation.FieldError{{Pointer: "", Message: err.Error()}}
+	}
+	return checkVersion(versions[CurrentVersion], data)
+}
+
+// schemaErrors flattens a schema validation error into one FieldError per failed keyword
+func schemaErrors(err *jsonschema.ValidationError) []validation.FieldError {
+	var problems []validation.FieldError
+	var collect func(*jsonschema.ValidationError)
+	collect = func(err *jsonschema.ValidationError) {
+		// Only the innermost errors name a keyword; the rest just group their causes
+		if len(err.Causes) == 0 {
+			problems = append(problems, validation.FieldError{
+				Pointer: pointer(err.InstanceLocation),
+				Message: err.ErrorKind.LocalizedString(printer),
+			})
+		}
+		for _, cause := range err.Causes {
+			collect(cause)
+		}
+	}
+	collect(err)
+	// The schema doesn't report failures in a fixed order
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Pointer != problems[j].Pointer {
+			return problems[i].Pointer < problems[j].Pointer
+		}
+		return problems[i].Message < problems[j].Message
+	})
+	return problems
+}
+
+// crossFieldErrors applies the checks the schema can't express to a receipt that passed it
+func crossFieldErrors(receipt Receipt) []validation.FieldError {
+	var problems []validation.FieldError
+	for i, item := range receipt.Items {
+		if item.Quantity != "" && item.UnitPrice != "" && !validation.LineTotal(item.Quantity, item.UnitPrice, item.Price) {
+			problems = append(problems, validation.FieldError{
+				Pointer:    fmt.Sprintf("/items/%d/price", i),
+				Message:    "quantity times unitPrice must be within a cent of price",
+				MessageKey: "field.lineTotal",
+			})
+		}
+	}
+	if receipt.Type == TypePurchase && strings.HasPrefix(receipt.Total, "-") {
+		problems = append(problems, validation.FieldError{
+			Pointer:    "/total",
+			Message:    "a purchase can't have a negative total",
+			MessageKey: "field.negativePurchase",
+		})
+	}
+	if receipt.OriginalReceiptID != "" && !receipt.IsReturn() {
+		problems = append(problems, validation.FieldError{
+			Pointer:    "/originalReceiptId",
+			Message:    "only a return can reference an original receipt",
+			MessageKey: "field.originalOnPurchase",
+		})
+	}
+	// A return balances by the amount refunded
+	if receipt.Subtotal != "" && !validation.Balances(receipt.Subtotal, receipt.Discount, receipt.Tax, strings.TrimPrefix(receipt.Total, "-")) {
+		problems = append(problems, validation.FieldError{
+			Pointer:    "/total",
+			Message:    "subtotal - discount + tax must be within a cent of total",
+			MessageKey: "field.balance",
+		})
+	}
+	return problems
+}
@@ -0,0 +1,87 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// CurrentVersion is the receipt schema version Receipt models and Schema describes. Payloads name
+// their version in schemaVersion; those without one are version 1.
+const CurrentVersion = 1
+
+// version is a receipt schema version: the schema its payloads are validated against and how they
+// are decoded into a Receipt, upgrading those of earlier versions
+type version struct {
+	schema *jsonschema.Schema
+	decode func(data []byte) (Receipt, error)
+}
+
+// versions holds every supported schema version. Changing the schema adds a version with its own
+// schema file and a decoder from its payloads, leaving the earlier versions' entries untouched.
+var versions = map[int]version{
+	1: {schema: schema, decode: decodeV1},
+}
+
+func decodeV1(data []byte) (Receipt, error) {
+	var receipt Receipt
+	err := json.Unmarshal(data, &receipt)
+	return receipt, err
+}
+
+// Versions returns the supported schema versions, oldest first
+func Versions() []int {
+	supported := make([]int, 0, len(versions))
+	for number := range versions {
+		supported = append(supported, number)
+	}
+	sort.Ints(supported)
+	return supported
+}
+
+// UnsupportedVersionError is returned for a payload naming a schema version the server doesn't support
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	supported := make([]string, 0, len(versions))
+	for _, number := range Versions() {
+		supported = append(supported, strconv.Itoa(number))
+	}
+	return fmt.Sprintf("schema version %d is not supported, use one of %s", e.Version, strings.Join(supported, ", "))
+}
+
+// versionOf returns the schema version an encoded receipt names, 1 when it names none. A payload
+// that isn't a JSON object, or whose schemaVersion isn't an integer, is left to the schema of
+// CurrentVersion to report.
+func versionOf(data []byte) (int, error) {
+	var header struct {
+		SchemaVersion json.RawMessage `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil || header.SchemaVersion == nil {
+		return 1, nil
+	}
+	number, err := strconv.Atoi(string(bytes.TrimSpace(header.SchemaVersion)))
+	if err != nil {
+		return CurrentVersion, nil
+	}
+	if _, ok := versions[number]; !ok {
+		return 0, &UnsupportedVersionError{Version: number}
+	}
+	return number, nil
+}
+
+// Decode decodes an encoded receipt with the decoder of the schema version it names
+func Decode(data []byte) (Receipt, error) {
+	number, err := versionOf(data)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return versions[number].decode(data)
+}
@@ -0,0 +1,50 @@
+package receipttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"receipt-processor/client"
+)
+
+var target = client.Receipt{
+	Retailer:     "Target",
+	PurchaseDate: "2022-01-01",
+	PurchaseTime: "13:01",
+	Items:        []client.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+	Total:        "6.49",
+}
+
+func TestDeterministicIDsAndTimes(t *testing.T) {
+	srv := NewTestServer()
+	defer srv.Close()
+	c := client.New(srv.URL, client.Options{})
+	ctx := context.Background()
+
+	for i, want := range []struct {
+		id        string
+		createdAt time.Time
+	}{
+		{"00000000-0000-4000-8000-000000000001", Start},
+		{"00000000-0000-4000-8000-000000000002", Start.Add(time.Hour)},
+	} {
+		if i > 0 {
+			srv.Clock.Advance(time.Hour)
+		}
+		id, err := c.ProcessReceipt(ctx, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want.id {
+			t.Errorf("receipt %d: id = %s, want %s", i, id, want.id)
+		}
+		record, err := srv.Store.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !record.CreatedAt.Equal(want.createdAt) || !record.StatusChangedAt.Equal(want.createdAt) {
+			t.Errorf("receipt %d: created at %s, status changed at %s, want %s", i, record.CreatedAt, record.StatusChangedAt, want.createdAt)
+		}
+	}
+}
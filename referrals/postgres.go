@@ -0,0 +1,113 @@
+package referrals
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Postgres keeps the referrals in a PostgreSQL table, so every instance sharing the database
+// rewards each referral once
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the referrals in db, creating the table when it doesn't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS referrals (
+		referred_id text PRIMARY KEY,
+		referrer_id text NOT NULL,
+		created_at  timestamptz NOT NULL DEFAULT now(),
+		rewarded_at timestamptz,
+		receipt_id  text NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating referrals table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS referrals_referrer ON referrals (referrer_id, created_at)`); err != nil {
+		return nil, fmt.Errorf("creating referrals referrer index: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+// Link records the referral, timed by the database clock so instances with skewed clocks agree
+func (p *Postgres) Link(referrer, referred string) (Referral, error) {
+	if referrer == referred {
+		return Referral{}, ErrSelf
+	}
+	referral := Referral{ReferrerID: referrer, ReferredID: referred}
+	err := p.db.QueryRow(`INSERT INTO referrals (referred_id, referrer_id) VALUES ($1, $2)
+		ON CONFLICT (referred_id) DO NOTHING RETURNING created_at`, referred, referrer).Scan(&referral.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Referral{}, ErrAlreadyReferred
+	}
+	if err != nil {
+		return Referral{}, err
+	}
+	referral.CreatedAt = referral.CreatedAt.UTC()
+	return referral, nil
+}
+
+func (p *Postgres) Referrals(referrer string) ([]Referral, error) {
+	rows, err := p.db.Query(`SELECT referrer_id, referred_id, created_at, rewarded_at, receipt_id
+		FROM referrals WHERE referrer_id = $1 ORDER BY created_at, referred_id`, referrer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrals := []Referral{}
+	for rows.Next() {
+		referral, err := scanReferral(rows)
+		if err != nil {
+			return nil, err
+		}
+		referrals = append(referrals, referral)
+	}
+	return referrals, rows.Err()
+}
+
+// Claim marks the referral rewarded in a single update, so two instances approving receipts of the
+// same user at once can't both claim it
+func (p *Postgres) Claim(referred, receiptID string) (Referral, bool, error) {
+	row := p.db.QueryRow(`UPDATE referrals SET rewarded_at = now(), receipt_id = $2
+		WHERE referred_id = $1 AND rewarded_at IS NULL
+		RETURNING referrer_id, referred_id, created_at, rewarded_at, receipt_id`, referred, receiptID)
+	referral, err := scanReferral(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Referral{}, false, nil
+	}
+	if err != nil {
+		return Referral{}, false, err
+	}
+	return referral, true, nil
+}
+
+func (p *Postgres) Release(referred string) error {
+	_, err := p.db.Exec(`UPDATE referrals SET rewarded_at = NULL, receipt_id = '' WHERE referred_id = $1`, referred)
+	return err
+}
+
+func (p *Postgres) EraseUser(userID string) (int, error) {
+	result, err := p.db.Exec(`DELETE FROM referrals WHERE referrer_id = $1 OR referred_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// scanReferral reads a row of referrer_id, referred_id, created_at, rewarded_at and receipt_id
+func scanReferral(row interface{ Scan(...interface{}) error }) (Referral, error) {
+	var referral Referral
+	var rewardedAt sql.NullTime
+	if err := row.Scan(&referral.ReferrerID, &referral.ReferredID, &referral.CreatedAt, &rewardedAt, &referral.ReceiptID); err != nil {
+		return Referral{}, err
+	}
+	referral.CreatedAt = referral.CreatedAt.UTC()
+	if rewardedAt.Valid {
+		at := rewardedAt.Time.UTC()
+		referral.RewardedAt = &at
+	}
+	return referral, nil
+}
@@ -0,0 +1,227 @@
+// Package referrals links users to the users who referred them, and tracks which referrals have
+// earned their bonus.
+package referrals
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+)
+
+var (
+	// ErrSelf is returned when a user refers themselves
+	ErrSelf = errors.New("users can't refer themselves")
+	// ErrAlreadyReferred is returned when the referred user already has a referrer
+	ErrAlreadyReferred = errors.New("user was already referred")
+)
+
+// Referral links a referred user to the user who referred them
+type Referral struct {
+	ReferrerID string    `json:"referrerId"`
+	ReferredID string    `json:"referredId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// RewardedAt is when the referred user's first approved receipt earned both users the bonus
+	RewardedAt *time.Time `json:"rewardedAt,omitempty"`
+	// ReceiptID is the receipt that earned the bonus
+	ReceiptID string `json:"receiptId,omitempty"`
+}
+
+// Store keeps the referrals: a Registry in memory or a file for a single instance, or Postgres
+// shared by every instance
+type Store interface {
+	// Link records that referrer referred referred
+	Link(referrer, referred string) (Referral, error)
+	// Referrals returns the referrals made by a user, oldest first
+	Referrals(referrer string) ([]Referral, error)
+	// Claim marks the referral of a user as rewarded by receiptID. It reports false when the user
+	// wasn't referred or their referral was already rewarded, so every referral is rewarded once.
+	Claim(referred, receiptID string) (Referral, bool, error)
+	// Release undoes a claim whose bonus couldn't be credited, so the next approved receipt claims it
+	Release(referred string) error
+	// EraseUser removes every referral a user made or was referred by, returning how many were removed
+	EraseUser(userID string) (int, error)
+}
+
+// Registry holds every referral, optionally persisted to a JSON file
+type Registry struct {
+	path  string
+	clock clock.Clock
+
+	mu sync.Mutex
+	// referrals are keyed by the referred user, who can only be referred once
+	referrals map[string]Referral
+}
+
+// Open loads the referrals persisted at path, creating the file on first change. An empty path keeps
+// them in memory. Referrals and rewards are timed by c, the system clock when nil.
+func Open(path string, c clock.Clock) (*Registry, error) {
+	if c == nil {
+		c = clock.System{}
+	}
+	reg := &Registry{path: path, clock: c, referrals: make(map[string]Referral)}
+	if path == "" {
+		return reg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var referrals []Referral
+	if err := json.Unmarshal(data, &referrals); err != nil {
+		return nil, fmt.Errorf("parsing referrals %s: %w", path, err)
+	}
+	for _, referral := range referrals {
+		reg.referrals[referral.ReferredID] = referral
+	}
+	return reg, nil
+}
+
+// Link records that referrer referred referred
+func (reg *Registry) Link(referrer, referred string) (Referral, error) {
+	if referrer == referred {
+		return Referral{}, ErrSelf
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, exists := reg.referrals[referred]; exists {
+		return Referral{}, ErrAlreadyReferred
+	}
+	referral := Referral{ReferrerID: referrer, ReferredID: referred, CreatedAt: reg.clock.Now().UTC()}
+	reg.referrals[referred] = referral
+	err := reg.persist(func() { delete(reg.referrals, referred) })
+	if err != nil {
+		return Referral{}, err
+	}
+	return referral, nil
+}
+
+// Referrals returns the referrals made by a user, oldest first
+func (reg *Registry) Referrals(referrer string) ([]Referral, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	referrals := []Referral{}
+	for _, referral := range reg.sorted() {
+		if referral.ReferrerID == referrer {
+			referrals = append(referrals, referral)
+		}
+	}
+	return referrals, nil
+}
+
+// Claim marks the referral of a user as rewarded by receiptID. It reports false when the user
+// wasn't referred or their referral was already rewarded, so every referral is rewarded once.
+func (reg *Registry) Claim(referred, receiptID string) (Referral, bool, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	referral, exists := reg.referrals[referred]
+	if !exists || referral.RewardedAt != nil {
+		return Referral{}, false, nil
+	}
+	previous := referral
+	now := reg.clock.Now().UTC()
+	referral.RewardedAt, referral.ReceiptID = &now, receiptID
+	reg.referrals[referred] = referral
+	if err := reg.persist(func() { reg.referrals[referred] = previous }); err != nil {
+		return Referral{}, false, err
+	}
+	return referral, true, nil
+}
+
+// Release undoes a claim whose bonus couldn't be credited, so the next approved receipt claims it
+func (reg *Registry) Release(referred string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	referral, exists := reg.referrals[referred]
+	if !exists || referral.RewardedAt == nil {
+		return nil
+	}
+	previous := referral
+	referral.RewardedAt, referral.ReceiptID = nil, ""
+	reg.referrals[referred] = referral
+	return reg.persist(func() { reg.referrals[referred] = previous })
+}
+
+// EraseUser removes every referral a user made or was referred by, returning how many were removed
+func (reg *Registry) EraseUser(userID string) (int, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	removed := make(map[string]Referral)
+	for referred, referral := range reg.referrals {
+		if referral.ReferrerID == userID || referral.ReferredID == userID {
+			removed[referred] = referral
+			delete(reg.referrals, referred)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	err := reg.persist(func() {
+		for referred, referral := range removed {
+			reg.referrals[referred] = referral
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// sorted returns every referral oldest first; the caller holds mu
+func (reg *Registry) sorted() []Referral {
+	referrals := make([]Referral, 0, len(reg.referrals))
+	for _, referral := range reg.referrals {
+		referrals = append(referrals, referral)
+	}
+	sort.Slice(referrals, func(i, j int) bool {
+		if !referrals[i].CreatedAt.Equal(referrals[j].CreatedAt) {
+			return referrals[i].CreatedAt.Before(referrals[j].CreatedAt)
+		}
+		return referrals[i].ReferredID < referrals[j].ReferredID
+	})
+	return referrals
+}
+
+// persist writes the referrals to their file, calling undo to roll the change back when that fails;
+// the caller holds mu
+func (reg *Registry) persist(undo func()) error {
+	if reg.path == "" {
+		return nil
+	}
+	err := writeFile(reg.path, reg.sorted())
+	if err != nil {
+		undo()
+	}
+	return err
+}
+
+// writeFile replaces the file through a temporary file so a crash never leaves it half written
+func writeFile(path string, referrals []Referral) error {
+	data, err := json.MarshalIndent(referrals, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".referrals-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,313 @@
+// Package report produces daily and weekly summaries of processed receipts on a schedule, writing
+// them to the blob store and optionally emailing them or posting them to a webhook.
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-processor/blob"
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+	"receipt-processor/notify"
+	"receipt-processor/resilience"
+	"receipt-processor/store"
+)
+
+var produced = metrics.NewCounterVec("receipts_reports_total", "Scheduled reports produced, by report and outcome.", "report", "result")
+
+// Periods a report can cover
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// topRetailers is how many retailers a report ranks
+const topRetailers = 10
+
+// Definition describes a scheduled report
+type Definition struct {
+	// Name identifies the report in blob keys, metrics and logs
+	Name string
+	// Period is Daily or Weekly: the report covers the day or week before each run
+	Period string
+	// Schedule is when the report runs
+	Schedule Schedule
+	// Webhook, when set, receives the report as a JSON POST
+	Webhook string
+	// Email lists the addresses the report is mailed to
+	Email []string
+}
+
+// Report summarizes the receipts processed during its period
+type Report struct {
+	Name        string    `json:"name"`
+	Period      string    `json:"period"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Receipts    int       `json:"receipts"`
+	// Points is net of the points returns clawed back
+	Points   int `json:"points"`
+	Approved int `json:"approved"`
+	Flagged  int `json:"flagged"`
+	// Returns counts the receipts refunding purchases, and ClawedBack the points they took back
+	Returns    int `json:"returns"`
+	ClawedBack int `json:"clawedBack"`
+	// TopRetailers ranks the retailers with the most receipts, then points
+	TopRetailers []RetailerTotal `json:"topRetailers"`
+}
+
+// RetailerTotal counts the receipts of one retailer
+type RetailerTotal struct {
+	Retailer string `json:"retailer"`
+	Receipts int    `json:"receipts"`
+	Points   int    `json:"points"`
+}
+
+// Generate summarizes the records created in [from, to), leaving out the receipts in the trash, as
+// of the time now
+func Generate(records []store.Record, from, to, now time.Time) Report {
+	report := Report{From: from, To: to, GeneratedAt: now.UTC(), TopRetailers: []RetailerTotal{}}
+	totals := make(map[string]*RetailerTotal)
+	for _, record := range records {
+		if record.Deleted() || record.CreatedAt.Before(from) || !record.CreatedAt.Before(to) {
+			continue
+		}
+		report.Receipts++
+		report.Points += record.Points
+		if record.Status == store.StatusApproved {
+			report.Approved++
+		}
+		if record.Flagged {
+			report.Flagged++
+		}
+		if record.Receipt.IsReturn() {
+			report.Returns++
+			report.ClawedBack -= record.Points
+		}
+		// Count linked receipts under their registered retailer, the rest under the printed name
+		name := record.Receipt.Retailer
+		if record.Receipt.RetailerID != "" {
+			name = record.Receipt.RetailerID
+		}
+		total, ok := totals[name]
+		if !ok {
+			total = &RetailerTotal{Retailer: name}
+			totals[name] = total
+		}
+		total.Receipts++
+		total.Points += record.Points
+	}
+	for _, total := range totals {
+		report.TopRetailers = append(report.TopRetailers, *total)
+	}
+	sort.Slice(report.TopRetailers, func(i, j int) bool {
+		a, b := report.TopRetailers[i], report.TopRetailers[j]
+		if a.Receipts != b.Receipts {
+			return a.Receipts > b.Receipts
+		}
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return a.Retailer < b.Retailer
+	})
+	if len(report.TopRetailers) > topRetailers {
+		report.TopRetailers = report.TopRetailers[:topRetailers]
+	}
+	return report
+}
+
+// Exclude drops the records carrying any of tags, e.g. receipts operators tagged "test", from the
+// records a report summarizes
+func Exclude(records []store.Record, tags []string) []store.Record {
+	if len(tags) == 0 {
+		return records
+	}
+	kept := make([]store.Record, 0, len(records))
+	for _, record := range records {
+		if !slices.ContainsFunc(tags, record.HasTag) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// Text renders the report as plain text for email
+func (r Report) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s report, %s to %s\n\n", r.Name, r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Receipts processed: %d\nPoints awarded (net): %d\nApproved: %d\nFlagged: %d\nReturns: %d, %d points clawed back\n",
+		r.Receipts, r.Points, r.Approved, r.Flagged, r.Returns, r.ClawedBack)
+	if len(r.TopRetailers) > 0 {
+		b.WriteString("\nTop retailers:\n")
+		for i, total := range r.TopRetailers {
+			fmt.Fprintf(&b, "%2d. %s: %d receipts, %d points\n", i+1, total.Retailer, total.Receipts, total.Points)
+		}
+	}
+	return b.String()
+}
+
+// Options configures a Scheduler
+type Options struct {
+	Reports []Definition
+	// ExcludeTags leaves the receipts carrying any of these tags out of every report
+	ExcludeTags []string
+	// Output receives every report as JSON under "<name>/<end of period>.json"
+	Output blob.Store
+	// Mail sends the reports of definitions with Email addresses; nil skips email
+	Mail *notify.SMTP
+	// Notifier, when set, raises the notify.Summary event for every report produced
+	Notifier *notify.Notifier
+	// Webhooks guards the posts to report webhooks
+	Webhooks resilience.Policy
+	// HTTPClient posts to webhooks, http.DefaultClient by default
+	HTTPClient *http.Client
+	// Leader, when set, limits reports to the instance holding it, so instances sharing a store
+	// don't each produce them
+	Leader interface{ Held() bool }
+	// Clock tells the time reports are generated at, the system clock by default
+	Clock clock.Clock
+}
+
+// Scheduler produces the configured reports on their schedules
+type Scheduler struct {
+	store    store.Store
+	opts     Options
+	webhooks *resilience.Caller
+	// mu keeps reports from being produced concurrently
+	mu sync.Mutex
+}
+
+func NewScheduler(s store.Store, opts Options) *Scheduler {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	return &Scheduler{store: s, opts: opts, webhooks: resilience.New("report-webhooks", opts.Webhooks)}
+}
+
+// Run produces each report when its schedule comes up, in UTC, until ctx is cancelled
+func (sc *Scheduler) Run(ctx context.Context) {
+	if len(sc.opts.Reports) == 0 {
+		return
+	}
+	next := make([]time.Time, len(sc.opts.Reports))
+	now := time.Now().UTC()
+	for i, def := range sc.opts.Reports {
+		next[i] = def.Schedule.Next(now)
+	}
+	for {
+		earliest := time.Time{}
+		for _, at := range next {
+			if !at.IsZero() && (earliest.IsZero() || at.Before(earliest)) {
+				earliest = at
+			}
+		}
+		if earliest.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(earliest))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for i, def := range sc.opts.Reports {
+			if next[i].After(earliest) || next[i].IsZero() {
+				continue
+			}
+			at := next[i]
+			next[i] = def.Schedule.Next(at)
+			if sc.opts.Leader != nil && !sc.opts.Leader.Held() {
+				continue
+			}
+			if _, err := sc.Produce(ctx, def, at); err != nil {
+				log.Printf("report name=%s failed: %v", def.Name, err)
+			}
+		}
+	}
+}
+
+// Produce generates the report of def for the period ending at end, stores it and delivers it,
+// returning its blob key. Delivery failures are logged once the report is stored.
+func (sc *Scheduler) Produce(ctx context.Context, def Definition, end time.Time) (string, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	start := end.AddDate(0, 0, -1)
+	if def.Period == Weekly {
+		start = end.AddDate(0, 0, -7)
+	}
+	records, err := sc.store.List()
+	if err != nil {
+		produced.With(def.Name, "failure").Inc()
+		return "", err
+	}
+	report := Generate(Exclude(records, sc.opts.ExcludeTags), start, end, sc.opts.Clock.Now())
+	report.Name, report.Period = def.Name, def.Period
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		produced.With(def.Name, "failure").Inc()
+		return "", err
+	}
+	key := def.Name + "/" + end.Format("20060102T1504Z") + ".json"
+	if err := sc.opts.Output.Put(key, bytes.NewReader(data)); err != nil {
+		produced.With(def.Name, "failure").Inc()
+		return "", fmt.Errorf("storing report: %w", err)
+	}
+	produced.With(def.Name, "success").Inc()
+	log.Printf("report name=%s key=%s receipts=%d points=%d", def.Name, key, report.Receipts, report.Points)
+
+	if def.Webhook != "" {
+		if err := sc.post(ctx, def.Webhook, data); err != nil {
+			log.Printf("report name=%s webhook failed: %v", def.Name, err)
+		}
+	}
+	if len(def.Email) > 0 && sc.opts.Mail != nil {
+		subject := fmt.Sprintf("Receipt report %s, %s to %s", def.Name, start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04"))
+		if err := sc.opts.Mail.Send(def.Email, subject, report.Text()); err != nil {
+			log.Printf("report name=%s email failed: %v", def.Name, err)
+		}
+	}
+	if sc.opts.Notifier != nil {
+		sc.opts.Notifier.Notify(notify.Summary, notify.Message{Subject: "Receipt report " + def.Name, Text: report.Text()})
+	}
+	return key, nil
+}
+
+// post sends the report to a webhook, retrying per the webhook policy
+func (sc *Scheduler) post(ctx context.Context, url string, data []byte) error {
+	return sc.webhooks.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := sc.opts.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 500:
+			return fmt.Errorf("webhook answered %s", resp.Status)
+		case resp.StatusCode >= 300:
+			return resilience.Permanent(fmt.Errorf("webhook answered %s", resp.Status))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,202 @@
+// Package resilience guards calls to outbound integrations, such as the product catalog, with
+// per-attempt timeouts, an overall time budget, retries with jittered backoff and a circuit breaker.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"receipt-processor/metrics"
+)
+
+var (
+	calls        = metrics.NewCounterVec("receipts_outbound_calls_total", "Attempted calls to outbound integrations, by outcome.", "integration", "result")
+	breakerState = metrics.NewGaugeVec("receipts_circuit_breaker_state", "Circuit breaker state of each outbound integration: 0 closed, 1 open, 2 half-open.", "integration")
+)
+
+// Call outcomes counted in receipts_outbound_calls_total
+const (
+	resultSuccess  = "success"
+	resultFailure  = "failure"
+	resultRejected = "rejected"
+)
+
+// Breaker states exposed in receipts_circuit_breaker_state
+const (
+	stateClosed   = 0
+	stateOpen     = 1
+	stateHalfOpen = 2
+)
+
+// ErrOpen is returned without calling the integration while its circuit is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Policy configures how calls to one integration are guarded. Zero values fall back to the defaults given.
+type Policy struct {
+	// Timeout bounds each attempt, 1s by default
+	Timeout time.Duration
+	// Budget bounds every attempt and backoff of a call together; 0 leaves only the caller's deadline
+	Budget time.Duration
+	// Retries is how many times a failed attempt is retried; 0 makes a single attempt
+	Retries int
+	// Backoff is the delay before the first retry, doubled on every attempt with jitter, 100ms by default
+	Backoff time.Duration
+	// FailureThreshold is how many consecutive failed attempts open the circuit, 5 by default
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a trial attempt is let through, 30s by default
+	Cooldown time.Duration
+}
+
+// Caller makes guarded calls to one integration. Its breaker is shared by every call through it.
+type Caller struct {
+	name   string
+	policy Policy
+
+	mu sync.Mutex
+	// failures counts consecutive failed attempts; openUntil is when an open circuit lets a trial through
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// New returns a caller for the integration called name, which labels its metrics and logs
+func New(name string, policy Policy) *Caller {
+	if policy.Timeout <= 0 {
+		policy.Timeout = time.Second
+	}
+	if policy.Retries < 0 {
+		policy.Retries = 0
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = 100 * time.Millisecond
+	}
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = 5
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = 30 * time.Second
+	}
+	breakerState.With(name).Set(stateClosed)
+	return &Caller{name: name, policy: policy}
+}
+
+// permanent marks an error that retrying can't fix
+type permanent struct {
+	err error
+}
+
+func (p *permanent) Error() string { return p.err.Error() }
+func (p *permanent) Unwrap() error { return p.err }
+
+// Permanent wraps an error, such as a rejected request, that should be returned straight away
+// rather than retried. It doesn't count against the integration's health.
+func Permanent(err error) error {
+	return &permanent{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent error, or the retries or time budget run out,
+// returning the last error. fn must respect the deadline of the context it is given.
+func (c *Caller) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	callCtx := ctx
+	if c.policy.Budget > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.policy.Budget)
+		defer cancel()
+	}
+
+	backoff := c.policy.Backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if !c.allow() {
+			calls.With(c.name, resultRejected).Inc()
+			// A retry refused because earlier attempts opened the circuit reports why they failed
+			if err != nil {
+				return err
+			}
+			return ErrOpen
+		}
+		attemptCtx, cancel := context.WithTimeout(callCtx, c.policy.Timeout)
+		err = fn(attemptCtx)
+		cancel()
+
+		var perm *permanent
+		switch {
+		case err == nil:
+			calls.With(c.name, resultSuccess).Inc()
+			c.record(true, true)
+			return nil
+		case errors.As(err, &perm):
+			calls.With(c.name, resultFailure).Inc()
+			c.record(true, false)
+			return perm.err
+		case ctx.Err() != nil:
+			// The caller gave up, which says nothing about the integration's health
+			calls.With(c.name, resultFailure).Inc()
+			c.record(false, false)
+			return err
+		}
+		calls.With(c.name, resultFailure).Inc()
+		c.record(false, true)
+		if attempt >= c.policy.Retries {
+			return err
+		}
+
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-callCtx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// allow reports whether an attempt may be made: always while the circuit is closed, and a single
+// trial attempt once an open circuit has cooled down
+func (c *Caller) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures < c.policy.FailureThreshold {
+		return true
+	}
+	if c.trial || time.Now().Before(c.openUntil) {
+		return false
+	}
+	c.trial = true
+	breakerState.With(c.name).Set(stateHalfOpen)
+	return true
+}
+
+// record closes the circuit after a successful attempt and opens it once failures reach the
+// threshold. Attempts that aren't counted only end a trial.
+func (c *Caller) record(succeeded bool, counted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasOpen := c.failures >= c.policy.FailureThreshold
+	c.trial = false
+	switch {
+	case !counted:
+		if wasOpen {
+			breakerState.With(c.name).Set(stateOpen)
+		}
+	case succeeded:
+		if wasOpen {
+			log.Printf("%s calls resumed", c.name)
+		}
+		c.failures = 0
+		breakerState.With(c.name).Set(stateClosed)
+	default:
+		c.failures++
+		if c.failures >= c.policy.FailureThreshold {
+			if !wasOpen {
+				log.Printf("%s calls suspended for %s after %d consecutive failures", c.name, c.policy.Cooldown, c.failures)
+			}
+			c.openUntil = time.Now().Add(c.policy.Cooldown)
+			breakerState.With(c.name).Set(stateOpen)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package retailers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Postgres keeps the registry in PostgreSQL tables, so every instance sharing the database links
+// receipts to the same retailers
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the registry in db, creating the tables when they don't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS retailers (
+		id       text PRIMARY KEY,
+		retailer jsonb NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating retailers table: %w", err)
+	}
+	// Every normalized name and alias belongs to one retailer
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS retailer_names (
+		name        text PRIMARY KEY,
+		retailer_id text NOT NULL REFERENCES retailers (id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating retailer_names table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS retailer_names_retailer ON retailer_names (retailer_id)`); err != nil {
+		return nil, fmt.Errorf("creating retailer_names retailer index: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+func (p *Postgres) Resolve(name string) (string, bool, error) {
+	var id string
+	err := p.db.QueryRow(`SELECT retailer_id FROM retailer_names WHERE name = $1`, normalize(name)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+func (p *Postgres) Get(id string) (Retailer, error) {
+	var data []byte
+	err := p.db.QueryRow(`SELECT retailer FROM retailers WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Retailer{}, ErrNotFound
+	}
+	if err != nil {
+		return Retailer{}, err
+	}
+	var retailer Retailer
+	err = json.Unmarshal(data, &retailer)
+	return retailer, err
+}
+
+func (p *Postgres) List() ([]Retailer, error) {
+	rows, err := p.db.Query(`SELECT retailer FROM retailers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	retailers := []Retailer{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var retailer Retailer
+		if err := json.Unmarshal(data, &retailer); err != nil {
+			return nil, err
+		}
+		retailers = append(retailers, retailer)
+	}
+	return retailers, rows.Err()
+}
+
+func (p *Postgres) Create(retailer Retailer) error {
+	if err := retailer.Validate(); err != nil {
+		return err
+	}
+	return p.write(retailer, func(tx *sql.Tx) error {
+		data, err := json.Marshal(retailer)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`INSERT INTO retailers (id, retailer) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`,
+			retailer.ID, string(data))
+		if err != nil {
+			return err
+		}
+		inserted, err := result.RowsAffected()
+		if err == nil && inserted == 0 {
+			return ErrConflict
+		}
+		return err
+	})
+}
+
+func (p *Postgres) Update(retailer Retailer) error {
+	if err := retailer.Validate(); err != nil {
+		return err
+	}
+	return p.write(retailer, func(tx *sql.Tx) error {
+		data, err := json.Marshal(retailer)
+		if err != nil {
+			return err
+		}
+		result, err := tx.Exec(`UPDATE retailers SET retailer = $2 WHERE id = $1`, retailer.ID, string(data))
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.Exec(`DELETE FROM retailer_names WHERE retailer_id = $1`, retailer.ID)
+		return err
+	})
+}
+
+func (p *Postgres) Delete(id string) error {
+	result, err := p.db.Exec(`DELETE FROM retailers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// write stores a retailer with store, then indexes its names, or returns ErrConflict when another
+// retailer is known under one of them. Writes are serialized by a lock held until commit.
+func (p *Postgres) write(retailer Retailer, store func(tx *sql.Tx) error) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('retailers'))`); err != nil {
+		return err
+	}
+	if err := store(tx); err != nil {
+		return err
+	}
+	for _, name := range retailer.names() {
+		// A name already taken is returned with the retailer that owns it, left unchanged
+		var owner string
+		err := tx.QueryRow(`INSERT INTO retailer_names (name, retailer_id) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING retailer_id`, name, retailer.ID).Scan(&owner)
+		if err != nil {
+			return err
+		}
+		if owner != retailer.ID {
+			return ErrConflict
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,280 @@
+// Package retailers keeps the registry of known retailers and links receipts to them.
+//
+// Receipts name retailers however the point-of-sale system prints them ("TARGET #1042",
+// "Target"), so the registry maps canonical names and aliases to a stable retailer ID.
+package retailers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"receipt-processor/validation"
+)
+
+var (
+	// ErrNotFound is returned when no retailer is registered under an ID
+	ErrNotFound = errors.New("retailer not found")
+	// ErrConflict is returned when a retailer's ID, name or alias is already used by another retailer
+	ErrConflict = errors.New("retailer conflicts with an existing retailer")
+)
+
+// Retailer is a known retailer
+type Retailer struct {
+	// ID is the stable identifier receipts are linked to, e.g. "target"
+	ID string `json:"id"`
+	// Name is the canonical display name
+	Name string `json:"name"`
+	// Aliases are other names the retailer appears under on receipts
+	Aliases []string `json:"aliases,omitempty"`
+	// Categories classify the retailer, e.g. "grocery"
+	Categories []string `json:"categories,omitempty"`
+}
+
+// Validate reports the first field of the retailer that is malformed
+func (r Retailer) Validate() error {
+	if normalize(r.Name) == "" {
+		return fmt.Errorf("name must contain letters or digits")
+	}
+	if !validation.Category(r.ID) {
+		return fmt.Errorf("id must be lowercase letters, digits and dashes")
+	}
+	for _, alias := range r.Aliases {
+		if normalize(alias) == "" {
+			return fmt.Errorf("aliases must contain letters or digits")
+		}
+	}
+	for _, category := range r.Categories {
+		if !validation.Category(category) {
+			return fmt.Errorf("category %q must be lowercase letters, digits and dashes", category)
+		}
+	}
+	return nil
+}
+
+// Slug derives a retailer ID from a name, e.g. "M&M Corner Market" becomes "m-m-corner-market"
+func Slug(name string) string {
+	return strings.ReplaceAll(normalize(name), " ", "-")
+}
+
+// names returns the normalized name and aliases a retailer is known under
+func (r Retailer) names() []string {
+	keys := []string{normalize(r.Name)}
+	for _, alias := range r.Aliases {
+		keys = append(keys, normalize(alias))
+	}
+	return keys
+}
+
+// Store keeps the registry: a Registry in memory or a file for a single instance, or Postgres shared
+// by every instance
+type Store interface {
+	// Resolve returns the ID of the retailer known under name, ignoring case and punctuation
+	Resolve(name string) (string, bool, error)
+	// Get returns the retailer registered under id, or ErrNotFound
+	Get(id string) (Retailer, error)
+	// List returns every retailer ordered by ID
+	List() ([]Retailer, error)
+	// Create registers a new retailer, or returns ErrConflict when its ID, name or an alias is taken
+	Create(retailer Retailer) error
+	// Update replaces a registered retailer, or returns ErrNotFound
+	Update(retailer Retailer) error
+	// Delete removes a registered retailer, or returns ErrNotFound
+	Delete(id string) error
+}
+
+// Registry holds the known retailers, optionally persisted to a JSON file
+type Registry struct {
+	path string
+
+	mu        sync.RWMutex
+	retailers map[string]Retailer
+	// names maps every normalized name and alias to its retailer's ID
+	names map[string]string
+}
+
+// Open loads the registry persisted at path, creating it on first change. An empty path keeps the registry in memory.
+func Open(path string) (*Registry, error) {
+	reg := &Registry{path: path, retailers: make(map[string]Retailer), names: make(map[string]string)}
+	if path == "" {
+		return reg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var retailers []Retailer
+	if err := json.Unmarshal(data, &retailers); err != nil {
+		return nil, fmt.Errorf("parsing retailer registry %s: %w", path, err)
+	}
+	for _, retailer := range retailers {
+		if err := retailer.Validate(); err != nil {
+			return nil, fmt.Errorf("retailer %q: %w", retailer.ID, err)
+		}
+		if err := reg.add(retailer); err != nil {
+			return nil, fmt.Errorf("retailer %q: %w", retailer.ID, err)
+		}
+	}
+	return reg, nil
+}
+
+// Resolve returns the ID of the retailer known under name, ignoring case and punctuation
+func (reg *Registry) Resolve(name string) (string, bool, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	id, ok := reg.names[normalize(name)]
+	return id, ok, nil
+}
+
+// Get returns the retailer registered under id, or ErrNotFound
+func (reg *Registry) Get(id string) (Retailer, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	retailer, ok := reg.retailers[id]
+	if !ok {
+		return Retailer{}, ErrNotFound
+	}
+	return retailer, nil
+}
+
+// List returns every retailer ordered by ID
+func (reg *Registry) List() ([]Retailer, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.sorted(), nil
+}
+
+// Create registers a new retailer, or returns ErrConflict when its ID, name or an alias is taken
+func (reg *Registry) Create(retailer Retailer) error {
+	if err := retailer.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, exists := reg.retailers[retailer.ID]; exists {
+		return ErrConflict
+	}
+	if err := reg.add(retailer); err != nil {
+		return err
+	}
+	return reg.persist(func() { reg.remove(retailer.ID) })
+}
+
+// Update replaces a registered retailer, or returns ErrNotFound
+func (reg *Registry) Update(retailer Retailer) error {
+	if err := retailer.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	previous, exists := reg.retailers[retailer.ID]
+	if !exists {
+		return ErrNotFound
+	}
+	reg.remove(retailer.ID)
+	if err := reg.add(retailer); err != nil {
+		reg.add(previous)
+		return err
+	}
+	return reg.persist(func() { reg.remove(retailer.ID); reg.add(previous) })
+}
+
+// Delete removes a registered retailer, or returns ErrNotFound
+func (reg *Registry) Delete(id string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	previous, exists := reg.retailers[id]
+	if !exists {
+		return ErrNotFound
+	}
+	reg.remove(id)
+	return reg.persist(func() { reg.add(previous) })
+}
+
+// add indexes a retailer; the caller holds mu for writing
+func (reg *Registry) add(retailer Retailer) error {
+	if _, exists := reg.retailers[retailer.ID]; exists {
+		return ErrConflict
+	}
+	keys := retailer.names()
+	for _, key := range keys {
+		if owner, taken := reg.names[key]; taken && owner != retailer.ID {
+			return ErrConflict
+		}
+	}
+	reg.retailers[retailer.ID] = retailer
+	for _, key := range keys {
+		reg.names[key] = retailer.ID
+	}
+	return nil
+}
+
+// remove drops a retailer and its names; the caller holds mu for writing
+func (reg *Registry) remove(id string) {
+	delete(reg.retailers, id)
+	for key, owner := range reg.names {
+		if owner == id {
+			delete(reg.names, key)
+		}
+	}
+}
+
+func (reg *Registry) sorted() []Retailer {
+	retailers := make([]Retailer, 0, len(reg.retailers))
+	for _, retailer := range reg.retailers {
+		retailers = append(retailers, retailer)
+	}
+	sort.Slice(retailers, func(i, j int) bool { return retailers[i].ID < retailers[j].ID })
+	return retailers
+}
+
+// persist writes the registry to its file, calling undo to roll the change back when that fails;
+// the caller holds mu for writing
+func (reg *Registry) persist(undo func()) error {
+	if reg.path == "" {
+		return nil
+	}
+	err := writeFile(reg.path, reg.sorted())
+	if err != nil {
+		undo()
+	}
+	return err
+}
+
+// writeFile replaces the file through a temporary file so a crash never leaves it half written
+func writeFile(path string, retailers []Retailer) error {
+	data, err := json.MarshalIndent(retailers, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".retailers-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// normalize lowercases s and reduces every run of other characters than letters and digits to one space
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,162 @@
+// Package retention purges receipts once they are older than the configured age, or have been in
+// the trash longer than the configured time.
+package retention
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"receipt-processor/blob"
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+	"receipt-processor/store"
+)
+
+var (
+	purgedReceipts   = metrics.NewCounter("receipts_retention_purged_total", "Receipts deleted by the retention sweeper.")
+	archivedReceipts = metrics.NewCounter("receipts_retention_archived_total", "Receipts archived by the retention sweeper before deletion.")
+	sweepFailures    = metrics.NewCounter("receipts_retention_sweep_failures_total", "Retention sweeps that stopped on an error.")
+)
+
+// archivePrefix starts the keys of the archives sweeps write
+const archivePrefix = "retention/"
+
+// Options configures a Sweeper
+type Options struct {
+	// MaxAge is how long after processing a receipt is kept; 0 keeps receipts outside the trash forever
+	MaxAge time.Duration
+	// TrashMaxAge is how long a receipt stays in the trash before it is purged; 0 keeps it there forever
+	TrashMaxAge time.Duration
+	// Interval is the time between background sweeps, one hour by default
+	Interval time.Duration
+	// Archive receives the purged receipts before they are deleted; nil deletes without archiving
+	Archive blob.Store
+	// Leader, when set, limits background sweeps to the instance holding it, so instances sharing a
+	// store don't sweep it at the same time; on-demand sweeps always run
+	Leader interface{ Held() bool }
+	// Clock tells how old receipts are, the system clock by default
+	Clock clock.Clock
+}
+
+// Result describes a completed sweep
+type Result struct {
+	Purged   int    `json:"purged"`
+	Archived int    `json:"archived"`
+	Archive  string `json:"archive,omitempty"`
+}
+
+// Sweeper deletes, and optionally archives, receipts older than the retention age or kept in the
+// trash too long
+type Sweeper struct {
+	store store.Store
+	opts  Options
+	// mu keeps background and on-demand sweeps from running at the same time
+	mu sync.Mutex
+}
+
+func NewSweeper(s store.Store, opts Options) *Sweeper {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	return &Sweeper{store: s, opts: opts}
+}
+
+// Sweep purges every receipt processed more than MaxAge ago or moved to the trash more than
+// TrashMaxAge ago
+func (sw *Sweeper) Sweep() (Result, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	records, err := sw.store.List()
+	if err != nil {
+		sweepFailures.Inc()
+		return Result{}, err
+	}
+	now := sw.opts.Clock.Now()
+	var expired []store.Record
+	for _, record := range records {
+		if sw.expired(record, now) {
+			expired = append(expired, record)
+		}
+	}
+	if len(expired) == 0 {
+		return Result{}, nil
+	}
+
+	// Archive everything before deleting anything, so a failed upload loses nothing
+	var result Result
+	if sw.opts.Archive != nil {
+		var buf bytes.Buffer
+		if err := store.WriteRecords(&buf, expired); err != nil {
+			sweepFailures.Inc()
+			return Result{}, err
+		}
+		key := archivePrefix + "receipts-" + now.UTC().Format("20060102T150405.000Z") + ".jsonl.gz"
+		if err := sw.opts.Archive.Put(key, &buf); err != nil {
+			sweepFailures.Inc()
+			return Result{}, err
+		}
+		result.Archived = len(expired)
+		result.Archive = key
+		archivedReceipts.Add(float64(len(expired)))
+	}
+
+	for _, record := range expired {
+		if err := sw.store.Delete(record.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			sweepFailures.Inc()
+			purgedReceipts.Add(float64(result.Purged))
+			return result, err
+		}
+		result.Purged++
+	}
+	purgedReceipts.Add(float64(result.Purged))
+	return result, nil
+}
+
+// Erase rewrites the archives of purged receipts without the records erase matches, so erased
+// receipts don't survive in them, and returns how many it removed
+func (sw *Sweeper) Erase(erase func(store.Record) bool) (int, error) {
+	if sw.opts.Archive == nil {
+		return 0, nil
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return store.EraseRecords(sw.opts.Archive, archivePrefix, erase)
+}
+
+// expired reports whether a record is due to be purged
+func (sw *Sweeper) expired(record store.Record, now time.Time) bool {
+	if sw.opts.MaxAge > 0 && record.CreatedAt.Before(now.Add(-sw.opts.MaxAge)) {
+		return true
+	}
+	return sw.opts.TrashMaxAge > 0 && record.Deleted() && record.DeletedAt.Before(now.Add(-sw.opts.TrashMaxAge))
+}
+
+// Run sweeps every Interval until ctx is cancelled
+func (sw *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(sw.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if sw.opts.Leader != nil && !sw.opts.Leader.Held() {
+				continue
+			}
+			result, err := sw.Sweep()
+			if err != nil {
+				log.Printf("retention sweep failed after purging %d receipts: %v", result.Purged, err)
+			} else if result.Purged > 0 {
+				log.Printf("retention sweep purged %d receipts", result.Purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package scoring_test
+
+import (
+	"fmt"
+	"testing"
+
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+)
+
+func benchmarkReceipt(itemCount int) receipt.Receipt {
+	r := receipt.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-21",
+		PurchaseTime: "15:33",
+		Total:        "9.00",
+	}
+	for i := 0; i < itemCount; i++ {
+		r.Items = append(r.Items, receipt.Item{ShortDescription: "Emils Cheese Pizza", Price: "12.25"})
+	}
+	return r
+}
+
+func BenchmarkCalculatePoints(b *testing.B) {
+	engine := scoring.NewEngine(scoring.DefaultRuleSet)
+	for _, size := range []struct {
+		name      string
+		itemCount int
+	}{
+		{"small", 2},
+		{"medium", 25},
+		{"large", 1000},
+	} {
+		r := benchmarkReceipt(size.itemCount)
+		b.Run(fmt.Sprintf("%s/items=%d", size.name, size.itemCount), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				engine.CalculatePoints(r)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package scoring_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+)
+
+func FuzzCalculatePoints(f *testing.F) {
+	// Seed from the fixtures, using each receipt's first item as the repeated item
+	fixtures, err := filepath.Glob(filepath.Join(fixturesDir, "*.json"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			f.Fatal(err)
+		}
+		var r receipt.Receipt
+		if err := json.Unmarshal(data, &r); err != nil {
+			f.Fatal(err)
+		}
+		item := receipt.Item{}
+		if len(r.Items) > 0 {
+			item = r.Items[0]
+		}
+		f.Add(r.Retailer, r.PurchaseDate, r.PurchaseTime, item.ShortDescription, item.Price, r.Total, uint16(len(r.Items)))
+	}
+
+	// Extreme amounts, exotic Unicode and the largest item count
+	f.Add("Target", "2022-01-01", "15:01", "abc", "99999999999999999999999999.99", "99999999999999999999999999.00", uint16(1))
+	f.Add("Café Ünïcødé 店", "2022-01-01", "15:01", "Ǆǅǆ", "1.00", "1.00", uint16(3))
+	f.Add("Target", "2022-01-01", "15:01", "abc", "100.00", "100.00", uint16(65535))
+
+	f.Fuzz(func(t *testing.T, retailer, purchaseDate, purchaseTime, description, price, total string, itemCount uint16) {
+		r := receipt.Receipt{
+			Retailer:     retailer,
+			PurchaseDate: purchaseDate,
+			PurchaseTime: purchaseTime,
+			Total:        total,
+			Items:        make([]receipt.Item, itemCount),
+		}
+		for i := range r.Items {
+			r.Items[i] = receipt.Item{ShortDescription: description, Price: price}
+		}
+
+		// Scoring must never panic, even for receipts that fail validation
+		breakdown := scoring.Breakdown(r, scoring.DefaultRuleSet)
+		if !receipt.Validate(r) {
+			return
+		}
+
+		// Every rule awards a non-negative amount for a valid receipt, so the total can't overflow negative
+		for _, result := range breakdown {
+			if result.Points < 0 {
+				t.Fatalf("rule %s awarded %d points", result.Rule, result.Points)
+			}
+		}
+		if points := scoring.Total(breakdown); points < 0 {
+			t.Fatalf("total points %d overflowed", points)
+		}
+
+		// Item points never fall below the pair bonus, which catches sums that wrapped around
+		pairPoints := int(itemCount) / 2 * scoring.DefaultRuleSet.ItemPairPoints
+		for _, result := range breakdown {
+			if result.Rule == "itemCountAndDescription" && result.Points < pairPoints {
+				t.Fatalf("item points %d below the %d pair bonus", result.Points, pairPoints)
+			}
+		}
+	})
+}
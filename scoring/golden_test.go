@@ -0,0 +1,112 @@
+package scoring_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+)
+
+// Regenerate the goldens with: go test ./scoring -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files from the current scoring results")
+
+const (
+	fixturesDir = "../testdata/receipts"
+	goldenDir   = "../testdata/golden"
+)
+
+// golden is the expected outcome of validating and scoring a fixture
+type golden struct {
+	Valid     bool                 `json:"valid"`
+	Points    int                  `json:"points"`
+	Breakdown []scoring.RuleResult `json:"breakdown,omitempty"`
+}
+
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join(fixturesDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("no fixtures found in %s", fixturesDir)
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r receipt.Receipt
+			if err := json.Unmarshal(data, &r); err != nil {
+				t.Fatalf("decoding fixture: %v", err)
+			}
+
+			var got golden
+			if receipt.Validate(r) {
+				got.Valid = true
+				got.Breakdown = scoring.Breakdown(r, scoring.DefaultRuleSet)
+				got.Points = scoring.Total(got.Breakdown)
+			}
+
+			goldenPath := filepath.Join(goldenDir, name+".json")
+			if *update {
+				writeGolden(t, goldenPath, got)
+				return
+			}
+
+			data, err = os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("reading golden (run with -update to create it): %v", err)
+			}
+			var want golden
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("decoding golden: %v", err)
+			}
+			if got.Valid != want.Valid {
+				t.Fatalf("valid = %v, want %v", got.Valid, want.Valid)
+			}
+			if got.Points != want.Points {
+				t.Errorf("points = %d, want %d", got.Points, want.Points)
+			}
+			if !equalBreakdowns(got.Breakdown, want.Breakdown) {
+				t.Errorf("breakdown = %v, want %v", got.Breakdown, want.Breakdown)
+			}
+		})
+	}
+}
+
+func writeGolden(t *testing.T, path string, g golden) {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(g); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equalBreakdowns(a, b []scoring.RuleResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package scoring
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// RulePolicy changes how a rule's points combine with those of the other rules
+type RulePolicy struct {
+	// Priority orders the rules, lowest first; rules of the same priority keep their registration order
+	Priority int `json:"priority,omitempty"`
+	// Cap is the most points the rule awards a receipt; 0 leaves it uncapped
+	Cap int `json:"cap,omitempty"`
+	// Exclusive names a group of rules of which only the one awarding the most points applies, the
+	// first in order on a tie; the others award nothing
+	Exclusive string `json:"exclusive,omitempty"`
+}
+
+func (rs RuleSet) validatePolicies() error {
+	for name, policy := range rs.Policies {
+		if !IsRule(name) {
+			return fmt.Errorf("policy for unknown rule %q", name)
+		}
+		if policy.Cap < 0 {
+			return fmt.Errorf("rule %q cap must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// orderedRules returns the rules in the order the rule-set's priorities apply them
+func (rs RuleSet) orderedRules() []rule {
+	if len(rs.Policies) == 0 {
+		return rules
+	}
+	ordered := slices.Clone(rules)
+	slices.SortStableFunc(ordered, func(a, b rule) int {
+		return cmp.Compare(rs.Policies[a.name].Priority, rs.Policies[b.name].Priority)
+	})
+	return ordered
+}
+
+// applyPolicies caps the points of each rule in the breakdown, then leaves only the highest of
+// each exclusive group
+func (rs RuleSet) applyPolicies(breakdown []RuleResult) {
+	if len(rs.Policies) == 0 {
+		return
+	}
+	for i, result := range breakdown {
+		if limit := rs.Policies[result.Rule].Cap; limit > 0 && result.Points > limit {
+			breakdown[i].Points, breakdown[i].Capped = limit, true
+		}
+	}
+	winners := make(map[string]int)
+	for i, result := range breakdown {
+		group := rs.Policies[result.Rule].Exclusive
+		if group == "" {
+			continue
+		}
+		if winner, ok := winners[group]; !ok || result.Points > breakdown[winner].Points {
+			winners[group] = i
+		}
+	}
+	for i, result := range breakdown {
+		if group := rs.Policies[result.Rule].Exclusive; group != "" && winners[group] != i {
+			breakdown[i].Points, breakdown[i].Excluded = 0, true
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package scoring_test
+
+import (
+	"testing"
+
+	"receipt-processor/receipt"
+	"receipt-processor/scoring"
+)
+
+// policyReceipt earns 6 retailer points, 75 total points, 5 item points and 6 purchase date points
+var policyReceipt = receipt.Receipt{
+	Retailer:     "Target",
+	PurchaseDate: "2022-01-01",
+	PurchaseTime: "13:01",
+	Items: []receipt.Item{
+		{ShortDescription: "Mountain Dew 12PK", Price: "5.00"},
+		{ShortDescription: "Pizza", Price: "5.00"},
+	},
+	Total: "10.00",
+}
+
+func TestRulePolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies map[string]scoring.RulePolicy
+		want     []scoring.RuleResult
+	}{
+		{
+			name: "no policies",
+			want: []scoring.RuleResult{
+				{Rule: "retailer", Points: 6},
+				{Rule: "total", Points: 75},
+				{Rule: "itemCountAndDescription", Points: 5},
+				{Rule: "purchaseDate", Points: 6},
+			},
+		},
+		{
+			name: "priority reorders rules and keeps ties in registration order",
+			policies: map[string]scoring.RulePolicy{
+				"purchaseDate": {Priority: -1},
+				"retailer":     {Priority: 1},
+			},
+			want: []scoring.RuleResult{
+				{Rule: "purchaseDate", Points: 6},
+				{Rule: "total", Points: 75},
+				{Rule: "itemCountAndDescription", Points: 5},
+				{Rule: "retailer", Points: 6},
+			},
+		},
+		{
+			name: "cap cuts only rules above it",
+			policies: map[string]scoring.RulePolicy{
+				"total":    {Cap: 30},
+				"retailer": {Cap: 10},
+			},
+			want: []scoring.RuleResult{
+				{Rule: "retailer", Points: 6},
+				{Rule: "total", Points: 30, Capped: true},
+				{Rule: "itemCountAndDescription", Points: 5},
+				{Rule: "purchaseDate", Points: 6},
+			},
+		},
+		{
+			name: "exclusive group keeps the highest",
+			policies: map[string]scoring.RulePolicy{
+				"retailer":                {Exclusive: "bonus"},
+				"itemCountAndDescription": {Exclusive: "bonus"},
+				"purchaseDate":            {Exclusive: "bonus"},
+			},
+			want: []scoring.RuleResult{
+				{Rule: "retailer", Points: 6},
+				{Rule: "total", Points: 75},
+				{Rule: "itemCountAndDescription", Points: 0, Excluded: true},
+				{Rule: "purchaseDate", Points: 0, Excluded: true},
+			},
+		},
+		{
+			name: "exclusive tie goes to the first in priority order",
+			policies: map[string]scoring.RulePolicy{
+				"retailer":     {Exclusive: "bonus"},
+				"purchaseDate": {Exclusive: "bonus", Priority: -1},
+			},
+			want: []scoring.RuleResult{
+				{Rule: "purchaseDate", Points: 6},
+				{Rule: "retailer", Points: 0, Excluded: true},
+				{Rule: "total", Points: 75},
+				{Rule: "itemCountAndDescription", Points: 5},
+			},
+		},
+		{
+			name: "exclusive groups compare capped points",
+			policies: map[string]scoring.RulePolicy{
+				"total":                   {Exclusive: "big", Cap: 4},
+				"itemCountAndDescription": {Exclusive: "big"},
+			},
+			want: []scoring.RuleResult{
+				{Rule: "retailer", Points: 6},
+				{Rule: "total", Points: 0, Capped: true, Excluded: true},
+				{Rule: "itemCountAndDescription", Points: 5},
+				{Rule: "purchaseDate", Points: 6},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := scoring.DefaultRuleSet.Clone()
+			rs.Policies = tt.policies
+			if err := rs.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			got := scoring.Breakdown(policyReceipt, rs)
+			// The other built-in rules award nothing for this receipt, so only those that do are compared
+			var earned []scoring.RuleResult
+			for _, result := range got {
+				if result.Points != 0 || result.Capped || result.Excluded {
+					earned = append(earned, result)
+				}
+			}
+			var want []scoring.RuleResult
+			for _, result := range tt.want {
+				if result.Points != 0 || result.Capped || result.Excluded {
+					want = append(want, result)
+				}
+			}
+			if !equalBreakdowns(earned, want) {
+				t.Errorf("breakdown = %v, want %v", earned, want)
+			}
+		})
+	}
+}
+
+func TestRulePolicyValidation(t *testing.T) {
+	for name, policies := range map[string]map[string]scoring.RulePolicy{
+		"unknown rule": {"nope": {Cap: 1}},
+		"negative cap": {"total": {Cap: -1}},
+	} {
+		rs := scoring.DefaultRuleSet.Clone()
+		rs.Policies = policies
+		if rs.Validate() == nil {
+			t.Errorf("%s: Validate() = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Rounding is how a rule turns a fractional amount of points into whole points
+type Rounding string
+
+const (
+	// RoundCeil rounds up, so any fraction earns a point
+	RoundCeil Rounding = "ceil"
+	// RoundFloor rounds down, so only whole points are earned
+	RoundFloor Rounding = "floor"
+	// RoundBankers rounds to the nearest point, and halves to the nearest even point
+	RoundBankers Rounding = "bankers"
+)
+
+// maxAmountPoints bounds the points derived from a single amount so huge prices can't overflow int
+const maxAmountPoints = 1 << 40
+
+func (mode Rounding) valid() bool {
+	switch mode {
+	case "", RoundCeil, RoundFloor, RoundBankers:
+		return true
+	}
+	return false
+}
+
+// MultiplyAmount returns amount times multiplier rounded to whole points. The product is computed
+// exactly in decimal, so "1.00" at 0.2 is exactly 0.2 and never rounds on float error; an empty
+// mode rounds up. Amounts that aren't plain decimal numbers earn nothing, and products too large
+// for an int are clamped.
+func MultiplyAmount(amount string, multiplier float64, mode Rounding) int {
+	value, ok := decimal(amount)
+	if !ok || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+		return 0
+	}
+	// The shortest decimal that reads back as the multiplier is the one the rule-set was written with
+	factor, ok := new(big.Rat).SetString(strconv.FormatFloat(multiplier, 'f', -1, 64))
+	if !ok {
+		return 0
+	}
+	product := value.Mul(value, factor)
+	if product.Sign() <= 0 {
+		return 0
+	}
+
+	// Split the product into whole points and the remaining fraction of a point
+	quotient, remainder := new(big.Int).DivMod(product.Num(), product.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		switch mode {
+		case RoundFloor:
+		case RoundBankers:
+			// Compare the fraction with a half by comparing twice the remainder with the denominator
+			half := new(big.Int).Lsh(remainder, 1).Cmp(product.Denom())
+			if half > 0 || half == 0 && quotient.Bit(0) == 1 {
+				quotient.Add(quotient, big.NewInt(1))
+			}
+		default:
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	if !quotient.IsInt64() || quotient.Int64() > maxAmountPoints {
+		return maxAmountPoints
+	}
+	return int(quotient.Int64())
+}
+
+// decimal parses a plain decimal number such as "12.25", without a sign or exponent
+func decimal(s string) (*big.Rat, bool) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole+fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// validateRounding reports a rounding mode or multiplier a rule can't apply
+func validateRounding(name string, mode Rounding, multiplier float64) error {
+	if !mode.valid() {
+		return fmt.Errorf("unknown %s rounding %q, must be ceil, floor or bankers", name, mode)
+	}
+	if multiplier < 0 || math.IsInf(multiplier, 0) || math.IsNaN(multiplier) {
+		return fmt.Errorf("%s multiplier must be a non-negative number", name)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package scoring_test
+
+import (
+	"math"
+	"testing"
+
+	"receipt-processor/scoring"
+)
+
+func TestMultiplyAmount(t *testing.T) {
+	tests := []struct {
+		amount     string
+		multiplier float64
+		mode       scoring.Rounding
+		want       int
+	}{
+		// 1.00 at 0.2 is exactly a fifth of a point, not the float product 0.2000000000000000111
+		{"1.00", 0.2, scoring.RoundCeil, 1},
+		{"1.00", 0.2, scoring.RoundFloor, 0},
+		{"1.00", 0.2, scoring.RoundBankers, 0},
+		// 50.00 at 1.1 is 55.00000000000001 in floating point, which would round up to 56
+		{"50.00", 1.1, scoring.RoundCeil, 55},
+		{"50.00", 1.1, scoring.RoundFloor, 55},
+		{"50.00", 1.1, scoring.RoundBankers, 55},
+		{"4.00", 1, scoring.RoundCeil, 4},
+		{"4.00", 1, scoring.RoundFloor, 4},
+		{"4.00", 1, scoring.RoundBankers, 4},
+		{"2.01", 1, scoring.RoundCeil, 3},
+		{"2.99", 1, scoring.RoundFloor, 2},
+		// Exact halves go up with ceil, down with floor and to the even neighbour with bankers
+		{"2.50", 1, scoring.RoundCeil, 3},
+		{"2.50", 1, scoring.RoundFloor, 2},
+		{"2.50", 1, scoring.RoundBankers, 2},
+		{"3.50", 1, scoring.RoundBankers, 4},
+		{"0.50", 1, scoring.RoundBankers, 0},
+		{"1.25", 2, scoring.RoundBankers, 2},
+		{"1.75", 2, scoring.RoundBankers, 4},
+		{"2.49", 1, scoring.RoundBankers, 2},
+		{"2.51", 1, scoring.RoundBankers, 3},
+		// An empty mode rounds up
+		{"1.00", 0.2, "", 1},
+		{"1.00", 0, scoring.RoundCeil, 0},
+		{"1.00", math.NaN(), scoring.RoundCeil, 0},
+		{"-1.00", 1, scoring.RoundCeil, 0},
+		{"1e3", 1, scoring.RoundCeil, 0},
+		{"", 1, scoring.RoundCeil, 0},
+		{"99999999999999999999", 1, scoring.RoundFloor, 1 << 40},
+	}
+	for _, tt := range tests {
+		if got := scoring.MultiplyAmount(tt.amount, tt.multiplier, tt.mode); got != tt.want {
+			t.Errorf("MultiplyAmount(%q, %v, %q) = %d, want %d", tt.amount, tt.multiplier, tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package scoring
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"receipt-processor/receipt"
+	"receipt-processor/validation"
+)
+
+func pointsForRetailer(r receipt.Receipt, rules RuleSet) int {
+	// return count of alphanumeric characters
+	return rules.RetailerCharacterPoints * len(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, r.Retailer))
+}
+
+func pointsForTotal(r receipt.Receipt, rules RuleSet) int {
+	amount := r.Total
+	if rules.ScoreSubtotal && r.Subtotal != "" {
+		amount = r.Subtotal
+	}
+	totalAmount, err := strconv.ParseFloat(amount, 64)
+	// Totals too large to count in cents can't be checked for round amounts
+	if err != nil || totalAmount*100 >= math.MaxInt64 {
+		return 0
+	}
+
+	points := 0
+	totalAmountInCents := int(totalAmount * 100)
+
+	// 50 points if the total is a round dollar amount with no cents.
+	if totalAmountInCents%100 == 0 {
+		points += rules.RoundDollarPoints
+	}
+
+	// 25 points if the total is a multiple of 0.25
+	if totalAmountInCents%25 == 0 {
+		points += rules.QuarterMultiplePoints
+	}
+
+	return points
+}
+
+func pointsForItemCountAndDescription(r receipt.Receipt, rules RuleSet) int {
+	points := 0
+	// 5 points for every two items on the receipt.
+	points += (len(r.Items) / 2) * rules.ItemPairPoints
+
+	// If the trimmed length of the item description is a multiple of 3, calculate points.
+	for _, item := range r.Items {
+		trimmedDescription := strings.TrimSpace(item.ShortDescription)
+		if len(trimmedDescription)%3 == 0 {
+			points += MultiplyAmount(item.Price, rules.DescriptionPriceMultiplier, rules.DescriptionRounding)
+		}
+	}
+	return points
+}
+
+func pointsForDate(r receipt.Receipt, rules RuleSet) int {
+	date, err := time.Parse(validation.DateLayout, r.PurchaseDate)
+
+	// 6 points if the date is odd
+	if err == nil && date.Day()%2 != 0 {
+		return rules.OddDayPoints
+	}
+	return 0
+}
+
+func pointsForTime(r receipt.Receipt, rules RuleSet) int {
+	purchaseTime, err := time.Parse(validation.TimeLayout, r.PurchaseTime)
+
+	// 10 points if the purchase is between 2:00pm and before 4:00pm non-inclusive
+	if err == nil && purchaseTime.Hour() > 14 && purchaseTime.Hour() < 16 {
+		return rules.AfternoonPoints
+	}
+	return 0
+}
+
+func pointsForCategories(r receipt.Receipt, rules RuleSet) int {
+	// award the category bonus for every item in a category that has one
+	points := 0
+	for _, item := range r.Items {
+		points += rules.CategoryBonuses[item.Category]
+	}
+	return points
+}
+
+func pointsForQuantity(r receipt.Receipt, rules RuleSet) int {
+	if rules.UnitPoints == 0 {
+		return 0
+	}
+	// award points for every whole unit, so 2.5 kg counts as 2
+	units := 0
+	for _, item := range r.Items {
+		if item.Quantity == "" {
+			units++
+			continue
+		}
+		whole, _, _ := strings.Cut(item.Quantity, ".")
+		count, _ := strconv.Atoi(whole)
+		units += count
+	}
+	return rules.UnitPoints * units
+}
+
+func pointsForRetailerBonus(r receipt.Receipt, rules RuleSet) int {
+	// award the bonus of the registered retailer the receipt was linked to
+	if r.RetailerID == "" {
+		return 0
+	}
+	return rules.RetailerBonuses[r.RetailerID]
+}
+
+func pointsForReturns(r receipt.Receipt, rules RuleSet) int {
+	// take the penalty for every returned item, which has a negative price
+	returned := 0
+	for _, item := range r.Items {
+		if strings.HasPrefix(item.Price, "-") {
+			returned++
+		}
+	}
+	return -rules.ReturnPenalty * returned
+}
@@ -0,0 +1,413 @@
+// Package scoring calculates loyalty points for receipts.
+package scoring
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"receipt-processor/receipt"
+)
+
+// RuleResult is the number of points a single scoring rule awarded
+type RuleResult struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+	// Capped reports that the rule's policy cut its points to its cap
+	Capped bool `json:"capped,omitempty"`
+	// Excluded reports that another rule of its exclusive group awarded more, so it awarded nothing
+	Excluded bool `json:"excluded,omitempty"`
+}
+
+type rule struct {
+	name   string
+	points func(receipt.Receipt, RuleSet) int
+}
+
+// rules lists every rule in the order it is applied. Custom rules are appended by RegisterRule.
+var rules = []rule{
+	{name: "retailer", points: pointsForRetailer},
+	{name: "total", points: pointsForTotal},
+	{name: "itemCountAndDescription", points: pointsForItemCountAndDescription},
+	{name: "purchaseDate", points: pointsForDate},
+	{name: "purchaseTime", points: pointsForTime},
+	{name: "category", points: pointsForCategories},
+	{name: "quantity", points: pointsForQuantity},
+	{name: "retailerBonus", points: pointsForRetailerBonus},
+	{name: "returns", points: pointsForReturns},
+}
+
+// RuleSet holds the tunable values used by the scoring rules
+type RuleSet struct {
+	RetailerCharacterPoints    int     `json:"retailerCharacterPoints"`
+	RoundDollarPoints          int     `json:"roundDollarPoints"`
+	QuarterMultiplePoints      int     `json:"quarterMultiplePoints"`
+	ItemPairPoints             int     `json:"itemPairPoints"`
+	DescriptionPriceMultiplier float64 `json:"descriptionPriceMultiplier"`
+	// DescriptionRounding rounds the description rule's points: ceil (the default), floor or bankers
+	DescriptionRounding Rounding `json:"descriptionRounding,omitempty"`
+	OddDayPoints        int      `json:"oddDayPoints"`
+	AfternoonPoints     int      `json:"afternoonPoints"`
+	// CategoryBonuses awards extra points for every item in a category, e.g. {"produce": 10}
+	CategoryBonuses map[string]int `json:"categoryBonuses,omitempty"`
+	// RetailerBonuses awards extra points for receipts linked to a registered retailer, keyed by retailer ID
+	RetailerBonuses map[string]int `json:"retailerBonuses,omitempty"`
+	// ScoreSubtotal applies the total rule to the subtotal before discounts and tax, when the receipt has one
+	ScoreSubtotal bool `json:"scoreSubtotal"`
+	// UnitPoints awards points for every whole unit bought; items without a quantity count as one unit
+	UnitPoints int `json:"unitPoints"`
+	// TierMultipliers multiply the points of receipts from users in a loyalty tier, keyed by tier name,
+	// e.g. {"gold": 1.5}; the extra points are rounded down
+	TierMultipliers map[string]float64 `json:"tierMultipliers,omitempty"`
+	// StreakBonuses awards the bonus of the longest streak reached, keyed by its length in days, to the
+	// receipt extending a user's streak of consecutive days with an approved receipt, e.g. {"3": 10, "7": 50}
+	StreakBonuses map[int]int `json:"streakBonuses,omitempty"`
+	// ReturnPenalty is taken for every returned item, one with a negative price
+	ReturnPenalty int `json:"returnPenalty,omitempty"`
+	// FlaggedPenalty is taken from receipts flagged by the fraud checks or the purchase date window
+	FlaggedPenalty int `json:"flaggedPenalty,omitempty"`
+	// MaxPoints caps the points of a receipt, bonuses included; 0 leaves them uncapped
+	MaxPoints int `json:"maxPoints,omitempty"`
+	// MinPoints is the fewest points a receipt earns, bonuses included
+	MinPoints int `json:"minPoints,omitempty"`
+	// Policies order, cap or group rules that overlap, keyed by rule name
+	Policies map[string]RulePolicy `json:"policies,omitempty"`
+	Disabled []string              `json:"disabled,omitempty"`
+}
+
+// Names of the breakdown entries for the points that depend on the user who submitted a receipt
+const (
+	// TierRule is the extra points of the user's loyalty tier
+	TierRule = "tier"
+	// StreakRule is the bonus for extending the user's streak
+	StreakRule = "streak"
+	// FlaggedRule is the rule-set's flaggedPenalty, taken from flagged receipts
+	FlaggedRule = "flagged"
+	// ClawbackRule takes back the points of the purchase a return refunds; returns are scored by it alone
+	ClawbackRule = "clawback"
+	// CapRule takes away the points above the rule-set's maxPoints
+	CapRule = "cap"
+	// FloorRule adds the points a receipt is short of the rule-set's minPoints
+	FloorRule = "floor"
+)
+
+// Member describes the user who submitted a receipt, for the points that depend on their history
+type Member struct {
+	// Tier is the loyalty tier the user's balance reaches, "" when it reaches none
+	Tier string
+	// Streak is the length the receipt extends the user's streak to, 0 when it doesn't extend it
+	Streak int
+}
+
+// Clone returns a copy of the rule-set that shares no maps or slices with it
+func (rs RuleSet) Clone() RuleSet {
+	rs.CategoryBonuses = maps.Clone(rs.CategoryBonuses)
+	rs.RetailerBonuses = maps.Clone(rs.RetailerBonuses)
+	rs.TierMultipliers = maps.Clone(rs.TierMultipliers)
+	rs.StreakBonuses = maps.Clone(rs.StreakBonuses)
+	rs.Policies = maps.Clone(rs.Policies)
+	rs.Disabled = slices.Clone(rs.Disabled)
+	return rs
+}
+
+func (rs RuleSet) isDisabled(name string) bool {
+	for _, disabled := range rs.Disabled {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRuleSet matches the published points rules
+var DefaultRuleSet = RuleSet{
+	RetailerCharacterPoints:    1,
+	RoundDollarPoints:          50,
+	QuarterMultiplePoints:      25,
+	ItemPairPoints:             5,
+	DescriptionPriceMultiplier: 0.2,
+	DescriptionRounding:        RoundCeil,
+	OddDayPoints:               6,
+	AfternoonPoints:            10,
+}
+
+// Validate reports the first rule the rule-set disables or sets a policy for that doesn't exist, or
+// the first rounding a rule can't apply
+func (rs RuleSet) Validate() error {
+	if err := validateRounding("itemCountAndDescription", rs.DescriptionRounding, rs.DescriptionPriceMultiplier); err != nil {
+		return err
+	}
+	for tier, multiplier := range rs.TierMultipliers {
+		if multiplier < 0 {
+			return fmt.Errorf("tier %q multiplier must not be negative", tier)
+		}
+	}
+	for days, bonus := range rs.StreakBonuses {
+		if days < 1 || bonus < 0 {
+			return fmt.Errorf("streak bonus for %d days must be for at least a day and not negative", days)
+		}
+	}
+	if rs.ReturnPenalty < 0 || rs.FlaggedPenalty < 0 {
+		return fmt.Errorf("returnPenalty and flaggedPenalty must not be negative")
+	}
+	if rs.MaxPoints < 0 || (rs.MaxPoints > 0 && rs.MinPoints > rs.MaxPoints) {
+		return fmt.Errorf("maxPoints must not be negative or below minPoints")
+	}
+	for _, name := range rs.Disabled {
+		if !IsRule(name) {
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return rs.validatePolicies()
+}
+
+// Version identifies the rule-set's values, changing whenever any of them does: the first 12 hex
+// digits of the SHA-256 of its JSON encoding
+func (rs RuleSet) Version() string {
+	data, _ := json.Marshal(rs)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// LoadRuleSet reads a JSON rule-set file. Fields the file omits keep their DefaultRuleSet values.
+func LoadRuleSet(path string) (RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("reading rule-set: %w", err)
+	}
+	rs := DefaultRuleSet.Clone()
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return RuleSet{}, fmt.Errorf("parsing rule-set %s: %w", path, err)
+	}
+	return rs, rs.Validate()
+}
+
+// RegisterRule appends a custom rule, applied after the built-in ones. Custom rules see the whole
+// receipt, including its metadata, and can be disabled by name like any other rule. Register rules
+// during initialisation, before any receipt is scored.
+func RegisterRule(name string, points func(receipt.Receipt, RuleSet) int) error {
+	if name == "" || name == TierRule || name == StreakRule || name == FlaggedRule || name == ClawbackRule || name == CapRule || name == FloorRule || IsRule(name) {
+		return fmt.Errorf("scoring rule %q is empty or already registered", name)
+	}
+	rules = append(rules, rule{name: name, points: points})
+	return nil
+}
+
+// RuleNames returns the name of every rule in the order it is applied
+func RuleNames() []string {
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.name
+	}
+	return names
+}
+
+// IsRule reports whether name identifies a scoring rule
+func IsRule(name string) bool {
+	for _, rule := range rules {
+		if rule.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Breakdown returns the points awarded by each rule in the rule-set for the receipt, in the order of
+// the rule-set's priorities and after its caps and exclusive groups
+func Breakdown(r receipt.Receipt, rs RuleSet) []RuleResult {
+	breakdown := make([]RuleResult, 0, len(rules))
+	for _, rule := range rs.orderedRules() {
+		points := 0
+		if !rs.isDisabled(rule.name) {
+			points = rule.points(r, rs)
+		}
+		breakdown = append(breakdown, RuleResult{Rule: rule.name, Points: points})
+	}
+	rs.applyPolicies(breakdown)
+	return breakdown
+}
+
+// TierBonus returns the extra points a receipt worth points earns under the rule-set's multiplier
+// for tier, rounded down; it is negative for multipliers below 1
+func TierBonus(points int, tier string, rs RuleSet) int {
+	multiplier, ok := rs.TierMultipliers[tier]
+	if !ok || points <= 0 {
+		return 0
+	}
+	return MultiplyAmount(strconv.Itoa(points), multiplier, RoundFloor) - points
+}
+
+// StreakBonus returns the bonus for extending a streak to the given length: that of the longest
+// streak in the rule-set's bonuses it reaches
+func StreakBonus(streak int, rs RuleSet) int {
+	bonus, reached := 0, 0
+	for days, points := range rs.StreakBonuses {
+		if days <= streak && days > reached {
+			bonus, reached = points, days
+		}
+	}
+	return bonus
+}
+
+// Bound returns the breakdown entry bringing a receipt worth points within the rule-set's maxPoints
+// and minPoints, reporting whether it needs one
+func Bound(points int, rs RuleSet) (RuleResult, bool) {
+	switch {
+	case rs.MaxPoints > 0 && points > rs.MaxPoints:
+		return RuleResult{Rule: CapRule, Points: rs.MaxPoints - points}, true
+	case points < rs.MinPoints:
+		return RuleResult{Rule: FloorRule, Points: rs.MinPoints - points}, true
+	}
+	return RuleResult{}, false
+}
+
+// AppendResult adds an entry to a breakdown, e.g. a penalty decided after scoring, and brings its
+// total back within the rule-set's maxPoints and minPoints, replacing the cap or floor entry
+func AppendResult(breakdown []RuleResult, result RuleResult, rs RuleSet) []RuleResult {
+	breakdown = slices.DeleteFunc(slices.Clone(breakdown), func(entry RuleResult) bool {
+		return entry.Rule == CapRule || entry.Rule == FloorRule
+	})
+	breakdown = append(breakdown, result)
+	if bound, ok := Bound(Total(breakdown), rs); ok {
+		breakdown = append(breakdown, bound)
+	}
+	return breakdown
+}
+
+// Total sums the points in a breakdown
+func Total(breakdown []RuleResult) int {
+	points := 0
+	for _, result := range breakdown {
+		points += result.Points
+	}
+	return points
+}
+
+// Engine scores receipts against the active rule-set
+type Engine struct {
+	mu      sync.RWMutex
+	ruleSet RuleSet
+	// overrides switches rules on or off regardless of the rule-set, keyed by rule name
+	overrides map[string]bool
+	// hits counts the stored receipts each rule awarded points to, keyed by rule name
+	hits map[string]int64
+}
+
+func NewEngine(rs RuleSet) *Engine {
+	return &Engine{ruleSet: rs, overrides: make(map[string]bool), hits: make(map[string]int64)}
+}
+
+// RuleSet returns the active rule-set, with the rules switched on or off by SetEnabled enabled or
+// disabled in it
+func (e *Engine) RuleSet() RuleSet {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.overrides) == 0 {
+		return e.ruleSet
+	}
+	rs := e.ruleSet.Clone()
+	rs.Disabled = slices.DeleteFunc(rs.Disabled, func(name string) bool { return e.overrides[name] })
+	for _, rule := range rules {
+		if enabled, ok := e.overrides[rule.name]; ok && !enabled {
+			rs.Disabled = append(rs.Disabled, rule.name)
+		}
+	}
+	return rs
+}
+
+// SetRuleSet replaces the active rule-set; receipts already being scored keep the one they started
+// with. Rules switched on or off by SetEnabled stay so.
+func (e *Engine) SetRuleSet(rs RuleSet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ruleSet = rs
+}
+
+// RuleStatus describes a rule as the engine applies it
+type RuleStatus struct {
+	Rule    string `json:"rule"`
+	Enabled bool   `json:"enabled"`
+	// Override is how SetEnabled switched the rule, null when the rule-set decides
+	Override *bool `json:"override"`
+	// Hits is the number of stored receipts the rule awarded points to since the engine started
+	Hits int64 `json:"hits"`
+}
+
+// Rules describes every rule in the order it is registered
+func (e *Engine) Rules() []RuleStatus {
+	rs := e.RuleSet()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	statuses := make([]RuleStatus, len(rules))
+	for i, rule := range rules {
+		statuses[i] = RuleStatus{Rule: rule.name, Enabled: !rs.isDisabled(rule.name)}
+		if enabled, ok := e.overrides[rule.name]; ok {
+			statuses[i].Override = &enabled
+		}
+		statuses[i].Hits = e.hits[rule.name]
+	}
+	return statuses
+}
+
+// SetEnabled switches a rule on or off whatever the rule-set says, until the engine restarts; a nil
+// enabled hands the rule back to the rule-set
+func (e *Engine) SetEnabled(name string, enabled *bool) error {
+	if !IsRule(name) {
+		return fmt.Errorf("unknown rule %q", name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if enabled == nil {
+		delete(e.overrides, name)
+	} else {
+		e.overrides[name] = *enabled
+	}
+	return nil
+}
+
+// Breakdown returns the points awarded by each rule for the receipt using the active rule-set
+func (e *Engine) Breakdown(r receipt.Receipt) []RuleResult {
+	return Breakdown(r, e.RuleSet())
+}
+
+// BreakdownFor returns the points awarded by each rule for the receipt of member using the active
+// rule-set, followed by the extra points of their tier and their streak bonus when the rule-set has
+// them. The tier multiplies the points of the rules alone. Last comes the cap or floor entry when
+// the total is outside the rule-set's maxPoints and minPoints.
+func (e *Engine) BreakdownFor(r receipt.Receipt, member Member) []RuleResult {
+	rs := e.RuleSet()
+	breakdown := Breakdown(r, rs)
+	if _, ok := rs.TierMultipliers[member.Tier]; ok {
+		breakdown = append(breakdown, RuleResult{Rule: TierRule, Points: TierBonus(Total(breakdown), member.Tier, rs)})
+	}
+	if len(rs.StreakBonuses) > 0 {
+		breakdown = append(breakdown, RuleResult{Rule: StreakRule, Points: StreakBonus(member.Streak, rs)})
+	}
+	if bound, ok := Bound(Total(breakdown), rs); ok {
+		breakdown = append(breakdown, bound)
+	}
+	return breakdown
+}
+
+// CountHits counts a hit for every rule awarding points in the breakdown of a stored receipt, so
+// dry runs and receipts that are rejected or scored again don't count
+func (e *Engine) CountHits(breakdown []RuleResult) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, result := range breakdown {
+		if result.Points != 0 && IsRule(result.Rule) {
+			e.hits[result.Rule]++
+		}
+	}
+}
+
+// CalculatePoints returns the total points for the receipt using the active rule-set
+func (e *Engine) CalculatePoints(r receipt.Receipt) int {
+	return Total(e.Breakdown(r))
+}
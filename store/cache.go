@@ -0,0 +1,137 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+)
+
+var (
+	cacheHits    = metrics.NewCounter("receipts_store_cache_hits_total", "Receipt lookups answered by the store cache.")
+	cacheMisses  = metrics.NewCounter("receipts_store_cache_misses_total", "Receipt lookups the store cache passed to the backing store.")
+	cacheEntries = metrics.NewGauge("receipts_store_cache_entries", "Receipts held by the store cache.")
+)
+
+// CacheOptions sizes a Cached store
+type CacheOptions struct {
+	// Size is the most receipts cached before the least recently used is dropped
+	Size int
+	// TTL bounds how long a receipt is served from the cache before it is read again; zero never refreshes
+	TTL time.Duration
+	// Clock tells how long receipts have been cached, the system clock by default
+	Clock clock.Clock
+}
+
+// Cached keeps recently read receipts in an in-process LRU cache in front of a slower store, such as
+// a database. Saves and deletes made through it invalidate the cached copy, and Invalidate drops the
+// copies of receipts other instances changed.
+type Cached struct {
+	Store
+	opts CacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru orders cached receipts from most to least recently used
+	lru *list.List
+	// version changes on every write so a read racing a write doesn't cache the old record
+	version uint64
+}
+
+type cacheEntry struct {
+	record   Record
+	cachedAt time.Time
+}
+
+func NewCached(backing Store, opts CacheOptions) *Cached {
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	return &Cached{
+		Store:   backing,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *Cached) Get(id string) (Record, error) {
+	now := c.opts.Clock.Now()
+	c.mu.Lock()
+	if element, exists := c.entries[id]; exists {
+		entry := element.Value.(*cacheEntry)
+		if c.opts.TTL <= 0 || now.Sub(entry.cachedAt) <= c.opts.TTL {
+			c.lru.MoveToFront(element)
+			c.mu.Unlock()
+			cacheHits.Inc()
+			return entry.record, nil
+		}
+		c.remove(element)
+	}
+	version := c.version
+	c.mu.Unlock()
+
+	cacheMisses.Inc()
+	record, err := c.Store.Get(id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == version && c.opts.Size > 0 {
+		if element, exists := c.entries[id]; exists {
+			c.remove(element)
+		}
+		c.entries[id] = c.lru.PushFront(&cacheEntry{record: record, cachedAt: now})
+		for c.lru.Len() > c.opts.Size {
+			c.remove(c.lru.Back())
+		}
+	}
+	cacheEntries.Set(float64(c.lru.Len()))
+	return record, nil
+}
+
+func (c *Cached) Save(record Record) error {
+	defer c.invalidate(record.ID)
+	return c.Store.Save(record)
+}
+
+func (c *Cached) Delete(id string) error {
+	defer c.invalidate(id)
+	return c.Store.Delete(id)
+}
+
+// Invalidate drops the cached copy of a receipt another instance changed, or every cached receipt
+// for an empty ID, when changes may have been missed. Pass it to Postgres.WatchChanges.
+func (c *Cached) Invalidate(id string) {
+	if id != "" {
+		c.invalidate(id)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	cacheEntries.Set(0)
+}
+
+// invalidate drops the cached copy of a receipt once the backing store has changed it
+func (c *Cached) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	if element, exists := c.entries[id]; exists {
+		c.remove(element)
+	}
+	cacheEntries.Set(float64(c.lru.Len()))
+}
+
+// remove deletes an element; the caller holds mu
+func (c *Cached) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.record.ID)
+}
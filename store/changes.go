@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// changesChannel is the PostgreSQL notification channel every save and delete announces the ID of
+// the receipt on, so instances caching it can drop their copy
+const changesChannel = "receipt_changes"
+
+// changesRetry is how long WatchChanges waits before listening again after losing its connection
+const changesRetry = time.Second
+
+// WatchChanges calls changed with the ID of every receipt any instance saves or deletes, until ctx
+// is cancelled. It calls changed with an empty ID whenever changes may have been missed: when it
+// starts listening and after it reconnects.
+func (p *Postgres) WatchChanges(ctx context.Context, changed func(id string)) {
+	for {
+		err := p.listen(ctx, changed)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listening for receipt changes failed, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(changesRetry):
+		}
+	}
+}
+
+// listen holds a connection listening on changesChannel until it fails or ctx is cancelled. The
+// connection is closed rather than returned to the pool, which would keep it listening.
+func (p *Postgres) listen(ctx context.Context, changed func(id string)) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		pg := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pg.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+			return errors.Join(err, driver.ErrBadConn)
+		}
+		changed("")
+		for {
+			notification, err := pg.WaitForNotification(ctx)
+			if err != nil {
+				return errors.Join(err, driver.ErrBadConn)
+			}
+			changed(notification.Payload)
+		}
+	})
+}
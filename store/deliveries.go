@@ -0,0 +1,186 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+// maxDeliveries is how many deliveries a store keeps, dropping the oldest beyond it
+const maxDeliveries = 10000
+
+// Delivery is an attempt to post an outbox event to a webhook, kept with the event so it can be
+// delivered again
+type Delivery struct {
+	ID      string `json:"id"`
+	Webhook string `json:"webhook"`
+	Event   Event  `json:"event"`
+	// RedeliveryOf is the delivery this one replayed, when it was asked for
+	RedeliveryOf string    `json:"redeliveryOf,omitempty"`
+	AttemptedAt  time.Time `json:"attemptedAt"`
+	// StatusCode is the webhook's answer, zero when the request failed before it answered
+	StatusCode int   `json:"statusCode,omitempty"`
+	LatencyMS  int64 `json:"latencyMs"`
+	// Response is the start of the webhook's response body
+	Response string `json:"response,omitempty"`
+	// Error says why the attempt failed; empty when the webhook accepted the event
+	Error string `json:"error,omitempty"`
+}
+
+// DeliveryLog is implemented by the stores that keep the attempts to deliver events to webhooks
+type DeliveryLog interface {
+	// RecordDelivery adds a delivery to the log
+	RecordDelivery(delivery Delivery) error
+	// Deliveries returns the deliveries to a webhook, newest first
+	Deliveries(webhook string) ([]Delivery, error)
+	// GetDelivery returns a delivery by its ID, or ErrNotFound
+	GetDelivery(id string) (Delivery, error)
+	// EraseDeliveries drops the deliveries of the events of the given receipts and returns how many it dropped
+	EraseDeliveries(receiptIDs ...string) (int, error)
+}
+
+func (m *Memory) RecordDelivery(delivery Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, delivery)
+	if len(m.deliveries) > maxDeliveries {
+		m.deliveries = append([]Delivery{}, m.deliveries[len(m.deliveries)-maxDeliveries:]...)
+	}
+	return nil
+}
+
+func (m *Memory) Deliveries(webhook string) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := []Delivery{}
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if m.deliveries[i].Webhook == webhook {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *Memory) GetDelivery(id string) (Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return Delivery{}, ErrNotFound
+}
+
+func (m *Memory) EraseDeliveries(receiptIDs ...string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.deliveries)
+	m.deliveries = slices.DeleteFunc(m.deliveries, func(delivery Delivery) bool {
+		return slices.Contains(receiptIDs, delivery.Event.ReceiptID)
+	})
+	return before - len(m.deliveries), nil
+}
+
+func (p *Postgres) RecordDelivery(delivery Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO webhook_deliveries (id, webhook, delivery) VALUES ($1, $2, $3)`,
+		delivery.ID, delivery.Webhook, string(data)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries
+		WHERE seq <= (SELECT max(seq) FROM webhook_deliveries) - $1`, maxDeliveries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) Deliveries(webhook string) ([]Delivery, error) {
+	rows, err := p.db.Query(`SELECT delivery FROM webhook_deliveries WHERE webhook = $1 ORDER BY seq DESC`, webhook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(data, &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (p *Postgres) GetDelivery(id string) (Delivery, error) {
+	var data []byte
+	err := p.db.QueryRow(`SELECT delivery FROM webhook_deliveries WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Delivery{}, ErrNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+	var delivery Delivery
+	err = json.Unmarshal(data, &delivery)
+	return delivery, err
+}
+
+func (p *Postgres) EraseDeliveries(receiptIDs ...string) (int, error) {
+	result, err := p.db.Exec(`DELETE FROM webhook_deliveries WHERE delivery->'event'->>'receiptId' = ANY($1)`, receiptIDs)
+	if err != nil {
+		return 0, err
+	}
+	erased, err := result.RowsAffected()
+	return int(erased), err
+}
+
+// errNoDeliveryLog is returned by a Cached store's delivery log methods when its backing store has none
+var errNoDeliveryLog = errors.New("the backing store has no delivery log")
+
+func (c *Cached) RecordDelivery(delivery Delivery) error {
+	log, ok := c.Store.(DeliveryLog)
+	if !ok {
+		return errNoDeliveryLog
+	}
+	return log.RecordDelivery(delivery)
+}
+
+func (c *Cached) Deliveries(webhook string) ([]Delivery, error) {
+	log, ok := c.Store.(DeliveryLog)
+	if !ok {
+		return nil, errNoDeliveryLog
+	}
+	return log.Deliveries(webhook)
+}
+
+func (c *Cached) GetDelivery(id string) (Delivery, error) {
+	log, ok := c.Store.(DeliveryLog)
+	if !ok {
+		return Delivery{}, errNoDeliveryLog
+	}
+	return log.GetDelivery(id)
+}
+
+func (c *Cached) EraseDeliveries(receiptIDs ...string) (int, error) {
+	log, ok := c.Store.(DeliveryLog)
+	if !ok {
+		return 0, errNoDeliveryLog
+	}
+	return log.EraseDeliveries(receiptIDs...)
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"slices"
+)
+
+// Locks is implemented by the stores that can lock receipts across every instance sharing them
+type Locks interface {
+	// LockReceipts waits until it holds the locks on the receipts with the given IDs and returns the
+	// function releasing them
+	LockReceipts(ids ...string) (func(), error)
+}
+
+// LockReceipts takes a transaction-scoped advisory lock on each receipt, in order of their IDs so
+// instances locking overlapping sets can't deadlock. The transaction holds a connection until the
+// locks are released.
+func (p *Postgres) LockReceipts(ids ...string) (func(), error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	for _, id := range ids {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('receipt:' || $1))`, id); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return func() { tx.Rollback() }, nil
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	"receipt-processor/clock"
+	"receipt-processor/metrics"
+)
+
+var (
+	storedReceipts = metrics.NewGauge("receipts_store_receipts", "Receipts held by the in-memory store.")
+	storedBytes    = metrics.NewGauge("receipts_store_bytes", "Approximate memory used by receipts in the in-memory store.")
+	evictions      = metrics.NewCounterVec("receipts_store_evictions_total", "Receipts removed from the in-memory store to respect its limits.", "reason")
+)
+
+// Eviction reasons reported by the receipts_store_evictions_total metric
+const (
+	evictedCapacity = "capacity"
+	evictedMemory   = "memory"
+	evictedExpired  = "expired"
+)
+
+// MemoryOptions bounds the in-memory store. Zero values mean unlimited.
+type MemoryOptions struct {
+	// MaxReceipts is the most receipts kept before the least recently used is evicted
+	MaxReceipts int
+	// MaxBytes is the approximate memory budget before the least recently used receipts are evicted
+	MaxBytes int64
+	// TTL expires receipts this long after they were created
+	TTL time.Duration
+	// Clock tells when receipts expire, the system clock by default
+	Clock clock.Clock
+}
+
+// Memory keeps receipts in a map for the lifetime of the process, optionally evicting
+// the least recently used receipts once it outgrows its limits
+type Memory struct {
+	opts MemoryOptions
+
+	mu       sync.Mutex
+	receipts map[string]*list.Element
+	// lru orders receipts from most to least recently used
+	lru   *list.List
+	bytes int64
+	// index finds receipts by the words of their retailer and item descriptions
+	index searchIndex
+	// users finds receipts by the user who submitted them
+	users userIndex
+	// events is the outbox, oldest first
+	events []Event
+	// deliveries are the attempts to deliver events to webhooks, oldest first
+	deliveries []Delivery
+
+	stop chan struct{}
+}
+
+type memoryEntry struct {
+	record Record
+	size   int64
+}
+
+func NewMemory(opts MemoryOptions) *Memory {
+	if opts.Clock == nil {
+		opts.Clock = clock.System{}
+	}
+	m := &Memory{
+		opts:     opts,
+		receipts: make(map[string]*list.Element),
+		lru:      list.New(),
+		index:    make(searchIndex),
+		users:    make(userIndex),
+		stop:     make(chan struct{}),
+	}
+	if opts.TTL > 0 {
+		go m.expireLoop()
+	}
+	return m
+}
+
+// Close stops the background expiry of a store created with a TTL
+func (m *Memory) Close() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
+
+func (m *Memory) Save(record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.save(record)
+	return nil
+}
+
+// save stores the record, evicting others to fit the limits; the caller holds mu
+func (m *Memory) save(record Record) {
+	if element, exists := m.receipts[record.ID]; exists {
+		m.remove(element)
+	}
+	entry := &memoryEntry{record: record, size: approximateSize(record)}
+	m.receipts[record.ID] = m.lru.PushFront(entry)
+	m.bytes += entry.size
+	m.index.add(record)
+	m.users.add(record)
+
+	// Evict from the least recently used end until the store fits its limits again
+	for m.opts.MaxReceipts > 0 && m.lru.Len() > m.opts.MaxReceipts {
+		m.remove(m.lru.Back())
+		evictions.With(evictedCapacity).Inc()
+	}
+	for m.opts.MaxBytes > 0 && m.bytes > m.opts.MaxBytes && m.lru.Len() > 1 {
+		m.remove(m.lru.Back())
+		evictions.With(evictedMemory).Inc()
+	}
+	m.updateGauges()
+}
+
+func (m *Memory) Get(id string) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, exists := m.receipts[id]
+	if !exists {
+		return Record{}, ErrNotFound
+	}
+	entry := element.Value.(*memoryEntry)
+	if m.expired(entry.record, m.opts.Clock.Now()) {
+		m.remove(element)
+		evictions.With(evictedExpired).Inc()
+		m.updateGauges()
+		return Record{}, ErrNotFound
+	}
+	m.lru.MoveToFront(element)
+	return entry.record, nil
+}
+
+func (m *Memory) List() ([]Record, error) {
+	now := m.opts.Clock.Now()
+	m.mu.Lock()
+	records := make([]Record, 0, len(m.receipts))
+	for _, element := range m.receipts {
+		record := element.Value.(*memoryEntry).record
+		if !m.expired(record, now) {
+			records = append(records, record)
+		}
+	}
+	m.mu.Unlock()
+
+	SortByCreatedAt(records)
+	return records, nil
+}
+
+func (m *Memory) ListSorted(by Sort) ([]Record, error) {
+	records, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	SortRecords(records, by)
+	return records, nil
+}
+
+func (m *Memory) Search(query string, limit int) ([]Record, error) {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return []Record{}, nil
+	}
+	now := m.opts.Clock.Now()
+	m.mu.Lock()
+	records := []Record{}
+	for _, id := range m.index.match(tokens) {
+		record := m.receipts[id].Value.(*memoryEntry).record
+		if !m.expired(record, now) {
+			records = append(records, record)
+		}
+	}
+	m.mu.Unlock()
+
+	rankSearch(records, tokens)
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, exists := m.receipts[id]
+	if !exists {
+		return ErrNotFound
+	}
+	m.remove(element)
+	m.updateGauges()
+	return nil
+}
+
+func (m *Memory) expired(record Record, now time.Time) bool {
+	return m.opts.TTL > 0 && now.Sub(record.CreatedAt) > m.opts.TTL
+}
+
+// remove deletes an element; the caller holds mu
+func (m *Memory) remove(element *list.Element) {
+	entry := m.lru.Remove(element).(*memoryEntry)
+	delete(m.receipts, entry.record.ID)
+	m.bytes -= entry.size
+	m.index.remove(entry.record)
+	m.users.remove(entry.record)
+}
+
+func (m *Memory) updateGauges() {
+	storedReceipts.Set(float64(m.lru.Len()))
+	storedBytes.Set(float64(m.bytes))
+}
+
+// expireLoop drops expired receipts in the background so unread receipts don't linger
+func (m *Memory) expireLoop() {
+	interval := m.opts.TTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			now := m.opts.Clock.Now()
+			m.mu.Lock()
+			for _, element := range m.receipts {
+				if m.expired(element.Value.(*memoryEntry).record, now) {
+					m.remove(element)
+					evictions.With(evictedExpired).Inc()
+				}
+			}
+			m.updateGauges()
+			m.mu.Unlock()
+		}
+	}
+}
+
+// approximateSize estimates the memory held by a record: its strings plus fixed overhead per value
+func approximateSize(record Record) int64 {
+	const recordOverhead, itemOverhead = 256, 64
+	r := record.Receipt
+	size := recordOverhead + len(record.ID) + len(r.Retailer) + len(r.PurchaseDate) + len(r.PurchaseTime) + len(r.Total) + len(r.UserID) + len(r.RetailerID) + len(record.Status) + len(record.ReviewedBy)
+	for _, item := range r.Items {
+		size += itemOverhead + len(item.ShortDescription) + len(item.Price)
+	}
+	for key, value := range r.Metadata {
+		size += len(key) + len(value)
+	}
+	for _, change := range record.History {
+		size += itemOverhead + len(change.Reason) + len(change.Actor)
+	}
+	for _, reason := range record.FlagReasons {
+		size += len(reason)
+	}
+	return int64(size)
+}
+
+// SortByCreatedAt orders records oldest first, breaking ties by ID
+func SortByCreatedAt(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].ID < records[j].ID
+		}
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+}
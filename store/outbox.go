@@ -0,0 +1,213 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Event is a change to a receipt recorded in the outbox with the change itself, to be published
+// once it is stored
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	ReceiptID string          `json:"receiptId"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Payload   json.RawMessage `json:"payload"`
+	// Attempts counts the failed attempts to publish the event, LastError says why the last one failed
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Outbox is implemented by the stores that can record an event in the same transaction as the
+// receipt it describes, so the event is published if and only if the change was stored
+type Outbox interface {
+	// SaveWithEvent stores the record and the event together, or neither
+	SaveWithEvent(record Record, event Event) error
+	// PendingEvents returns up to limit unpublished events, oldest first; a limit of zero returns every one
+	PendingEvents(limit int) ([]Event, error)
+	// DeleteEvent removes an event once it was published, or returns ErrNotFound
+	DeleteEvent(id string) error
+	// FailEvent counts a failed attempt to publish an event
+	FailEvent(id string, reason string) error
+	// EraseEvents removes the unpublished events of the given receipts, whose payloads hold the
+	// receipts, and returns how many it removed
+	EraseEvents(receiptIDs ...string) (int, error)
+}
+
+func (m *Memory) SaveWithEvent(record Record, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.save(record)
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *Memory) PendingEvents(limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if limit <= 0 || limit > len(m.events) {
+		limit = len(m.events)
+	}
+	return append([]Event{}, m.events[:limit]...), nil
+}
+
+func (m *Memory) DeleteEvent(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, event := range m.events {
+		if event.ID == id {
+			m.events = append(m.events[:i], m.events[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) FailEvent(id string, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].Attempts++
+			m.events[i].LastError = reason
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) EraseEvents(receiptIDs ...string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.events)
+	m.events = slices.DeleteFunc(m.events, func(event Event) bool {
+		return slices.Contains(receiptIDs, event.ReceiptID)
+	})
+	return before - len(m.events), nil
+}
+
+func (p *Postgres) SaveWithEvent(record Record, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := saveRecord(tx, record); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO outbox (id, event) VALUES ($1, $2)`, event.ID, string(data)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) PendingEvents(limit int) ([]Event, error) {
+	statement := `SELECT event FROM outbox ORDER BY seq`
+	args := []interface{}{}
+	if limit > 0 {
+		statement += ` LIMIT $1`
+		args = append(args, limit)
+	}
+	rows, err := p.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (p *Postgres) DeleteEvent(id string) error {
+	result, err := p.db.Exec(`DELETE FROM outbox WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (p *Postgres) FailEvent(id string, reason string) error {
+	result, err := p.db.Exec(`UPDATE outbox SET event = event || jsonb_build_object(
+		'attempts', coalesce((event->>'attempts')::integer, 0) + 1, 'lastError', $2::text) WHERE id = $1`, id, reason)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (p *Postgres) EraseEvents(receiptIDs ...string) (int, error) {
+	result, err := p.db.Exec(`DELETE FROM outbox WHERE event->>'receiptId' = ANY($1)`, receiptIDs)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// errNoOutbox is returned by a Cached store's outbox methods when its backing store has none
+var errNoOutbox = errors.New("the backing store has no outbox")
+
+// SaveWithEvent saves through the backing store's outbox, invalidating the cached copy
+func (c *Cached) SaveWithEvent(record Record, event Event) error {
+	box, ok := c.Store.(Outbox)
+	if !ok {
+		return errNoOutbox
+	}
+	defer c.invalidate(record.ID)
+	return box.SaveWithEvent(record, event)
+}
+
+func (c *Cached) PendingEvents(limit int) ([]Event, error) {
+	box, ok := c.Store.(Outbox)
+	if !ok {
+		return nil, errNoOutbox
+	}
+	return box.PendingEvents(limit)
+}
+
+func (c *Cached) DeleteEvent(id string) error {
+	box, ok := c.Store.(Outbox)
+	if !ok {
+		return errNoOutbox
+	}
+	return box.DeleteEvent(id)
+}
+
+func (c *Cached) FailEvent(id string, reason string) error {
+	box, ok := c.Store.(Outbox)
+	if !ok {
+		return errNoOutbox
+	}
+	return box.FailEvent(id, reason)
+}
+
+func (c *Cached) EraseEvents(receiptIDs ...string) (int, error) {
+	box, ok := c.Store.(Outbox)
+	if !ok {
+		return 0, errNoOutbox
+	}
+	return box.EraseEvents(receiptIDs...)
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"receipt-processor/metrics"
+)
+
+var (
+	poolConnections = metrics.NewGaugeVec("receipts_db_connections", "Connections of the database pools, by pool and state.", "pool", "state")
+	poolMaxOpen     = metrics.NewGaugeVec("receipts_db_max_open_connections", "Most connections each database pool opens, 0 for unlimited.", "pool")
+	poolWaits       = metrics.NewCounterVec("receipts_db_waits_total", "Times a query waited for a free connection, by pool.", "pool")
+	poolWaitSeconds = metrics.NewCounterVec("receipts_db_wait_seconds_total", "Time queries spent waiting for a free connection, by pool.", "pool")
+)
+
+// Pool is the state of a database connection pool and whether its database answered a ping
+type Pool struct {
+	// Name is primary, or replica-1, replica-2... in the order the replicas were given
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	// MaxOpen is the most connections the pool opens, 0 for unlimited
+	MaxOpen int `json:"maxOpen"`
+	InUse   int `json:"inUse"`
+	Idle    int `json:"idle"`
+	// Waits counts the queries that waited for a free connection, and WaitSeconds the time they waited
+	Waits       int64   `json:"waits"`
+	WaitSeconds float64 `json:"waitSeconds"`
+}
+
+// Checker is implemented by the stores kept in a database, which can be out of reach
+type Checker interface {
+	// Check pings the databases, returning the state of each pool, the primary first
+	Check(ctx context.Context) []Pool
+}
+
+type namedPool struct {
+	name string
+	db   *sql.DB
+}
+
+// pools names the connection pools of the primary and the replicas, the primary first
+func (p *Postgres) pools() []namedPool {
+	pools := []namedPool{{"primary", p.db}}
+	for i, r := range p.replicas {
+		pools = append(pools, namedPool{"replica-" + strconv.Itoa(i+1), r.db})
+	}
+	return pools
+}
+
+func (p *Postgres) Check(ctx context.Context) []Pool {
+	var pools []Pool
+	for _, pool := range p.pools() {
+		pools = append(pools, checkPool(ctx, pool.name, pool.db))
+	}
+	return pools
+}
+
+func checkPool(ctx context.Context, name string, db *sql.DB) Pool {
+	stats := db.Stats()
+	pool := Pool{
+		Name:        name,
+		Reachable:   true,
+		MaxOpen:     stats.MaxOpenConnections,
+		InUse:       stats.InUse,
+		Idle:        stats.Idle,
+		Waits:       stats.WaitCount,
+		WaitSeconds: stats.WaitDuration.Seconds(),
+	}
+	if err := db.PingContext(ctx); err != nil {
+		pool.Reachable, pool.Error = false, err.Error()
+	}
+	return pool
+}
+
+// ReportPools updates the receipts_db_* metrics from the pools' statistics every interval until
+// ctx is done
+func (p *Postgres) ReportPools(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// The pools count waits since they were opened, so only what changed is added to the counters
+	reported := make(map[string]sql.DBStats)
+	for {
+		for _, pool := range p.pools() {
+			name, stats := pool.name, pool.db.Stats()
+			poolConnections.With(name, "in_use").Set(float64(stats.InUse))
+			poolConnections.With(name, "idle").Set(float64(stats.Idle))
+			poolMaxOpen.With(name).Set(float64(stats.MaxOpenConnections))
+			last := reported[name]
+			poolWaits.With(name).Add(float64(stats.WaitCount - last.WaitCount))
+			poolWaitSeconds.With(name).Add((stats.WaitDuration - last.WaitDuration).Seconds())
+			reported[name] = stats
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the backing store when it is kept in a database
+func (c *Cached) Check(ctx context.Context) []Pool {
+	if checker, ok := c.Store.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Postgres stores receipts in a PostgreSQL table shared by every server instance connected to it.
+// Records are kept as JSON documents so new fields need no migration.
+type Postgres struct {
+	db *sql.DB
+
+	// replicas answer reads in turn when there are any
+	replicasMu sync.Mutex
+	replicas   []*replica
+	nextRead   int
+}
+
+// NewPostgres stores receipts in db, creating the receipts table when it doesn't exist yet. Reads
+// go to the read replicas given, if any, and writes to db.
+func NewPostgres(db *sql.DB, replicas ...*sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS receipts (
+		id         text PRIMARY KEY,
+		created_at timestamptz NOT NULL,
+		record     jsonb NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating receipts table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS receipts_created_at ON receipts (created_at, id)`); err != nil {
+		return nil, fmt.Errorf("creating receipts index: %w", err)
+	}
+	// Find each user's recent receipts for their submission limits
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS receipts_user ON receipts ((record->'receipt'->>'userId'), created_at)`); err != nil {
+		return nil, fmt.Errorf("creating receipts user index: %w", err)
+	}
+	// Keep a full-text vector of the retailer and item descriptions, indexed for search
+	_, err = db.Exec(`ALTER TABLE receipts ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+		to_tsvector('simple', coalesce(record->'receipt'->>'retailer', '') || ' ' ||
+			coalesce(jsonb_path_query_array(record, '$.receipt.items[*].shortDescription')::text, ''))
+	) STORED`)
+	if err != nil {
+		return nil, fmt.Errorf("adding receipts search column: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS receipts_search ON receipts USING gin (search)`); err != nil {
+		return nil, fmt.Errorf("creating receipts search index: %w", err)
+	}
+	// Index every other sort key, with the tie-breaks, so sorted listings read in index order
+	for field, key := range postgresSortKeys {
+		if field == SortCreatedAt {
+			continue
+		}
+		index := "receipts_sort_" + strings.ToLower(field)
+		if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS ` + index + ` ON receipts ((` + key + `), created_at, id)`); err != nil {
+			return nil, fmt.Errorf("creating receipts index %s: %w", index, err)
+		}
+	}
+	// The outbox holds the events saved with receipts until they are published, in the order they were saved
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS outbox (
+		seq   bigserial PRIMARY KEY,
+		id    text UNIQUE NOT NULL,
+		event jsonb NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox table: %w", err)
+	}
+	// The attempts to deliver the outbox's events to webhooks, with the events, so they can be replayed
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		seq      bigserial PRIMARY KEY,
+		id       text UNIQUE NOT NULL,
+		webhook  text NOT NULL,
+		delivery jsonb NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating webhook deliveries table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (webhook, seq)`); err != nil {
+		return nil, fmt.Errorf("creating webhook deliveries index: %w", err)
+	}
+	p := &Postgres{db: db}
+	for _, replicaDB := range replicas {
+		p.replicas = append(p.replicas, &replica{db: replicaDB})
+	}
+	return p, nil
+}
+
+func (p *Postgres) Save(record Record) error {
+	return saveRecord(p.db, record)
+}
+
+// saveRecord upserts a record through db or a transaction, announcing the change to the instances
+// caching it once it commits
+func saveRecord(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`WITH saved AS (
+			INSERT INTO receipts (id, created_at, record) VALUES ($1, $2, $3)
+			ON CONFLICT (id) DO UPDATE SET created_at = EXCLUDED.created_at, record = EXCLUDED.record
+			RETURNING id
+		)
+		SELECT pg_notify('`+changesChannel+`', id) FROM saved`,
+		record.ID, record.CreatedAt, string(data))
+	return err
+}
+
+func (p *Postgres) Get(id string) (Record, error) {
+	var record Record
+	err := p.read(func(db *sql.DB) error {
+		var data []byte
+		err := db.QueryRow(`SELECT record FROM receipts WHERE id = $1`, id).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// postgresSortKeys are the expressions each sort field orders by, matching SortRecords
+var postgresSortKeys = map[string]string{
+	SortCreatedAt:    "created_at",
+	SortPoints:       "(record->>'points')::integer",
+	SortTotal:        "(record->'receipt'->>'total')::numeric",
+	SortPurchaseDate: `(record->'receipt'->>'purchaseDate') COLLATE "C"`,
+	SortRetailer:     "lower(record->'receipt'->>'retailer')",
+}
+
+func (p *Postgres) List() ([]Record, error) {
+	return p.ListSorted(Sort{Field: SortCreatedAt})
+}
+
+func (p *Postgres) ListSorted(by Sort) ([]Record, error) {
+	key, ok := postgresSortKeys[by.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", by.Field)
+	}
+	direction := "ASC"
+	if by.Descending {
+		direction = "DESC"
+	}
+	order := key + " " + direction
+	if by.Field != SortCreatedAt {
+		order += ", created_at " + direction
+	}
+	return p.query(`SELECT record FROM receipts ORDER BY ` + order + `, id ` + direction)
+}
+
+// query reads the records a query returns, from a replica when there is one
+func (p *Postgres) query(statement string, args ...interface{}) ([]Record, error) {
+	var records []Record
+	err := p.read(func(db *sql.DB) error {
+		rows, err := db.Query(statement, args...)
+		if err != nil {
+			return err
+		}
+		records, err = scanRecords(rows)
+		return err
+	})
+	return records, err
+}
+
+// scanRecords decodes the records a query returned
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (p *Postgres) Search(query string, limit int) ([]Record, error) {
+	// Search the words Tokenize finds, as the memory store does, rather than tsquery syntax
+	words := strings.Join(Tokenize(query), " ")
+	if words == "" {
+		return []Record{}, nil
+	}
+	statement := `SELECT record FROM receipts, plainto_tsquery('simple', $1) query WHERE search @@ query
+		ORDER BY ts_rank(search, query) DESC, created_at, id`
+	args := []interface{}{words}
+	if limit > 0 {
+		statement += ` LIMIT $2`
+		args = append(args, limit)
+	}
+	return p.query(statement, args...)
+}
+
+func (p *Postgres) Delete(id string) error {
+	result, err := p.db.Exec(`WITH deleted AS (DELETE FROM receipts WHERE id = $1 RETURNING id)
+		SELECT pg_notify('`+changesChannel+`', id) FROM deleted`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ErrNotFound
+	}
+	return err
+}
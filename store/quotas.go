@@ -0,0 +1,137 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Quotas is implemented by the stores that find a user's receipts through an index and can store a
+// receipt only when the user's other recent receipts leave room for it, atomically, so concurrent
+// submissions, even to different instances, can't share the last of a quota
+type Quotas interface {
+	// UserReceipts returns the receipts of a user created at or after since, oldest first
+	UserReceipts(userID string, since time.Time) ([]Record, error)
+	// SaveChecked stores the record, with event unless it is nil, after check accepted the receipts
+	// the record's user created at or after since. An error from check is returned as it is and
+	// nothing is stored.
+	SaveChecked(record Record, event *Event, since time.Time, check func(recent []Record) error) error
+}
+
+// userIndex finds the IDs of the receipts of each user
+type userIndex map[string]map[string]bool
+
+func (u userIndex) add(record Record) {
+	userID := record.Receipt.UserID
+	if userID == "" {
+		return
+	}
+	if u[userID] == nil {
+		u[userID] = make(map[string]bool)
+	}
+	u[userID][record.ID] = true
+}
+
+func (u userIndex) remove(record Record) {
+	userID := record.Receipt.UserID
+	delete(u[userID], record.ID)
+	if len(u[userID]) == 0 {
+		delete(u, userID)
+	}
+}
+
+func (m *Memory) UserReceipts(userID string, since time.Time) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.userReceipts(userID, since), nil
+}
+
+// userReceipts reads the user's receipts created at or after since; the caller holds mu
+func (m *Memory) userReceipts(userID string, since time.Time) []Record {
+	now := m.opts.Clock.Now()
+	records := []Record{}
+	for id := range m.users[userID] {
+		record := m.receipts[id].Value.(*memoryEntry).record
+		if !record.CreatedAt.Before(since) && !m.expired(record, now) {
+			records = append(records, record)
+		}
+	}
+	SortByCreatedAt(records)
+	return records
+}
+
+func (m *Memory) SaveChecked(record Record, event *Event, since time.Time, check func(recent []Record) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := check(m.userReceipts(record.Receipt.UserID, since)); err != nil {
+		return err
+	}
+	m.save(record)
+	if event != nil {
+		m.events = append(m.events, *event)
+	}
+	return nil
+}
+
+func (p *Postgres) UserReceipts(userID string, since time.Time) ([]Record, error) {
+	return p.query(`SELECT record FROM receipts WHERE record->'receipt'->>'userId' = $1 AND created_at >= $2
+		ORDER BY created_at, id`, userID, since)
+}
+
+func (p *Postgres) SaveChecked(record Record, event *Event, since time.Time, check func(recent []Record) error) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Saves for the same user wait for each other until commit; the lock is released with the transaction
+	userID := record.Receipt.UserID
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('receipts-user:' || $1))`, userID); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`SELECT record FROM receipts WHERE record->'receipt'->>'userId' = $1 AND created_at >= $2
+		ORDER BY created_at, id`, userID, since)
+	if err != nil {
+		return err
+	}
+	recent, err := scanRecords(rows)
+	if err != nil {
+		return err
+	}
+	if err := check(recent); err != nil {
+		return err
+	}
+	if err := saveRecord(tx, record); err != nil {
+		return err
+	}
+	if event != nil {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO outbox (id, event) VALUES ($1, $2)`, event.ID, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// errNoQuotas is returned by a Cached store's quota methods when its backing store can't enforce them
+var errNoQuotas = errors.New("the backing store can't enforce quotas")
+
+func (c *Cached) UserReceipts(userID string, since time.Time) ([]Record, error) {
+	quotas, ok := c.Store.(Quotas)
+	if !ok {
+		return nil, errNoQuotas
+	}
+	return quotas.UserReceipts(userID, since)
+}
+
+func (c *Cached) SaveChecked(record Record, event *Event, since time.Time, check func(recent []Record) error) error {
+	quotas, ok := c.Store.(Quotas)
+	if !ok {
+		return errNoQuotas
+	}
+	defer c.invalidate(record.ID)
+	return quotas.SaveChecked(record, event, since, check)
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"receipt-processor/metrics"
+)
+
+var replicaReads = metrics.NewCounterVec("receipts_store_replica_reads_total", "Reads sent to PostgreSQL read replicas, by where they were answered.", "result")
+
+// Replica read outcomes counted in receipts_store_replica_reads_total
+const (
+	readReplica  = "replica"
+	readFallback = "primary"
+)
+
+// replicaCooldown is how long a replica that failed a read is skipped before it is tried again
+const replicaCooldown = 30 * time.Second
+
+// replica is a read-only copy of the primary database
+type replica struct {
+	db *sql.DB
+	// downUntil is when a replica that failed a read may be tried again
+	downUntil time.Time
+}
+
+// read runs query on the next replica that isn't cooling down, or on the primary when there is
+// none. A read the replica fails is retried on the primary, and so is one it finds nothing for,
+// since a receipt saved a moment ago may not have reached the replica yet.
+func (p *Postgres) read(query func(db *sql.DB) error) error {
+	r := p.nextReplica()
+	if r == nil {
+		return query(p.db)
+	}
+	err := query(r.db)
+	if err == nil {
+		replicaReads.With(readReplica).Inc()
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		log.Printf("reading from a replica failed, reading from the primary for %s: %v", replicaCooldown, err)
+		p.replicasMu.Lock()
+		r.downUntil = time.Now().Add(replicaCooldown)
+		p.replicasMu.Unlock()
+	}
+	replicaReads.With(readFallback).Inc()
+	return query(p.db)
+}
+
+// nextReplica picks the replicas in turn, skipping those cooling down after a failure
+func (p *Postgres) nextReplica() *replica {
+	if len(p.replicas) == 0 {
+		return nil
+	}
+	now := time.Now()
+	p.replicasMu.Lock()
+	defer p.replicasMu.Unlock()
+	for range p.replicas {
+		p.nextRead = (p.nextRead + 1) % len(p.replicas)
+		if r := p.replicas[p.nextRead]; !now.Before(r.downUntil) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into the lowercase words search matches on, in order of appearance
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchText is the text of a record that search covers: the retailer and every item description
+func searchText(record Record) []string {
+	texts := []string{record.Receipt.Retailer}
+	for _, item := range record.Receipt.Items {
+		texts = append(texts, item.ShortDescription)
+	}
+	return texts
+}
+
+// searchTokens returns how often each token occurs in the searchable text of a record
+func searchTokens(record Record) map[string]int {
+	tokens := make(map[string]int)
+	for _, text := range searchText(record) {
+		for _, token := range Tokenize(text) {
+			tokens[token]++
+		}
+	}
+	return tokens
+}
+
+// searchIndex maps every token to the IDs of the records containing it
+type searchIndex map[string]map[string]struct{}
+
+func (index searchIndex) add(record Record) {
+	for token := range searchTokens(record) {
+		ids, ok := index[token]
+		if !ok {
+			ids = make(map[string]struct{})
+			index[token] = ids
+		}
+		ids[record.ID] = struct{}{}
+	}
+}
+
+func (index searchIndex) remove(record Record) {
+	for token := range searchTokens(record) {
+		delete(index[token], record.ID)
+		if len(index[token]) == 0 {
+			delete(index, token)
+		}
+	}
+}
+
+// match returns the IDs of the records containing every token
+func (index searchIndex) match(tokens []string) []string {
+	var smallest map[string]struct{}
+	for _, token := range tokens {
+		ids := index[token]
+		if len(ids) == 0 {
+			return nil
+		}
+		if smallest == nil || len(ids) < len(smallest) {
+			smallest = ids
+		}
+	}
+	var matched []string
+	for id := range smallest {
+		all := true
+		for _, token := range tokens {
+			if _, ok := index[token][id]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			matched = append(matched, id)
+		}
+	}
+	return matched
+}
+
+// rankSearch orders matching records by how often the query's tokens occur in them, then oldest first
+func rankSearch(records []Record, tokens []string) {
+	rank := make(map[string]int, len(records))
+	for _, record := range records {
+		occurrences := searchTokens(record)
+		for _, token := range tokens {
+			rank[record.ID] += occurrences[token]
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if rank[a.ID] != rank[b.ID] {
+			return rank[a.ID] > rank[b.ID]
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+}
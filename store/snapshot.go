@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"receipt-processor/blob"
+)
+
+// WriteSnapshot writes every record in s to w as gzip-compressed JSON lines, returning the number written
+func WriteSnapshot(w io.Writer, s Store) (int, error) {
+	records, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	return len(records), WriteRecords(w, records)
+}
+
+// WriteRecords writes records to w in the snapshot format, gzip-compressed JSON lines
+func WriteRecords(w io.Writer, records []Record) error {
+	compressed := gzip.NewWriter(w)
+	encoder := json.NewEncoder(compressed)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return compressed.Close()
+}
+
+// ReadSnapshot loads a snapshot written by WriteSnapshot into s, returning the number of records restored.
+// Records already in s are kept unless the snapshot holds a record with the same ID.
+func ReadSnapshot(r io.Reader, s Store) (int, error) {
+	restored := 0
+	err := ReadRecords(r, func(record Record) error {
+		if err := s.Save(record); err != nil {
+			return err
+		}
+		restored++
+		return nil
+	})
+	return restored, err
+}
+
+// ReadRecords calls fn with every record of a file in the snapshot format, stopping at the first
+// error fn returns
+func ReadRecords(r io.Reader, fn func(Record) error) error {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	defer compressed.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(compressed))
+	for n := 1; ; n++ {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading snapshot record %d: %w", n, err)
+		}
+		if record.ID == "" {
+			return fmt.Errorf("reading snapshot record %d: missing id", n)
+		}
+		// Snapshots taken before receipts had a status only held receipts that counted
+		if record.Status == "" {
+			record.Status, record.StatusChangedAt = StatusApproved, record.CreatedAt
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// EraseRecords rewrites every file stored below prefix, each in the snapshot format, without the
+// records erase matches, and returns how many records it removed. Files holding none of them are
+// left as they are.
+func EraseRecords(objects blob.Store, prefix string, erase func(Record) bool) (int, error) {
+	keys, err := objects.List(prefix)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, key := range keys {
+		file, err := objects.Get(key)
+		if err != nil {
+			return removed, fmt.Errorf("opening %s: %w", key, err)
+		}
+		var kept []Record
+		matched := 0
+		err = ReadRecords(file, func(record Record) error {
+			if erase(record) {
+				matched++
+			} else {
+				kept = append(kept, record)
+			}
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return removed, fmt.Errorf("reading %s: %w", key, err)
+		}
+		if matched == 0 {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := WriteRecords(&buf, kept); err != nil {
+			return removed, err
+		}
+		if err := objects.Put(key, &buf); err != nil {
+			return removed, fmt.Errorf("rewriting %s: %w", key, err)
+		}
+		removed += matched
+	}
+	return removed, nil
+}
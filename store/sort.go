@@ -0,0 +1,83 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields listings can be sorted by
+const (
+	SortCreatedAt    = "createdAt"
+	SortPoints       = "points"
+	SortTotal        = "total"
+	SortPurchaseDate = "purchaseDate"
+	SortRetailer     = "retailer"
+)
+
+// SortFields lists every field listings can be sorted by
+var SortFields = []string{SortCreatedAt, SortPoints, SortTotal, SortPurchaseDate, SortRetailer}
+
+// Sort orders a listing by one field. Ties are broken by creation time, then ID, so the order is
+// stable; Descending reverses the whole order, tie-breaks included. Retailers compare ignoring case.
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// ValidSortField reports whether listings can be sorted by field
+func ValidSortField(field string) bool {
+	for _, candidate := range SortFields {
+		if field == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// SortRecords orders records in memory, for backends that can't sort as they read
+func SortRecords(records []Record, by Sort) {
+	compare := func(a, b Record) int {
+		switch by.Field {
+		case SortPoints:
+			return a.Points - b.Points
+		case SortTotal:
+			return compareFloats(parseTotal(a.Receipt.Total), parseTotal(b.Receipt.Total))
+		case SortPurchaseDate:
+			// Dates are YYYY-MM-DD, so they sort as strings
+			return strings.Compare(a.Receipt.PurchaseDate, b.Receipt.PurchaseDate)
+		case SortRetailer:
+			return strings.Compare(strings.ToLower(a.Receipt.Retailer), strings.ToLower(b.Receipt.Retailer))
+		}
+		return 0
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if by.Descending {
+			a, b = b, a
+		}
+		if c := compare(a, b); c != 0 {
+			return c < 0
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// parseTotal reads a receipt total, treating one that doesn't parse as zero
+func parseTotal(total string) float64 {
+	value, _ := strconv.ParseFloat(total, 64)
+	return value
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
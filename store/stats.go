@@ -0,0 +1,135 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Stats describes what a store holds, for capacity planning
+type Stats struct {
+	// Backend names the store receipts are kept in: memory or postgres
+	Backend  string `json:"backend"`
+	Receipts int    `json:"receipts"`
+	// Bytes is the approximate memory, or disk for a database, the receipts take up
+	Bytes int64 `json:"bytes"`
+	// Oldest and Newest are when the first and last stored receipts were created, nil when there are none
+	Oldest *time.Time `json:"oldestReceipt"`
+	Newest *time.Time `json:"newestReceipt"`
+	// Users counts the receipts of each user, and WithoutUser those submitted without one
+	Users       map[string]int `json:"users"`
+	WithoutUser int            `json:"withoutUser"`
+	// Cached is the number of receipts held by a read cache in front of the store, nil without one
+	Cached *int `json:"cachedReceipts,omitempty"`
+}
+
+// Introspector is implemented by the stores that can describe their contents without listing them
+type Introspector interface {
+	Stats() (Stats, error)
+}
+
+// BackendName names the store receipts are kept in behind s: memory, postgres or unknown
+func BackendName(s Store) string {
+	switch s := s.(type) {
+	case *Memory:
+		return "memory"
+	case *Postgres:
+		return "postgres"
+	case *Cached:
+		return BackendName(s.Store)
+	}
+	return "unknown"
+}
+
+// CollectStats describes s, listing its records when it can't describe itself
+func CollectStats(s Store) (Stats, error) {
+	if introspector, ok := s.(Introspector); ok {
+		return introspector.Stats()
+	}
+	records, err := s.List()
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{Backend: "unknown", Users: make(map[string]int)}
+	for _, record := range records {
+		stats.add(record)
+		stats.Bytes += approximateSize(record)
+	}
+	return stats, nil
+}
+
+// add counts a record in the stats
+func (s *Stats) add(record Record) {
+	s.Receipts++
+	if s.Oldest == nil || record.CreatedAt.Before(*s.Oldest) {
+		createdAt := record.CreatedAt
+		s.Oldest = &createdAt
+	}
+	if s.Newest == nil || record.CreatedAt.After(*s.Newest) {
+		createdAt := record.CreatedAt
+		s.Newest = &createdAt
+	}
+	if userID := record.Receipt.UserID; userID != "" {
+		s.Users[userID]++
+	} else {
+		s.WithoutUser++
+	}
+}
+
+func (m *Memory) Stats() (Stats, error) {
+	now := m.opts.Clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := Stats{Backend: "memory", Bytes: m.bytes, Users: make(map[string]int)}
+	for _, element := range m.receipts {
+		if record := element.Value.(*memoryEntry).record; !m.expired(record, now) {
+			stats.add(record)
+		}
+	}
+	return stats, nil
+}
+
+func (p *Postgres) Stats() (Stats, error) {
+	stats := Stats{Backend: "postgres", Users: make(map[string]int)}
+	var oldest, newest sql.NullTime
+	// The table's size includes its indexes and the TOAST storage of large records
+	err := p.db.QueryRow(`SELECT count(*), min(created_at), max(created_at), pg_total_relation_size('receipts') FROM receipts`).
+		Scan(&stats.Receipts, &oldest, &newest, &stats.Bytes)
+	if err != nil {
+		return Stats{}, err
+	}
+	if oldest.Valid {
+		stats.Oldest, stats.Newest = &oldest.Time, &newest.Time
+	}
+
+	rows, err := p.db.Query(`SELECT coalesce(record->'receipt'->>'userId', ''), count(*) FROM receipts GROUP BY 1`)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return Stats{}, err
+		}
+		if userID == "" {
+			stats.WithoutUser = count
+		} else {
+			stats.Users[userID] = count
+		}
+	}
+	return stats, rows.Err()
+}
+
+// Stats describes the backing store, with the number of receipts cached in front of it
+func (c *Cached) Stats() (Stats, error) {
+	stats, err := CollectStats(c.Store)
+	if err != nil {
+		return Stats{}, err
+	}
+	c.mu.Lock()
+	cached := c.lru.Len()
+	c.mu.Unlock()
+	stats.Cached = &cached
+	return stats, nil
+}
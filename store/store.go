@@ -0,0 +1,104 @@
+// Package store persists processed receipts.
+package store
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"receipt-processor/receipt"
+)
+
+// ErrNotFound is returned when no receipt is stored under an ID
+var ErrNotFound = errors.New("receipt not found")
+
+// Receipt statuses. Receipts start pending, or in review when flagged, until they are
+// approved or rejected; only approved receipts count toward a user's points. Receipts merged into
+// another are merged whatever their status was.
+const (
+	StatusPending  = "pending"
+	StatusReview   = "review"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusMerged   = "merged"
+)
+
+// Record is a processed receipt together with the points it was awarded
+type Record struct {
+	ID        string          `json:"id"`
+	Points    int             `json:"points"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Receipt   receipt.Receipt `json:"receipt"`
+	// Flagged marks receipts a fraud check found suspicious, with the reasons it gave
+	Flagged     bool     `json:"flagged,omitempty"`
+	FlagReasons []string `json:"flagReasons,omitempty"`
+	// Status is where the receipt is in its review lifecycle
+	Status          string    `json:"status"`
+	StatusChangedAt time.Time `json:"statusChangedAt"`
+	// ReviewedBy names the caller who approved or rejected the receipt, empty when it was auto-approved
+	ReviewedBy string `json:"reviewedBy,omitempty"`
+	// Edited marks receipts a reviewer corrected before approving them
+	Edited bool `json:"edited,omitempty"`
+	// Streak is the length the receipt extended its user's streak of consecutive days to when it was
+	// submitted, 0 when it didn't extend it
+	Streak int `json:"streak,omitempty"`
+	// DeletedAt is when the receipt was moved to the trash; deleted receipts are hidden until they
+	// are restored or purged
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Tags are the labels operators put on the receipt, e.g. "disputed", sorted
+	Tags []string `json:"tags,omitempty"`
+	// History lists every change to the points since the receipt was first scored, oldest first
+	History []ScoreChange `json:"history,omitempty"`
+	// ArchivedAt is when the receipt was moved to cold storage, leaving this record as a stub without
+	// its items, metadata or history; Archive is the key of the cold storage object holding them
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	Archive    string     `json:"archive,omitempty"`
+	// MergedInto is the ID of the receipt this one was merged into, with the other parts of its purchase
+	MergedInto string `json:"mergedInto,omitempty"`
+}
+
+// ScoreChange records one change to a receipt's points
+type ScoreChange struct {
+	OldPoints int       `json:"oldPoints"`
+	NewPoints int       `json:"newPoints"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	Time      time.Time `json:"time"`
+}
+
+// Decided reports whether the receipt was already approved, rejected or merged
+func (r Record) Decided() bool {
+	return r.Status == StatusApproved || r.Status == StatusRejected || r.Status == StatusMerged
+}
+
+// Deleted reports whether the receipt is in the trash
+func (r Record) Deleted() bool {
+	return r.DeletedAt != nil
+}
+
+// Archived reports whether the receipt is a stub of one moved to cold storage
+func (r Record) Archived() bool {
+	return r.ArchivedAt != nil
+}
+
+// HasTag reports whether an operator put tag on the receipt
+func (r Record) HasTag(tag string) bool {
+	return slices.Contains(r.Tags, tag)
+}
+
+// Store is implemented by every persistence backend
+type Store interface {
+	// Save stores the record, replacing any record with the same ID
+	Save(record Record) error
+	// Get returns the record stored under id, or ErrNotFound
+	Get(id string) (Record, error)
+	// List returns every stored record, oldest first
+	List() ([]Record, error)
+	// ListSorted returns every stored record in the given order
+	ListSorted(by Sort) ([]Record, error)
+	// Search returns up to limit records whose retailer or item descriptions contain every word
+	// of query, best matches first; a limit of zero returns every match
+	Search(query string, limit int) ([]Record, error)
+	// Delete removes the record stored under id, or returns ErrNotFound
+	Delete(id string) error
+}
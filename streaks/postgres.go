@@ -0,0 +1,99 @@
+package streaks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Postgres keeps the streaks in a PostgreSQL table, so every instance sharing the database extends
+// the same streak
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres keeps the streaks in db, creating the table when it doesn't exist yet
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS streaks (
+		user_id   text PRIMARY KEY,
+		current   integer NOT NULL,
+		longest   integer NOT NULL,
+		last_day  text NOT NULL,
+		bonus_day text NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating streaks table: %w", err)
+	}
+	return &Postgres{db: db}, nil
+}
+
+func (p *Postgres) Get(userID string) (Streak, error) {
+	streak := Streak{UserID: userID}
+	err := p.db.QueryRow(`SELECT current, longest, last_day, bonus_day FROM streaks WHERE user_id = $1`, userID).
+		Scan(&streak.Current, &streak.Longest, &streak.LastDay, &streak.BonusDay)
+	if errors.Is(err, sql.ErrNoRows) {
+		return streak, nil
+	}
+	return streak, err
+}
+
+func (p *Postgres) Record(userID string, submitted time.Time) (Streak, error) {
+	return p.update(userID, func(streak Streak) (Streak, bool) { return streak.extend(submitted) })
+}
+
+func (p *Postgres) Reserve(userID string, now time.Time) (int, error) {
+	next := 0
+	_, err := p.update(userID, func(streak Streak) (Streak, bool) {
+		var reserved bool
+		streak, next, reserved = streak.reserve(now)
+		return streak, reserved
+	})
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+func (p *Postgres) Release(userID string, submitted time.Time) error {
+	_, err := p.update(userID, func(streak Streak) (Streak, bool) { return streak.release(submitted) })
+	return err
+}
+
+// update replaces a user's streak with the one change returns while holding its row locked, so
+// approvals and submissions on different instances change it one after the other
+func (p *Postgres) update(userID string, change func(Streak) (Streak, bool)) (Streak, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return Streak{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO streaks (user_id, current, longest, last_day) VALUES ($1, 0, 0, '')
+		ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+		return Streak{}, err
+	}
+	previous := Streak{UserID: userID}
+	err = tx.QueryRow(`SELECT current, longest, last_day, bonus_day FROM streaks WHERE user_id = $1 FOR UPDATE`, userID).
+		Scan(&previous.Current, &previous.Longest, &previous.LastDay, &previous.BonusDay)
+	if err != nil {
+		return Streak{}, err
+	}
+	streak, changed := change(previous)
+	if !changed {
+		return streak, nil
+	}
+	if _, err := tx.Exec(`UPDATE streaks SET current = $2, longest = $3, last_day = $4, bonus_day = $5 WHERE user_id = $1`,
+		userID, streak.Current, streak.Longest, streak.LastDay, streak.BonusDay); err != nil {
+		return Streak{}, err
+	}
+	return streak, tx.Commit()
+}
+
+func (p *Postgres) EraseUser(userID string) (bool, error) {
+	result, err := p.db.Exec(`DELETE FROM streaks WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
@@ -0,0 +1,264 @@
+// Package streaks tracks how many consecutive days each user has had a receipt approved.
+package streaks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dayLayout formats the UTC days streaks are counted in
+const dayLayout = "2006-01-02"
+
+// Streak is a user's run of consecutive days with at least one approved receipt
+type Streak struct {
+	UserID string `json:"userId"`
+	// Current is the length of the run ending on LastDay
+	Current int `json:"current"`
+	// Longest is the longest run the user ever had
+	Longest int `json:"longest"`
+	// LastDay is the last UTC day the user had a receipt approved, e.g. "2022-03-20"
+	LastDay string `json:"lastDay"`
+	// BonusDay is the last UTC day one of the user's receipts was granted the streak bonus, so the
+	// receipts they submit that day before it is approved don't earn it again
+	BonusDay string `json:"bonusDay,omitempty"`
+}
+
+// Active returns the streak as of now: a run whose last day is before yesterday is broken, so its
+// current length is 0
+func (s Streak) Active(now time.Time) Streak {
+	if s.LastDay != day(now) && s.LastDay != day(now.AddDate(0, 0, -1)) {
+		s.Current = 0
+	}
+	return s
+}
+
+// Next returns the length the streak reaches with a receipt submitted at now, or 0 when the user
+// already had a receipt approved that day, or granted that day's bonus, and the streak doesn't grow
+func (s Streak) Next(now time.Time) int {
+	today := day(now)
+	switch {
+	case s.LastDay == today || s.BonusDay == today:
+		return 0
+	case s.LastDay == day(now.AddDate(0, 0, -1)):
+		return s.Current + 1
+	}
+	return 1
+}
+
+// reserve grants the bonus of the day of now, returning the length the streak reaches as Next
+// does; the streak is unchanged when that is 0
+func (s Streak) reserve(now time.Time) (Streak, int, bool) {
+	next := s.Next(now)
+	if next == 0 {
+		return s, 0, false
+	}
+	s.BonusDay = day(now)
+	return s, next, true
+}
+
+// release gives back the bonus of the day of submitted, reporting false when it wasn't granted
+func (s Streak) release(submitted time.Time) (Streak, bool) {
+	if s.BonusDay == "" || s.BonusDay != day(submitted) {
+		return s, false
+	}
+	s.BonusDay = ""
+	return s, true
+}
+
+// extend returns the streak with a receipt submitted at submitted approved, reporting false when
+// the streak already covers that day and is left unchanged
+func (s Streak) extend(submitted time.Time) (Streak, bool) {
+	today := day(submitted)
+	switch {
+	case s.LastDay != "" && today <= s.LastDay:
+		// Approving an older receipt late doesn't rewrite the streak
+		return s, false
+	case s.LastDay == day(submitted.AddDate(0, 0, -1)):
+		s.Current++
+	default:
+		s.Current = 1
+	}
+	s.LastDay = today
+	s.Longest = max(s.Longest, s.Current)
+	return s, true
+}
+
+// Store keeps the streaks: a Registry in memory or a file for a single instance, or Postgres shared
+// by every instance
+type Store interface {
+	// Get returns a user's streak as stored, the zero streak when they never had a receipt approved
+	Get(userID string) (Streak, error)
+	// Record extends a user's streak with a receipt they submitted at submitted that was approved.
+	// Receipts from a day the streak already covers leave it unchanged.
+	Record(userID string, submitted time.Time) (Streak, error)
+	// Reserve grants the streak bonus of the day of now to one of the user's receipts, returning
+	// the length the streak reaches, or 0 when the day's bonus was already granted or the streak
+	// already covers the day
+	Reserve(userID string, now time.Time) (int, error)
+	// Release gives back the bonus granted to a receipt submitted at submitted that won't be
+	// approved, so another receipt of that day can earn it
+	Release(userID string, submitted time.Time) error
+	// EraseUser removes a user's streak, reporting whether they had one
+	EraseUser(userID string) (bool, error)
+}
+
+// Registry holds every user's streak, optionally persisted to a JSON file
+type Registry struct {
+	path string
+
+	mu      sync.Mutex
+	streaks map[string]Streak
+}
+
+// Open loads the streaks persisted at path, creating the file on first change. An empty path keeps
+// them in memory.
+func Open(path string) (*Registry, error) {
+	reg := &Registry{path: path, streaks: make(map[string]Streak)}
+	if path == "" {
+		return reg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var streaks []Streak
+	if err := json.Unmarshal(data, &streaks); err != nil {
+		return nil, fmt.Errorf("parsing streaks %s: %w", path, err)
+	}
+	for _, streak := range streaks {
+		reg.streaks[streak.UserID] = streak
+	}
+	return reg, nil
+}
+
+// Get returns a user's streak as stored, the zero streak when they never had a receipt approved
+func (reg *Registry) Get(userID string) (Streak, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	streak, ok := reg.streaks[userID]
+	if !ok {
+		streak.UserID = userID
+	}
+	return streak, nil
+}
+
+// Record extends a user's streak with a receipt they submitted at submitted that was approved.
+// Receipts from a day the streak already covers leave it unchanged.
+func (reg *Registry) Record(userID string, submitted time.Time) (Streak, error) {
+	return reg.update(userID, func(streak Streak) (Streak, bool) { return streak.extend(submitted) })
+}
+
+// Reserve grants the streak bonus of the day of now to one of the user's receipts, returning the
+// length the streak reaches, or 0 when the day's bonus was already granted or the streak covers it
+func (reg *Registry) Reserve(userID string, now time.Time) (int, error) {
+	next := 0
+	_, err := reg.update(userID, func(streak Streak) (Streak, bool) {
+		var reserved bool
+		streak, next, reserved = streak.reserve(now)
+		return streak, reserved
+	})
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// Release gives back the bonus granted to a receipt submitted at submitted that won't be approved
+func (reg *Registry) Release(userID string, submitted time.Time) error {
+	_, err := reg.update(userID, func(streak Streak) (Streak, bool) { return streak.release(submitted) })
+	return err
+}
+
+// update replaces a user's streak with the one change returns, persisting it when change reports
+// a change
+func (reg *Registry) update(userID string, change func(Streak) (Streak, bool)) (Streak, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	previous, existed := reg.streaks[userID]
+	previous.UserID = userID
+	streak, changed := change(previous)
+	if !changed {
+		return streak, nil
+	}
+	reg.streaks[userID] = streak
+
+	err := reg.persist(func() {
+		if existed {
+			reg.streaks[userID] = previous
+		} else {
+			delete(reg.streaks, userID)
+		}
+	})
+	if err != nil {
+		return Streak{}, err
+	}
+	return streak, nil
+}
+
+// EraseUser removes a user's streak, reporting whether they had one
+func (reg *Registry) EraseUser(userID string) (bool, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	previous, exists := reg.streaks[userID]
+	if !exists {
+		return false, nil
+	}
+	delete(reg.streaks, userID)
+	if err := reg.persist(func() { reg.streaks[userID] = previous }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// persist writes the streaks to their file, calling undo to roll the change back when that fails;
+// the caller holds mu
+func (reg *Registry) persist(undo func()) error {
+	if reg.path == "" {
+		return nil
+	}
+	streaks := make([]Streak, 0, len(reg.streaks))
+	for _, streak := range reg.streaks {
+		streaks = append(streaks, streak)
+	}
+	sort.Slice(streaks, func(i, j int) bool { return streaks[i].UserID < streaks[j].UserID })
+	err := writeFile(reg.path, streaks)
+	if err != nil {
+		undo()
+	}
+	return err
+}
+
+// writeFile replaces the file through a temporary file so a crash never leaves it half written
+func writeFile(path string, streaks []Streak) error {
+	data, err := json.MarshalIndent(streaks, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".streaks-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format(dayLayout)
+}
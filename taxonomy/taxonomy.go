@@ -0,0 +1,89 @@
+// Package taxonomy assigns item categories from keywords in their descriptions.
+package taxonomy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"receipt-processor/receipt"
+	"receipt-processor/validation"
+)
+
+// Taxonomy maps description keywords to categories
+type Taxonomy struct {
+	categories []category
+}
+
+type category struct {
+	name     string
+	keywords []string
+}
+
+// New builds a taxonomy from category names to keywords. Keywords match whole words of a
+// description regardless of case, and may span several words, e.g. "orange juice".
+func New(keywords map[string][]string) (*Taxonomy, error) {
+	t := &Taxonomy{}
+	for name, words := range keywords {
+		if !validation.Category(name) {
+			return nil, fmt.Errorf("category %q is not a valid category name", name)
+		}
+		c := category{name: name}
+		for _, word := range words {
+			if normalized := normalize(word); normalized != "  " {
+				c.keywords = append(c.keywords, normalized)
+			}
+		}
+		t.categories = append(t.categories, c)
+	}
+	// Check categories in name order so a description matching several always gets the same one
+	sort.Slice(t.categories, func(i, j int) bool { return t.categories[i].name < t.categories[j].name })
+	return t, nil
+}
+
+// Load reads a JSON file mapping each category to its keywords, e.g. {"produce": ["apple", "banana"]}
+func Load(path string) (*Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading category taxonomy: %w", err)
+	}
+	var keywords map[string][]string
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return nil, fmt.Errorf("parsing category taxonomy %s: %w", path, err)
+	}
+	return New(keywords)
+}
+
+// Categorize returns the category whose keywords appear in the description, or "" when none do
+func (t *Taxonomy) Categorize(description string) string {
+	normalized := normalize(description)
+	for _, c := range t.categories {
+		for _, keyword := range c.keywords {
+			if strings.Contains(normalized, keyword) {
+				return c.name
+			}
+		}
+	}
+	return ""
+}
+
+// Apply fills in the category of every item the client didn't categorize itself
+func (t *Taxonomy) Apply(r *receipt.Receipt) {
+	for i := range r.Items {
+		if r.Items[i].Category == "" {
+			r.Items[i].Category = t.Categorize(r.Items[i].ShortDescription)
+		}
+	}
+}
+
+// normalize lowercases s, turns every run of non-alphanumeric characters into one space and pads
+// it with spaces, so strings.Contains only matches whole words
+func normalize(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
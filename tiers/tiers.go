@@ -0,0 +1,51 @@
+// Package tiers ranks users into loyalty tiers by their points balance.
+package tiers
+
+import "sort"
+
+// Tier is a loyalty tier, reached once a user's balance is at least MinPoints
+type Tier struct {
+	Name      string `json:"name"`
+	MinPoints int    `json:"minPoints"`
+}
+
+// Tiers lists the loyalty tiers from the lowest threshold to the highest
+type Tiers []Tier
+
+// DefaultThresholds are the tiers used when none are configured
+var DefaultThresholds = map[string]int{"bronze": 0, "silver": 1000, "gold": 5000}
+
+// New orders the tiers named by thresholds, which map tier names to their minimum balance
+func New(thresholds map[string]int) Tiers {
+	tiers := make(Tiers, 0, len(thresholds))
+	for name, minPoints := range thresholds {
+		tiers = append(tiers, Tier{Name: name, MinPoints: minPoints})
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		if tiers[i].MinPoints != tiers[j].MinPoints {
+			return tiers[i].MinPoints < tiers[j].MinPoints
+		}
+		return tiers[i].Name < tiers[j].Name
+	})
+	return tiers
+}
+
+// For returns the highest tier a balance reaches, reporting false when it is below every threshold
+func (t Tiers) For(balance int) (Tier, bool) {
+	for i := len(t) - 1; i >= 0; i-- {
+		if balance >= t[i].MinPoints {
+			return t[i], true
+		}
+	}
+	return Tier{}, false
+}
+
+// Next returns the lowest tier a balance hasn't reached yet, reporting false when it reached them all
+func (t Tiers) Next(balance int) (Tier, bool) {
+	for _, tier := range t {
+		if balance < tier.MinPoints {
+			return tier, true
+		}
+	}
+	return Tier{}, false
+}
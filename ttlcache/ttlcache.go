@@ -0,0 +1,205 @@
+// Package ttlcache is an in-memory key-value cache whose entries expire a fixed time after they
+// are stored. It backs the idempotency keys, request nonces and catalog lookups kept in memory.
+package ttlcache
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// Options configures a Cache
+type Options struct {
+	// TTL is how long an entry lives after it is stored
+	TTL time.Duration
+	// MaxEntries bounds the entries held, 0 for no bound. A full cache drops its expired entries,
+	// then arbitrary ones, to make room.
+	MaxEntries int
+	// Shards splits the cache so concurrent callers rarely wait on each other, 16 by default
+	Shards int
+	// SweepInterval is how often the janitor drops expired entries, TTL by default; expired
+	// entries are never returned, the janitor only bounds the memory they hold
+	SweepInterval time.Duration
+	// Now tells the time, time.Now by default
+	Now func() time.Time
+}
+
+// Cache maps keys to values that expire. Its methods are safe for concurrent use.
+type Cache[K ~string, V any] struct {
+	opts   Options
+	seed   maphash.Seed
+	shards []*shard[K, V]
+	stop   chan struct{}
+	once   sync.Once
+}
+
+type shard[K ~string, V any] struct {
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	// limit is the shard's share of MaxEntries, 0 for no bound
+	limit int
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// New returns a cache and starts its janitor, which runs until Close
+func New[K ~string, V any](opts Options) *Cache[K, V] {
+	if opts.Shards <= 0 {
+		opts.Shards = 16
+	}
+	if opts.SweepInterval <= 0 {
+		opts.SweepInterval = opts.TTL
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	c := &Cache[K, V]{opts: opts, seed: maphash.MakeSeed(), shards: make([]*shard[K, V], opts.Shards), stop: make(chan struct{})}
+	for i := range c.shards {
+		c.shards[i] = &shard[K, V]{entries: make(map[K]entry[V])}
+		if opts.MaxEntries > 0 {
+			// Round up so the shards together hold at least MaxEntries
+			c.shards[i].limit = (opts.MaxEntries + opts.Shards - 1) / opts.Shards
+		}
+	}
+	if opts.SweepInterval > 0 {
+		go c.janitor()
+	}
+	return c
+}
+
+func (c *Cache[K, V]) shard(key K) *shard[K, V] {
+	return c.shards[maphash.String(c.seed, string(key))%uint64(len(c.shards))]
+}
+
+// Get returns the value stored under key, reporting false when there is none or it expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || !c.opts.Now().Before(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key for TTL, replacing any earlier value
+func (c *Cache[K, V]) Set(key K, value V) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := c.opts.Now()
+	s.put(key, entry[V]{value: value, expires: now.Add(c.opts.TTL)}, now)
+}
+
+// SetIfAbsent stores value under key for TTL unless a live value is already stored, which it
+// returns with false instead
+func (c *Cache[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := c.opts.Now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.value, false
+	}
+	s.put(key, entry[V]{value: value, expires: now.Add(c.opts.TTL)}, now)
+	return value, true
+}
+
+// Update replaces the value stored under key with the one fn returns, given the live value and
+// whether there is one. A replaced value keeps its expiry and a new one lives for TTL; when fn
+// reports false the key is removed instead.
+func (c *Cache[K, V]) Update(key K, fn func(value V, ok bool) (V, bool)) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := c.opts.Now()
+	e, ok := s.entries[key]
+	if ok && !now.Before(e.expires) {
+		var zero V
+		e, ok = entry[V]{value: zero}, false
+	}
+	value, keep := fn(e.value, ok)
+	if !keep {
+		delete(s.entries, key)
+		return
+	}
+	if !ok {
+		e.expires = now.Add(c.opts.TTL)
+	}
+	e.value = value
+	s.put(key, e, now)
+}
+
+// Delete removes the value stored under key
+func (c *Cache[K, V]) Delete(key K) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// Len counts the entries held, including expired ones the janitor hasn't dropped yet
+func (c *Cache[K, V]) Len() int {
+	count := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		count += len(s.entries)
+		s.mu.Unlock()
+	}
+	return count
+}
+
+// Close stops the janitor
+func (c *Cache[K, V]) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+func (c *Cache[K, V]) janitor() {
+	ticker := time.NewTicker(c.opts.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.sweep()
+		}
+	}
+}
+
+// sweep drops every expired entry
+func (c *Cache[K, V]) sweep() {
+	now := c.opts.Now()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.dropExpired(now)
+		s.mu.Unlock()
+	}
+}
+
+// put stores an entry, making room first when the shard is full. The caller holds s.mu.
+func (s *shard[K, V]) put(key K, e entry[V], now time.Time) {
+	if _, exists := s.entries[key]; !exists && s.limit > 0 && len(s.entries) >= s.limit {
+		s.dropExpired(now)
+		for k := range s.entries {
+			if len(s.entries) < s.limit {
+				break
+			}
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = e
+}
+
+func (s *shard[K, V]) dropExpired(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
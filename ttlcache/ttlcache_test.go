@@ -0,0 +1,142 @@
+package ttlcache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a time source the tests move by hand
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestCache(opts Options) (*Cache[string, int], *clock) {
+	clk := &clock{now: time.Unix(1700000000, 0)}
+	opts.Now = clk.Now
+	// Sweep by hand so the janitor doesn't race the assertions
+	opts.SweepInterval = time.Hour * 24 * 365
+	c := New[string, int](opts)
+	return c, clk
+}
+
+func TestEntriesExpireAfterTTL(t *testing.T) {
+	c, clk := newTestCache(Options{TTL: time.Minute})
+	defer c.Close()
+
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get = %d, %v, want 1, true", v, ok)
+	}
+	clk.Advance(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("entry outlived its TTL")
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Len = %d before the sweep, want 1", c.Len())
+	}
+	c.sweep()
+	if c.Len() != 0 {
+		t.Fatalf("Len = %d after the sweep, want 0", c.Len())
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	c, clk := newTestCache(Options{TTL: time.Minute})
+	defer c.Close()
+
+	if v, stored := c.SetIfAbsent("a", 1); !stored || v != 1 {
+		t.Fatalf("first SetIfAbsent = %d, %v, want 1, true", v, stored)
+	}
+	if v, stored := c.SetIfAbsent("a", 2); stored || v != 1 {
+		t.Fatalf("second SetIfAbsent = %d, %v, want 1, false", v, stored)
+	}
+	clk.Advance(time.Minute)
+	if v, stored := c.SetIfAbsent("a", 3); !stored || v != 3 {
+		t.Fatalf("SetIfAbsent after expiry = %d, %v, want 3, true", v, stored)
+	}
+}
+
+func TestUpdateKeepsExpiry(t *testing.T) {
+	c, clk := newTestCache(Options{TTL: time.Minute})
+	defer c.Close()
+
+	increment := func(v int, _ bool) (int, bool) { return v + 1, true }
+	c.Update("a", increment)
+	clk.Advance(40 * time.Second)
+	c.Update("a", increment)
+	if v, _ := c.Get("a"); v != 2 {
+		t.Fatalf("Get = %d, want 2", v)
+	}
+	clk.Advance(20 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Update extended the entry's expiry")
+	}
+
+	c.Set("b", 1)
+	c.Update("b", func(int, bool) (int, bool) { return 0, false })
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("Update reporting false kept the entry")
+	}
+}
+
+func TestMaxEntriesBoundsSize(t *testing.T) {
+	c, clk := newTestCache(Options{TTL: time.Minute, MaxEntries: 64, Shards: 4})
+	defer c.Close()
+
+	for i := 0; i < 1000; i++ {
+		c.Set(strconv.Itoa(i), i)
+		if i == 500 {
+			clk.Advance(time.Minute)
+		}
+	}
+	if n := c.Len(); n > 64 {
+		t.Fatalf("Len = %d, want at most 64", n)
+	}
+	if v, ok := c.Get("999"); !ok || v != 999 {
+		t.Fatalf("latest entry = %d, %v, want 999, true", v, ok)
+	}
+}
+
+func TestConcurrentSetIfAbsentStoresOnce(t *testing.T) {
+	c := New[string, int](Options{TTL: time.Minute})
+	defer c.Close()
+
+	const goroutines, keys = 8, 1000
+	stored := make([]int, goroutines)
+	var wg sync.WaitGroup
+	for g := range stored {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				if _, ok := c.SetIfAbsent(strconv.Itoa(i), g); ok {
+					stored[g]++
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range stored {
+		total += n
+	}
+	if total != keys {
+		t.Fatalf("%d keys stored, want %d", total, keys)
+	}
+}
@@ -0,0 +1,53 @@
+package validation_test
+
+import (
+	"regexp"
+	"testing"
+
+	"receipt-processor/validation"
+)
+
+// The CompilePerCall benchmarks reproduce the previous approach of compiling the pattern
+// inside the item loop, for comparison with the precompiled validators.
+
+func BenchmarkShortDescription(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		validation.ShortDescription("Klarbrunn 12-PK 12 FL OZ")
+	}
+}
+
+func BenchmarkShortDescriptionCompilePerCall(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		regexp.MustCompile("^[\\w\\s\\-]+$").MatchString("Klarbrunn 12-PK 12 FL OZ")
+	}
+}
+
+func BenchmarkPrice(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		validation.Price("12.25")
+	}
+}
+
+func BenchmarkPriceCompilePerCall(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		regexp.MustCompile("^\\d+\\.\\d{2}$").MatchString("12.25")
+	}
+}
+
+func BenchmarkRetailer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		validation.Retailer("M&M Corner Market")
+	}
+}
+
+func BenchmarkRetailerCompilePerCall(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		regexp.MustCompile("^[\\w\\s\\-&]+$").MatchString("M&M Corner Market")
+	}
+}
@@ -0,0 +1,185 @@
+// Package validation holds the field formats accepted on receipts. Patterns are compiled once
+// at init and shared by every request.
+package validation
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field patterns
+var (
+	RetailerPattern         = regexp.MustCompile("^[\\w\\s\\-&]+$")
+	ShortDescriptionPattern = regexp.MustCompile("^[\\w\\s\\-]+$")
+	AmountPattern           = regexp.MustCompile("^\\d+\\.\\d{2}$")
+	SignedAmountPattern     = regexp.MustCompile("^-?\\d+\\.\\d{2}$")
+	UserIDPattern           = regexp.MustCompile("^[\\w\\-.@]{1,128}$")
+	QuantityPattern         = regexp.MustCompile("^\\d{1,6}(\\.\\d{1,3})?$")
+	CategoryPattern         = regexp.MustCompile("^[a-z0-9\\-]{1,64}$")
+	UPCPattern              = regexp.MustCompile("^\\d{8,14}$")
+	BrandPattern            = regexp.MustCompile("^[\\w\\s\\-&.']{1,64}$")
+	MetadataKeyPattern      = regexp.MustCompile("^[\\w\\-.]{1,64}$")
+	TagPattern              = regexp.MustCompile("^[\\w\\-.:]{1,64}$")
+)
+
+// FieldError locates one reason a request body is invalid, e.g. {"pointer": "/items/2/price", ...}
+type FieldError struct {
+	// Pointer is the JSON Pointer of the offending value, "" for the body itself
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+	// MessageKey identifies the message in the error message catalog when it is there, so problem
+	// responses write it in the language of the request and clients can translate it themselves
+	MessageKey string `json:"messageKey,omitempty"`
+}
+
+// Metadata size limits, so integrators can't turn receipts into arbitrary storage
+const (
+	MaxMetadataEntries     = 32
+	MaxMetadataValueLength = 256
+)
+
+// MaxTags is how many tags an operator can put on one receipt
+const MaxTags = 32
+
+// Layouts used to parse the purchase date and time
+const (
+	DateLayout = "2006-01-02"
+	TimeLayout = "15:04"
+)
+
+// Retailer reports whether s is a valid retailer name
+func Retailer(s string) bool {
+	return RetailerPattern.MatchString(s)
+}
+
+// ShortDescription reports whether s is a valid item description
+func ShortDescription(s string) bool {
+	return ShortDescriptionPattern.MatchString(s)
+}
+
+// Price reports whether s is a valid item price: an amount, negative for a returned item
+func Price(s string) bool {
+	return SignedAmountPattern.MatchString(s)
+}
+
+// Total reports whether s is a valid receipt total: an amount, negative for a return
+func Total(s string) bool {
+	return SignedAmountPattern.MatchString(s)
+}
+
+// UserID reports whether s is a valid user ID
+func UserID(s string) bool {
+	return UserIDPattern.MatchString(s)
+}
+
+// Quantity reports whether s is a valid item quantity: a positive number with up to 3 decimals, e.g. "2" or "0.750"
+func Quantity(s string) bool {
+	return QuantityPattern.MatchString(s) && strings.Trim(s, "0.") != ""
+}
+
+// UnitPrice reports whether s is a valid item unit price
+func UnitPrice(s string) bool {
+	return AmountPattern.MatchString(s)
+}
+
+// LineTotal reports whether quantity times unitPrice is within a cent of price, compared by amount
+// for a returned item's negative price. All three must already be valid; amounts too large to
+// multiply exactly are rejected.
+func LineTotal(quantity string, unitPrice string, price string) bool {
+	price = strings.TrimPrefix(price, "-")
+	// Work in thousandths of a unit and cents so the comparison is exact
+	whole, fraction, _ := strings.Cut(quantity, ".")
+	milliUnits, err := strconv.ParseInt(whole+(fraction + "000")[:3], 10, 64)
+	if err != nil {
+		return false
+	}
+	unitCents, ok := cents(unitPrice)
+	// Quantities stay below 10^9 thousandths, so this bound keeps the product from overflowing
+	if !ok || unitCents > math.MaxInt64/1000000000 {
+		return false
+	}
+	priceCents, ok := cents(price)
+	if !ok || priceCents > math.MaxInt64/1000 {
+		return false
+	}
+	difference := milliUnits*unitCents - priceCents*1000
+	return difference >= -1000 && difference <= 1000
+}
+
+// Amount reports whether s is a valid money amount such as a subtotal, tax or discount
+func Amount(s string) bool {
+	return AmountPattern.MatchString(s)
+}
+
+// Balances reports whether subtotal - discount + tax is within a cent of total. All four must
+// already be valid amounts; an empty discount or tax counts as zero.
+func Balances(subtotal string, discount string, tax string, total string) bool {
+	// Bound every amount so the sum can't overflow
+	var values [4]int64
+	for i, amount := range []string{subtotal, discount, tax, total} {
+		if amount == "" {
+			continue
+		}
+		value, ok := cents(amount)
+		if !ok || value > math.MaxInt64/4 {
+			return false
+		}
+		values[i] = value
+	}
+	difference := values[0] - values[1] + values[2] - values[3]
+	return difference >= -1 && difference <= 1
+}
+
+// cents parses a valid amount such as "12.50" as 1250, reporting false when it overflows
+func cents(amount string) (int64, bool) {
+	value, err := strconv.ParseInt(strings.Replace(amount, ".", "", 1), 10, 64)
+	return value, err == nil
+}
+
+// Category reports whether s is a valid item category: lowercase letters, digits and dashes
+func Category(s string) bool {
+	return CategoryPattern.MatchString(s)
+}
+
+// UPC reports whether s is a valid product barcode: 8 to 14 digits, covering EAN-8, UPC-A, EAN-13 and GTIN-14
+func UPC(s string) bool {
+	return UPCPattern.MatchString(s)
+}
+
+// Brand reports whether s is a valid brand name
+func Brand(s string) bool {
+	return BrandPattern.MatchString(s)
+}
+
+// PurchaseDate reports whether s is a valid YYYY-MM-DD date
+func PurchaseDate(s string) bool {
+	_, err := time.Parse(DateLayout, s)
+	return err == nil
+}
+
+// PurchaseTime reports whether s is a valid 24-hour HH:MM time
+func PurchaseTime(s string) bool {
+	_, err := time.Parse(TimeLayout, s)
+	return err == nil
+}
+
+// Metadata reports whether m fits the metadata limits and every key is a valid metadata key
+func Metadata(m map[string]string) bool {
+	if len(m) > MaxMetadataEntries {
+		return false
+	}
+	for key, value := range m {
+		if !MetadataKeyPattern.MatchString(key) || len(value) > MaxMetadataValueLength {
+			return false
+		}
+	}
+	return true
+}
+
+// Tag reports whether s is a valid receipt tag: letters, digits and the characters "-_.:"
+func Tag(s string) bool {
+	return TagPattern.MatchString(s)
+}
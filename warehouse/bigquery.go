@@ -0,0 +1,260 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"receipt-processor/gcpauth"
+	"receipt-processor/resilience"
+	"receipt-processor/store"
+)
+
+// bigQueryScope is the OAuth scope requested for managing the table and inserting rows
+const bigQueryScope = "https://www.googleapis.com/auth/bigquery"
+
+// Errors of the BigQuery API answers the sink handles
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("already exists")
+)
+
+// BigQueryOptions configures a BigQuery sink
+type BigQueryOptions struct {
+	// Project and Dataset hold the table, which is created on first use
+	Project string
+	Dataset string
+	// Table is DefaultTable by default
+	Table string
+	// CredentialsFile is a service account key file, GOOGLE_APPLICATION_CREDENTIALS by default;
+	// without one, tokens come from the metadata server of the instance the server runs on
+	CredentialsFile string
+	// Endpoint replaces https://bigquery.googleapis.com, e.g. for an emulator, which is called
+	// without credentials; BIGQUERY_EMULATOR_HOST by default
+	Endpoint string
+	// Policy guards the calls to the API
+	Policy resilience.Policy
+	// HTTPClient sends the requests, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// BigQuery streams rows into a BigQuery table with the streaming insert API. Each row's insert ID
+// is its event ID, so BigQuery drops most repeated deliveries of an event; the event_id column
+// identifies the rest.
+type BigQuery struct {
+	opts BigQueryOptions
+	// tokens authorizes requests; nil skips authentication, for emulators
+	tokens *gcpauth.TokenSource
+	calls  *resilience.Caller
+
+	// mu serializes the checks of the table's schema, which are made again after a failed insert
+	mu          sync.Mutex
+	schemaReady bool
+}
+
+func NewBigQuery(opts BigQueryOptions) (*BigQuery, error) {
+	if opts.Project == "" || opts.Dataset == "" {
+		return nil, fmt.Errorf("bigquery project and dataset are required")
+	}
+	if opts.Table == "" {
+		opts.Table = DefaultTable
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	b := &BigQuery{opts: opts, calls: resilience.New("warehouse", opts.Policy)}
+	if b.opts.Endpoint == "" {
+		if host := os.Getenv("BIGQUERY_EMULATOR_HOST"); host != "" {
+			b.opts.Endpoint = host
+			if !strings.Contains(host, "://") {
+				b.opts.Endpoint = "http://" + host
+			}
+		}
+	}
+	if b.opts.Endpoint != "" {
+		b.opts.Endpoint = strings.TrimSuffix(b.opts.Endpoint, "/")
+		return b, nil
+	}
+	b.opts.Endpoint = "https://bigquery.googleapis.com"
+	tokens, err := gcpauth.New(bigQueryScope, opts.CredentialsFile, opts.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	b.tokens = tokens
+	return b, nil
+}
+
+// Publish inserts a row for every event, creating the table or adding the fields it lacks first
+func (b *BigQuery) Publish(ctx context.Context, events []store.Event) error {
+	return publish(ctx, events, b.insert)
+}
+
+func (b *BigQuery) insert(ctx context.Context, rows []Row) error {
+	if err := b.prepareTable(ctx); err != nil {
+		return fmt.Errorf("preparing bigquery table %s: %w", b.opts.Table, err)
+	}
+
+	type insertRow struct {
+		InsertID string `json:"insertId"`
+		JSON     Row    `json:"json"`
+	}
+	request := struct {
+		Rows []insertRow `json:"rows"`
+	}{}
+	for _, row := range rows {
+		request.Rows = append(request.Rows, insertRow{InsertID: row["event_id"].(string), JSON: row})
+	}
+	var response struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	err := b.call(ctx, http.MethodPost, b.tablePath()+"/insertAll", request, &response)
+	if err == nil {
+		// Rows are inserted all or none, so the valid rows are reported as stopped by the invalid one
+		for _, rowErrors := range response.InsertErrors {
+			for _, rowError := range rowErrors.Errors {
+				if rowError.Reason != "stopped" && err == nil {
+					err = fmt.Errorf("bigquery rejected the row of event %s: %s: %s", rows[rowErrors.Index]["event_id"], rowError.Reason, rowError.Message)
+				}
+			}
+		}
+		if err == nil && len(response.InsertErrors) > 0 {
+			err = fmt.Errorf("bigquery rejected %d rows", len(response.InsertErrors))
+		}
+	}
+	if err != nil {
+		// The table may have been changed or dropped since it was checked
+		b.mu.Lock()
+		b.schemaReady = false
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// prepareTable creates the table, partitioned by day of event, or adds the fields of Schema it lacks
+func (b *BigQuery) prepareTable(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.schemaReady {
+		return nil
+	}
+
+	// The fields are kept as they are, with any descriptions or policy tags added in BigQuery
+	var table struct {
+		Schema struct {
+			Fields []json.RawMessage `json:"fields"`
+		} `json:"schema"`
+	}
+	err := b.call(ctx, http.MethodGet, b.tablePath(), nil, &table)
+	switch {
+	case errors.Is(err, errNotFound):
+		create := map[string]interface{}{
+			"tableReference":   map[string]string{"projectId": b.opts.Project, "datasetId": b.opts.Dataset, "tableId": b.opts.Table},
+			"schema":           map[string]interface{}{"fields": Schema},
+			"timePartitioning": map[string]string{"type": "DAY", "field": "event_time"},
+		}
+		err = b.call(ctx, http.MethodPost, b.datasetPath()+"/tables", create, nil)
+		if errors.Is(err, errConflict) {
+			// Another instance created it first; its schema is checked again after a failed insert
+			err = nil
+		} else if err == nil {
+			log.Printf("warehouse created bigquery table %s.%s.%s", b.opts.Project, b.opts.Dataset, b.opts.Table)
+		}
+	case err != nil:
+	default:
+		fields := []interface{}{}
+		names := []string{}
+		for _, field := range table.Schema.Fields {
+			var named struct {
+				Name string `json:"name"`
+			}
+			json.Unmarshal(field, &named)
+			fields = append(fields, field)
+			names = append(names, named.Name)
+		}
+		if missing := missingFields(names); len(missing) > 0 {
+			for _, field := range missing {
+				fields = append(fields, field)
+			}
+			patch := map[string]interface{}{"schema": map[string]interface{}{"fields": fields}}
+			if err = b.call(ctx, http.MethodPatch, b.tablePath(), patch, nil); err == nil {
+				log.Printf("warehouse added %d fields to bigquery table %s", len(missing), b.opts.Table)
+			}
+		}
+	}
+	b.schemaReady = err == nil
+	return err
+}
+
+func (b *BigQuery) datasetPath() string {
+	return "/bigquery/v2/projects/" + url.PathEscape(b.opts.Project) + "/datasets/" + url.PathEscape(b.opts.Dataset)
+}
+
+func (b *BigQuery) tablePath() string {
+	return b.datasetPath() + "/tables/" + url.PathEscape(b.opts.Table)
+}
+
+// call sends a JSON request to the API, retrying per the policy, and decodes the answer into out
+// when it isn't nil
+func (b *BigQuery) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = data
+	}
+	return b.calls.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, method, b.opts.Endpoint+path, bytes.NewReader(body))
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if b.tokens != nil {
+			token, err := b.tokens.Token()
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := b.opts.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return resilience.Permanent(errNotFound)
+		case resp.StatusCode == http.StatusConflict:
+			return resilience.Permanent(errConflict)
+		case resp.StatusCode/100 != 2:
+			detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			err := fmt.Errorf("bigquery %s %s answered %s: %s", method, path, resp.Status, bytes.TrimSpace(detail))
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				return err
+			}
+			return resilience.Permanent(err)
+		}
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+}
@@ -0,0 +1,73 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"receipt-processor/resilience"
+	"receipt-processor/store"
+)
+
+// EndpointOptions configures a sink posting to a batch endpoint
+type EndpointOptions struct {
+	// URL receives every batch as a JSON POST
+	URL string
+	// Table names the table the rows belong in, DefaultTable by default
+	Table string
+	// Policy guards the posts
+	Policy resilience.Policy
+	// HTTPClient sends the requests, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// Endpoint posts batches of rows to a service loading them into a warehouse, such as a JDBC bridge.
+// Every batch carries the table's name and Schema, so the service can create or extend the table
+// before inserting the rows; it should drop rows whose event_id it already has.
+type Endpoint struct {
+	opts  EndpointOptions
+	calls *resilience.Caller
+}
+
+func NewEndpoint(opts EndpointOptions) *Endpoint {
+	if opts.Table == "" {
+		opts.Table = DefaultTable
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Endpoint{opts: opts, calls: resilience.New("warehouse", opts.Policy)}
+}
+
+// Publish posts a row for every event in one batch
+func (e *Endpoint) Publish(ctx context.Context, events []store.Event) error {
+	return publish(ctx, events, e.post)
+}
+
+func (e *Endpoint) post(ctx context.Context, rows []Row) error {
+	data, err := json.Marshal(map[string]interface{}{"table": e.opts.Table, "schema": Schema, "rows": rows})
+	if err != nil {
+		return err
+	}
+	return e.calls.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL, bytes.NewReader(data))
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := e.opts.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 500:
+			return fmt.Errorf("warehouse endpoint answered %s", resp.Status)
+		case resp.StatusCode >= 300:
+			return resilience.Permanent(fmt.Errorf("warehouse endpoint answered %s", resp.Status))
+		}
+		return nil
+	})
+}
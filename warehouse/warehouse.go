@@ -0,0 +1,148 @@
+// Package warehouse loads the receipt events of the outbox into a data warehouse, BigQuery or any
+// service behind a batch endpoint, as rows of one table whose schema it keeps up to date.
+package warehouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"receipt-processor/metrics"
+	"receipt-processor/store"
+	"receipt-processor/validation"
+)
+
+var rowsLoaded = metrics.NewCounterVec("receipts_warehouse_rows_total", "Receipt event rows sent to the warehouse, by outcome.", "result")
+
+// DefaultTable is the table events are loaded into unless another is configured
+const DefaultTable = "receipt_events"
+
+// Field is a column of the table, in BigQuery's terms: a STRING, INTEGER, NUMERIC, BOOLEAN, DATE,
+// TIMESTAMP or RECORD that is NULLABLE, REQUIRED or REPEATED
+type Field struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Mode   string  `json:"mode"`
+	Fields []Field `json:"fields,omitempty"`
+}
+
+// Schema is the table's schema, one row per event. New fields are only ever appended, NULLABLE or
+// REPEATED, so the sinks can extend the tables earlier versions created.
+var Schema = []Field{
+	{Name: "event_id", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "event_type", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "event_time", Type: "TIMESTAMP", Mode: "REQUIRED"},
+	{Name: "receipt_id", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "created_at", Type: "TIMESTAMP", Mode: "NULLABLE"},
+	{Name: "status", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "flagged", Type: "BOOLEAN", Mode: "NULLABLE"},
+	{Name: "user_id", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "retailer", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "retailer_id", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "purchase_date", Type: "DATE", Mode: "NULLABLE"},
+	{Name: "purchase_time", Type: "STRING", Mode: "NULLABLE"},
+	{Name: "total", Type: "NUMERIC", Mode: "NULLABLE"},
+	{Name: "points", Type: "INTEGER", Mode: "NULLABLE"},
+	{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+	{Name: "items", Type: "RECORD", Mode: "REPEATED", Fields: []Field{
+		{Name: "description", Type: "STRING", Mode: "NULLABLE"},
+		{Name: "price", Type: "NUMERIC", Mode: "NULLABLE"},
+		{Name: "quantity", Type: "NUMERIC", Mode: "NULLABLE"},
+		{Name: "category", Type: "STRING", Mode: "NULLABLE"},
+		{Name: "brand", Type: "STRING", Mode: "NULLABLE"},
+		{Name: "upc", Type: "STRING", Mode: "NULLABLE"},
+	}},
+}
+
+// Row is an event as a row of the table, by field name
+type Row map[string]interface{}
+
+// NewRow flattens an event and the record it carries into a row
+func NewRow(event store.Event) (Row, error) {
+	var record store.Record
+	if err := json.Unmarshal(event.Payload, &record); err != nil {
+		return nil, fmt.Errorf("decoding event %s: %w", event.ID, err)
+	}
+	receipt := record.Receipt
+	row := Row{
+		"event_id":      event.ID,
+		"event_type":    event.Type,
+		"event_time":    event.CreatedAt.UTC(),
+		"receipt_id":    event.ReceiptID,
+		"created_at":    record.CreatedAt.UTC(),
+		"status":        record.Status,
+		"flagged":       record.Flagged,
+		"retailer":      receipt.Retailer,
+		"purchase_time": receipt.PurchaseTime,
+		"points":        record.Points,
+		"tags":          append([]string{}, record.Tags...),
+	}
+	optional := func(name, value string) {
+		if value != "" {
+			row[name] = value
+		}
+	}
+	optional("user_id", receipt.UserID)
+	optional("retailer_id", receipt.RetailerID)
+	optional("total", receipt.Total)
+	if validation.PurchaseDate(receipt.PurchaseDate) {
+		row["purchase_date"] = receipt.PurchaseDate
+	}
+	items := []Row{}
+	for _, item := range receipt.Items {
+		fields := Row{"description": item.ShortDescription}
+		for name, value := range map[string]string{"price": item.Price, "quantity": item.Quantity, "category": item.Category, "brand": item.Brand, "upc": item.UPC} {
+			if value != "" {
+				fields[name] = value
+			}
+		}
+		items = append(items, fields)
+	}
+	row["items"] = items
+	return row, nil
+}
+
+// newRows flattens a batch of events
+func newRows(events []store.Event) ([]Row, error) {
+	rows := make([]Row, 0, len(events))
+	for _, event := range events {
+		row, err := NewRow(event)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// missingFields returns the fields of the schema a table with the named fields doesn't have yet
+func missingFields(existing []string) []Field {
+	have := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		have[name] = true
+	}
+	var missing []Field
+	for _, field := range Schema {
+		if !have[field.Name] {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// publish is the part of Publish the sinks share: flattening the events and counting the outcome
+func publish(ctx context.Context, events []store.Event, load func(ctx context.Context, rows []Row) error) error {
+	if len(events) == 0 {
+		return nil
+	}
+	rows, err := newRows(events)
+	if err == nil {
+		err = load(ctx, rows)
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	rowsLoaded.With(result).Add(float64(len(events)))
+	return err
+}